@@ -25,6 +25,8 @@ package beater
 import (
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
 	"github.com/elastic/beats/filebeat/input/file"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
 )
 
 // AckEvents 用于处理libeat发送事件后的回调，确保事件至少发送一次
@@ -32,6 +34,8 @@ func AckEvents(data []interface{}) {
 
 	stateless := 0
 	states := make([]file.State, 0, len(data))
+	// 非文件类型的 state 由注册的回调处理，如消息队列的 ack
+	handled := map[string][]file.State{}
 	for _, datum := range data {
 		if datum == nil {
 			stateless++
@@ -44,12 +48,25 @@ func AckEvents(data []interface{}) {
 			continue
 		}
 
+		if _, ok = base.GetAckHandler(st.Type); ok {
+			handled[st.Type] = append(handled[st.Type], st)
+			continue
+		}
 		states = append(states, st)
 	}
 
 	if len(states) > 0 {
 		logp.L.Debugw("stateful ack", "count", len(states))
 		Registrar.Channel <- states
+		for _, observer := range base.GetAckObservers() {
+			observer(states)
+		}
+	}
+
+	for stateType, sts := range handled {
+		handler, _ := base.GetAckHandler(stateType)
+		logp.L.Debugw("handler ack", "type", stateType, "count", len(sts))
+		handler(sts)
 	}
 
 	if stateless > 0 {
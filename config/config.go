@@ -78,6 +78,11 @@ type Seccomp struct {
 type Registry struct {
 	FlushTimeout time.Duration `config:"flush"`
 	GcFrequency  time.Duration `config:"gc_frequency"`
+
+	// 采集进度快照，用于进度文件损坏时恢复
+	SnapshotPath     string        `config:"snapshot_path"`     // 快照目录，默认为数据目录下的 registrar_snapshots
+	SnapshotCount    int           `config:"snapshot_count"`    // 保留的快照数量，小于等于0时不开启
+	SnapshotInterval time.Duration `config:"snapshot_interval"` // 快照间隔
 }
 
 // Factory 默认配置
@@ -110,8 +115,10 @@ func Parse(cfg *beat.Config) (Config, error) {
 		MaxCpuLimit:   -1,
 		CpuCheckTimes: 10,
 		Registry: Registry{
-			FlushTimeout: 1 * time.Second,
-			GcFrequency:  1 * time.Minute,
+			FlushTimeout:     1 * time.Second,
+			GcFrequency:      1 * time.Minute,
+			SnapshotCount:    3,
+			SnapshotInterval: 5 * time.Minute,
 		},
 		Seccomp: Seccomp{
 			Enable: false,
@@ -0,0 +1,120 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package input
+
+import (
+	"fmt"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
+
+	cfg "github.com/TencentBlueKing/bkunifylogbeat/config"
+)
+
+const (
+	containerStreamAll    = "all"
+	containerStreamStdout = "stdout"
+	containerStreamStderr = "stderr"
+
+	containerFormatAuto   = "auto"
+	containerFormatDocker = "docker"
+	containerFormatCRI    = "cri"
+)
+
+// ContainerConfig 容器标准输出日志采集配置
+// auto 格式下逐行识别 docker json-file 与 CRI 格式，同一文件中混合两种格式的日志也能逐行正确解析；
+// 在多行合并、过滤之前将被切分的日志重新组合
+type ContainerConfig struct {
+	Stream          string `config:"stream"`            // 采集的输出流：all、stdout、stderr
+	Format          string `config:"format"`            // 日志格式：auto、docker、cri
+	PartialMaxBytes int    `config:"partial_max_bytes"` // 分片日志重组后的最大长度，超出部分会被截断
+}
+
+func initContainerConfig(rawConfig *beat.Config) (*beat.Config, error) {
+	containerConfig := ContainerConfig{
+		Stream: containerStreamAll,
+		Format: containerFormatAuto,
+	}
+	err := rawConfig.Unpack(&containerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing raw config => %v", err)
+	}
+
+	switch containerConfig.Stream {
+	case containerStreamAll, containerStreamStdout, containerStreamStderr:
+	default:
+		return nil, fmt.Errorf("container stream(%s) is not supported", containerConfig.Stream)
+	}
+	switch containerConfig.Format {
+	case containerFormatAuto, containerFormatDocker, containerFormatCRI:
+	default:
+		return nil, fmt.Errorf("container format(%s) is not supported", containerConfig.Format)
+	}
+
+	// 需要保留每行日志的 stream、log_time 字段，默认不开启批量模式
+	if !rawConfig.HasField("ludicrous_mode") {
+		err = rawConfig.SetBool("ludicrous_mode", -1, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = checkMultilineAuto(rawConfig, "container")
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err = initLogConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	overrideConfig := beat.MapStr{
+		// 由 log input 完成采集，docker-json reader 负责格式识别以及分片重组
+		// docker json-file 没有 CRI 分片标记，指定 docker 格式时不解析该标记
+		"type": "log",
+		"docker-json": beat.MapStr{
+			"stream":         containerConfig.Stream,
+			"partial":        true,
+			"cri_flags":      containerConfig.Format != containerFormatDocker,
+			"force_cri_logs": containerConfig.Format == containerFormatCRI,
+		},
+		// 与旧的容器标准输出解析互斥，避免重复解析
+		"is_container_std":     false,
+		"is_cri_container_std": false,
+	}
+	if containerConfig.PartialMaxBytes > 0 {
+		overrideConfig["max_bytes"] = containerConfig.PartialMaxBytes
+	}
+
+	err = rawConfig.Merge(overrideConfig)
+	if err != nil {
+		return nil, err
+	}
+	return rawConfig, nil
+}
+
+func init() {
+	err := cfg.Register("container", initContainerConfig)
+	if err != nil {
+		panic(err)
+	}
+}
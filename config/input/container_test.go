@@ -0,0 +1,176 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package input
+
+import (
+	"io"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/reader"
+	"github.com/elastic/beats/libbeat/reader/readjson"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试容器标准输出采集配置
+func TestContainerConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":            "999990001",
+		"type":              "container",
+		"paths":             []string{"/var/log/containers/*.log"},
+		"stream":            "stderr",
+		"partial_max_bytes": 1048576,
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	taskConfig := map[string]interface{}{}
+	err = config.RawConfig.Unpack(taskConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "log", taskConfig["type"])
+	assert.Equal(t, false, taskConfig["ludicrous_mode"])
+	assert.EqualValues(t, 1048576, taskConfig["max_bytes"])
+	assert.Equal(t, false, taskConfig["is_container_std"])
+
+	dockerJSON := taskConfig["docker-json"].(map[string]interface{})
+	assert.Equal(t, "stderr", dockerJSON["stream"])
+	assert.Equal(t, true, dockerJSON["partial"])
+	assert.Equal(t, true, dockerJSON["cri_flags"])
+	assert.Equal(t, false, dockerJSON["force_cri_logs"])
+
+	// 指定 CRI 格式
+	vars["format"] = "cri"
+	config, err = mockTaskConfig(vars)
+	assert.Nil(t, err)
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, true, taskConfig["docker-json"].(map[string]interface{})["force_cri_logs"])
+
+	// 指定 docker 格式
+	vars["format"] = "docker"
+	config, err = mockTaskConfig(vars)
+	assert.Nil(t, err)
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	dockerJSON = taskConfig["docker-json"].(map[string]interface{})
+	assert.Equal(t, false, dockerJSON["force_cri_logs"])
+	assert.Equal(t, false, dockerJSON["cri_flags"])
+
+	// 不支持的 format
+	vars["format"] = "json"
+	_, err = mockTaskConfig(vars)
+	assert.NotNil(t, err)
+
+	// 不支持的 stream
+	vars["format"] = "auto"
+	vars["stream"] = "stdin"
+	_, err = mockTaskConfig(vars)
+	assert.NotNil(t, err)
+}
+
+// mockLineReader 逐行返回文件内容
+type mockLineReader struct {
+	lines []string
+}
+
+func (r *mockLineReader) Next() (reader.Message, error) {
+	if len(r.lines) == 0 {
+		return reader.Message{}, io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return reader.Message{Content: []byte(line), Bytes: len(line)}, nil
+}
+
+// 测试按容器采集配置生成的 docker-json reader 能够重组被切分的日志
+func TestContainerPartialReassembly(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid": "999990001",
+		"type":   "container",
+		"paths":  []string{"/var/log/containers/*.log"},
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.Nil(t, err) {
+		return
+	}
+	taskConfig := map[string]interface{}{}
+	assert.Nil(t, config.RawConfig.Unpack(taskConfig))
+	dockerJSON := taskConfig["docker-json"].(map[string]interface{})
+
+	newReader := func(lines ...string) *readjson.DockerJSONReader {
+		return readjson.New(&mockLineReader{lines: lines},
+			dockerJSON["stream"].(string), dockerJSON["partial"].(bool),
+			dockerJSON["force_cri_logs"].(bool), dockerJSON["cri_flags"].(bool))
+	}
+
+	// docker json-file：不以换行结尾的 log 为分片
+	r := newReader(
+		`{"log":"hello ","stream":"stdout","time":"2021-06-01T12:00:00.000000001Z"}`+"\n",
+		`{"log":"docker ","stream":"stdout","time":"2021-06-01T12:00:00.000000002Z"}`+"\n",
+		`{"log":"world\n","stream":"stdout","time":"2021-06-01T12:00:00.000000003Z"}`+"\n",
+		`{"log":"next\n","stream":"stderr","time":"2021-06-01T12:00:01Z"}`+"\n",
+	)
+	message, err := r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello docker world\n", string(message.Content))
+	stream, _ := message.Fields.GetValue("stream")
+	assert.Equal(t, "stdout", stream)
+
+	message, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "next\n", string(message.Content))
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// CRI：P 标记为分片，F 标记为最后一片
+	r = newReader(
+		"2021-06-01T12:00:00.000000001Z stdout P hello \n",
+		"2021-06-01T12:00:00.000000002Z stdout P cri \n",
+		"2021-06-01T12:00:00.000000003Z stdout F world\n",
+		"2021-06-01T12:00:01Z stderr F next\n",
+	)
+	message, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "hello cri world\n", string(message.Content))
+
+	message, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "next\n", string(message.Content))
+	stream, _ = message.Fields.GetValue("stream")
+	assert.Equal(t, "stderr", stream)
+
+	// auto 格式下同一文件中混合两种格式时逐行解析
+	r = newReader(
+		`{"log":"docker\n","stream":"stdout","time":"2021-06-01T12:00:00Z"}`+"\n",
+		"2021-06-01T12:00:01Z stderr F cri\n",
+	)
+	message, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "docker\n", string(message.Content))
+
+	message, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "cri\n", string(message.Content))
+}
@@ -42,87 +42,163 @@ type LogConfig struct {
 	CleanInactive time.Duration `config:"clean_inactive" validate:"min=0"`
 }
 
-func init() {
-	config := beat.MapStr{
-		"enabled":         true,
-		"scan_frequency":  10 * time.Second,
-		"harvester_limit": 1000,
-		"exclude_files":   []string{".gz$", ".bz2$", ".tgz$", ".tbz$", ".zip$", ".7z$", ".bak$", ".backup$", ".swp$"},
+// logDefaultConfig 日志采集默认配置
+var logDefaultConfig = beat.MapStr{
+	"enabled":         true,
+	"scan_frequency":  10 * time.Second,
+	"harvester_limit": 1000,
+	"exclude_files":   []string{".gz$", ".bz2$", ".tgz$", ".tbz$", ".zip$", ".7z$", ".bak$", ".backup$", ".swp$"},
 
-		// close
-		"close_inactive": 2 * time.Minute,
+	// close
+	"close_inactive": 2 * time.Minute,
 
-		// clean: 如果文件删除，则清除registry文件
-		"clean_removed": true,
+	// clean: 如果文件删除，则清除registry文件
+	"clean_removed": true,
 
-		// 监听文件变更时间
-		"ignore_older": 7 * 24 * time.Hour,
+	// 监听文件变更时间
+	"ignore_older": 7 * 24 * time.Hour,
 
-		// harvester
-		"tail_files": true,
-		"encoding":   "utf-8",
-		"symlinks":   true,
+	// harvester
+	"tail_files": true,
+	"encoding":   "utf-8",
+	"symlinks":   true,
 
-		// 不再限制单行大小
-		"max_bytes": 1 * humanize.MiByte,
+	// 不再限制单行大小
+	"max_bytes": 1 * humanize.MiByte,
 
-		// 打开后，采集速率直接起飞
-		"ludicrous_mode": true,
+	// 打开后，采集速率直接起飞
+	"ludicrous_mode": true,
 
-		// 采集状态的唯一标识符
-		"file_identifier": "inode",
-	}
-	err := cfg.Register("log", func(rawConfig *beat.Config) (*beat.Config, error) {
-		var err error
-		defaultConfig := beat.MapStr{}
-
-		fields := rawConfig.GetFields()
-		for key, value := range config {
-			isExists := false
-			for _, field := range fields {
-				if key == field {
-					isExists = true
-					break
-				}
-			}
-			if !isExists {
-				defaultConfig[string(key)] = value
+	// 采集状态的唯一标识符
+	"file_identifier": "inode",
+}
+
+// initLogConfig 补充日志采集的默认配置，并对不合理的配置进行修正
+func initLogConfig(rawConfig *beat.Config) (*beat.Config, error) {
+	var err error
+	defaultConfig := beat.MapStr{}
+
+	fields := rawConfig.GetFields()
+	for key, value := range logDefaultConfig {
+		isExists := false
+		for _, field := range fields {
+			if key == field {
+				isExists = true
+				break
 			}
 		}
-
-		// 特殊配置处理
-		logConfig := &LogConfig{
-			CloseInactive: 5 * time.Minute,
-			IgnoreOlder:   24 * time.Hour,
+		if !isExists {
+			defaultConfig[string(key)] = value
 		}
-		err = rawConfig.Unpack(&logConfig)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing raw config => %v", err)
+	}
+
+	// 特殊配置处理
+	logConfig := &LogConfig{
+		CloseInactive: 5 * time.Minute,
+		IgnoreOlder:   24 * time.Hour,
+	}
+	err = rawConfig.Unpack(&logConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing raw config => %v", err)
+	}
+
+	// FD释放（close_inactive）配置不能超过5分钟
+	if logConfig.CloseInactive > 5*time.Minute {
+		defaultConfig["close_inactive"] = 5 * time.Minute
+	}
+
+	if logConfig.CleanInactive > 0 {
+		// 2. 如果配置了CleanInactive，那么必须大于 IgnoreOlder + ScanFrequency
+		if logConfig.CleanInactive < logConfig.IgnoreOlder+logConfig.ScanFrequency {
+			defaultConfig["clean_inactive"] = logConfig.IgnoreOlder + logConfig.ScanFrequency + 1*time.Hour
 		}
+	} else {
+		// 如果没有配置CleanInactive，那么给一个默认值，半年
+		// 对于长时间未写的文件，采集进度保留半年，半年后如果再次写入会出现将整个文件重新读取现象。
+		// 可适当调大，但是更建议对业务日志本身做处理，增加轮转机制，而不是一直写同一个日志文件
+		defaultConfig["clean_inactive"] = logConfig.IgnoreOlder + logConfig.ScanFrequency + 180*24*time.Hour
+	}
+
+	err = rawConfig.Merge(defaultConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多行合并的预设规则
+	return initMultilineConfig(rawConfig)
+}
 
-		// FD释放（close_inactive）配置不能超过5分钟
-		if logConfig.CloseInactive > 5*time.Minute {
-			defaultConfig["close_inactive"] = 5 * time.Minute
+// initLogTaskConfig log 类型任务的配置初始化
+// 配置了文件保护、encoding: auto、multiline.auto 或 harvester_scheduling 时由按文件管理的日志采集组合完成，
+// backfill 模式下由回填采集读取存量文件，读取时同样可以组合上述功能
+func initLogTaskConfig(rawConfig *beat.Config) (*beat.Config, error) {
+	rawConfig, err := initLogConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, _ := rawConfig.String("mode", -1)
+	encoding, _ := rawConfig.String("encoding", -1)
+	scheduling, _ := rawConfig.String("harvester_scheduling", -1)
+	if scheduling != "" {
+		limit, _ := rawConfig.Int("harvester_limit", -1)
+		if limit <= 0 {
+			return nil, fmt.Errorf("harvester_scheduling(%s) requires harvester_limit to be greater than 0", scheduling)
 		}
+	}
+	fileInput := "log"
+	if isFileGuardEnabled(rawConfig) || encoding == cfg.EncodingAuto || scheduling != "" || isMultilineAuto(rawConfig) {
+		fileInput = "managed_log"
+	}
 
-		if logConfig.CleanInactive > 0 {
-			// 2. 如果配置了CleanInactive，那么必须大于 IgnoreOlder + ScanFrequency
-			if logConfig.CleanInactive < logConfig.IgnoreOlder+logConfig.ScanFrequency {
-				defaultConfig["clean_inactive"] = logConfig.IgnoreOlder + logConfig.ScanFrequency + 1*time.Hour
+	if mode != cfg.TaskModeBackfill {
+		if fileInput != "log" {
+			err = rawConfig.SetString("type", -1, fileInput)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			// 如果没有配置CleanInactive，那么给一个默认值，半年
-			// 对于长时间未写的文件，采集进度保留半年，半年后如果再次写入会出现将整个文件重新读取现象。
-			// 可适当调大，但是更建议对业务日志本身做处理，增加轮转机制，而不是一直写同一个日志文件
-			defaultConfig["clean_inactive"] = logConfig.IgnoreOlder + logConfig.ScanFrequency + 180*24*time.Hour
 		}
+		return initStartPosition(rawConfig)
+	}
+	// 从头读取到文件末尾，不再持续采集，也不忽略较早的文件
+	err = rawConfig.Merge(beat.MapStr{
+		"type":           "backfill",
+		"file_input":     fileInput,
+		"tail_files":     false,
+		"close_eof":      true,
+		"ignore_older":   0,
+		"clean_inactive": 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rawConfig, nil
+}
 
-		err = rawConfig.Merge(defaultConfig)
-		if err != nil {
-			return nil, err
-		}
+// isFileGuardEnabled 是否配置了文件大小、单次扫描读取量或二进制文件的限制
+func isFileGuardEnabled(rawConfig *beat.Config) bool {
+	maxFileSize, _ := rawConfig.Int("max_file_size", -1)
+	maxReadBytes, _ := rawConfig.Int("max_read_bytes_per_file_per_scan", -1)
+	skipBinary, _ := rawConfig.Bool("skip_binary_files", -1)
+	return maxFileSize > 0 || maxReadBytes > 0 || skipBinary
+}
+
+// initStartPosition 配置了 start_position 时，启动时已存在的文件由任务按配置确定起始位置，
+// 之后出现的文件均从头读取，因此不再使用 tail_files
+func initStartPosition(rawConfig *beat.Config) (*beat.Config, error) {
+	position, _ := rawConfig.String("start_position", -1)
+	if position == "" {
 		return rawConfig, nil
-	})
+	}
+	err := rawConfig.SetBool("tail_files", -1, false)
+	if err != nil {
+		return nil, err
+	}
+	return rawConfig, nil
+}
+
+func init() {
+	err := cfg.Register("log", initLogTaskConfig)
 	if err != nil {
 		panic(err)
 	}
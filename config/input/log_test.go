@@ -142,3 +142,143 @@ func TestNewTaskConfig(t *testing.T) {
 	assert.Equal(t, "744h0m0s", taskConfig["ignore_older"].(string))
 	assert.Equal(t, "745h0m0s", taskConfig["clean_inactive"].(string))
 }
+
+// 测试回填模式配置
+func TestBackfillTaskConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid": "999990001",
+		"paths":  []string{"/var/log/*.log"},
+		"mode":   "backfill",
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, config.IsBackfill())
+	assert.Equal(t, cfg.StateIsolationTask, config.StateIsolation)
+
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "backfill", taskConfig["type"])
+	assert.Equal(t, false, taskConfig["tail_files"].(bool))
+	assert.Equal(t, true, taskConfig["close_eof"].(bool))
+
+	vars["mode"] = "unknown"
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+}
+
+// 测试自动识别编码配置
+func TestAutoEncodingTaskConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":   "999990001",
+		"paths":    []string{"/var/log/*.log"},
+		"encoding": "auto",
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, config.IsAutoEncoding())
+
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "managed_log", taskConfig["type"])
+
+	// 回填模式下由按文件管理的日志采集读取
+	vars["mode"] = "backfill"
+	config, err = mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "backfill", taskConfig["type"])
+	assert.Equal(t, "managed_log", taskConfig["file_input"])
+}
+
+func TestHarvesterSchedulingTaskConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":               "999990001",
+		"paths":                []string{"/var/log/*.log"},
+		"harvester_scheduling": "newest",
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "managed_log", taskConfig["type"])
+
+	// 不限制 harvester 数量时无法调度
+	vars["harvester_limit"] = 0
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+}
+
+func TestStartPositionTaskConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":         "999990001",
+		"paths":          []string{"/var/log/*.log"},
+		"start_position": "since:1h",
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "since:1h", config.StartPosition)
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, false, taskConfig["tail_files"].(bool))
+
+	vars["start_position"] = "unknown"
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+
+	// 回填模式固定从头读取
+	vars["start_position"] = "end"
+	vars["mode"] = "backfill"
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+}
+
+func TestFileGuardTaskConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":        "999990001",
+		"paths":         []string{"/var/log/*.log"},
+		"max_file_size": 1024,
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "managed_log", taskConfig["type"])
+
+	// 文件保护、调度以及自动识别编码可以同时开启
+	vars["harvester_scheduling"] = "lag"
+	vars["skip_binary_files"] = true
+	vars["encoding"] = "auto"
+	config, err = mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "managed_log", taskConfig["type"])
+
+	// 未开启任何功能时使用原生的日志采集
+	delete(vars, "harvester_scheduling")
+	delete(vars, "skip_binary_files")
+	delete(vars, "encoding")
+	delete(vars, "max_file_size")
+	config, err = mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.NotEqual(t, "managed_log", taskConfig["type"])
+}
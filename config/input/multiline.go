@@ -0,0 +1,235 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package input
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
+)
+
+const (
+	multilinePresetJava   = "java"
+	multilinePresetPython = "python"
+	multilinePresetGo     = "go"
+	multilinePresetDotnet = "dotnet"
+	multilinePresetNodejs = "nodejs"
+
+	// DefaultMultilineSampleLines 自动识别时默认读取每个文件的前 N 行
+	DefaultMultilineSampleLines = 200
+	// 单行最大长度，超出的行不参与识别
+	maxMultilineSampleLineBytes = 64 * 1024
+)
+
+// MultilinePreset 常见异常堆栈的多行合并规则
+type MultilinePreset struct {
+	Pattern string // 续行的匹配规则，匹配的行追加到上一行
+	Negate  bool
+	Match   string
+
+	signatures []*regexp.Regexp // 自动识别时用于判断日志格式的特征行
+}
+
+// multilinePresetOrder 自动识别时得分相同的情况下，按该顺序优先选择
+var multilinePresetOrder = []string{
+	multilinePresetJava,
+	multilinePresetPython,
+	multilinePresetGo,
+	multilinePresetDotnet,
+	multilinePresetNodejs,
+}
+
+var multilinePresets = map[string]MultilinePreset{
+	// 堆栈、Caused by 异常链、Suppressed 以及 "... 12 more" 均追加到异常信息所在的行
+	multilinePresetJava: {
+		Pattern: `^[[:space:]]+(at|\.{3})[[:space:]]+\b|^[[:space:]]*(Caused by|Suppressed):`,
+		Negate:  false,
+		Match:   "after",
+		signatures: []*regexp.Regexp{
+			regexp.MustCompile(`^[[:space:]]+at [\w$.<>/]+\(([\w$]+\.(java|kt|scala|groovy):\d+|Native Method|Unknown Source)\)`),
+			regexp.MustCompile(`^[[:space:]]*Caused by: [\w$.]+`),
+		},
+	},
+	// Traceback 及其后的缩进行、异常链的说明行追加到上一行，以 "XxxError: 说明" 形式的异常所在的行结束
+	// 空行不作为续行，异常链之间的空行会开始新的一条日志
+	multilinePresetPython: {
+		Pattern: `^Traceback \(most recent call last\):|^[[:space:]]+|^(During handling of the above exception|The above exception was the direct cause)|^[A-Za-z_][\w.]*(Error|Exception|Exit|Interrupt|Warning|Iteration)(: |$)`,
+		Negate:  false,
+		Match:   "after",
+		signatures: []*regexp.Regexp{
+			regexp.MustCompile(`^Traceback \(most recent call last\):`),
+			regexp.MustCompile(`^  File ".+", line \d+`),
+		},
+	},
+	// panic 之后的 goroutine 信息、函数调用及文件位置追加到上一行，函数调用需要包含包名且参数为地址
+	// 空行不作为续行，panic 信息之后的空行会开始新的一条日志
+	multilinePresetGo: {
+		Pattern: `^[[:space:]]|^goroutine \d+ \[|^created by |^\[signal |^([\w.-]+/)*[\w-]+(\.\(\*?\w+(\[[^\]]*\])?\)|\.[\w-]+)+(\[[^\]]*\])?\([0-9a-fx{}., ]*\)$|^exit status \d+`,
+		Negate:  false,
+		Match:   "after",
+		signatures: []*regexp.Regexp{
+			regexp.MustCompile(`^(panic|fatal error): `),
+			regexp.MustCompile(`^goroutine \d+ \[.+\]:$`),
+		},
+	},
+	// 堆栈、内部异常以及堆栈分隔行追加到异常信息所在的行
+	multilinePresetDotnet: {
+		Pattern: `^[[:space:]]+(at|--->)[[:space:]]|^[[:space:]]*--- End of`,
+		Negate:  false,
+		Match:   "after",
+		signatures: []*regexp.Regexp{
+			regexp.MustCompile(`^[[:space:]]+at .+ in .+:line \d+`),
+			regexp.MustCompile(`^[[:space:]]*--- End of (inner exception )?stack trace`),
+		},
+	},
+	// 堆栈以及 "... 2 lines matching cause stack trace ..." 追加到异常信息所在的行
+	multilinePresetNodejs: {
+		Pattern: `^[[:space:]]+(at|\.{3})[[:space:]]|^[[:space:]]*\[cause\]`,
+		Negate:  false,
+		Match:   "after",
+		signatures: []*regexp.Regexp{
+			regexp.MustCompile(`^[[:space:]]+at (async )?.*\(?(node:[\w/]+|.+\.(js|mjs|cjs|ts)):\d+:\d+\)?$`),
+		},
+	},
+}
+
+// MultilineConfig 多行合并配置中用于展开预设规则的部分
+type MultilineConfig struct {
+	Pattern     *string `config:"pattern"`
+	Preset      string  `config:"preset"`       // 预设规则：java、python、go、dotnet、nodejs
+	Auto        bool    `config:"auto"`         // 根据每个文件的前 N 行自动选择预设规则
+	SampleLines int     `config:"sample_lines"` // 自动识别时读取的行数
+}
+
+// IsAuto 是否需要按文件自动选择预设规则
+func (c *MultilineConfig) IsAuto() bool {
+	return c.Auto && c.Pattern == nil && c.Preset == ""
+}
+
+// unpackMultilineConfig 获取多行合并配置，未配置时返回 nil
+func unpackMultilineConfig(rawConfig *beat.Config) (*MultilineConfig, error) {
+	if !rawConfig.HasField("multiline") {
+		return nil, nil
+	}
+	child, err := rawConfig.Child("multiline", -1)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing multiline config => %v", err)
+	}
+	config := &MultilineConfig{SampleLines: DefaultMultilineSampleLines}
+	err = child.Unpack(config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing multiline config => %v", err)
+	}
+	if config.Preset != "" {
+		if _, ok := multilinePresets[config.Preset]; !ok {
+			return nil, fmt.Errorf("multiline.preset(%s) is not supported", config.Preset)
+		}
+	}
+	return config, nil
+}
+
+// isMultilineAuto 是否配置了 multiline.auto，由按文件管理的日志采集在采集前识别每个文件
+func isMultilineAuto(rawConfig *beat.Config) bool {
+	config, err := unpackMultilineConfig(rawConfig)
+	return err == nil && config != nil && config.IsAuto()
+}
+
+// checkMultilineAuto multiline.auto 需要在采集前识别每个文件，仅 log 类型的任务支持
+func checkMultilineAuto(rawConfig *beat.Config, taskType string) error {
+	if isMultilineAuto(rawConfig) {
+		return fmt.Errorf("multiline.auto is not supported by %s, use multiline.preset instead", taskType)
+	}
+	return nil
+}
+
+// initMultilineConfig 将 multiline.preset 展开为 pattern、negate、match
+// 已经配置了 multiline.pattern 或配置了 multiline.auto 时保持原有配置不变
+func initMultilineConfig(rawConfig *beat.Config) (*beat.Config, error) {
+	config, err := unpackMultilineConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Pattern != nil || config.Preset == "" {
+		return rawConfig, nil
+	}
+	err = rawConfig.Merge(beat.MapStr{
+		"multiline": MultilinePresetConfig(config.Preset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rawConfig, nil
+}
+
+// MultilinePresetConfig 预设规则对应的 multiline 配置，规则不存在时返回 nil
+func MultilinePresetConfig(name string) beat.MapStr {
+	preset, ok := multilinePresets[name]
+	if !ok {
+		return nil
+	}
+	return beat.MapStr{
+		"pattern": preset.Pattern,
+		"negate":  preset.Negate,
+		"match":   preset.Match,
+	}
+}
+
+// DetectMultilinePreset 读取文件的前 N 行，返回特征行最多的预设规则以及读取的行数，没有匹配时返回空
+func DetectMultilinePreset(path string, sampleLines int) (string, int, error) {
+	if sampleLines <= 0 {
+		sampleLines = DefaultMultilineSampleLines
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	scores := make(map[string]int, len(multilinePresets))
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), maxMultilineSampleLineBytes)
+	for lines < sampleLines && scanner.Scan() {
+		lines++
+		line := scanner.Text()
+		for name, preset := range multilinePresets {
+			for _, signature := range preset.signatures {
+				if signature.MatchString(line) {
+					scores[name]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore := "", 0
+	for _, name := range multilinePresetOrder {
+		if scores[name] > bestScore {
+			best, bestScore = name, scores[name]
+		}
+	}
+	return best, lines, nil
+}
@@ -0,0 +1,226 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package input
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// groupLines 按 negate: false、match: after 的规则合并多行
+func groupLines(pattern string, lines []string) []string {
+	re := regexp.MustCompile(pattern)
+	var events []string
+	for _, line := range lines {
+		if len(events) > 0 && re.MatchString(line) {
+			events[len(events)-1] += "\n" + line
+			continue
+		}
+		events = append(events, line)
+	}
+	return events
+}
+
+var multilineSamples = map[string][]string{
+	multilinePresetJava: {
+		"2021-01-01 00:00:00 ERROR request failed",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Service.handle(Service.java:42)",
+		"\tat com.example.Main.main(Main.java:10)",
+		"Caused by: java.io.IOException: closed",
+		"\tat com.example.Client.read(Client.java:7)",
+		"\t... 2 more",
+		"2021-01-01 00:00:01 INFO next",
+	},
+	multilinePresetPython: {
+		"2021-01-01 00:00:00 ERROR request failed",
+		"Traceback (most recent call last):",
+		"  File \"/app/main.py\", line 10, in <module>",
+		"    main()",
+		"  File \"/app/main.py\", line 6, in main",
+		"    raise ValueError(\"boom\")",
+		"ValueError: boom",
+		"2021-01-01 00:00:01 INFO next",
+	},
+	multilinePresetGo: {
+		"panic: runtime error: index out of range [3] with length 3",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/app/main.go:8 +0x1d",
+		"exit status 2",
+		"2021/01/01 00:00:01 next",
+	},
+	multilinePresetDotnet: {
+		"System.InvalidOperationException: boom",
+		" ---> System.IO.IOException: closed",
+		"   at Example.Client.Read() in /app/Client.cs:line 7",
+		"   --- End of inner exception stack trace ---",
+		"   at Example.Service.Handle() in /app/Service.cs:line 42",
+		"2021-01-01 00:00:01 INFO next",
+	},
+	multilinePresetNodejs: {
+		"Error: boom",
+		"    at handle (/app/service.js:42:11)",
+		"    at async main (/app/main.mjs:10:3)",
+		"    at node:internal/main/run_main_module:17:47",
+		"2021-01-01T00:00:01Z info next",
+	},
+}
+
+func TestMultilinePresets(t *testing.T) {
+	expected := map[string]int{
+		multilinePresetJava:   3,
+		multilinePresetPython: 2,
+		multilinePresetGo:     3,
+		multilinePresetDotnet: 2,
+		multilinePresetNodejs: 2,
+	}
+	for _, name := range multilinePresetOrder {
+		preset := multilinePresets[name]
+		assert.False(t, preset.Negate, name)
+		assert.Equal(t, "after", preset.Match, name)
+
+		events := groupLines(preset.Pattern, multilineSamples[name])
+		assert.Equal(t, expected[name], len(events), "%s: %q", name, events)
+		// 最后一行为新的日志
+		assert.Equal(t, multilineSamples[name][len(multilineSamples[name])-1], events[len(events)-1], name)
+	}
+
+	// python 异常链以异常所在的行结束
+	events := groupLines(multilinePresets[multilinePresetPython].Pattern, multilineSamples[multilinePresetPython])
+	assert.True(t, strings.HasSuffix(events[0], "ValueError: boom"), events[0])
+
+	// go 堆栈从 goroutine 开始合并到退出码
+	events = groupLines(multilinePresets[multilinePresetGo].Pattern, multilineSamples[multilinePresetGo])
+	assert.True(t, strings.HasSuffix(events[1], "exit status 2"), events[1])
+}
+
+func TestMultilinePresetsPlainLines(t *testing.T) {
+	plain := []string{
+		"2021-01-01 00:00:00 INFO started",
+		"",
+		"connect(fd=3)",
+		"handler.ServeHTTP(req)",
+		"ConnectionError retrying",
+		"TimeoutError while connecting",
+		"ErrorReporter started",
+	}
+	for _, name := range multilinePresetOrder {
+		events := groupLines(multilinePresets[name].Pattern, plain)
+		assert.Equal(t, len(plain), len(events), "%s: %q", name, events)
+	}
+
+	// go 函数调用需要包含包名且参数为地址
+	pattern := regexp.MustCompile(multilinePresets[multilinePresetGo].Pattern)
+	assert.True(t, pattern.MatchString("github.com/example/app/pkg.(*Server).Serve(0xc000010000, {0x4b2f40, 0xc00001c030})"))
+	assert.True(t, pattern.MatchString("main.main()"))
+	assert.True(t, pattern.MatchString("main.(*T).Method-fm(...)"))
+}
+
+func TestDetectMultilinePreset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range multilinePresetOrder {
+		path := filepath.Join(dir, name+".log")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Join(multilineSamples[name], "\n")), 0644))
+		preset, lines, err := DetectMultilinePreset(path, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, name, preset, name)
+		assert.Equal(t, len(multilineSamples[name]), lines, name)
+	}
+
+	plain := filepath.Join(dir, "plain.txt")
+	assert.NoError(t, ioutil.WriteFile(plain, []byte("a\nb\nc\n"), 0644))
+	preset, lines, err := DetectMultilinePreset(plain, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "", preset)
+	assert.Equal(t, 3, lines)
+
+	_, _, err = DetectMultilinePreset(filepath.Join(dir, "missing.log"), 0)
+	assert.Error(t, err)
+
+	// 仅读取前 N 行
+	preset, lines, err = DetectMultilinePreset(filepath.Join(dir, multilinePresetJava+".log"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "", preset)
+	assert.Equal(t, 2, lines)
+}
+
+func TestMultilinePresetConfig(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":           "999990001",
+		"paths":            []string{"/var/log/*.log"},
+		"multiline.preset": "java",
+	}
+	config, err := mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig := map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	multiline := taskConfig["multiline"].(map[string]interface{})
+	assert.Equal(t, multilinePresets[multilinePresetJava].Pattern, multiline["pattern"])
+	assert.Equal(t, "after", multiline["match"])
+
+	// 已配置 pattern 时保持不变
+	vars["multiline.pattern"] = "^\\["
+	config, err = mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "^\\[", taskConfig["multiline"].(map[string]interface{})["pattern"])
+
+	vars["multiline.preset"] = "ruby"
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+
+	// 自动识别时保持配置不变，由按文件管理的日志采集在采集前识别每个文件
+	delete(vars, "multiline.preset")
+	delete(vars, "multiline.pattern")
+	vars["multiline.auto"] = true
+	config, err = mockTaskConfig(vars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	taskConfig = map[string]interface{}{}
+	config.RawConfig.Unpack(taskConfig)
+	assert.Equal(t, "managed_log", taskConfig["type"])
+	assert.Equal(t, true, taskConfig["multiline"].(map[string]interface{})["auto"])
+	assert.Nil(t, taskConfig["multiline"].(map[string]interface{})["pattern"])
+
+	// 容器日志不支持自动识别
+	vars["type"] = "container"
+	_, err = mockTaskConfig(vars)
+	assert.Error(t, err)
+}
@@ -35,4 +35,12 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+
+	// 通过消费组读取 Redis Stream，见 task/input/redisstream
+	err = cfg.Register("redis_stream", func(rawConfig *beat.Config) (*beat.Config, error) {
+		return rawConfig, nil
+	})
+	if err != nil {
+		panic(err)
+	}
 }
@@ -51,4 +51,21 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+
+	// 离线解析导出的 EVTX 文件，见 task/input/evtx
+	err = cfg.Register("evtx", func(rawConfig *beat.Config) (*beat.Config, error) {
+		if !rawConfig.HasField("scan_frequency") {
+			defaultConfig := beat.MapStr{}
+			defaultConfig["scan_frequency"] = 1 * time.Minute
+			err := rawConfig.Merge(defaultConfig)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return rawConfig, nil
+	})
+	if err != nil {
+		panic(err)
+	}
 }
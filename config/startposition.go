@@ -0,0 +1,83 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 没有采集进度的文件的起始位置
+const (
+	StartPositionBeginning = "beginning"  // 从头读取
+	StartPositionEnd       = "end"        // 从末尾读取
+	StartPositionSince     = "since"      // 从时间不早于指定时间的第一行开始，如 since:1h 或 since:2021-03-04T00:00:00+08:00
+	StartPositionLastLines = "last_lines" // 从倒数第 N 行开始，如 last_lines:100
+)
+
+// StartPosition 解析后的起始位置
+type StartPosition struct {
+	Mode      string
+	Since     time.Time
+	LastLines int
+}
+
+// ParseStartPosition 解析 start_position 配置，since 为时长时以 now 往前推算
+func ParseStartPosition(s string, now time.Time) (StartPosition, error) {
+	mode, value := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		mode, value = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	mode = strings.TrimSpace(mode)
+
+	switch mode {
+	case "":
+		return StartPosition{}, nil
+	case StartPositionBeginning, StartPositionEnd:
+		if value != "" {
+			return StartPosition{}, fmt.Errorf("start_position(%s) does not accept a value", s)
+		}
+		return StartPosition{Mode: mode}, nil
+	case StartPositionSince:
+		if d, err := time.ParseDuration(value); err == nil {
+			if d <= 0 {
+				return StartPosition{}, fmt.Errorf("start_position(%s) duration must be greater than 0", s)
+			}
+			return StartPosition{Mode: mode, Since: now.Add(-d)}, nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return StartPosition{}, fmt.Errorf("start_position(%s) expect a duration or RFC3339 time", s)
+		}
+		return StartPosition{Mode: mode, Since: t}, nil
+	case StartPositionLastLines:
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return StartPosition{}, fmt.Errorf("start_position(%s) expect a positive number of lines", s)
+		}
+		return StartPosition{Mode: mode, LastLines: n}, nil
+	}
+	return StartPosition{}, fmt.Errorf("start_position(%s) is not supported", s)
+}
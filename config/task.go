@@ -30,6 +30,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
@@ -76,12 +77,46 @@ func (a ConditionSortByIndex) Less(i, j int) bool { return a[i].Index < a[j].Ind
 
 type ProcessorConfig struct {
 	Processors processors.PluginConfig `config:"processors"`
+	Dedup      DedupConfig             `config:"dedup"`
+}
+
+// DedupConfig 重复日志合并，同一文件中相同(或数字、十六进制 ID 归一化后相同)的行在 Window 内只输出第一行，
+// 周期结束时输出一行包含重复次数及时间范围的汇总
+type DedupConfig struct {
+	Enabled    bool          `config:"enabled"`
+	Window     time.Duration `config:"window"`
+	Normalize  bool          `config:"normalize"`   // 是否将数字、十六进制 ID 归一化后再比较
+	MaxEntries int           `config:"max_entries"` // 最多同时跟踪的不同行数，超出时提前结束最早的周期
 }
 
 type FiltersConfig struct {
-	Delimiter string         `config:"delimiter"`
-	Filters   []FilterConfig `config:"filters"`
-	HasFilter bool
+	Delimiter   string            `config:"delimiter"`
+	Filters     []FilterConfig    `config:"filters"`
+	FilterStats FilterStatsConfig `config:"filter_stats"`
+	HasFilter   bool
+
+	// 按内容路由到不同的 dataid，与过滤条件在过滤节点中一起计算
+	Routes             []RouteConfig `config:"routes"`
+	RouteMode          string        `config:"route_mode"`           // first：按顺序命中第一条规则；all：命中的所有规则
+	RouteDefaultDataID int           `config:"route_default_dataid"` // 没有命中任何规则时的 dataid，为 0 时丢弃
+}
+
+// 路由模式
+const (
+	RouteModeFirst = "first"
+	RouteModeAll   = "all"
+)
+
+// RouteConfig 路由规则，条件之间为与，条件与过滤条件一致
+type RouteConfig struct {
+	DataID     int               `config:"dataid"`
+	Conditions []ConditionConfig `config:"conditions"`
+}
+
+// FilterStatsConfig 过滤条件命中统计，每 SampleRate 行抽取 1 行统计各组及各条件的命中情况
+type FilterStatsConfig struct {
+	Enabled    bool `config:"enabled"`
+	SampleRate int  `config:"sample_rate"`
 }
 
 type SenderConfig struct {
@@ -174,6 +209,18 @@ type TaskConfig struct {
 	IsContainerStd    bool `config:"is_container_std"`     // 是否为容器标准输出日志(docker)
 	IsCRIContainerStd bool `config:"is_cri_container_std"` // 是否为容器标准输出日志(CRI)
 
+	// 采集进度隔离模式，为空时与相同 paths 的任务共享采集进度
+	StateIsolation string `config:"state_isolation"`
+
+	// 日志采集模式，为空时持续采集；backfill 时一次性读取存量文件，完成后停止
+	Mode string `config:"mode"`
+
+	// 文件编码，auto 时按文件自动识别
+	Encoding string `config:"encoding"`
+
+	// 没有采集进度的文件的起始位置：beginning、end、since:<时长或 RFC3339 时间>、last_lines:<N>
+	StartPosition string `config:"start_position"`
+
 	Output common.ConfigNamespace `config:"output"`
 
 	RawConfig *beat.Config
@@ -183,6 +230,39 @@ func (c *TaskConfig) GetExtMeta() map[string]interface{} {
 	return c.ext
 }
 
+const (
+	StateIsolationTask  = "task"  // 按任务(dataid)隔离采集进度
+	StateIsolationInput = "input" // 按 InputID 隔离采集进度
+)
+
+// TaskModeBackfill 存量日志回填模式
+const TaskModeBackfill = "backfill"
+
+// IsBackfill 是否为存量日志回填任务，仅对 log 类型生效
+func (c *TaskConfig) IsBackfill() bool {
+	return c.Type == "log" && c.Mode == TaskModeBackfill
+}
+
+// EncodingAuto 按文件自动识别编码
+const EncodingAuto = "auto"
+
+// IsAutoEncoding 是否按文件自动识别编码，仅对 log 类型生效
+func (c *TaskConfig) IsAutoEncoding() bool {
+	return c.Type == "log" && c.Encoding == EncodingAuto
+}
+
+// GetStateNamespace 获取采集进度的命名空间，为空表示使用共享的采集进度
+func (c *TaskConfig) GetStateNamespace() string {
+	switch c.StateIsolation {
+	case StateIsolationTask:
+		return fmt.Sprintf("task-%d", c.DataID)
+	case StateIsolationInput:
+		return c.InputID
+	default:
+		return ""
+	}
+}
+
 // NewTaskConfig 创建采集任务配置
 func NewTaskConfig(beatConfig Config, rawConfig *beat.Config) (*TaskConfig, error) {
 	config := &TaskConfig{
@@ -194,6 +274,16 @@ func NewTaskConfig(beatConfig Config, rawConfig *beat.Config) (*TaskConfig, erro
 			ExtMeta:      nil,
 			OutputFormat: "v2",
 		},
+		FiltersConfig: FiltersConfig{
+			FilterStats: FilterStatsConfig{SampleRate: 1},
+		},
+		ProcessorConfig: ProcessorConfig{
+			Dedup: DedupConfig{
+				Window:     10 * time.Second,
+				Normalize:  true,
+				MaxEntries: 10000,
+			},
+		},
 	}
 
 	// TODO 这里需要改造成通用逻辑
@@ -206,6 +296,36 @@ func NewTaskConfig(beatConfig Config, rawConfig *beat.Config) (*TaskConfig, erro
 	if config.DataID == 0 {
 		return nil, fmt.Errorf("error creating task, DataID cannot be empty")
 	}
+	switch config.StateIsolation {
+	case "", StateIsolationTask, StateIsolationInput:
+	default:
+		return nil, fmt.Errorf("error creating task, state_isolation(%s) is not supported", config.StateIsolation)
+	}
+	if config.Type == "log" {
+		switch config.Mode {
+		case "":
+		case TaskModeBackfill:
+			// 回填任务需要从头读取，不能复用持续采集任务的采集进度
+			if config.StateIsolation == "" {
+				config.StateIsolation = StateIsolationTask
+			}
+		default:
+			return nil, fmt.Errorf("error creating task, mode(%s) is not supported", config.Mode)
+		}
+		if _, err = ParseStartPosition(config.StartPosition, time.Now()); err != nil {
+			return nil, fmt.Errorf("error creating task, %v", err)
+		}
+		if config.StartPosition != "" && config.Mode == TaskModeBackfill {
+			return nil, fmt.Errorf("error creating task, start_position is not supported in backfill mode")
+		}
+	}
+
+	if config.FilterStats.SampleRate <= 0 {
+		return nil, fmt.Errorf("error creating task, filter_stats.sample_rate must be greater than 0")
+	}
+	if config.Dedup.Enabled && (config.Dedup.Window <= 0 || config.Dedup.MaxEntries <= 0) {
+		return nil, fmt.Errorf("error creating task, dedup.window and dedup.max_entries must be greater than 0")
+	}
 
 	config.RawConfig, err = initTaskConfig(config.Type, rawConfig)
 	if err != nil {
@@ -240,6 +360,10 @@ func NewTaskConfig(beatConfig Config, rawConfig *beat.Config) (*TaskConfig, erro
 		}
 	}
 
+	if err = initRoutes(config); err != nil {
+		return nil, fmt.Errorf("error creating task, %v", err)
+	}
+
 	// sort conditions
 	if config.HasFilter {
 		for _, f := range config.Filters {
@@ -276,6 +400,49 @@ func NewTaskConfig(beatConfig Config, rawConfig *beat.Config) (*TaskConfig, erro
 	return config, nil
 }
 
+// initRoutes 校验路由规则并初始化条件的匹配方法
+func initRoutes(config *TaskConfig) error {
+	switch config.RouteMode {
+	case "":
+		config.RouteMode = RouteModeFirst
+	case RouteModeFirst, RouteModeAll:
+	default:
+		return fmt.Errorf("route_mode(%s) is not supported", config.RouteMode)
+	}
+	if config.RouteDefaultDataID < 0 {
+		return fmt.Errorf("route_default_dataid(%d) is invalid", config.RouteDefaultDataID)
+	}
+
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		if route.DataID <= 0 {
+			return fmt.Errorf("route[%d] dataid(%d) is invalid", i, route.DataID)
+		}
+		if len(route.Conditions) == 0 {
+			return fmt.Errorf("route[%d] conditions is required", i)
+		}
+		for j, condition := range route.Conditions {
+			// 按列匹配时需要分隔符，整行匹配不需要
+			if condition.Index > 0 && len(config.Delimiter) != 1 {
+				return fmt.Errorf("route[%d] condition [%+v] requires a single character delimiter", i, condition)
+			}
+
+			// 与过滤条件一致，整行匹配时 '=' 为包含
+			if condition.Index <= 0 && condition.Op == opEqual {
+				condition.Op = opInclude
+			}
+			matcher, err := getOperationFunc(condition.Op, condition.Key)
+			if err != nil {
+				return fmt.Errorf("route[%d] condition [%+v] init matcher error: %s", i, condition, err.Error())
+			}
+			condition.matcher = matcher
+			route.Conditions[j] = condition
+		}
+		sort.Sort(ConditionSortByIndex(route.Conditions))
+	}
+	return nil
+}
+
 func initIDWithConfig(config *TaskConfig) {
 	var (
 		hashVal    string
@@ -291,14 +458,47 @@ func initIDWithConfig(config *TaskConfig) {
 	_, hashVal = utils.HashRawConfig(copyConfig)
 	config.ProcessorID = fmt.Sprintf("processor-%s", hashVal)
 
+	// 配置了路由的任务按路由规则发送到各自的 dataid，不同 dataid 的任务不能共享同一个 Processor 与 Sender
+	// 路由规则本身已包含在上面的配置中
+	if len(config.Routes) > 0 {
+		config.SenderID = fmt.Sprintf("%s-%d", config.SenderID, config.DataID)
+		config.ProcessorID = fmt.Sprintf("%s-%d", config.ProcessorID, config.DataID)
+	} else if config.hasProcessor("mask") {
+		// mask 的命中指标按 dataid 上报，见 task/processor/processor.go setProcessorsDataID
+		config.ProcessorID = fmt.Sprintf("%s-%d", config.ProcessorID, config.DataID)
+	}
+
 	RemoveFields(copyConfig, config.ProcessorConfig)
-	RemoveFields(copyConfig, map[string]interface{}{"filters": config.Filters})
+	// 命中统计不影响过滤结果，统计配置不同的任务仍共享同一个过滤节点
+	RemoveFields(copyConfig, map[string]interface{}{
+		"filters":              config.Filters,
+		"filter_stats":         config.FilterStats,
+		"routes":               config.Routes,
+		"route_mode":           config.RouteMode,
+		"route_default_dataid": config.RouteDefaultDataID,
+	})
 	_, hashVal = utils.HashRawConfig(copyConfig)
 	config.FilterID = fmt.Sprintf("filter-%s", hashVal)
 
 	RemoveFields(copyConfig, config.FiltersConfig)
 	_, hashVal = utils.HashRawConfig(copyConfig)
 	config.InputID = fmt.Sprintf("input-%s", hashVal)
+
+	// 按任务隔离采集进度时，不同任务之间不能共享同一个 Input
+	// redis_stream 按 pipeline 确认的顺序执行 XACK，多个任务共享时一个任务的确认会提前确认其他任务未发送的消息
+	if config.StateIsolation == StateIsolationTask || config.Type == "redis_stream" {
+		config.InputID = fmt.Sprintf("%s-%d", config.InputID, config.DataID)
+	}
+}
+
+// hasProcessor 是否配置了指定的 processor
+func (c *TaskConfig) hasProcessor(name string) bool {
+	for _, cfg := range c.Processors {
+		if cfg.HasField(name) {
+			return true
+		}
+	}
+	return false
 }
 
 func RemoveFields(config *common.Config, from interface{}) {
@@ -25,6 +25,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -78,3 +79,214 @@ foobar
 
 	assert.Equal(t, excepted, meta)
 }
+
+// TestTaskConfig_StateIsolation 测试采集进度隔离
+func TestTaskConfig_StateIsolation(t *testing.T) {
+	shared, err := CreateTaskConfig(map[string]interface{}{
+		"dataid": "999990001",
+		"paths":  []string{"/data/logs/*.log"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "", shared.GetStateNamespace())
+
+	task1, err := CreateTaskConfig(map[string]interface{}{
+		"dataid":          "999990001",
+		"paths":           []string{"/data/logs/*.log"},
+		"state_isolation": "task",
+	})
+	assert.NoError(t, err)
+	task2, err := CreateTaskConfig(map[string]interface{}{
+		"dataid":          "999990002",
+		"paths":           []string{"/data/logs/*.log"},
+		"state_isolation": "task",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "task-999990001", task1.GetStateNamespace())
+	assert.Equal(t, "task-999990002", task2.GetStateNamespace())
+	assert.NotEqual(t, task1.InputID, task2.InputID)
+	assert.NotEqual(t, shared.InputID, task1.InputID)
+
+	input, err := CreateTaskConfig(map[string]interface{}{
+		"dataid":          "999990001",
+		"paths":           []string{"/data/logs/*.log"},
+		"state_isolation": "input",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, input.InputID, input.GetStateNamespace())
+
+	_, err = CreateTaskConfig(map[string]interface{}{
+		"dataid":          "999990001",
+		"state_isolation": "unknown",
+	})
+	assert.Error(t, err)
+}
+
+// TestTaskConfig_FilterStats 测试过滤条件命中统计配置
+func TestTaskConfig_FilterStats(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":    "999990001",
+		"paths":     []string{"/data/logs/*.log"},
+		"delimiter": "|",
+		"filters": []map[string]interface{}{
+			{"conditions": []map[string]interface{}{{"index": 1, "key": "ERROR", "op": "eq"}}},
+		},
+	}
+	task, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.False(t, task.FilterStats.Enabled)
+	assert.Equal(t, 1, task.FilterStats.SampleRate)
+
+	vars["filter_stats"] = map[string]interface{}{"enabled": true, "sample_rate": 100}
+	stats, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.True(t, stats.FilterStats.Enabled)
+	assert.Equal(t, 100, stats.FilterStats.SampleRate)
+	// 统计配置不影响过滤节点的共享
+	assert.Equal(t, task.FilterID, stats.FilterID)
+	assert.Equal(t, task.InputID, stats.InputID)
+
+	vars["filter_stats"] = map[string]interface{}{"enabled": true, "sample_rate": 0}
+	_, err = CreateTaskConfig(vars)
+	assert.Error(t, err)
+}
+
+// TestTaskConfig_Dedup 测试重复日志合并配置
+func TestTaskConfig_Dedup(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid": "999990001",
+		"paths":  []string{"/data/logs/*.log"},
+	}
+	task, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.False(t, task.Dedup.Enabled)
+	assert.Equal(t, 10*time.Second, task.Dedup.Window)
+	assert.True(t, task.Dedup.Normalize)
+
+	vars["dedup"] = map[string]interface{}{"enabled": true, "window": "1m", "max_entries": 100}
+	dedup, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, dedup.Dedup.Window)
+	assert.Equal(t, 100, dedup.Dedup.MaxEntries)
+	// 合并在处理节点中进行，不影响过滤节点的共享
+	assert.Equal(t, task.FilterID, dedup.FilterID)
+	assert.NotEqual(t, task.ProcessorID, dedup.ProcessorID)
+
+	vars["dedup"] = map[string]interface{}{"enabled": true, "window": "0s"}
+	_, err = CreateTaskConfig(vars)
+	assert.Error(t, err)
+}
+
+// TestTaskConfig_MaskProcessor 配置了 mask 的任务按 dataid 上报命中指标，不同 dataid 的任务不共享处理节点
+func TestTaskConfig_MaskProcessor(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid": "999990001",
+		"paths":  []string{"/data/logs/*.log"},
+	}
+	plain1, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	vars["dataid"] = "999990002"
+	plain2, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, plain1.ProcessorID, plain2.ProcessorID)
+
+	vars["processors"] = []map[string]interface{}{{"mask": map[string]interface{}{"fields": []string{"data"}}}}
+	vars["dataid"] = "999990001"
+	mask1, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	vars["dataid"] = "999990002"
+	mask2, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.NotEqual(t, mask1.ProcessorID, mask2.ProcessorID)
+	assert.Equal(t, mask1.FilterID, mask2.FilterID)
+}
+
+// TestTaskConfig_Routes 测试按内容路由配置
+func TestTaskConfig_Routes(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":    "999990001",
+		"paths":     []string{"/data/logs/*.log"},
+		"delimiter": "|",
+	}
+	task, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+
+	vars["routes"] = []map[string]interface{}{
+		{"dataid": 1001, "conditions": []map[string]interface{}{{"index": 1, "key": "ERROR", "op": "eq"}}},
+		{"dataid": 1002, "conditions": []map[string]interface{}{{"index": -1, "key": "timeout", "op": "="}}},
+	}
+	vars["route_default_dataid"] = 999990001
+	routed, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, RouteModeFirst, routed.RouteMode)
+	assert.Len(t, routed.Routes, 2)
+	// 整行匹配时 '=' 为包含
+	assert.Equal(t, opInclude, routed.Routes[1].Conditions[0].Op)
+	assert.True(t, routed.Routes[1].Conditions[0].GetMatcher()("connect timeout"))
+	// 路由规则与过滤条件一起在过滤节点中计算，不影响过滤节点的共享
+	assert.Equal(t, task.FilterID, routed.FilterID)
+
+	// 路由到各自 dataid 的任务不共享处理节点与发送节点
+	vars["dataid"] = "999990002"
+	other, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.Equal(t, routed.FilterID, other.FilterID)
+	assert.NotEqual(t, routed.ProcessorID, other.ProcessorID)
+	assert.NotEqual(t, routed.SenderID, other.SenderID)
+
+	// 路由方式不同的任务同样不共享
+	vars["dataid"] = "999990001"
+	vars["route_mode"] = RouteModeAll
+	all, err := CreateTaskConfig(vars)
+	assert.NoError(t, err)
+	assert.NotEqual(t, routed.ProcessorID, all.ProcessorID)
+	assert.NotEqual(t, routed.SenderID, all.SenderID)
+	delete(vars, "route_mode")
+
+	for _, invalid := range []map[string]interface{}{
+		{"route_mode": "random"},
+		{"routes": []map[string]interface{}{{"dataid": 0, "conditions": []map[string]interface{}{{"index": 1, "key": "a", "op": "eq"}}}}},
+		{"routes": []map[string]interface{}{{"dataid": 1001}}},
+		{"routes": []map[string]interface{}{{"dataid": 1001, "conditions": []map[string]interface{}{{"index": 1, "key": "a", "op": "unknown"}}}}},
+		{"delimiter": "", "routes": []map[string]interface{}{{"dataid": 1001, "conditions": []map[string]interface{}{{"index": 1, "key": "a", "op": "eq"}}}}},
+	} {
+		c := map[string]interface{}{
+			"dataid":    "999990001",
+			"paths":     []string{"/data/logs/*.log"},
+			"delimiter": "|",
+		}
+		for k, v := range invalid {
+			c[k] = v
+		}
+		_, err = CreateTaskConfig(c)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseStartPosition(t *testing.T) {
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	pos, err := ParseStartPosition("", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "", pos.Mode)
+
+	pos, err = ParseStartPosition("end", now)
+	assert.NoError(t, err)
+	assert.Equal(t, StartPositionEnd, pos.Mode)
+
+	pos, err = ParseStartPosition("since: 1h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, StartPosition{Mode: StartPositionSince, Since: now.Add(-time.Hour)}, pos)
+
+	pos, err = ParseStartPosition("since:2021-03-04T08:00:00+08:00", now)
+	assert.NoError(t, err)
+	assert.True(t, pos.Since.Equal(now.Add(-12*time.Hour)))
+
+	pos, err = ParseStartPosition("last_lines:100", now)
+	assert.NoError(t, err)
+	assert.Equal(t, StartPosition{Mode: StartPositionLastLines, LastLines: 100}, pos)
+
+	for _, s := range []string{"middle", "end:1", "since:yesterday", "since:-1h", "last_lines:0", "last_lines:abc"} {
+		_, err = ParseStartPosition(s, now)
+		assert.Error(t, err, s)
+	}
+}
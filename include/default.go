@@ -32,5 +32,21 @@ import (
 
 	_ "github.com/TencentBlueKing/bkunifylogbeat/config/input"
 	_ "github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/autoencoding"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/automultiline"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/backfill"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/evtx"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/execinput"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/fifo"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/fileguard"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/httppush"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/k8spods"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/redisstream"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/tcp"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/unixsocket"
 	_ "github.com/TencentBlueKing/bkunifylogbeat/task/input/wineventlog"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/processor/masker"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/processor/sampler"
+	_ "github.com/TencentBlueKing/bkunifylogbeat/task/processor/syslogparser"
 )
@@ -0,0 +1,60 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package registrar
+
+import (
+	"github.com/elastic/beats/filebeat/input/file"
+)
+
+const (
+	// stateFingerprintKey 压缩文件指纹在 state.Meta 中的存储 key
+	stateFingerprintKey = "bk_compressed_fingerprint"
+	// stateCompletedKey 压缩文件已读取完成的标记，重启后所有 state 都会被重置为 Finished，需要单独记录
+	stateCompletedKey = "bk_compressed_completed"
+)
+
+// GetStateFingerprint 获取压缩文件的指纹，非压缩文件的 state 为空
+func GetStateFingerprint(state file.State) string {
+	return state.Meta[stateFingerprintKey]
+}
+
+// WithFingerprint 在 state 中记录压缩文件的指纹，state ID 保持不变
+func WithFingerprint(state file.State, fingerprint string) file.State {
+	if fingerprint == "" || GetStateFingerprint(state) == fingerprint {
+		return state
+	}
+	return withPrivateMeta(state, stateFingerprintKey, fingerprint)
+}
+
+// IsStateCompleted 压缩文件是否已读取完成
+func IsStateCompleted(state file.State) bool {
+	return state.Meta[stateCompletedKey] == "true"
+}
+
+// WithCompleted 标记压缩文件已读取完成，state ID 保持不变
+func WithCompleted(state file.State) file.State {
+	if IsStateCompleted(state) {
+		return state
+	}
+	return withPrivateMeta(state, stateCompletedKey, "true")
+}
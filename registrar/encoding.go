@@ -0,0 +1,53 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package registrar
+
+import (
+	"github.com/elastic/beats/filebeat/input/file"
+)
+
+const (
+	// stateEncodingKey 自动识别的文件编码在 state.Meta 中的存储 key
+	stateEncodingKey = "bk_encoding"
+)
+
+// GetStateEncoding 获取 state 中记录的文件编码，未记录时为空
+func GetStateEncoding(state file.State) string {
+	return state.Meta[stateEncodingKey]
+}
+
+// WithEncoding 在 state 中记录文件编码，state ID 保持不变
+func WithEncoding(state file.State, encoding string) file.State {
+	if encoding == "" || GetStateEncoding(state) == encoding {
+		return state
+	}
+	return withPrivateMeta(state, stateEncodingKey, encoding)
+}
+
+// WithoutEncoding 移除 state 中记录的文件编码，还原为 Input 可识别的原始 state
+func WithoutEncoding(state file.State) file.State {
+	if GetStateEncoding(state) == "" {
+		return state
+	}
+	return withoutPrivateMeta(state, stateEncodingKey)
+}
@@ -0,0 +1,196 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package registrar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	bkStorage "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/storage"
+	"github.com/elastic/beats/filebeat/input/file"
+)
+
+const (
+	// stateNamespaceKey 命名空间在 state.Meta 中的存储 key
+	stateNamespaceKey = "bk_state_namespace"
+	// namespaceKeyPrefix 命名空间已完成共享进度迁移的标记，与 state 的存储 key 前缀区分开
+	namespaceKeyPrefix = "namespace:"
+)
+
+// privateMetaKeys 采集器内部写入 state.Meta 的 key，不参与 Input 的 state ID 计算
+var privateMetaKeys = map[string]struct{}{
+	stateNamespaceKey:   {},
+	stateEncodingKey:    {},
+	stateFingerprintKey: {},
+	stateCompletedKey:   {},
+}
+
+// GetStateNamespace 获取 state 所属的命名空间，共享模式下为空
+func GetStateNamespace(state file.State) string {
+	return state.Meta[stateNamespaceKey]
+}
+
+// WithNamespace 将 state 归属到指定的命名空间
+// 同一个文件在不同命名空间下的 state.ID() 不同，因此在 Registrar 中可以各自维护采集进度
+func WithNamespace(state file.State, namespace string) file.State {
+	if namespace == "" {
+		return state
+	}
+	return withPrivateMeta(state, stateNamespaceKey, namespace)
+}
+
+// WithoutNamespace 移除 state 的命名空间，还原为 Input 可识别的原始 state
+func WithoutNamespace(state file.State) file.State {
+	if GetStateNamespace(state) == "" {
+		return state
+	}
+	return withoutPrivateMeta(state, stateNamespaceKey)
+}
+
+// FilterStatesByNamespace 获取指定命名空间下的 state 列表，返回的 state 已移除命名空间
+// migrate 为 true 且该命名空间下没有任何 state 时，从共享的 state 中迁移一份过来
+func FilterStatesByNamespace(states []file.State, namespace string, migrate bool) []file.State {
+	if namespace == "" {
+		return filterStatesByNamespace(states, "")
+	}
+
+	result := filterStatesByNamespace(states, namespace)
+	if len(result) > 0 || !migrate {
+		return result
+	}
+	return filterStatesByNamespace(states, "")
+}
+
+// LoadNamespaceStates 加载命名空间的采集进度
+// 共享的 state 只在命名空间首次启用时迁移一次，保证切换到隔离模式后不会重新采集；
+// 之后即使命名空间下的 state 都被清理了，也不会再把旧的共享进度迁移回来
+func LoadNamespaceStates(states []file.State, namespace string) []file.State {
+	if namespace == "" {
+		return filterStatesByNamespace(states, "")
+	}
+
+	key := namespaceKeyPrefix + namespace
+	_, err := bkStorage.Get(key)
+	migrated := err == nil
+	if err != nil && err != bkStorage.ErrNotFound {
+		// 无法确认是否迁移过时不迁移，宁可按 Input 配置重新确定起始位置也不回退进度
+		logp.L.Errorf("get namespace(%s) migrate flag error: %v", namespace, err)
+		migrated = true
+	}
+
+	result := FilterStatesByNamespace(states, namespace, !migrated)
+	if !migrated {
+		bkStorage.Set(key, time.Now().Format(time.UnixDate), 0)
+	}
+	return result
+}
+
+// GetNamespaceStates 仅获取指定命名空间下的 state 列表，不从共享的 state 迁移
+func GetNamespaceStates(states []file.State, namespace string) []file.State {
+	return filterStatesByNamespace(states, namespace)
+}
+
+func filterStatesByNamespace(states []file.State, namespace string) []file.State {
+	result := make([]file.State, 0, len(states))
+	for _, state := range states {
+		if GetStateNamespace(state) != namespace {
+			continue
+		}
+		result = append(result, WithoutNamespace(state))
+	}
+	return result
+}
+
+// withPrivateMeta 在 state.Meta 中写入内部使用的 key，并保持原有的 state ID
+func withPrivateMeta(state file.State, key, value string) file.State {
+	meta := make(map[string]string, len(state.Meta)+1)
+	for k, v := range state.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	state.Meta = meta
+	normalizeStateID(&state)
+	return state
+}
+
+// withoutPrivateMeta 移除 state.Meta 中内部使用的 key
+func withoutPrivateMeta(state file.State, key string) file.State {
+	meta := make(map[string]string, len(state.Meta))
+	for k, v := range state.Meta {
+		if k == key {
+			continue
+		}
+		meta[k] = v
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+	state.Meta = meta
+	state.Id = ""
+	normalizeStateID(&state)
+	state.ID()
+	return state
+}
+
+// hasPrivateMeta state.Meta 中是否存在内部使用的 key
+func hasPrivateMeta(meta map[string]string) bool {
+	for k := range meta {
+		if _, ok := privateMetaKeys[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeStateID 重新生成 state ID
+// 从存储中反序列化时 state.Id 为空，需要去掉内部使用的 key 计算原始 ID，有命名空间时再加上命名空间前缀
+func normalizeStateID(state *file.State) {
+	if !hasPrivateMeta(state.Meta) {
+		return
+	}
+
+	origin := *state
+	origin.Meta = metaWithoutPrivate(state.Meta)
+	origin.Id = ""
+	if namespace := GetStateNamespace(*state); namespace != "" {
+		state.Id = fmt.Sprintf("%s::%s", namespace, origin.ID())
+		return
+	}
+	state.Id = origin.ID()
+}
+
+func metaWithoutPrivate(meta map[string]string) map[string]string {
+	result := make(map[string]string, len(meta))
+	for k, v := range meta {
+		if _, ok := privateMetaKeys[k]; ok {
+			continue
+		}
+		result[k] = v
+	}
+	// 与 Input 生成的 state 保持一致，没有 meta 时为 nil
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/elastic/beats/filebeat/input/file"
 	commonFile "github.com/elastic/beats/libbeat/common/file"
 	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/elastic/beats/libbeat/paths"
 
 	cfg "github.com/TencentBlueKing/bkunifylogbeat/config"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/input/wineventlog"
@@ -47,12 +48,21 @@ const (
 	stateNanosecond = 1
 	stateNotManage  = -2
 	stateKeyPrefix  = "state:"
+
+	defaultSnapshotDir = "registrar_snapshots"
 )
 
+// errStoreEmpty 存储中没有任何采集进度，首次启动或进度文件丢失
+var errStoreEmpty = errors.New("registrar store is empty")
+
 var (
 	registrarFlushed      = bkmonitoring.NewInt("registrar_flushed")
 	registrarMarshalError = bkmonitoring.NewInt("registrar_marshal_error")
 	registrarFiles        = bkmonitoring.NewInt("registrar_files", monitoring.Gauge)
+
+	registrarSnapshot      = bkmonitoring.NewInt("registrar_snapshot")       // 快照次数
+	registrarSnapshotError = bkmonitoring.NewInt("registrar_snapshot_error") // 快照失败次数
+	registrarRecovered     = bkmonitoring.NewInt("registrar_recovered")      // 从快照恢复的次数
 )
 
 // Registrar: 采集进度管理
@@ -69,6 +79,10 @@ type Registrar struct {
 	stateIDCache map[string]struct{} // 等待持久化的状态ID
 
 	fileIdentifier string
+
+	snapshotter      *snapshotter  // 采集进度快照，为空时不开启
+	snapshotInterval time.Duration // 快照间隔
+	recovered        bool          // 启动时是否从快照恢复
 }
 
 // New creates a new Registrar instance, updating the registry file on
@@ -86,43 +100,94 @@ func New(config cfg.Registry, fileIdentifier string) (*Registrar, error) {
 		stateIDCache: make(map[string]struct{}),
 
 		fileIdentifier: fileIdentifier,
+
+		snapshotInterval: config.SnapshotInterval,
+	}
+	if config.SnapshotCount > 0 {
+		snapshotPath := config.SnapshotPath
+		if snapshotPath == "" {
+			snapshotPath = paths.Resolve(paths.Data, defaultSnapshotDir)
+		}
+		if r.snapshotInterval <= 0 {
+			r.snapshotInterval = 5 * time.Minute
+		}
+		r.snapshotter = newSnapshotter(snapshotPath, config.SnapshotCount)
 	}
 	return r, r.Init()
 }
 
 // Init: 采集器启动时调用，同时对原采集器采集进度迁移
 func (r *Registrar) Init() error {
-	var states []file.State
-
 	// set flush interval
 	if r.flushTimeout > time.Second {
 		bkStorage.SetFlushInterval(r.flushTimeout)
 	}
 
+	t, states, corrupted, err := r.loadStates()
+	if err != nil || corrupted > 0 {
+		recoveredStates, ok := r.recoverStates(states, corrupted, err)
+		if ok {
+			states = recoveredStates
+		} else if errors.Is(err, errStoreEmpty) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// storage 存储以 state.ID() 来作为 key
+	// 当切换了不同的 fileIdentifier，state.ID() 会发生变化
+	// 因此可能会出现 key 不同，但 state 代表了同一个文件的情况
+	// 这里对 state 进行去重
+	states = r.deduplicateStates(states)
+
+	states = r.migrate(states)
+	logp.L.Infof("load states: time=>%s, count=>%d, flush=>%s, gcFrequency=>%s",
+		t, len(states), r.flushTimeout, r.gcFrequency)
+
+	r.states.SetStates(ResetStates(states))
+
+	// 从快照恢复后，需要将全量进度重新写入存储
+	if r.recovered {
+		for _, state := range r.states.GetStates() {
+			r.addStateIDCache(state.ID())
+		}
+	}
+	return nil
+}
+
+// loadStates 从存储中加载采集进度，返回无法解析的进度数量
+func (r *Registrar) loadStates() (time.Time, []file.State, int, error) {
+	var (
+		t         time.Time
+		states    []file.State
+		corrupted int
+	)
+
 	// get time
 	str, err := bkStorage.Get(timeKey)
 	if err != nil {
 		if err == bkStorage.ErrNotFound {
-			return nil
+			return t, nil, 0, errStoreEmpty
 		} else {
-			return fmt.Errorf("get %s from bkStorage error", timeKey)
+			return t, nil, 0, fmt.Errorf("get %s from bkStorage error", timeKey)
 		}
 	}
-	t, err := time.Parse(time.UnixDate, str)
+	t, err = time.Parse(time.UnixDate, str)
 	if err != nil {
-		return fmt.Errorf("parse time error: %v", err)
+		return t, nil, 0, fmt.Errorf("parse time error: %v", err)
 	}
 
 	// get v1 registrar key
 	str, err = bkStorage.Get(registrarKey)
 	if err != nil {
 		if !errors.Is(err, bkStorage.ErrNotFound) {
-			return fmt.Errorf("get %s from bkStorage err: %v", registrarKey, err)
+			return t, nil, 0, fmt.Errorf("get %s from bkStorage err: %v", registrarKey, err)
 		} else {
 			// registrarKey 不存在的情况，说明是没有进度文件、或者已经迁移完成，直接从新的 key 获取进度
 			values, err := bkStorage.List(stateKeyPrefix)
 			if err != nil {
-				return fmt.Errorf("list keys with prefix %s from bkStorage err: %v", stateKeyPrefix, err)
+				return t, nil, 0, fmt.Errorf("list keys with prefix %s from bkStorage err: %v", stateKeyPrefix, err)
 			}
 
 			// merge states with two versions
@@ -130,7 +195,8 @@ func (r *Registrar) Init() error {
 				var state file.State
 				err = json.Unmarshal([]byte(v), &state)
 				if err != nil {
-					logp.L.Errorf("json unmarshal single state error, %s", str)
+					corrupted++
+					logp.L.Errorf("json unmarshal single state error, %s", v)
 					continue
 				}
 				states = append(states, state)
@@ -141,7 +207,7 @@ func (r *Registrar) Init() error {
 		err = json.Unmarshal([]byte(str), &states)
 		if err != nil {
 			logp.L.Errorf("json unmarshal error, %s", str)
-			return fmt.Errorf("error decoding states: %s", err)
+			return t, nil, 0, fmt.Errorf("error decoding states: %s", err)
 		}
 
 		logp.L.Infof("load states from key=>%s and migrate to new key, count=>%d", registrarKey, len(states))
@@ -162,19 +228,61 @@ func (r *Registrar) Init() error {
 		logp.L.Infof("migrate states from key=>%s success, delete this key", registrarKey)
 
 	}
+	return t, states, corrupted, nil
+}
 
-	// storage 存储以 state.ID() 来作为 key
-	// 当切换了不同的 fileIdentifier，state.ID() 会发生变化
-	// 因此可能会出现 key 不同，但 state 代表了同一个文件的情况
-	// 这里对 state 进行去重
-	states = r.deduplicateStates(states)
+// recoverStates 存储不可用或部分进度损坏时，使用最新的有效快照补全采集进度
+// 存储中仍然有效的进度会与快照合并，时间较新的进度优先
+func (r *Registrar) recoverStates(states []file.State, corrupted int, loadErr error) ([]file.State, bool) {
+	if r.snapshotter == nil {
+		return nil, false
+	}
 
-	states = r.migrate(states)
-	logp.L.Infof("load states: time=>%s, count=>%d, flush=>%s, gcFrequency=>%s",
-		t, len(states), r.flushTimeout, r.gcFrequency)
+	snap, errs := r.snapshotter.loadLatest()
+	for _, err := range errs {
+		logp.L.Errorf("skip invalid registrar snapshot: %v", err)
+	}
+	if snap == nil {
+		// 首次启动时既没有进度也没有快照，属于正常情况
+		if !errors.Is(loadErr, errStoreEmpty) || len(errs) > 0 {
+			logp.L.Errorf("registrar store is broken(err=>%v, corrupted=>%d) and no valid snapshot found in %s",
+				loadErr, corrupted, r.snapshotter.path)
+		}
+		return nil, false
+	}
 
-	r.states.SetStates(ResetStates(states))
-	return nil
+	var snapStates []file.State
+	if err := json.Unmarshal(snap.States, &snapStates); err != nil {
+		logp.L.Errorf("decode registrar snapshot(%s) error: %v", snap.name, err)
+		return nil, false
+	}
+
+	existIDs := make(map[string]struct{}, len(states))
+	for _, state := range states {
+		state.FileIdentifier = r.fileIdentifier
+		normalizeStateID(&state)
+		existIDs[state.ID()] = struct{}{}
+	}
+
+	restored := 0
+	for _, state := range snapStates {
+		state.FileIdentifier = r.fileIdentifier
+		normalizeStateID(&state)
+		if _, ok := existIDs[state.ID()]; ok {
+			continue
+		}
+		restored++
+		logp.L.Warnf("restore state from snapshot, source=>%s, offset=>%d, updated=>%s",
+			state.Source, state.Offset, state.Timestamp)
+	}
+
+	logp.L.Warnf("registrar recovered from snapshot(%s): reason=>%v, corrupted=>%d, valid=>%d, restored=>%d. "+
+		"progress updated after %s is lost, these files may be collected again from snapshot offset",
+		snap.name, loadErr, corrupted, len(states), restored, snap.Time)
+
+	registrarRecovered.Add(1)
+	r.recovered = true
+	return append(states, snapStates...), true
 }
 
 // GetStates return the registrar states
@@ -215,10 +323,18 @@ func (r *Registrar) run() {
 	flushTicker := time.NewTicker(r.flushTimeout)
 	gcTicker := time.NewTicker(r.gcFrequency)
 
+	var snapshotC <-chan time.Time
+	if r.snapshotter != nil {
+		snapshotTicker := time.NewTicker(r.snapshotInterval)
+		defer snapshotTicker.Stop()
+		snapshotC = snapshotTicker.C
+	}
+
 	defer func() {
 		flushTicker.Stop()
 		gcTicker.Stop()
 		r.flushRegistry()
+		r.saveSnapshot()
 		r.wg.Done()
 	}()
 
@@ -231,6 +347,8 @@ func (r *Registrar) run() {
 			r.flushRegistry()
 		case <-gcTicker.C:
 			r.gcRequired = true
+		case <-snapshotC:
+			r.saveSnapshot()
 		case states := <-r.Channel:
 			r.onEvents(states)
 		}
@@ -281,12 +399,36 @@ func (r *Registrar) flushRegistry() {
 
 }
 
+// saveSnapshot 保存全量采集进度快照
+func (r *Registrar) saveSnapshot() {
+	if r.snapshotter == nil {
+		return
+	}
+
+	states := r.states.GetStates()
+	data, err := json.Marshal(states)
+	if err != nil {
+		registrarSnapshotError.Add(1)
+		logp.L.Errorf("marshal registrar snapshot error: %v", err)
+		return
+	}
+	if err = r.snapshotter.save(data, len(states), time.Now()); err != nil {
+		registrarSnapshotError.Add(1)
+		logp.L.Errorf("save registrar snapshot error: %v", err)
+		return
+	}
+	registrarSnapshot.Add(1)
+	logp.L.Debugf("save registrar snapshot, count=>%d", len(states))
+}
+
 // deduplicateStates removes duplicate states from the list.
 func (r *Registrar) deduplicateStates(states []file.State) []file.State {
 	deduplicatedMap := make(map[string]file.State, len(states))
 	for _, state := range states {
 		// 设置去重依据
 		state.FileIdentifier = r.fileIdentifier
+		// 隔离模式下的 state 需要带上命名空间，避免与共享的 state 去重
+		normalizeStateID(&state)
 		if _, ok := deduplicatedMap[state.ID()]; !ok {
 			// 从未出现过的，添加到 map
 			deduplicatedMap[state.ID()] = state
@@ -23,6 +23,7 @@
 package registrar
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"sort"
@@ -206,3 +207,284 @@ func TestStateFileIdentifierInode(t *testing.T) {
 	bkStorage.Close()
 	os.Remove(testRegPath)
 }
+
+func TestStateNamespace(t *testing.T) {
+	state := file.State{
+		Source:         "/data/logs/test.log",
+		Offset:         10,
+		FileIdentifier: "inode",
+		FileStateOS:    beatfile.StateOS{Inode: 100, Device: 900},
+	}
+
+	// 共享模式不做任何处理
+	assert.Equal(t, state, WithNamespace(state, ""))
+
+	nsState := WithNamespace(state, "task-1")
+	assert.Equal(t, "task-1", GetStateNamespace(nsState))
+	assert.Equal(t, "task-1::100-900", nsState.ID())
+	assert.Empty(t, GetStateNamespace(state))
+
+	// 反序列化后 Id 丢失，需要能重新生成
+	nsState.Id = ""
+	normalizeStateID(&nsState)
+	assert.Equal(t, "task-1::100-900", nsState.ID())
+
+	originState := WithoutNamespace(nsState)
+	assert.Empty(t, GetStateNamespace(originState))
+	assert.Nil(t, originState.Meta)
+	assert.Equal(t, "100-900", originState.ID())
+
+	otherState := state
+	otherState.Offset = 20
+	otherState.FileStateOS = beatfile.StateOS{Inode: 101, Device: 900}
+	otherState = WithNamespace(otherState, "task-2")
+
+	// 命名空间下已有进度，只加载该命名空间的进度
+	states := FilterStatesByNamespace([]file.State{state, otherState}, "task-2", true)
+	assert.Len(t, states, 1)
+	assert.Equal(t, int64(20), states[0].Offset)
+	assert.Equal(t, "101-900", states[0].ID())
+
+	// 命名空间下没有进度，从共享进度迁移
+	states = FilterStatesByNamespace([]file.State{state, otherState}, "task-3", true)
+	assert.Len(t, states, 1)
+	assert.Equal(t, int64(10), states[0].Offset)
+
+	// 已经迁移过的命名空间不再迁移
+	states = FilterStatesByNamespace([]file.State{state, otherState}, "task-3", false)
+	assert.Len(t, states, 0)
+
+	// 共享模式不加载隔离模式的进度
+	states = FilterStatesByNamespace([]file.State{state, otherState}, "", true)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "100-900", states[0].ID())
+}
+
+func TestLoadNamespaceStates(t *testing.T) {
+	testRegPath, err := filepath.Abs("../tests/namespace.bkpipe.db")
+	if err != nil {
+		panic(err)
+	}
+	os.Remove(testRegPath)
+	err = bkStorage.Init(testRegPath, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		bkStorage.Close()
+		os.Remove(testRegPath)
+	}()
+
+	shared := file.State{
+		Source:         "/data/logs/test.log",
+		Offset:         10,
+		FileIdentifier: "inode",
+		FileStateOS:    beatfile.StateOS{Inode: 100, Device: 900},
+	}
+
+	// 首次启用隔离模式，从共享进度迁移
+	states := LoadNamespaceStates([]file.State{shared}, "task-1")
+	assert.Len(t, states, 1)
+	assert.Equal(t, int64(10), states[0].Offset)
+
+	// 命名空间下的进度被清理后，不会再次迁移旧的共享进度
+	states = LoadNamespaceStates([]file.State{shared}, "task-1")
+	assert.Len(t, states, 0)
+
+	// 其他命名空间不受影响
+	states = LoadNamespaceStates([]file.State{shared}, "task-2")
+	assert.Len(t, states, 1)
+
+	// 共享模式只加载共享进度
+	states = LoadNamespaceStates([]file.State{shared, WithNamespace(shared, "task-1")}, "")
+	assert.Len(t, states, 1)
+	assert.Empty(t, GetStateNamespace(states[0]))
+}
+
+func TestStateEncoding(t *testing.T) {
+	state := file.State{
+		Source:         "/data/logs/test.log",
+		Offset:         10,
+		FileIdentifier: "inode",
+		FileStateOS:    beatfile.StateOS{Inode: 100, Device: 900},
+	}
+
+	// 记录编码后 state ID 不变
+	encState := WithEncoding(state, "gbk")
+	assert.Equal(t, "gbk", GetStateEncoding(encState))
+	assert.Equal(t, "100-900", encState.ID())
+	assert.Empty(t, GetStateEncoding(state))
+
+	// 反序列化后 Id 丢失，需要能重新生成
+	encState.Id = ""
+	normalizeStateID(&encState)
+	assert.Equal(t, "100-900", encState.ID())
+
+	// 与命名空间同时使用
+	nsState := WithNamespace(encState, "task-1")
+	assert.Equal(t, "task-1::100-900", nsState.ID())
+	nsState.Id = ""
+	normalizeStateID(&nsState)
+	assert.Equal(t, "task-1::100-900", nsState.ID())
+
+	originState := WithoutNamespace(nsState)
+	assert.Equal(t, "gbk", GetStateEncoding(originState))
+	assert.Equal(t, "100-900", originState.ID())
+
+	originState = WithoutEncoding(originState)
+	assert.Nil(t, originState.Meta)
+	assert.Equal(t, "100-900", originState.ID())
+}
+
+// initTestStorage 初始化一份空的进度存储，返回清理函数
+func initTestStorage(t *testing.T, name string) func() {
+	testRegPath, err := filepath.Abs("../tests/" + name + ".bkpipe.db")
+	if err != nil {
+		panic(err)
+	}
+	os.Remove(testRegPath)
+	if err = bkStorage.Init(testRegPath, nil); err != nil {
+		panic(err)
+	}
+	return func() {
+		bkStorage.Close()
+		os.Remove(testRegPath)
+	}
+}
+
+// saveTestSnapshot 写入一份包含指定进度的快照
+func saveTestSnapshot(t *testing.T, s *snapshotter, states []file.State, now time.Time) {
+	data, err := json.Marshal(states)
+	assert.NoError(t, err)
+	assert.NoError(t, s.save(data, len(states), now))
+}
+
+// findState 按文件路径查找进度
+func findState(states []file.State, source string) (file.State, bool) {
+	for _, state := range states {
+		if state.Source == source {
+			return state, true
+		}
+	}
+	return file.State{}, false
+}
+
+func TestRegistrarRecover(t *testing.T) {
+	now := time.Now()
+	stateA := file.State{
+		Source: "/data/logs/a.log", Offset: 50, Timestamp: now,
+		FileStateOS: beatfile.StateOS{Inode: 100, Device: 900},
+	}
+	stateB := file.State{
+		Source: "/data/logs/b.log", Offset: 20, Timestamp: now.Add(-time.Minute),
+		FileStateOS: beatfile.StateOS{Inode: 101, Device: 900},
+	}
+	oldStateA := stateA
+	oldStateA.Offset = 30
+	oldStateA.Timestamp = now.Add(-time.Minute)
+
+	newRegistrar := func(snapshotPath string) (*Registrar, error) {
+		return New(cfg.Registry{
+			FlushTimeout:  1 * time.Second,
+			GcFrequency:   1 * time.Second,
+			SnapshotPath:  snapshotPath,
+			SnapshotCount: 3,
+		}, "inode")
+	}
+	writeState := func(state file.State) {
+		data, err := json.Marshal(state)
+		assert.NoError(t, err)
+		bkStorage.Set(stateKeyPrefix+state.ID(), string(data), 0)
+	}
+
+	t.Run("corrupted state", func(t *testing.T) {
+		defer initTestStorage(t, "recover_corrupted")()
+		snapshotPath := t.TempDir()
+		saveTestSnapshot(t, newSnapshotter(snapshotPath, 3), []file.State{oldStateA, stateB}, now.Add(-time.Minute))
+
+		bkStorage.Set(timeKey, now.Format(time.UnixDate), 0)
+		writeState(stateA)
+		bkStorage.Set(stateKeyPrefix+"101-900", `{"source": "/data/logs/b.log", "offs`, 0)
+
+		r, err := newRegistrar(snapshotPath)
+		assert.NoError(t, err)
+		assert.True(t, r.recovered)
+
+		states := r.GetStates()
+		assert.Len(t, states, 2)
+		// 存储中仍然有效且较新的进度优先
+		a, ok := findState(states, stateA.Source)
+		assert.True(t, ok)
+		assert.Equal(t, int64(50), a.Offset)
+		// 损坏的进度从快照补全
+		b, ok := findState(states, stateB.Source)
+		assert.True(t, ok)
+		assert.Equal(t, int64(20), b.Offset)
+		// 恢复后的全量进度需要重新写入存储
+		assert.Len(t, r.stateIDCache, 2)
+	})
+
+	t.Run("store lost", func(t *testing.T) {
+		defer initTestStorage(t, "recover_lost")()
+		snapshotPath := t.TempDir()
+		saveTestSnapshot(t, newSnapshotter(snapshotPath, 3), []file.State{stateA, stateB}, now)
+
+		r, err := newRegistrar(snapshotPath)
+		assert.NoError(t, err)
+		assert.True(t, r.recovered)
+		assert.Len(t, r.GetStates(), 2)
+	})
+
+	t.Run("partial snapshot", func(t *testing.T) {
+		defer initTestStorage(t, "recover_partial")()
+		snapshotPath := t.TempDir()
+		s := newSnapshotter(snapshotPath, 3)
+		saveTestSnapshot(t, s, []file.State{oldStateA}, now.Add(-time.Minute))
+		saveTestSnapshot(t, s, []file.State{stateA, stateB}, now)
+
+		// 最新的快照只写入了一半
+		names, err := s.list()
+		assert.NoError(t, err)
+		content, err := os.ReadFile(names[0])
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(names[0], content[:len(content)/2], 0o600))
+
+		bkStorage.Set(timeKey, now.Format(time.UnixDate), 0)
+		bkStorage.Set(registrarKey, `[{"source": "/data/logs/a.log"`, 0)
+
+		r, err := newRegistrar(snapshotPath)
+		assert.NoError(t, err)
+		assert.True(t, r.recovered)
+
+		// 回退到上一份有效快照
+		states := r.GetStates()
+		assert.Len(t, states, 1)
+		assert.Equal(t, int64(30), states[0].Offset)
+	})
+
+	t.Run("no valid snapshot", func(t *testing.T) {
+		defer initTestStorage(t, "recover_invalid")()
+		snapshotPath := t.TempDir()
+		saveTestSnapshot(t, newSnapshotter(snapshotPath, 3), []file.State{stateA}, now)
+		names, err := newSnapshotter(snapshotPath, 3).list()
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(names[0], []byte("{"), 0o600))
+
+		// 部分进度损坏时保留仍然有效的进度
+		bkStorage.Set(timeKey, now.Format(time.UnixDate), 0)
+		writeState(stateB)
+		bkStorage.Set(stateKeyPrefix+"100-900", "{", 0)
+
+		r, err := newRegistrar(snapshotPath)
+		assert.NoError(t, err)
+		assert.False(t, r.recovered)
+		states := r.GetStates()
+		assert.Len(t, states, 1)
+		assert.Equal(t, stateB.Source, states[0].Source)
+
+		// 进度整体无法解析且没有快照时启动失败
+		bkStorage.Set(registrarKey, "[{", 0)
+		_, err = newRegistrar(snapshotPath)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,208 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package registrar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotVersion = 1
+	snapshotPrefix  = "states-"
+	snapshotSuffix  = ".json"
+	snapshotTmp     = ".tmp"
+)
+
+// snapshot 采集进度快照，states 为全量采集进度的 JSON 序列化内容
+type snapshot struct {
+	Version  int             `json:"version"`
+	Time     time.Time       `json:"time"`
+	Count    int             `json:"count"`
+	Checksum string          `json:"checksum"`
+	States   json.RawMessage `json:"states"`
+
+	name string
+}
+
+// snapshotter 采集进度快照管理，在进度文件之外保留 N 份带校验的全量快照
+type snapshotter struct {
+	path  string
+	count int
+}
+
+func newSnapshotter(path string, count int) *snapshotter {
+	return &snapshotter{
+		path:  path,
+		count: count,
+	}
+}
+
+func snapshotChecksum(states []byte) string {
+	sum := sha256.Sum256(states)
+	return hex.EncodeToString(sum[:])
+}
+
+// save 写入一份新的快照，并清理超出数量的旧快照
+// 先写临时文件再重命名，保证快照文件要么完整要么不存在
+func (s *snapshotter) save(states json.RawMessage, count int, now time.Time) error {
+	if err := os.MkdirAll(s.path, 0o750); err != nil {
+		return fmt.Errorf("create snapshot path(%s) error: %v", s.path, err)
+	}
+
+	// 序列化时 RawMessage 会被压缩，这里先压缩再计算校验值
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, states); err != nil {
+		return fmt.Errorf("invalid snapshot states: %v", err)
+	}
+	states = compacted.Bytes()
+
+	content, err := json.Marshal(snapshot{
+		Version:  snapshotVersion,
+		Time:     now,
+		Count:    count,
+		Checksum: snapshotChecksum(states),
+		States:   states,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal snapshot error: %v", err)
+	}
+
+	name := filepath.Join(s.path, fmt.Sprintf("%s%020d%s", snapshotPrefix, now.UnixNano(), snapshotSuffix))
+	tmpName := name + snapshotTmp
+	if err = writeFileSync(tmpName, content); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("write snapshot(%s) error: %v", tmpName, err)
+	}
+	if err = os.Rename(tmpName, name); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("rename snapshot(%s) error: %v", tmpName, err)
+	}
+	return s.rotate()
+}
+
+func writeFileSync(name string, content []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// list 返回所有快照文件，最新的在前
+func (s *snapshotter) list() ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		names = append(names, filepath.Join(s.path, name))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// rotate 只保留最新的 count 份快照，同时清理异常退出遗留的临时文件
+func (s *snapshotter) rotate() error {
+	names, err := s.list()
+	if err != nil {
+		return err
+	}
+	if len(names) > s.count {
+		for _, name := range names[s.count:] {
+			if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("remove snapshot(%s) error: %v", name, err)
+			}
+		}
+	}
+
+	tmpNames, _ := filepath.Glob(filepath.Join(s.path, snapshotPrefix+"*"+snapshotSuffix+snapshotTmp))
+	for _, name := range tmpNames {
+		_ = os.Remove(name)
+	}
+	return nil
+}
+
+// loadLatest 从新到旧查找第一份校验通过的快照，返回校验失败的快照及原因
+func (s *snapshotter) loadLatest() (*snapshot, []error) {
+	names, err := s.list()
+	if err != nil {
+		return nil, []error{fmt.Errorf("list snapshots in %s error: %v", s.path, err)}
+	}
+
+	var errs []error
+	for _, name := range names {
+		snap, err := readSnapshot(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return snap, errs
+	}
+	return nil, errs
+}
+
+func readSnapshot(name string) (*snapshot, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot(%s) error: %v", name, err)
+	}
+
+	snap := &snapshot{}
+	if err = json.Unmarshal(content, snap); err != nil {
+		return nil, fmt.Errorf("snapshot(%s) is corrupted: %v", name, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot(%s) version(%d) is not supported", name, snap.Version)
+	}
+	if checksum := snapshotChecksum(snap.States); checksum != snap.Checksum {
+		return nil, fmt.Errorf("snapshot(%s) checksum mismatch, expect=>%s, actual=>%s", name, snap.Checksum, checksum)
+	}
+	snap.name = name
+	return snap, nil
+}
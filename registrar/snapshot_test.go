@@ -0,0 +1,96 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package registrar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotter(t *testing.T) {
+	path, err := os.MkdirTemp("", "registrar_snapshots")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	s := newSnapshotter(path, 3)
+
+	// 没有任何快照
+	snap, errs := s.loadLatest()
+	assert.Nil(t, snap)
+	assert.Empty(t, errs)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		states := json.RawMessage(`[{"source": "/data/logs/test.log", "offset": ` + strconv.Itoa(i) + `}]`)
+		assert.NoError(t, s.save(states, 1, now.Add(time.Duration(i)*time.Second)))
+	}
+
+	// 只保留最新的3份快照
+	names, err := s.list()
+	assert.NoError(t, err)
+	assert.Len(t, names, 3)
+
+	snap, errs = s.loadLatest()
+	assert.Empty(t, errs)
+	assert.NotNil(t, snap)
+	assert.Equal(t, names[0], snap.name)
+	assert.Equal(t, `[{"source":"/data/logs/test.log","offset":4}]`, string(snap.States))
+	assert.True(t, now.Add(4*time.Second).Equal(snap.Time))
+
+	// 最新的快照被截断，回退到上一份有效快照
+	content, err := os.ReadFile(names[0])
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(names[0], content[:len(content)/2], 0o600))
+
+	snap, errs = s.loadLatest()
+	assert.Len(t, errs, 1)
+	assert.Equal(t, names[1], snap.name)
+	assert.Equal(t, `[{"source":"/data/logs/test.log","offset":3}]`, string(snap.States))
+
+	// 内容被篡改，校验失败
+	content, err = os.ReadFile(names[1])
+	assert.NoError(t, err)
+	var broken snapshot
+	assert.NoError(t, json.Unmarshal(content, &broken))
+	broken.States = json.RawMessage(`[{"source":"/data/logs/test.log","offset":9}]`)
+	content, err = json.Marshal(broken)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(names[1], content, 0o600))
+
+	snap, errs = s.loadLatest()
+	assert.Len(t, errs, 2)
+	assert.Equal(t, names[2], snap.name)
+
+	// 清理异常退出遗留的临时文件
+	tmpName := filepath.Join(path, snapshotPrefix+"1"+snapshotSuffix+snapshotTmp)
+	assert.NoError(t, os.WriteFile(tmpName, []byte("{"), 0o600))
+	assert.NoError(t, s.rotate())
+	_, err = os.Stat(tmpName)
+	assert.True(t, os.IsNotExist(err))
+}
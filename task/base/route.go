@@ -0,0 +1,51 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package base
+
+import (
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// routeDataIDKey 路由的目标 dataid 在 event.Meta 中的 key
+const routeDataIDKey = "route_dataid"
+
+// SetRouteDataID 设置事件路由的目标 dataid，由过滤节点按任务的路由规则设置
+// 同一行路由到多个 dataid 时各事件共享原始的 Meta，因此复制后再修改
+func SetRouteDataID(event *beat.Event, dataID int) {
+	meta := make(common.MapStr, len(event.Meta)+1)
+	for k, v := range event.Meta {
+		meta[k] = v
+	}
+	meta[routeDataIDKey] = dataID
+	event.Meta = meta
+}
+
+// GetRouteDataID 获取事件路由的目标 dataid，没有路由时返回 0，发送时使用任务的 dataid
+func GetRouteDataID(event *beat.Event) int {
+	if event.Meta == nil {
+		return 0
+	}
+	dataID, _ := event.Meta[routeDataIDKey].(int)
+	return dataID
+}
@@ -0,0 +1,110 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package base
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+)
+
+// StatelessStateType 无采集进度的事件类型，如 tcp、unix socket 等网络输入
+// 这类事件的 state 仅用于打包和填充 filename，不写入 Registrar
+const StatelessStateType = "stateless"
+
+// NewStatelessState 生成无采集进度的 state，source 用于区分数据来源
+func NewStatelessState(source string) file.State {
+	return file.State{
+		Source: source,
+		Type:   StatelessStateType,
+	}
+}
+
+// IsStatelessState 判断 state 是否无需写入 Registrar
+func IsStatelessState(state file.State) bool {
+	return state.Type == StatelessStateType
+}
+
+// AckHandler 处理非文件类型 state 的确认回调，如消息队列的 ack
+// 在 pipeline 确认发送后由 beater.AckEvents 调用，不能阻塞
+type AckHandler func(states []file.State)
+
+var (
+	ackHandlers   = map[string]AckHandler{}
+	ackObservers  []AckHandler
+	ackHandlersMu sync.RWMutex
+)
+
+// RegisterAckHandler 注册 state 类型的确认回调，该类型的 state 不写入 Registrar
+func RegisterAckHandler(stateType string, handler AckHandler) {
+	ackHandlersMu.Lock()
+	defer ackHandlersMu.Unlock()
+	ackHandlers[stateType] = handler
+}
+
+// GetAckHandler 获取 state 类型的确认回调
+func GetAckHandler(stateType string) (AckHandler, bool) {
+	ackHandlersMu.RLock()
+	defer ackHandlersMu.RUnlock()
+	handler, ok := ackHandlers[stateType]
+	return handler, ok
+}
+
+// RegisterAckObserver 注册文件采集进度的确认回调，state 仍然写入 Registrar
+// 用于在数据确认发送后才能执行的动作，如回填完成标记
+func RegisterAckObserver(observer AckHandler) {
+	ackHandlersMu.Lock()
+	defer ackHandlersMu.Unlock()
+	ackObservers = append(ackObservers, observer)
+}
+
+// GetAckObservers 获取文件采集进度的确认回调
+func GetAckObservers() []AckHandler {
+	ackHandlersMu.RLock()
+	defer ackHandlersMu.RUnlock()
+	return ackObservers
+}
+
+// IsFileState 判断 state 是否为文件采集进度，需要写入 Registrar
+func IsFileState(state file.State) bool {
+	if IsStatelessState(state) {
+		return false
+	}
+	_, ok := GetAckHandler(state.Type)
+	return !ok
+}
+
+// DroppedStateData 事件被过滤或丢弃时，由回调确认的 state 以采集进度类事件继续发送，
+// 否则对应的消息一直处于未确认状态；文件采集进度由之后的事件更新，返回 nil
+func DroppedStateData(state file.State) *util.Data {
+	if IsStatelessState(state) {
+		return nil
+	}
+	if _, ok := GetAckHandler(state.Type); !ok {
+		return nil
+	}
+	data := &util.Data{}
+	data.SetState(state)
+	return data
+}
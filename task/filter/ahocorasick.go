@@ -0,0 +1,150 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+// ahoCorasick 多模式字符串匹配自动机，一次扫描找出文本中出现的所有模式
+type ahoCorasick struct {
+	root     [256]int32 // 根节点的完整转移表
+	edges    [][]acEdge // 其余节点的转移，按字节排序
+	fail     []int32
+	dictLink []int32   // 沿失败链找到的下一个有输出的节点，没有时为 -1
+	outputs  [][]int32 // 节点自身对应的模式编号
+}
+
+type acEdge struct {
+	b    byte
+	next int32
+}
+
+// newAhoCorasick 构建自动机，模式编号为 patterns 中的下标，空模式不参与匹配
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{
+		edges:    [][]acEdge{nil},
+		fail:     []int32{0},
+		dictLink: []int32{-1},
+		outputs:  [][]int32{nil},
+	}
+
+	// 构建 trie
+	for id, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		state := int32(0)
+		for i := 0; i < len(pattern); i++ {
+			next := ac.child(state, pattern[i])
+			if next < 0 {
+				next = int32(len(ac.edges))
+				ac.edges = append(ac.edges, nil)
+				ac.fail = append(ac.fail, 0)
+				ac.dictLink = append(ac.dictLink, -1)
+				ac.outputs = append(ac.outputs, nil)
+				ac.addEdge(state, pattern[i], next)
+			}
+			state = next
+		}
+		ac.outputs[state] = append(ac.outputs[state], int32(id))
+	}
+
+	// 按层计算失败链接
+	queue := make([]int32, 0, len(ac.edges))
+	for _, e := range ac.edges[0] {
+		queue = append(queue, e.next)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, e := range ac.edges[state] {
+			f := ac.fail[state]
+			for f > 0 && ac.child(f, e.b) < 0 {
+				f = ac.fail[f]
+			}
+			if next := ac.child(f, e.b); next >= 0 {
+				f = next
+			} else {
+				f = 0
+			}
+			ac.fail[e.next] = f
+			if len(ac.outputs[f]) > 0 {
+				ac.dictLink[e.next] = f
+			} else {
+				ac.dictLink[e.next] = ac.dictLink[f]
+			}
+			queue = append(queue, e.next)
+		}
+	}
+
+	// 根节点的转移表，没有对应子节点时停留在根节点
+	for _, e := range ac.edges[0] {
+		ac.root[e.b] = e.next
+	}
+	return ac
+}
+
+func (ac *ahoCorasick) child(state int32, b byte) int32 {
+	for _, e := range ac.edges[state] {
+		if e.b == b {
+			return e.next
+		}
+		if e.b > b {
+			break
+		}
+	}
+	return -1
+}
+
+func (ac *ahoCorasick) addEdge(state int32, b byte, next int32) {
+	edges := ac.edges[state]
+	i := len(edges)
+	for i > 0 && edges[i-1].b > b {
+		i--
+	}
+	edges = append(edges, acEdge{})
+	copy(edges[i+1:], edges[i:])
+	edges[i] = acEdge{b: b, next: next}
+	ac.edges[state] = edges
+}
+
+// scan 扫描文本，对出现的每个模式调用 fn，同一模式可能被多次回调
+func (ac *ahoCorasick) scan(text string, fn func(id int32)) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		for {
+			if state == 0 {
+				state = ac.root[b]
+				break
+			}
+			if next := ac.child(state, b); next >= 0 {
+				state = next
+				break
+			}
+			state = ac.fail[state]
+		}
+		for s := state; s > 0; s = ac.dictLink[s] {
+			for _, id := range ac.outputs[s] {
+				fn(id)
+			}
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// 条件的计算方式
+const (
+	atomContains = iota // 子串匹配，同一列的所有子串由一个 Aho-Corasick 自动机一次扫描完成
+	atomEqual           // 完全相等，由哈希表完成
+	atomRegex           // 正则匹配，需要时才计算，相同的正则只计算一次
+	atomFunc            // 其他操作符，使用条件自身的匹配函数
+)
+
+// conditionSpec 编译前的过滤条件，与 config.ConditionConfig 对应
+type conditionSpec struct {
+	Index   int
+	Op      string
+	Value   string
+	Matcher func(text string) bool
+}
+
+// branchSpec 编译前的处理分支，即共享同一个过滤节点的一个 processor
+type branchSpec struct {
+	ID        string
+	HasFilter bool
+	Groups    [][]conditionSpec // 组之间为或，组内条件为与
+}
+
+// atom 去重后的基本匹配单元，相同列、相同方式、相同内容的条件共享同一个 atom
+type atom struct {
+	column int // 0 表示整行
+	kind   int
+	value  string
+	re     *regexp.Regexp
+	fn     func(text string) bool
+}
+
+// condRef 组内需要单独计算的条件
+type condRef struct {
+	atom   int
+	negate bool
+}
+
+// group 编译后的过滤条件组
+type group struct {
+	branch  int
+	need    int       // 需要命中的正向子串及相等条件的数量，由扫描结果计数
+	lazy    []condRef // 计数之外的条件：正则、匹配函数以及所有反向条件
+	columns []int     // 条件涉及的列，列不存在时条件不满足
+	invalid bool      // 存在无法计算的条件，始终不满足
+}
+
+// column 一列上的所有子串及相等条件
+type column struct {
+	index   int
+	ac      *ahoCorasick
+	acAtoms []int          // 自动机的模式编号 => atom
+	equals  map[string]int // 相等条件的值 => atom
+	empty   []int          // 空字符串的子串条件，列存在即命中
+}
+
+// compiledFilter 一个过滤节点上所有分支的过滤条件编译结果
+// 每行数据在每一列上只扫描一次，得到命中的 atom 后通过计数找出可能满足的组，再计算组内剩余的条件
+type compiledFilter struct {
+	branches   []string
+	always     []int // 没有过滤条件的分支
+	atoms      []atom
+	columns    []*column
+	groups     []group
+	atomGroups [][]int // 正向子串及相等 atom => 以其计数的组
+	zeroNeed   []int   // 不需要计数的组，每行都需要计算
+}
+
+// literalOf 正则仅由字面量以及前后的 .* 组成时，等价于子串匹配
+func literalOf(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+
+	literal, found := "", false
+	for _, sub := range subs {
+		switch {
+		case sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 && !found:
+			literal, found = string(sub.Rune), true
+		case sub.Op == syntax.OpStar && (sub.Sub[0].Op == syntax.OpAnyCharNotNL || sub.Sub[0].Op == syntax.OpAnyChar):
+			// 可以匹配空串的 .* 不影响是否匹配
+		case sub.Op == syntax.OpEmptyMatch:
+		default:
+			return "", false
+		}
+	}
+	// 非法的 utf-8 字节在正则中按 U+FFFD 匹配，与子串匹配不一致
+	if !found || strings.ContainsRune(literal, utf8.RuneError) {
+		return "", false
+	}
+	return literal, true
+}
+
+// compileFilter 编译所有分支的过滤条件
+func compileFilter(branches []branchSpec) *compiledFilter {
+	c := &compiledFilter{}
+	atomIDs := make(map[string]int)
+	columns := make(map[int]*column)
+	addAtom := func(a atom) int {
+		key := fmt.Sprintf("%d/%d/%s", a.column, a.kind, a.value)
+		if a.kind == atomFunc {
+			// 匹配函数无法比较，不去重
+			key = fmt.Sprintf("%s/%d", key, len(c.atoms))
+		}
+		if id, ok := atomIDs[key]; ok {
+			return id
+		}
+		id := len(c.atoms)
+		atomIDs[key] = id
+		c.atoms = append(c.atoms, a)
+		c.atomGroups = append(c.atomGroups, nil)
+		if a.kind == atomContains || a.kind == atomEqual {
+			col, ok := columns[a.column]
+			if !ok {
+				col = &column{index: a.column, equals: make(map[string]int)}
+				columns[a.column] = col
+				c.columns = append(c.columns, col)
+			}
+			switch {
+			case a.kind == atomEqual:
+				col.equals[a.value] = id
+			case a.value == "":
+				col.empty = append(col.empty, id)
+			default:
+				col.acAtoms = append(col.acAtoms, id)
+			}
+		}
+		return id
+	}
+
+	for branchID, branch := range branches {
+		c.branches = append(c.branches, branch.ID)
+		if !branch.HasFilter {
+			c.always = append(c.always, branchID)
+			continue
+		}
+		for _, conditions := range branch.Groups {
+			g := group{branch: branchID}
+			counted := make(map[int]struct{})
+			seenColumns := make(map[int]struct{})
+			for _, cond := range conditions {
+				a, negate, ok := toAtom(cond)
+				if !ok {
+					g.invalid = true
+					break
+				}
+				if _, seen := seenColumns[a.column]; !seen {
+					seenColumns[a.column] = struct{}{}
+					g.columns = append(g.columns, a.column)
+				}
+				id := addAtom(a)
+				if !negate && (a.kind == atomContains || a.kind == atomEqual) {
+					if _, ok := counted[id]; !ok {
+						counted[id] = struct{}{}
+						g.need++
+					}
+					continue
+				}
+				g.lazy = append(g.lazy, condRef{atom: id, negate: negate})
+			}
+			groupID := len(c.groups)
+			c.groups = append(c.groups, g)
+			if g.invalid {
+				continue
+			}
+			for id := range counted {
+				c.atomGroups[id] = append(c.atomGroups[id], groupID)
+			}
+			if g.need == 0 {
+				c.zeroNeed = append(c.zeroNeed, groupID)
+			}
+		}
+	}
+
+	for _, col := range c.columns {
+		patterns := make([]string, 0, len(col.acAtoms))
+		for _, id := range col.acAtoms {
+			patterns = append(patterns, c.atoms[id].value)
+		}
+		col.ac = newAhoCorasick(patterns)
+	}
+	return c
+}
+
+// toAtom 将条件转换为 atom，返回是否为反向条件
+func toAtom(cond conditionSpec) (atom, bool, bool) {
+	a := atom{column: cond.Index, value: cond.Value}
+	if a.column < 0 {
+		a.column = 0
+	}
+	switch cond.Op {
+	case "=", "eq":
+		a.kind = atomEqual
+		return a, false, true
+	case "!=", "neq":
+		a.kind = atomEqual
+		return a, true, true
+	case "include":
+		a.kind = atomContains
+		return a, false, true
+	case "exclude":
+		a.kind = atomContains
+		return a, true, true
+	case "regex", "nregex":
+		negate := cond.Op == "nregex"
+		if literal, ok := literalOf(cond.Value); ok {
+			a.kind, a.value = atomContains, literal
+			return a, negate, true
+		}
+		re, err := regexp.Compile(cond.Value)
+		if err == nil {
+			a.kind, a.re = atomRegex, re
+			return a, negate, true
+		}
+	}
+	if cond.Matcher == nil {
+		return a, false, false
+	}
+	a.kind, a.fn = atomFunc, cond.Matcher
+	return a, false, true
+}
+
+// matchState 单行匹配时的临时状态，通过行号区分不同行的结果，避免每行清空
+type matchState struct {
+	line       uint32
+	atomLine   []uint32
+	atomHit    []bool
+	hitLine    []uint32
+	hits       []int
+	candidates []int
+	matched    []bool
+}
+
+// reset 开始新的一行，编译结果变化时重新分配
+func (st *matchState) reset(c *compiledFilter) {
+	if len(st.atomLine) != len(c.atoms) || len(st.hitLine) != len(c.groups) || len(st.matched) != len(c.branches) {
+		*st = matchState{
+			atomLine: make([]uint32, len(c.atoms)),
+			atomHit:  make([]bool, len(c.atoms)),
+			hitLine:  make([]uint32, len(c.groups)),
+			hits:     make([]int, len(c.groups)),
+			matched:  make([]bool, len(c.branches)),
+		}
+	}
+	st.line++
+	if st.line == 0 {
+		// 行号回绕时清空历史结果
+		for i := range st.atomLine {
+			st.atomLine[i] = 0
+		}
+		for i := range st.hitLine {
+			st.hitLine[i] = 0
+		}
+		st.line = 1
+	}
+	st.candidates = st.candidates[:0]
+	for i := range st.matched {
+		st.matched[i] = false
+	}
+}
+
+// columnText 获取列的内容，index 为 0 时为整行
+func columnText(words []string, text string, index int) (string, bool) {
+	if index <= 0 {
+		return text, true
+	}
+	if len(words) < index {
+		return "", false
+	}
+	return words[index-1], true
+}
+
+// hit 记录命中的子串或相等 atom，并累加对应组的计数
+func (c *compiledFilter) hit(st *matchState, id int) {
+	if st.atomLine[id] == st.line {
+		return
+	}
+	st.atomLine[id] = st.line
+	st.atomHit[id] = true
+	for _, g := range c.atomGroups[id] {
+		if st.hitLine[g] != st.line {
+			st.hitLine[g] = st.line
+			st.hits[g] = 0
+		}
+		st.hits[g]++
+		if st.hits[g] == c.groups[g].need {
+			st.candidates = append(st.candidates, g)
+		}
+	}
+}
+
+// value 获取 atom 的结果，正则及匹配函数在第一次需要时计算
+func (c *compiledFilter) value(st *matchState, words []string, text string, id int) bool {
+	if st.atomLine[id] == st.line {
+		return st.atomHit[id]
+	}
+	a := c.atoms[id]
+	result := false
+	if s, ok := columnText(words, text, a.column); ok {
+		switch a.kind {
+		case atomRegex:
+			result = a.re.MatchString(s)
+		case atomFunc:
+			result = a.fn(s)
+		}
+	}
+	st.atomLine[id] = st.line
+	st.atomHit[id] = result
+	return result
+}
+
+// match 计算一行数据命中的分支，返回值在下一次调用前有效
+func (c *compiledFilter) match(words []string, text string, st *matchState) []bool {
+	st.reset(c)
+	for _, branch := range c.always {
+		st.matched[branch] = true
+	}
+
+	// 每一列只扫描一次
+	for _, col := range c.columns {
+		s, ok := columnText(words, text, col.index)
+		if !ok {
+			continue
+		}
+		for _, id := range col.empty {
+			c.hit(st, id)
+		}
+		if id, ok := col.equals[s]; ok {
+			c.hit(st, id)
+		}
+		if len(col.acAtoms) > 0 {
+			col.ac.scan(s, func(pattern int32) {
+				c.hit(st, col.acAtoms[pattern])
+			})
+		}
+	}
+
+	check := func(g int) {
+		grp := &c.groups[g]
+		if st.matched[grp.branch] {
+			return
+		}
+		for _, index := range grp.columns {
+			if _, ok := columnText(words, text, index); !ok {
+				return
+			}
+		}
+		for _, ref := range grp.lazy {
+			if c.value(st, words, text, ref.atom) == ref.negate {
+				return
+			}
+		}
+		st.matched[grp.branch] = true
+	}
+	for _, g := range st.candidates {
+		check(g)
+	}
+	for _, g := range c.zeroNeed {
+		check(g)
+	}
+	return st.matched
+}
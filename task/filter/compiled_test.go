@@ -0,0 +1,257 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// specMatcher 与 config 中的操作符实现一致，用于对照编译后的结果
+func specMatcher(op, value string) func(string) bool {
+	switch op {
+	case "=", "eq":
+		return func(s string) bool { return s == value }
+	case "!=", "neq":
+		return func(s string) bool { return s != value }
+	case "include":
+		return func(s string) bool { return strings.Contains(s, value) }
+	case "exclude":
+		return func(s string) bool { return !strings.Contains(s, value) }
+	case "regex":
+		re := regexp.MustCompile(value)
+		return re.MatchString
+	case "nregex":
+		re := regexp.MustCompile(value)
+		return func(s string) bool { return !re.MatchString(s) }
+	}
+	return nil
+}
+
+func cond(index int, op, value string) conditionSpec {
+	return conditionSpec{Index: index, Op: op, Value: value, Matcher: specMatcher(op, value)}
+}
+
+// naiveMatch 与 Filters.Handle 的逻辑一致
+func naiveMatch(branch branchSpec, words []string, text string) bool {
+	if !branch.HasFilter {
+		return true
+	}
+	for _, conditions := range branch.Groups {
+		access := true
+		for _, c := range conditions {
+			if c.Matcher == nil {
+				access = false
+				break
+			}
+			if c.Index <= 0 {
+				if !c.Matcher(text) {
+					access = false
+					break
+				}
+				continue
+			}
+			if len(words) < c.Index || !c.Matcher(words[c.Index-1]) {
+				access = false
+				break
+			}
+		}
+		if access {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAhoCorasick(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "", "e"}
+	ac := newAhoCorasick(patterns)
+
+	found := map[string]int{}
+	ac.scan("ushers", func(id int32) {
+		found[patterns[id]]++
+	})
+	assert.Equal(t, map[string]int{"he": 1, "she": 1, "hers": 1, "e": 1}, found)
+
+	found = map[string]int{}
+	ac.scan("hishe", func(id int32) {
+		found[patterns[id]]++
+	})
+	assert.Equal(t, map[string]int{"his": 1, "she": 1, "he": 1, "e": 1}, found)
+}
+
+func TestLiteralOf(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"error":        "error",
+		".*info.*":     "info",
+		"time.*out":    "",
+		"(?i)error":    "",
+		"^error":       "",
+		"err(or)?":     "",
+		".*":           "",
+		"中文":           "中文",
+		`\[ERROR\]`:    "[ERROR]",
+		"a|b":          "",
+		".*timeout":    "timeout",
+		"(?s).*info.*": "info",
+	} {
+		literal, ok := literalOf(pattern)
+		assert.Equal(t, expected != "", ok, pattern)
+		assert.Equal(t, expected, literal, pattern)
+	}
+}
+
+func TestCompiledFilter(t *testing.T) {
+	branches := []branchSpec{
+		{ID: "all"},
+		{ID: "error", HasFilter: true, Groups: [][]conditionSpec{{cond(-1, "include", "ERROR")}}},
+		{ID: "warn-or-error", HasFilter: true, Groups: [][]conditionSpec{
+			{cond(1, "=", "WARN")},
+			{cond(0, "regex", ".*ERROR.*"), cond(2, "!=", "debug")},
+		}},
+		{ID: "not-debug", HasFilter: true, Groups: [][]conditionSpec{{cond(2, "neq", "debug"), cond(3, "exclude", "heartbeat")}}},
+		{ID: "timeout", HasFilter: true, Groups: [][]conditionSpec{{cond(3, "regex", "time.*out")}}},
+		{ID: "empty-group", HasFilter: true, Groups: [][]conditionSpec{{}}},
+		{ID: "no-group", HasFilter: true},
+		{ID: "invalid", HasFilter: true, Groups: [][]conditionSpec{{{Index: 1, Op: "unknown", Value: "x"}}}},
+	}
+	c := compileFilter(branches)
+	st := &matchState{}
+
+	matchedIDs := func(text string) []string {
+		words := strings.Split(text, "|")
+		var ids []string
+		for i, ok := range c.match(words, text, st) {
+			if ok {
+				ids = append(ids, c.branches[i])
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	assert.Equal(t, []string{"all", "empty-group", "error", "not-debug", "warn-or-error"}, matchedIDs("ERROR|app|failed"))
+	assert.Equal(t, []string{"all", "empty-group", "error"}, matchedIDs("ERROR|debug|x"))
+	assert.Equal(t, []string{"all", "empty-group", "not-debug", "timeout", "warn-or-error"}, matchedIDs("WARN|app|time is out"))
+	// 列不存在时条件不满足
+	assert.Equal(t, []string{"all", "empty-group"}, matchedIDs("INFO"))
+}
+
+// randomBranches 生成随机的过滤条件，覆盖所有操作符以及列不存在的情况
+func randomBranches(r *rand.Rand, n int, words []string) []branchSpec {
+	ops := []string{"=", "eq", "!=", "neq", "include", "exclude", "regex", "nregex"}
+	branches := make([]branchSpec, 0, n)
+	for i := 0; i < n; i++ {
+		branch := branchSpec{ID: fmt.Sprintf("branch-%d", i), HasFilter: r.Intn(10) > 0}
+		for g := r.Intn(3) + 1; g > 0; g-- {
+			var conditions []conditionSpec
+			for k := r.Intn(3) + 1; k > 0; k-- {
+				op := ops[r.Intn(len(ops))]
+				value := words[r.Intn(len(words))]
+				if r.Intn(4) == 0 {
+					runes := []rune(value)
+					value = string(runes[:r.Intn(len(runes)+1)])
+				}
+				if strings.HasSuffix(op, "regex") && r.Intn(2) == 0 {
+					value = ".*" + regexp.QuoteMeta(value) + "[0-9]?"
+				}
+				conditions = append(conditions, cond(r.Intn(5)-1, op, value))
+			}
+			branch.Groups = append(branch.Groups, conditions)
+		}
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+func TestCompiledFilterRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vocabulary := []string{"ERROR", "WARN", "INFO", "debug", "app", "db", "timeout", "user1", "user12", "中文", "a"}
+	branches := randomBranches(r, 200, vocabulary)
+	c := compileFilter(branches)
+	st := &matchState{}
+
+	for i := 0; i < 2000; i++ {
+		words := make([]string, r.Intn(5))
+		for j := range words {
+			words[j] = vocabulary[r.Intn(len(vocabulary))] + strings.Repeat("1", r.Intn(2))
+		}
+		text := strings.Join(words, "|")
+		result := c.match(words, text, st)
+		for b, branch := range branches {
+			if !assert.Equal(t, naiveMatch(branch, words, text), result[b], "%s: %+v", text, branch) {
+				return
+			}
+		}
+	}
+}
+
+// keywordBranches 模拟大量按关键字过滤的任务共享同一个过滤节点
+func keywordBranches(n int) []branchSpec {
+	branches := make([]branchSpec, 0, n)
+	for i := 0; i < n; i++ {
+		branches = append(branches, branchSpec{
+			ID:        fmt.Sprintf("processor-%d", i),
+			HasFilter: true,
+			Groups: [][]conditionSpec{
+				{cond(-1, "include", fmt.Sprintf("keyword-%d ", i))},
+				{cond(2, "=", fmt.Sprintf("module-%d", i)), cond(0, "exclude", "heartbeat")},
+				{cond(0, "regex", fmt.Sprintf(".*trace_id=%d;.*", i))},
+			},
+		})
+	}
+	return branches
+}
+
+var benchmarkLine = "2021-03-04 05:06:07|module-7|INFO|request handled by keyword-42 in 10ms, trace_id=99;"
+
+func BenchmarkFilterMatch(b *testing.B) {
+	text := benchmarkLine
+	words := strings.Split(text, "|")
+	for i := range words {
+		words[i] = strings.TrimSpace(words[i])
+	}
+	for _, n := range []int{1, 100, 1000} {
+		branches := keywordBranches(n)
+		b.Run(fmt.Sprintf("naive/tasks=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, branch := range branches {
+					naiveMatch(branch, words, text)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("compiled/tasks=%d", n), func(b *testing.B) {
+			c := compileFilter(branches)
+			st := &matchState{}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.match(words, text, st)
+			}
+		})
+	}
+}
@@ -23,12 +23,16 @@
 package filter
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
 	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
 	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/monitoring"
 
 	"github.com/TencentBlueKing/bkunifylogbeat/config"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
@@ -52,6 +56,16 @@ type Filters struct {
 	filterMaxIndex int
 
 	taskConfigMaps map[string]*config.TaskConfig
+
+	compiled atomic.Value // *compiledTasks，任务配置变化时重新编译
+	state    matchState   // 仅在 Run 中使用
+	targets  []int        // 路由的目标 dataid，仅在 Run 中使用
+
+	unmatched map[string]*monitoring.Int // 配置了路由的任务没有命中任何规则的行数，key 为 ProcessorID
+
+	stats     map[string]*filterStats // 开启了命中统计的任务，key 为 ProcessorID
+	statsList atomic.Value            // []*filterStats
+	line      uint64                  // 已处理的行数，用于抽样，仅在 Run 中使用
 }
 
 // GetFilters get filter
@@ -88,6 +102,8 @@ func NewFilters(taskCfg *config.TaskConfig, taskNode *base.TaskNode) (*Filters,
 		Delimiter: taskCfg.Delimiter,
 
 		taskConfigMaps: map[string]*config.TaskConfig{},
+		unmatched:      map[string]*monitoring.Int{},
+		stats:          map[string]*filterStats{},
 	}
 	fil.MergeFilterConfig(taskCfg)
 
@@ -128,7 +144,118 @@ func (f *Filters) MergeFilterConfig(taskCfg *config.TaskConfig) {
 			}
 		}
 	}
+	if maxIndex := maxRouteIndex(taskCfg); f.filterMaxIndex < maxIndex {
+		f.filterMaxIndex = maxIndex
+	}
 	f.taskConfigMaps[taskCfg.ProcessorID] = taskCfg
+	// 路由未命中的指标每个任务只创建一次，不随重新编译创建
+	if _, ok := f.unmatched[taskCfg.ProcessorID]; !ok && len(taskCfg.Routes) > 0 {
+		f.unmatched[taskCfg.ProcessorID] = bkmonitoring.NewIntWithDataID(taskCfg.DataID, "route_unmatched")
+	}
+	f.compiled.Store(compileTaskConfigs(f.taskConfigMaps, f.unmatched))
+	f.mergeFilterStats(taskCfg)
+}
+
+// mergeFilterStats 更新任务的命中统计
+func (f *Filters) mergeFilterStats(taskCfg *config.TaskConfig) {
+	if taskCfg.HasFilter && taskCfg.FilterStats.Enabled {
+		branch := newBranchSpec(taskCfg.ProcessorID, taskCfg)
+		stats := newFilterStats(taskCfg.DataID, taskCfg.FilterStats.SampleRate, branch.Groups)
+		f.stats[taskCfg.ProcessorID] = stats
+		logp.L.Infof("filter(%s) stats of task(%d) enabled, sample_rate(%d), %s",
+			f.ID, taskCfg.DataID, taskCfg.FilterStats.SampleRate, stats)
+	} else {
+		delete(f.stats, taskCfg.ProcessorID)
+	}
+
+	statsList := make([]*filterStats, 0, len(f.stats))
+	for _, stats := range f.stats {
+		statsList = append(statsList, stats)
+	}
+	f.statsList.Store(statsList)
+}
+
+// compileTaskConfigs 将所有任务的过滤条件及路由规则编译为一个匹配器，任务按 ProcessorID 排序，路由规则的分支在所有任务之后
+// unmatched 为各任务路由未命中的指标，key 为 ProcessorID
+func compileTaskConfigs(taskConfigMaps map[string]*config.TaskConfig, unmatched map[string]*monitoring.Int) *compiledTasks {
+	ids := make([]string, 0, len(taskConfigMaps))
+	for processorID := range taskConfigMaps {
+		ids = append(ids, processorID)
+	}
+	sort.Strings(ids)
+
+	c := &compiledTasks{tasks: ids, routers: make([]*router, len(ids))}
+	branches := make([]branchSpec, 0, len(ids))
+	for _, processorID := range ids {
+		branches = append(branches, newBranchSpec(processorID, taskConfigMaps[processorID]))
+	}
+	for i, processorID := range ids {
+		taskConfig := taskConfigMaps[processorID]
+		if len(taskConfig.Routes) == 0 {
+			continue
+		}
+		r := &router{
+			all:           taskConfig.RouteMode == config.RouteModeAll,
+			defaultDataID: taskConfig.RouteDefaultDataID,
+			unmatched:     unmatched[processorID],
+		}
+		for j, route := range taskConfig.Routes {
+			r.dataIDs = append(r.dataIDs, route.DataID)
+			r.branches = append(r.branches, len(branches))
+			branches = append(branches, branchSpec{
+				ID:        fmt.Sprintf("%s/route-%d", processorID, j),
+				HasFilter: true,
+				Groups:    [][]conditionSpec{toConditionSpecs(route.Conditions)},
+			})
+		}
+		c.routers[i] = r
+		c.routed = true
+	}
+	c.filter = compileFilter(branches)
+	return c
+}
+
+// maxRouteIndex 路由条件中最大的列
+func maxRouteIndex(taskCfg *config.TaskConfig) int {
+	maxIndex := 0
+	for _, route := range taskCfg.Routes {
+		if n := len(route.Conditions); n > 0 && route.Conditions[n-1].Index > maxIndex {
+			maxIndex = route.Conditions[n-1].Index
+		}
+	}
+	return maxIndex
+}
+
+// newBranchSpec 任务的过滤条件
+func newBranchSpec(processorID string, taskConfig *config.TaskConfig) branchSpec {
+	branch := branchSpec{ID: processorID, HasFilter: taskConfig.HasFilter}
+	for _, filterConfig := range taskConfig.Filters {
+		branch.Groups = append(branch.Groups, toConditionSpecs(filterConfig.Conditions))
+	}
+	return branch
+}
+
+func toConditionSpecs(conditionConfigs []config.ConditionConfig) []conditionSpec {
+	conditions := make([]conditionSpec, 0, len(conditionConfigs))
+	for _, condition := range conditionConfigs {
+		conditions = append(conditions, conditionSpec{
+			Index:   condition.Index,
+			Op:      condition.Op,
+			Value:   condition.Key,
+			Matcher: condition.GetMatcher(),
+		})
+	}
+	return conditions
+}
+
+// observeStats 按各任务的抽样频率统计过滤条件的命中情况
+func (f *Filters) observeStats(words []string, text string) {
+	f.line++
+	for _, stats := range f.statsList.Load().([]*filterStats) {
+		if stats.sampling(f.line) {
+			stats.observe(words, text)
+		}
+	}
 }
 
 func (f *Filters) Run() {
@@ -153,50 +280,66 @@ func (f *Filters) Run() {
 // singleFilter 常规单行处理模式
 func (f *Filters) singleFilter(data *util.Data) {
 	event := &data.Event
+	compiled := f.compiled.Load().(*compiledTasks)
 
 	var text string
 	var ok bool
 	text, ok = event.Fields["data"].(string)
-	if !ok || f.Delimiter == "" {
+	if !ok || (f.Delimiter == "" && !compiled.routed) {
 		for _, out := range f.GetOuts() {
-			select {
-			case <-f.End:
-				logp.L.Infof("node filter(%s) is done", f.ID)
+			if !f.send(out, data, 1) {
 				return
-			case out <- data:
-				filterHandledTotal.Add(1)
 			}
 		}
 		return
 	}
 
-	// index为N时，数组切分最少需要分成N+1段
-	words := strings.SplitN(text, f.Delimiter, f.filterMaxIndex+1)
+	words := f.split(text)
 	for i := range words {
 		words[i] = strings.TrimSpace(words[i])
 	}
-	for processorID, taskConfig := range f.taskConfigMaps {
-		matched := f.Handle(words, text, taskConfig)
-		if !matched {
-			// update metric
-			{
-				filterDroppedTotal.Add(1)
-				f.ForEachTaskNodeBy(processorID, func(tNode *base.TaskNode) {
-					base.CrawlerDropped.Add(1)
-					tNode.CrawlerDropped.Add(1)
-				})
+	matched := compiled.filter.match(words, text, &f.state)
+	f.observeStats(words, text)
+	for i, processorID := range compiled.tasks {
+		out, ok := f.Outs[processorID]
+		if !matched[i] {
+			f.dropped(processorID, 1)
+			if ok && !f.sendDroppedState(out, data) {
+				return
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		r := compiled.routers[i]
+		if r == nil {
+			if !f.send(out, data, 1) {
+				return
 			}
 			continue
 		}
 
-		out, ok := f.Outs[processorID]
-		if ok {
-			select {
-			case <-f.End:
-				logp.L.Infof("node filter(%s) is done", f.ID)
+		// 按路由规则复制到每个目标 dataid
+		f.targets = r.route(matched, f.targets)
+		if len(f.targets) == 0 {
+			f.dropped(processorID, 1)
+			if !f.sendDroppedState(out, data) {
+				return
+			}
+			continue
+		}
+		for _, dataID := range f.targets {
+			// 各 dataid 的事件在后续处理中可能被修改，因此复制字段
+			routedEvent := data.GetEvent()
+			if routedEvent.Fields != nil {
+				routedEvent.Fields = routedEvent.Fields.Clone()
+			}
+			base.SetRouteDataID(&routedEvent, dataID)
+			routedData := &util.Data{Event: routedEvent}
+			routedData.SetState(data.GetState())
+			if !f.send(out, routedData, 1) {
 				return
-			case out <- data:
-				filterHandledTotal.Add(1)
 			}
 		}
 	}
@@ -205,70 +348,141 @@ func (f *Filters) singleFilter(data *util.Data) {
 // batchFilter 针对多行文本的批量处理
 func (f *Filters) batchFilter(data *util.Data) {
 	texts := data.Event.GetTexts()
+	compiled := f.compiled.Load().(*compiledTasks)
 
-	if f.Delimiter == "" {
+	if f.Delimiter == "" && !compiled.routed {
 		for _, out := range f.GetOuts() {
-			select {
-			case <-f.End:
-				logp.L.Infof("node filter(%s) is done", f.ID)
+			if !f.send(out, data, int64(len(texts))) {
 				return
-			case out <- data:
-				filterHandledTotal.Add(int64(len(texts)))
 			}
 		}
 		return
 	}
 
-	wordsInTexts := make([][]string, 0, len(texts))
+	// 每行只匹配一次，得到命中的分支
+	textsByBranch := make([][]string, len(compiled.tasks))
+	routed := make([]routedTexts, len(compiled.tasks))
 	for _, text := range texts {
-		wordsInTexts = append(wordsInTexts, strings.SplitN(text, f.Delimiter, f.filterMaxIndex+1))
-	}
-
-	for processorID, taskConfig := range f.taskConfigMaps {
-
-		matchedTexts := make([]string, 0, len(texts))
-
-		for idx, words := range wordsInTexts {
-			matched := f.Handle(words, texts[idx], taskConfig)
-			if matched {
-				matchedTexts = append(matchedTexts, texts[idx])
+		words := f.split(text)
+		f.observeStats(words, text)
+		matched := compiled.filter.match(words, text, &f.state)
+		for i := range compiled.tasks {
+			if !matched[i] {
 				continue
 			}
+			textsByBranch[i] = append(textsByBranch[i], text)
+			if r := compiled.routers[i]; r != nil {
+				f.targets = r.route(matched, f.targets)
+				if len(f.targets) == 0 {
+					routed[i].dropped++
+				}
+				for _, dataID := range f.targets {
+					routed[i].add(dataID, text)
+				}
+			}
 		}
+	}
+
+	for i, processorID := range compiled.tasks {
+		matchedTexts := textsByBranch[i]
 
 		unmatchedCount := int64(len(texts) - len(matchedTexts))
 
 		if unmatchedCount > 0 {
-			// update metric
-			filterDroppedTotal.Add(unmatchedCount)
-			f.ForEachTaskNodeBy(processorID, func(tNode *base.TaskNode) {
-				base.CrawlerDropped.Add(unmatchedCount)
-				tNode.CrawlerDropped.Add(unmatchedCount)
-			})
+			f.dropped(processorID, unmatchedCount)
 		}
 
-		if len(matchedTexts) > 0 {
-			if out, ok := f.Outs[processorID]; ok {
-
-				// 复制一个新的事件出来，只修改 Texts 字段
-				event := data.GetEvent()
-				event.Texts = matchedTexts
-				taskData := &util.Data{Event: event}
-				taskData.SetState(data.GetState())
-
-				select {
-				case <-f.End:
-					logp.L.Infof("node filter(%s) is done", f.ID)
-					return
-				case out <- taskData:
-					filterHandledTotal.Add(int64(len(matchedTexts)))
-				}
+		out, ok := f.Outs[processorID]
+		if !ok {
+			continue
+		}
+		if len(matchedTexts) == 0 {
+			if !f.sendDroppedState(out, data) {
+				return
+			}
+			continue
+		}
+		if compiled.routers[i] == nil {
+			if !f.send(out, f.textsData(data, matchedTexts, 0), int64(len(matchedTexts))) {
+				return
 			}
+			continue
 		}
+
+		// 按目标 dataid 拆分，没有目标的行被丢弃
+		if routed[i].dropped > 0 {
+			f.dropped(processorID, int64(routed[i].dropped))
+		}
+		if len(routed[i].dataIDs) == 0 {
+			if !f.sendDroppedState(out, data) {
+				return
+			}
+			continue
+		}
+		for j, dataID := range routed[i].dataIDs {
+			if !f.send(out, f.textsData(data, routed[i].texts[j], dataID), int64(len(routed[i].texts[j]))) {
+				return
+			}
+		}
+	}
+}
+
+// split 按分隔符切分，index为N时，数组切分最少需要分成N+1段
+// 没有分隔符时只能整行匹配
+func (f *Filters) split(text string) []string {
+	if f.Delimiter == "" {
+		return nil
+	}
+	return strings.SplitN(text, f.Delimiter, f.filterMaxIndex+1)
+}
+
+// textsData 复制一个新的事件出来，只修改 Texts 字段，dataID 大于 0 时设置路由的目标 dataid
+func (f *Filters) textsData(data *util.Data, texts []string, dataID int) *util.Data {
+	event := data.GetEvent()
+	event.Texts = texts
+	if dataID > 0 {
+		// 各 dataid 的事件在后续处理中可能被修改，因此复制字段
+		if event.Fields != nil {
+			event.Fields = event.Fields.Clone()
+		}
+		base.SetRouteDataID(&event, dataID)
+	}
+	taskData := &util.Data{Event: event}
+	taskData.SetState(data.GetState())
+	return taskData
+}
+
+// send 发送到下游节点，节点结束时返回 false
+func (f *Filters) send(out chan interface{}, data *util.Data, count int64) bool {
+	select {
+	case <-f.End:
+		logp.L.Infof("node filter(%s) is done", f.ID)
+		return false
+	case out <- data:
+		filterHandledTotal.Add(count)
+		return true
 	}
 }
 
-// Handle 过滤数据
+// sendDroppedState 事件被全部过滤时，由回调确认的 state(如消息队列的消息)继续发送到下游，保证消息得到确认
+func (f *Filters) sendDroppedState(out chan interface{}, data *util.Data) bool {
+	stateData := base.DroppedStateData(data.GetState())
+	if stateData == nil {
+		return true
+	}
+	return f.send(out, stateData, 0)
+}
+
+// dropped 更新被过滤的指标
+func (f *Filters) dropped(processorID string, count int64) {
+	filterDroppedTotal.Add(count)
+	f.ForEachTaskNodeBy(processorID, func(tNode *base.TaskNode) {
+		base.CrawlerDropped.Add(count)
+		tNode.CrawlerDropped.Add(count)
+	})
+}
+
+// Handle 过滤数据，与编译后的匹配结果一致，仅用于单个任务的判断
 func (f *Filters) Handle(words []string, text string, taskConfig *config.TaskConfig) bool {
 	if !taskConfig.HasFilter {
 		return true
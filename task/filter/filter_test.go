@@ -28,9 +28,11 @@ import (
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	"github.com/elastic/beats/filebeat/input/file"
 	libbeatlogp "github.com/elastic/beats/libbeat/logp"
 
 	cfg "github.com/TencentBlueKing/bkunifylogbeat/config"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
 	"github.com/TencentBlueKing/bkunifylogbeat/tests"
 )
 
@@ -123,6 +125,43 @@ func TestFilters_Handle(t *testing.T) {
 	}
 }
 
+// TestFilters_Handle_DroppedState 由回调确认的 state(如消息队列的消息)被过滤时，仍以采集进度类事件发送
+func TestFilters_Handle_DroppedState(t *testing.T) {
+	base.RegisterAckHandler("test_ack", func([]file.State) {})
+	event = beat.Event{}
+	filter := newFilter(map[string]interface{}{
+		"dataid":    "999990001",
+		"delimiter": "|",
+		"filters": []cfg.FilterConfig{
+			{
+				Conditions: []cfg.ConditionConfig{
+					{
+						Index: -1,
+						Key:   "test",
+						Op:    "=",
+					},
+				},
+			},
+		},
+	})
+
+	data := tests.MockLogEvent("test_ack://stream", "not match log text")
+	state := data.GetState()
+	state.Type = "test_ack"
+	data.SetState(state)
+	filter.In <- data
+	time.Sleep(2 * time.Second)
+
+	if event.Fields != nil {
+		t.Error("filter must not match.")
+		return
+	}
+	private, ok := event.Private.(file.State)
+	if !ok || private.Type != "test_ack" || private.Offset != state.Offset {
+		t.Errorf("dropped state must be sent, got %v", event.Private)
+	}
+}
+
 func TestFilters_Handle_Multi_Condition(t *testing.T) {
 	event = beat.Event{}
 	filter := newFilter(map[string]interface{}{
@@ -0,0 +1,99 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+var routeUnmatchedTotal = bkmonitoring.NewInt("route_unmatched_total") // 没有命中任何路由规则的总行数
+
+// router 一个任务的路由规则，规则的条件作为分支与过滤条件一起编译，每行只匹配一次
+type router struct {
+	dataIDs       []int // 规则对应的 dataid
+	branches      []int // 规则在编译结果中的分支
+	all           bool  // 是否路由到命中的所有规则，否则只路由到命中的第一条规则
+	defaultDataID int   // 没有命中任何规则时的 dataid，为 0 时丢弃
+
+	unmatched *monitoring.Int // 没有命中任何规则的行数
+}
+
+// route 根据匹配结果得到一行数据的目标 dataid，结果写入 dst 并返回，没有目标时丢弃
+func (r *router) route(matched []bool, dst []int) []int {
+	dst = dst[:0]
+	for i, branch := range r.branches {
+		if !matched[branch] {
+			continue
+		}
+		if !containsInt(dst, r.dataIDs[i]) {
+			dst = append(dst, r.dataIDs[i])
+		}
+		if !r.all {
+			break
+		}
+	}
+	if len(dst) == 0 {
+		routeUnmatchedTotal.Add(1)
+		r.unmatched.Add(1)
+		if r.defaultDataID > 0 {
+			dst = append(dst, r.defaultDataID)
+		}
+	}
+	return dst
+}
+
+// compiledTasks 过滤节点中所有任务的过滤条件及路由规则的编译结果
+type compiledTasks struct {
+	filter  *compiledFilter
+	tasks   []string  // 任务的 ProcessorID，与编译结果中的前 len(tasks) 个分支一一对应
+	routers []*router // 与 tasks 一一对应，没有路由规则的任务为 nil
+	routed  bool      // 是否有任务配置了路由规则
+}
+
+// routedTexts 按目标 dataid 分组的多行文本，保持 dataid 第一次出现的顺序
+type routedTexts struct {
+	dataIDs []int
+	texts   [][]string
+	dropped int // 没有目标 dataid 而丢弃的行数
+}
+
+func (r *routedTexts) add(dataID int, text string) {
+	for i, id := range r.dataIDs {
+		if id == dataID {
+			r.texts[i] = append(r.texts[i], text)
+			return
+		}
+	}
+	r.dataIDs = append(r.dataIDs, dataID)
+	r.texts = append(r.texts, []string{text})
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
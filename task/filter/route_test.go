@@ -0,0 +1,105 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRouter 第 0 个分支为任务自身的过滤条件(不过滤)，之后为路由规则
+func newTestRouter(all bool, defaultDataID int) (*compiledFilter, *router) {
+	rules := []struct {
+		dataID     int
+		conditions []conditionSpec
+	}{
+		{1001, []conditionSpec{cond(1, "eq", "ERROR")}},
+		{1002, []conditionSpec{cond(2, "eq", "payment")}},
+		{1003, []conditionSpec{cond(0, "include", "timeout"), cond(1, "neq", "DEBUG")}},
+	}
+	branches := []branchSpec{{ID: "task"}}
+	r := &router{all: all, defaultDataID: defaultDataID, unmatched: &monitoring.Int{}}
+	for _, rule := range rules {
+		r.dataIDs = append(r.dataIDs, rule.dataID)
+		r.branches = append(r.branches, len(branches))
+		branches = append(branches, branchSpec{ID: "route", HasFilter: true, Groups: [][]conditionSpec{rule.conditions}})
+	}
+	return compileFilter(branches), r
+}
+
+func TestRouter(t *testing.T) {
+	cases := []struct {
+		line  string
+		first []int
+		all   []int
+	}{
+		{"ERROR|payment|timeout", []int{1001}, []int{1001, 1002, 1003}},
+		{"INFO|payment|ok", []int{1002}, []int{1002}},
+		{"WARN|order|timeout", []int{1003}, []int{1003}},
+		{"DEBUG|order|timeout", nil, nil},
+		{"INFO", nil, nil},
+	}
+
+	c, first := newTestRouter(false, 0)
+	_, all := newTestRouter(true, 0)
+	var st matchState
+	var dst []int
+	for _, tc := range cases {
+		matched := c.match(strings.Split(tc.line, "|"), tc.line, &st)
+		assert.True(t, matched[0])
+
+		dst = first.route(matched, dst)
+		if tc.first == nil {
+			assert.Empty(t, dst, tc.line)
+		} else {
+			assert.Equal(t, tc.first, dst, tc.line)
+		}
+		dst = all.route(matched, dst)
+		if tc.all == nil {
+			assert.Empty(t, dst, tc.line)
+		} else {
+			assert.Equal(t, tc.all, dst, tc.line)
+		}
+	}
+	assert.Equal(t, int64(2), first.unmatched.Get())
+	assert.Equal(t, int64(2), all.unmatched.Get())
+
+	// 没有命中时使用默认 dataid，仍计入未命中
+	c, r := newTestRouter(false, 1000)
+	line := "INFO|order|ok"
+	dst = r.route(c.match(strings.Split(line, "|"), line, &st), dst)
+	assert.Equal(t, []int{1000}, dst)
+	assert.Equal(t, int64(1), r.unmatched.Get())
+}
+
+func TestRoutedTexts(t *testing.T) {
+	var routed routedTexts
+	routed.add(1002, "a")
+	routed.add(1001, "b")
+	routed.add(1002, "c")
+	assert.Equal(t, []int{1002, 1001}, routed.dataIDs)
+	assert.Equal(t, [][]string{{"a", "c"}, {"b"}}, routed.texts)
+}
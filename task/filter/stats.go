@@ -0,0 +1,148 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+// conditionStats 单个条件的统计，条件按 index 排序后的位置编号
+type conditionStats struct {
+	condition conditionSpec
+	evaluated *monitoring.Int // 所在的组被计算的行数
+	matched   *monitoring.Int // 条件成立的行数
+	rejected  *monitoring.Int // 该条件是组内第一个不成立的条件的行数，即由该条件导致组不命中
+}
+
+// groupStats 一组条件的统计
+type groupStats struct {
+	evaluated  *monitoring.Int // 之前的组均未命中，计算该组的行数
+	matched    *monitoring.Int // 组内条件全部成立的行数
+	conditions []conditionStats
+}
+
+// filterStats 一个任务的过滤条件命中统计
+// 过滤节点编译后的匹配只得到每个任务的最终结果，因此按抽样对命中的行逐组、逐条件重新计算
+type filterStats struct {
+	sampleRate uint64
+	sampled    *monitoring.Int // 抽样统计的行数
+	dropped    *monitoring.Int // 抽样统计中被过滤的行数
+	groups     []groupStats
+}
+
+// newFilterStats 创建任务的命中统计，指标按 dataid 上报
+// 组及条件的指标名为 filter_stats_g{组}_{evaluated|matched} 以及 filter_stats_g{组}_c{条件}_{evaluated|matched|rejected}
+func newFilterStats(dataID int, sampleRate int, groups [][]conditionSpec) *filterStats {
+	if sampleRate <= 0 {
+		sampleRate = 1
+	}
+	s := &filterStats{
+		sampleRate: uint64(sampleRate),
+		sampled:    bkmonitoring.NewIntWithDataID(dataID, "filter_stats_sampled"),
+		dropped:    bkmonitoring.NewIntWithDataID(dataID, "filter_stats_dropped"),
+		groups:     make([]groupStats, 0, len(groups)),
+	}
+	for g, conditions := range groups {
+		group := groupStats{
+			evaluated:  bkmonitoring.NewIntWithDataID(dataID, fmt.Sprintf("filter_stats_g%d_evaluated", g)),
+			matched:    bkmonitoring.NewIntWithDataID(dataID, fmt.Sprintf("filter_stats_g%d_matched", g)),
+			conditions: make([]conditionStats, 0, len(conditions)),
+		}
+		for c, condition := range conditions {
+			group.conditions = append(group.conditions, conditionStats{
+				condition: condition,
+				evaluated: bkmonitoring.NewIntWithDataID(dataID, fmt.Sprintf("filter_stats_g%d_c%d_evaluated", g, c)),
+				matched:   bkmonitoring.NewIntWithDataID(dataID, fmt.Sprintf("filter_stats_g%d_c%d_matched", g, c)),
+				rejected:  bkmonitoring.NewIntWithDataID(dataID, fmt.Sprintf("filter_stats_g%d_c%d_rejected", g, c)),
+			})
+		}
+		s.groups = append(s.groups, group)
+	}
+	return s
+}
+
+// String 指标编号与条件的对应关系，用于日志输出
+func (s *filterStats) String() string {
+	var b strings.Builder
+	for g, group := range s.groups {
+		for c, cs := range group.conditions {
+			if b.Len() > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "g%dc%d: index(%d) %s %q", g, c, cs.condition.Index, cs.condition.Op, cs.condition.Value)
+		}
+	}
+	return b.String()
+}
+
+// sampling 第 seq 行是否需要统计
+func (s *filterStats) sampling(seq uint64) bool {
+	return seq%s.sampleRate == 0
+}
+
+// observe 统计一行数据，与 Handle 的计算顺序一致：组按顺序计算直到命中，
+// 但组内的条件全部计算，以便得到每个条件各自的命中数
+func (s *filterStats) observe(words []string, text string) bool {
+	s.sampled.Add(1)
+	for _, group := range s.groups {
+		group.evaluated.Add(1)
+		access := true
+		for _, cs := range group.conditions {
+			cs.evaluated.Add(1)
+			if cs.match(words, text) {
+				cs.matched.Add(1)
+				continue
+			}
+			if access {
+				cs.rejected.Add(1)
+				access = false
+			}
+		}
+		if access {
+			group.matched.Add(1)
+			return true
+		}
+	}
+	s.dropped.Add(1)
+	return false
+}
+
+// match 计算单个条件
+func (cs *conditionStats) match(words []string, text string) bool {
+	matcher := cs.condition.Matcher
+	if matcher == nil {
+		return false
+	}
+	// 匹配第n列，如果n小于等于0，则变更为整个字符串匹配操作
+	if cs.condition.Index <= 0 {
+		return matcher(text)
+	}
+	if len(words) < cs.condition.Index {
+		return false
+	}
+	return matcher(words[cs.condition.Index-1])
+}
@@ -0,0 +1,88 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterStats(t *testing.T) {
+	groups := [][]conditionSpec{
+		{cond(1, "eq", "ERROR"), cond(2, "include", "db")},
+		{cond(0, "include", "panic")},
+	}
+	stats := newFilterStats(1, 1, groups)
+
+	lines := []string{
+		"ERROR|db timeout",   // 第一组命中
+		"ERROR|cache miss",   // 第一组由第二个条件导致不命中，第二组不命中
+		"INFO|db ok",         // 第一组由第一个条件导致不命中，第二组不命中
+		"WARN|panic: db nil", // 第一组两个条件中第一个不成立，第二组命中
+	}
+	var matched []bool
+	for _, line := range lines {
+		matched = append(matched, stats.observe(strings.Split(line, "|"), line))
+	}
+	assert.Equal(t, []bool{true, false, false, true}, matched)
+
+	assert.Equal(t, int64(4), stats.sampled.Get())
+	assert.Equal(t, int64(2), stats.dropped.Get())
+
+	g0, g1 := stats.groups[0], stats.groups[1]
+	assert.Equal(t, int64(4), g0.evaluated.Get())
+	assert.Equal(t, int64(1), g0.matched.Get())
+	assert.Equal(t, int64(3), g1.evaluated.Get())
+	assert.Equal(t, int64(1), g1.matched.Get())
+
+	// 组内条件全部计算，rejected 只记录第一个不成立的条件
+	assert.Equal(t, int64(4), g0.conditions[0].evaluated.Get())
+	assert.Equal(t, int64(2), g0.conditions[0].matched.Get())
+	assert.Equal(t, int64(2), g0.conditions[0].rejected.Get())
+	assert.Equal(t, int64(3), g0.conditions[1].matched.Get())
+	assert.Equal(t, int64(1), g0.conditions[1].rejected.Get())
+	assert.Equal(t, int64(2), g1.conditions[0].rejected.Get())
+
+	assert.Equal(t, `g0c0: index(1) eq "ERROR", g0c1: index(2) include "db", g1c0: index(0) include "panic"`, stats.String())
+}
+
+func TestFilterStatsSampling(t *testing.T) {
+	stats := newFilterStats(1, 10, [][]conditionSpec{{cond(1, "eq", "ERROR")}})
+	count := 0
+	for seq := uint64(1); seq <= 100; seq++ {
+		if stats.sampling(seq) {
+			count++
+		}
+	}
+	assert.Equal(t, 10, count)
+
+	// 与编译后的匹配结果一致
+	branch := branchSpec{HasFilter: true, Groups: [][]conditionSpec{{cond(1, "eq", "ERROR"), cond(0, "nregex", "^#")}}}
+	stats = newFilterStats(1, 1, branch.Groups)
+	for _, line := range []string{"ERROR|x", "#ERROR|x", "INFO|x", "ERROR"} {
+		words := strings.Split(line, "|")
+		assert.Equal(t, naiveMatch(branch, words, line), stats.observe(words, line), line)
+	}
+}
@@ -0,0 +1,121 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package formatter
+
+import (
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// eventExtKey 事件级别的扩展字段在 event.Meta 中的 key
+const eventExtKey = "ext"
+
+// SampleRateKey 采样率在 ext 中的字段，由采样 processor 为每个事件设置，下游统计时以数量除以采样率还原
+const SampleRateKey = "sample_rate"
+
+// SetEventExt 设置事件级别的扩展字段，输出时会与任务的 ext_meta 合并
+// 用于 input 从文件路径等来源解析出的元数据，如容器的 namespace、pod 等
+func SetEventExt(data *util.Data, ext map[string]interface{}) {
+	if len(ext) == 0 {
+		return
+	}
+	if data.Event.Meta == nil {
+		data.Event.Meta = common.MapStr{}
+	}
+	data.Event.Meta[eventExtKey] = ext
+}
+
+// PutEventExt 在事件级别的扩展字段中追加一个字段，用于 processor 记录处理信息，如采样率
+// input 设置的扩展字段可能被多个事件共享，因此复制后再修改
+func PutEventExt(event *beat.Event, key string, value interface{}) {
+	if event.Meta == nil {
+		event.Meta = common.MapStr{}
+	}
+	origin, _ := event.Meta[eventExtKey].(map[string]interface{})
+	ext := make(map[string]interface{}, len(origin)+1)
+	for k, v := range origin {
+		ext[k] = v
+	}
+	ext[key] = value
+	event.Meta[eventExtKey] = ext
+}
+
+// getEventExt 获取事件级别的扩展字段
+func getEventExt(data *util.Data) map[string]interface{} {
+	if data.Event.Meta == nil {
+		return nil
+	}
+	ext, _ := data.Event.Meta[eventExtKey].(map[string]interface{})
+	return ext
+}
+
+// mergeExt 合并任务的 ext_meta 与事件级别的扩展字段
+// 同一个打包中的事件来自同一个文件，因此取最后一个事件的扩展字段即可，采样率按打包中的全部事件计算
+func mergeExt(taskExt map[string]interface{}, events []*util.Data) map[string]interface{} {
+	var eventExt map[string]interface{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if eventExt = getEventExt(events[i]); eventExt != nil {
+			break
+		}
+	}
+	if len(eventExt) == 0 {
+		return taskExt
+	}
+
+	ext := make(map[string]interface{}, len(taskExt)+len(eventExt))
+	for k, v := range taskExt {
+		ext[k] = v
+	}
+	for k, v := range eventExt {
+		ext[k] = v
+	}
+	if rate, ok := packageSampleRate(events); ok {
+		ext[SampleRateKey] = rate
+	}
+	return ext
+}
+
+// packageSampleRate 各事件的采样率可能不同，打包的采样率为保留的行数与估计的原始行数之比
+func packageSampleRate(events []*util.Data) (float64, bool) {
+	var kept, origin float64
+	sampled := false
+	for _, event := range events {
+		count := float64(event.Event.Count())
+		if count == 0 {
+			continue
+		}
+		rate, ok := getEventExt(event)[SampleRateKey].(float64)
+		if !ok || rate <= 0 {
+			rate = 1
+		} else {
+			sampled = true
+		}
+		kept += count
+		origin += count / rate
+	}
+	if !sampled || origin == 0 {
+		return 0, false
+	}
+	return kept / origin, true
+}
@@ -96,8 +96,8 @@ func (f v2Formatter) Format(events []*util.Data) beat.MapStr {
 	}
 
 	//发送正常事件
-	if len(f.taskConfig.GetExtMeta()) > 0 {
-		data["ext"] = f.taskConfig.GetExtMeta()
+	if ext := mergeExt(f.taskConfig.GetExtMeta(), events); len(ext) > 0 {
+		data["ext"] = ext
 	} else {
 		data["ext"] = map[string]interface{}{}
 	}
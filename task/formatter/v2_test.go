@@ -150,3 +150,80 @@ func TestV2FormatterMountReplace(t *testing.T) {
 	assert.Equal(t, data["filename"], "/data/datahub/backup/deeper/d/e/f.log")
 
 }
+
+func TestV2FormatterEventExt(t *testing.T) {
+	vars := map[string]interface{}{
+		"dataid":   "999990001",
+		"ext_meta": map[string]interface{}{"cluster": "bcs-k8s-00001"},
+	}
+	taskConfig, err := config.CreateTaskConfig(vars)
+	if err != nil {
+		panic(err)
+	}
+	f, err := NewV2Formatter(taskConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	event := &util.Data{
+		Event: beat.Event{
+			Timestamp: time.Now(),
+			Texts:     []string{"Hello from the Kubernetes cluster"},
+		},
+	}
+	event.SetState(file.State{Source: "/var/log/pods/default_nginx_6f1f8c3a/nginx/0.log"})
+	SetEventExt(event, map[string]interface{}{
+		"io_kubernetes_pod_namespace": "default",
+		"container_name":              "nginx",
+	})
+
+	data := f.Format([]*util.Data{event})
+	ext := data["ext"].(map[string]interface{})
+	assert.Equal(t, "bcs-k8s-00001", ext["cluster"])
+	assert.Equal(t, "default", ext["io_kubernetes_pod_namespace"])
+	assert.Equal(t, "nginx", ext["container_name"])
+
+	// 不影响任务的 ext_meta
+	assert.Len(t, taskConfig.GetExtMeta(), 1)
+}
+
+func TestV2FormatterPutEventExt(t *testing.T) {
+	taskConfig, err := config.CreateTaskConfig(map[string]interface{}{"dataid": "999990001"})
+	if err != nil {
+		panic(err)
+	}
+	f, err := NewV2Formatter(taskConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	shared := map[string]interface{}{"container_name": "nginx"}
+	event := &util.Data{
+		Event: beat.Event{
+			Timestamp: time.Now(),
+			Texts:     []string{"sampled line"},
+		},
+	}
+	SetEventExt(event, shared)
+	PutEventExt(&event.Event, "sample_rate", 0.1)
+
+	data := f.Format([]*util.Data{event})
+	ext := data["ext"].(map[string]interface{})
+	assert.Equal(t, "nginx", ext["container_name"])
+	assert.Equal(t, 0.1, ext["sample_rate"])
+
+	// 不影响 input 共享的扩展字段
+	assert.Len(t, shared, 1)
+
+	// 打包中各事件的采样率不同时，按保留的行数与估计的原始行数计算
+	other := &util.Data{
+		Event: beat.Event{
+			Timestamp: time.Now(),
+			Texts:     []string{"line1", "line2", "line3"},
+		},
+	}
+	PutEventExt(&other.Event, SampleRateKey, 1.0)
+	data = f.Format([]*util.Data{event, other})
+	ext = data["ext"].(map[string]interface{})
+	assert.InDelta(t, 4.0/13, ext[SampleRateKey], 1e-9)
+}
@@ -0,0 +1,209 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package autoencoding
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	// encodingAuto 自动识别文件编码，见 config.EncodingAuto
+	encodingAuto = "auto"
+
+	encodingUTF8       = "utf-8"
+	encodingUTF16LEBOM = "utf-16le-bom"
+	encodingUTF16BEBOM = "utf-16be-bom"
+	encodingUTF16LE    = "utf-16le"
+	encodingUTF16BE    = "utf-16be"
+	encodingGB18030    = "gb18030"
+
+	// sampleSize 用于识别编码的文件头大小
+	sampleSize = 4096
+)
+
+// detectResult 编码的识别结果
+type detectResult int
+
+const (
+	resultDetected  detectResult = iota // 识别出编码
+	resultFallback                      // 内容不符合任何编码，使用默认编码
+	resultUndecided                     // 内容为纯 ASCII，与多数编码兼容，需要读取到非 ASCII 内容后再识别
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// readSample 读取文件头用于识别编码
+func readSample(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sampleSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readSampleAt 读取 end 之前的内容用于识别编码，从完整的一行开始
+func readSampleAt(path string, end int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	start := end - sampleSize
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, end-start)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+	if start > 0 {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+	return buf, nil
+}
+
+// detectEncoding 根据 BOM 以及文件头的内容识别编码，无法确定时返回 fallback
+// 纯 ASCII 的内容与多数编码兼容，返回 fallback 并标记为未确定
+func detectEncoding(sample []byte, fallback string) (string, detectResult) {
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		return encodingUTF8, resultDetected
+	case bytes.HasPrefix(sample, utf16LEBOM):
+		return encodingUTF16LEBOM, resultDetected
+	case bytes.HasPrefix(sample, utf16BEBOM):
+		return encodingUTF16BEBOM, resultDetected
+	}
+
+	if encoding := detectUTF16(sample); encoding != "" {
+		return encoding, resultDetected
+	}
+	if isASCII(sample) {
+		return fallback, resultUndecided
+	}
+	if isUTF8(sample) {
+		return encodingUTF8, resultDetected
+	}
+	// GB18030 兼容 GBK，统一按 GB18030 解码
+	if isGB18030(sample) {
+		return encodingGB18030, resultDetected
+	}
+	return fallback, resultFallback
+}
+
+// detectUTF16 没有 BOM 的 UTF-16 文件中，ASCII 字符的高位字节为 0
+func detectUTF16(sample []byte) string {
+	pairs := len(sample) / 2
+	if pairs < 4 {
+		return ""
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < pairs*2; i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case oddZeros*10 > pairs*3 && evenZeros*20 < pairs:
+		return encodingUTF16LE
+	case evenZeros*10 > pairs*3 && oddZeros*20 < pairs:
+		return encodingUTF16BE
+	}
+	return ""
+}
+
+func isASCII(sample []byte) bool {
+	for _, b := range sample {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// isUTF8 文件头的末尾可能截断了一个字符，不视为非法
+func isUTF8(sample []byte) bool {
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(sample[i:])
+		}
+		i += size
+	}
+	return true
+}
+
+// isGB18030 按 GB18030 的双字节、四字节结构校验，文件头的末尾可能截断了一个字符，不视为非法
+func isGB18030(sample []byte) bool {
+	for i := 0; i < len(sample); {
+		b := sample[i]
+		switch {
+		case b < 0x80:
+			i++
+			continue
+		case b == 0x80 || b == 0xFF:
+			return false
+		}
+		if i+1 >= len(sample) {
+			return true
+		}
+		b2 := sample[i+1]
+		switch {
+		case b2 >= 0x40 && b2 <= 0xFE && b2 != 0x7F:
+			i += 2
+		case b2 >= 0x30 && b2 <= 0x39:
+			if i+3 >= len(sample) {
+				return true
+			}
+			b3, b4 := sample[i+2], sample[i+3]
+			if b3 < 0x81 || b3 > 0xFE || b4 < 0x30 || b4 > 0x39 {
+				return false
+			}
+			i += 4
+		default:
+			return false
+		}
+	}
+	return true
+}
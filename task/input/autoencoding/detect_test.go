@@ -0,0 +1,89 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package autoencoding
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// "中文日志" 的 GBK 编码
+var gbkText = []byte{0xD6, 0xD0, 0xCE, 0xC4, 0xC8, 0xD5, 0xD6, 0xBE}
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		name     string
+		sample   []byte
+		encoding string
+		result   detectResult
+	}{
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "hello"...), encodingUTF8, resultDetected},
+		{"utf-16le bom", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, encodingUTF16LEBOM, resultDetected},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, encodingUTF16BEBOM, resultDetected},
+		{"utf-16le", []byte{'h', 0, 'e', 0, 'l', 0, 'l', 0, 'o', 0, '\n', 0}, encodingUTF16LE, resultDetected},
+		{"utf-16be", []byte{0, 'h', 0, 'e', 0, 'l', 0, 'l', 0, 'o', 0, '\n'}, encodingUTF16BE, resultDetected},
+		{"utf-8", []byte("2021-01-01 中文日志\n"), encodingUTF8, resultDetected},
+		// 文件头末尾截断了一个字符
+		{"utf-8 truncated", []byte("中文日志")[:11], encodingUTF8, resultDetected},
+		{"gbk", append([]byte("2021-01-01 "), gbkText...), encodingGB18030, resultDetected},
+		{"gbk truncated", append([]byte("2021-01-01 "), gbkText[:7]...), encodingGB18030, resultDetected},
+		{"gb18030 four bytes", []byte{'a', 0x81, 0x30, 0x81, 0x30, 'b'}, encodingGB18030, resultDetected},
+		{"ascii", []byte("2021-01-01 INFO hello\n"), "gbk", resultUndecided},
+		{"binary", []byte{0xFF, 0x00, 0x80, 0x7F, 0xFF}, "gbk", resultFallback},
+	}
+	for _, c := range cases {
+		encoding, result := detectEncoding(c.sample, "gbk")
+		assert.Equal(t, c.encoding, encoding, c.name)
+		assert.Equal(t, c.result, result, c.name)
+	}
+}
+
+func TestReadSample(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoencoding")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	small := filepath.Join(dir, "small.log")
+	assert.NoError(t, ioutil.WriteFile(small, gbkText, 0644))
+	sample, err := readSample(small)
+	assert.NoError(t, err)
+	assert.Equal(t, gbkText, sample)
+
+	large := filepath.Join(dir, "large.log")
+	assert.NoError(t, ioutil.WriteFile(large, make([]byte, sampleSize*2), 0644))
+	sample, err = readSample(large)
+	assert.NoError(t, err)
+	assert.Len(t, sample, sampleSize)
+
+	_, err = readSample(filepath.Join(dir, "missing.log"))
+	assert.Error(t, err)
+}
+
+func TestCountReplaced(t *testing.T) {
+	assert.Equal(t, 0, countReplaced("中文日志"))
+	assert.Equal(t, 2, countReplaced("a�b�"))
+}
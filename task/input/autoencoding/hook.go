@@ -0,0 +1,250 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package autoencoding
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+)
+
+const hookName = "auto_encoding"
+
+var (
+	encodingDetected = bkmonitoring.NewInt("encoding_detected") // 识别出编码的文件数量
+	encodingFallback = bkmonitoring.NewInt("encoding_fallback") // 使用默认编码的文件数量
+	encodingReplaced = bkmonitoring.NewInt("encoding_replaced") // 解码时被替换的非法字节序列数量
+	encodingError    = bkmonitoring.NewInt("encoding_error")    // 读取文件头失败次数
+)
+
+func init() {
+	err := managedlog.RegisterHook(hookName, newHook)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// hook 为每个文件识别编码，并按识别结果设置文件日志采集的编码
+// 文件头为纯 ASCII 时先按默认编码采集，出现非法字节序列时停止采集，识别该行的编码后从采集进度处重新采集
+// log 类型任务配置 encoding: auto 后开启，见 config/input/log.go
+type hook struct {
+	mtx        sync.Mutex
+	config     config
+	encodings  map[string]string // 文件标识(inode、device) => 编码，从采集进度中恢复
+	identities map[string]string // 文件路径 => 文件标识
+	redetect   map[string]int64  // 未确定编码的文件出现非法字节序列的行的结束位置，以文件标识为 key
+}
+
+func newHook(cfg *common.Config, context *input.Context) (managedlog.Hook, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Encoding != encodingAuto {
+		return nil, nil
+	}
+
+	// 记录的编码仅由当前 Hook 使用，日志采集加载的 state 需要移除
+	encodings := make(map[string]string)
+	states := make([]file.State, 0, len(context.States))
+	for _, state := range context.States {
+		if encoding := registrar.GetStateEncoding(state); encoding != "" {
+			encodings[state.FileStateOS.String()] = encoding
+		}
+		states = append(states, registrar.WithoutEncoding(state))
+	}
+	context.States = states
+
+	return &hook{
+		config:     config,
+		encodings:  encodings,
+		identities: make(map[string]string),
+		redetect:   make(map[string]int64),
+	}, nil
+}
+
+// fileKey 文件标识，路径变化(如轮转)后仍然使用识别出的编码
+func fileKey(info os.FileInfo) string {
+	return commonFile.GetOSState(info).String()
+}
+
+// Check 编码识别不影响文件是否采集
+func (h *hook) Check(string, os.FileInfo, time.Time) bool {
+	return true
+}
+
+// Prepare 识别文件编码后设置日志采集的编码，文件为空时等待下次扫描
+func (h *hook) Prepare(f *managedlog.File) (bool, error) {
+	key := fileKey(f.Info)
+	h.mtx.Lock()
+	h.setIdentity(f.Path, key)
+	encoding, decided := h.encodings[key]
+	h.mtx.Unlock()
+
+	if !decided {
+		sample, err := readSample(f.Path)
+		if err != nil {
+			encodingError.Add(1)
+			logp.Err("%s read file(%s) error: %v", hookName, f.Path, err)
+			return false, nil
+		}
+		if len(sample) == 0 {
+			return false, nil
+		}
+		var result detectResult
+		encoding, result = detectEncoding(sample, h.config.Fallback)
+		decided = result != resultUndecided
+		if decided {
+			h.decide(key, encoding, result)
+		}
+	}
+
+	if err := f.Config.SetString("encoding", -1, encoding); err != nil {
+		return false, err
+	}
+	logp.Info("%s file(%s) encoding: %s, decided: %v", hookName, f.Path, encoding, decided)
+	if decided {
+		f.AddFilter(func(data *util.Data, _ <-chan struct{}) bool {
+			// 在采集进度中记录文件编码，并统计解码时被替换的非法字节序列
+			data.SetState(registrar.WithEncoding(data.GetState(), encoding))
+			encodingReplaced.Add(int64(countEventReplaced(data)))
+			return true
+		})
+		return true, nil
+	}
+	f.AddFilter(func(data *util.Data, _ <-chan struct{}) bool {
+		if countEventReplaced(data) == 0 {
+			return true
+		}
+		// 按默认编码无法解码，不发送该行并停止采集，由 Refresh 识别编码后重新采集
+		h.mtx.Lock()
+		h.redetect[key] = data.GetState().Offset
+		h.mtx.Unlock()
+		return false
+	})
+	return true, nil
+}
+
+// decide 记录文件编码
+func (h *hook) decide(key, encoding string, result detectResult) {
+	h.mtx.Lock()
+	h.encodings[key] = encoding
+	h.mtx.Unlock()
+	if result == resultDetected {
+		encodingDetected.Add(1)
+	} else {
+		encodingFallback.Add(1)
+	}
+}
+
+// Refresh 未确定编码的文件出现非法字节序列时，按该行的内容识别编码，并重新开始采集
+func (h *hook) Refresh(f *managedlog.File, _ os.FileInfo) bool {
+	key := fileKey(f.Info)
+	h.mtx.Lock()
+	end, ok := h.redetect[key]
+	delete(h.redetect, key)
+	h.mtx.Unlock()
+	if !ok {
+		return false
+	}
+
+	encoding, result := h.config.Fallback, resultFallback
+	sample, err := readSampleAt(f.Path, end)
+	if err != nil {
+		encodingError.Add(1)
+		logp.Err("%s read file(%s) error: %v", hookName, f.Path, err)
+	} else if info, err := os.Stat(f.Path); err == nil && fileKey(info) == key {
+		// 路径已对应其他文件时使用默认编码
+		encoding, result = detectEncoding(sample, h.config.Fallback)
+		if result == resultUndecided {
+			result = resultFallback
+		}
+	}
+	h.decide(key, encoding, result)
+	logp.Info("%s file(%s) encoding redetected at offset %d: %s", hookName, f.Path, end, encoding)
+	return true
+}
+
+// Reset 不需要处理
+func (h *hook) Reset() {}
+
+// Forget 文件已删除，移除记录的编码
+func (h *hook) Forget(path string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.setIdentity(path, "")
+}
+
+// setIdentity 更新路径对应的文件，没有其他路径指向原来的文件时移除记录的编码，key 为空表示路径已删除
+func (h *hook) setIdentity(path, key string) {
+	last, ok := h.identities[path]
+	if key == "" {
+		delete(h.identities, path)
+	} else {
+		h.identities[path] = key
+	}
+	if !ok || last == key {
+		return
+	}
+	for _, other := range h.identities {
+		if other == last {
+			return
+		}
+	}
+	delete(h.encodings, last)
+	delete(h.redetect, last)
+}
+
+// Close 不需要处理
+func (h *hook) Close() {}
+
+// countEventReplaced 统计事件中解码时被替换的非法字节序列数量
+func countEventReplaced(data *util.Data) int {
+	count := 0
+	if text, ok := data.Event.Fields["data"].(string); ok {
+		count += countReplaced(text)
+	}
+	for _, text := range data.Event.Texts {
+		count += countReplaced(text)
+	}
+	return count
+}
+
+// countReplaced 统计解码后的替换字符数量，即非法字节序列的数量
+func countReplaced(text string) int {
+	return strings.Count(text, string(utf8.RuneError))
+}
@@ -0,0 +1,151 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package autoencoding
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+)
+
+func newTestHook(t *testing.T, states []file.State) *hook {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{"encoding": "auto"})
+	assert.NoError(t, err)
+	h, err := newHook(cfg, &input.Context{States: states})
+	assert.NoError(t, err)
+	return h.(*hook)
+}
+
+func newTestFile(t *testing.T, path string) *managedlog.File {
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	cfg, err := common.NewConfigFrom(map[string]interface{}{})
+	assert.NoError(t, err)
+	return &managedlog.File{Path: path, Info: info, Config: cfg}
+}
+
+func newTestEvent(text string, offset int64) *util.Data {
+	data := util.NewData()
+	data.Event.Fields = common.MapStr{"data": text}
+	data.SetState(file.State{Source: "test.log", Offset: offset})
+	return data
+}
+
+func prepare(t *testing.T, h *hook, f *managedlog.File) string {
+	ok, err := h.Prepare(f)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	encoding, err := f.Config.String("encoding", -1)
+	assert.NoError(t, err)
+	return encoding
+}
+
+func TestHookRedetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoencoding")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	header := []byte("2021-01-01 INFO start\n")
+	assert.NoError(t, ioutil.WriteFile(path, header, 0644))
+
+	h := newTestHook(t, nil)
+	assert.Nil(t, newTestHookDisabled(t))
+
+	// 文件头为纯 ASCII，先按默认编码采集，不记录编码
+	f := newTestFile(t, path)
+	assert.Equal(t, "utf-8", prepare(t, h, f))
+	data := newTestEvent("2021-01-01 INFO start", int64(len(header)))
+	assert.True(t, f.Filter(data, nil))
+	assert.Equal(t, "", registrar.GetStateEncoding(data.GetState()))
+	assert.False(t, h.Refresh(f, f.Info))
+
+	// 之后写入的内容出现非法字节序列时停止采集，按该行识别编码后重新采集
+	content := append(append([]byte{}, header...), append(gbkText, '\n')...)
+	assert.NoError(t, ioutil.WriteFile(path, content, 0644))
+	assert.False(t, f.Filter(newTestEvent("��", int64(len(content))), nil))
+	assert.True(t, h.Refresh(f, f.Info))
+	assert.False(t, h.Refresh(f, f.Info))
+
+	f = newTestFile(t, path)
+	assert.Equal(t, encodingGB18030, prepare(t, h, f))
+	data = newTestEvent("中文日志", int64(len(content)))
+	assert.True(t, f.Filter(data, nil))
+	assert.Equal(t, encodingGB18030, registrar.GetStateEncoding(data.GetState()))
+
+	// 编码按文件标识记录，重命名后仍然使用识别出的编码
+	renamed := filepath.Join(dir, "test.log.1")
+	assert.NoError(t, os.Rename(path, renamed))
+	h.Forget(path)
+	assert.Equal(t, encodingGB18030, prepare(t, h, newTestFile(t, renamed)))
+
+	// 文件删除后移除记录的编码
+	h.Forget(renamed)
+	assert.Empty(t, h.encodings)
+}
+
+func TestHookStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoencoding")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("ascii\n"), 0644))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	// 从采集进度中恢复编码，并从日志采集加载的 state 中移除
+	states := []file.State{registrar.WithEncoding(file.State{
+		Source:      path,
+		Offset:      6,
+		FileStateOS: commonFile.GetOSState(info),
+	}, encodingGB18030)}
+	h := newTestHook(t, states)
+	assert.Equal(t, encodingGB18030, prepare(t, h, newTestFile(t, path)))
+
+	// 空文件等待下次扫描
+	empty := filepath.Join(dir, "empty.log")
+	assert.NoError(t, ioutil.WriteFile(empty, nil, 0644))
+	ok, err := h.Prepare(newTestFile(t, empty))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func newTestHookDisabled(t *testing.T) managedlog.Hook {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{"encoding": "utf-8"})
+	assert.NoError(t, err)
+	h, err := newHook(cfg, &input.Context{})
+	assert.NoError(t, err)
+	return h
+}
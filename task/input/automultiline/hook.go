@@ -0,0 +1,173 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package automultiline
+
+import (
+	"os"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+	"github.com/elastic/beats/libbeat/logp"
+
+	cfginput "github.com/TencentBlueKing/bkunifylogbeat/config/input"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+)
+
+const hookName = "auto_multiline"
+
+var (
+	multilineDetected   = bkmonitoring.NewInt("multiline_detected")   // 识别出预设规则的文件数量
+	multilineUndetected = bkmonitoring.NewInt("multiline_undetected") // 读取足够的行数后仍未识别出预设规则的文件数量
+	multilineError      = bkmonitoring.NewInt("multiline_error")      // 读取文件失败次数
+)
+
+func init() {
+	err := managedlog.RegisterHook(hookName, newHook)
+	if err != nil {
+		panic(err)
+	}
+}
+
+type config struct {
+	Multiline *cfginput.MultilineConfig `config:"multiline"`
+}
+
+// fileState 文件的识别结果
+type fileState struct {
+	key     string // 文件标识(inode、device)，路径对应其他文件时重新识别
+	preset  string // 识别出的预设规则，为空时不做多行合并
+	decided bool   // 已识别出预设规则或已读取足够的行数
+	size    int64  // 上次识别时的文件大小
+}
+
+// hook 读取每个文件的前 N 行识别异常堆栈的格式，并按识别出的预设规则设置文件日志采集的多行合并
+// 文件内容不足 N 行且未识别出时先不做多行合并，文件增长后重新识别，识别出后从采集进度处重新采集
+// log 类型任务配置 multiline.auto 后开启，见 config/input/log.go
+type hook struct {
+	sampleLines int
+	files       map[string]*fileState // 文件路径 => 识别结果
+}
+
+func newHook(cfg *common.Config, _ *input.Context) (managedlog.Hook, error) {
+	config := config{
+		Multiline: &cfginput.MultilineConfig{SampleLines: cfginput.DefaultMultilineSampleLines},
+	}
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Multiline == nil || !config.Multiline.IsAuto() {
+		return nil, nil
+	}
+	sampleLines := config.Multiline.SampleLines
+	if sampleLines <= 0 {
+		sampleLines = cfginput.DefaultMultilineSampleLines
+	}
+	return &hook{
+		sampleLines: sampleLines,
+		files:       make(map[string]*fileState),
+	}, nil
+}
+
+// fileKey 文件标识，路径对应其他文件(如轮转)后重新识别
+func fileKey(info os.FileInfo) string {
+	return commonFile.GetOSState(info).String()
+}
+
+// Check 多行合并的识别不影响文件是否采集
+func (h *hook) Check(string, os.FileInfo, time.Time) bool {
+	return true
+}
+
+// Prepare 识别文件的预设规则后设置日志采集的多行合并
+func (h *hook) Prepare(f *managedlog.File) (bool, error) {
+	key := fileKey(f.Info)
+	state, ok := h.files[f.Path]
+	if !ok || state.key != key {
+		state = &fileState{key: key}
+		h.files[f.Path] = state
+	}
+	if !state.decided {
+		h.detect(f.Path, state, f.Info.Size())
+	}
+
+	// multiline.auto 不是日志采集的配置，按识别结果替换
+	_, _ = f.Config.Remove("multiline", -1)
+	if state.preset == "" {
+		return true, nil
+	}
+	err := f.Config.Merge(common.MapStr{
+		"multiline": cfginput.MultilinePresetConfig(state.preset),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// detect 读取文件的前 N 行识别预设规则
+func (h *hook) detect(path string, state *fileState, size int64) {
+	state.size = size
+	preset, lines, err := cfginput.DetectMultilinePreset(path, h.sampleLines)
+	if err != nil {
+		multilineError.Add(1)
+		logp.Err("%s read file(%s) error: %v", hookName, path, err)
+		return
+	}
+	if preset != "" {
+		state.preset, state.decided = preset, true
+		multilineDetected.Add(1)
+		logp.Info("%s file(%s) multiline preset: %s", hookName, path, preset)
+		return
+	}
+	if lines >= h.sampleLines {
+		state.decided = true
+		multilineUndetected.Add(1)
+		logp.Warn("%s no stack trace found in the first %d lines of file(%s), multiline is disabled for it",
+			hookName, lines, path)
+	}
+}
+
+// Refresh 未确定预设规则的文件增长后重新识别，识别出时重新开始采集
+func (h *hook) Refresh(f *managedlog.File, info os.FileInfo) bool {
+	state, ok := h.files[f.Path]
+	if !ok || state.decided || state.key != fileKey(info) || info.Size() == state.size {
+		return false
+	}
+	h.detect(f.Path, state, info.Size())
+	return state.preset != ""
+}
+
+// Reset 不需要处理
+func (h *hook) Reset() {}
+
+// Forget 文件已删除，移除识别结果
+func (h *hook) Forget(path string) {
+	delete(h.files, path)
+}
+
+// Close 不需要处理
+func (h *hook) Close() {}
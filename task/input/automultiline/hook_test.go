@@ -0,0 +1,142 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package automultiline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+
+	cfginput "github.com/TencentBlueKing/bkunifylogbeat/config/input"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+)
+
+func newTestHook(t *testing.T, multiline map[string]interface{}) managedlog.Hook {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{"multiline": multiline})
+	assert.NoError(t, err)
+	h, err := newHook(cfg, &input.Context{})
+	assert.NoError(t, err)
+	return h
+}
+
+func newTestFile(t *testing.T, path string) *managedlog.File {
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"multiline": map[string]interface{}{"auto": true, "sample_lines": 4},
+	})
+	assert.NoError(t, err)
+	return &managedlog.File{Path: path, Info: info, Config: cfg}
+}
+
+// prepare 返回文件日志采集的多行合并规则，未开启时返回空
+func prepare(t *testing.T, h managedlog.Hook, f *managedlog.File) string {
+	ok, err := h.Prepare(f)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	var config struct {
+		Multiline *struct {
+			Pattern string `config:"pattern"`
+		} `config:"multiline"`
+	}
+	assert.NoError(t, f.Config.Unpack(&config))
+	if config.Multiline == nil {
+		return ""
+	}
+	return config.Multiline.Pattern
+}
+
+func writeLines(t *testing.T, path string, lines ...string) {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+}
+
+func TestHookDisabled(t *testing.T) {
+	assert.Nil(t, newTestHook(t, map[string]interface{}{"preset": "java", "auto": true}))
+	assert.Nil(t, newTestHook(t, map[string]interface{}{"pattern": "^\\[", "auto": true}))
+	assert.NotNil(t, newTestHook(t, map[string]interface{}{"auto": true}))
+}
+
+func TestHookDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "automultiline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h := newTestHook(t, map[string]interface{}{"auto": true, "sample_lines": 4})
+	javaPattern := cfginput.MultilinePresetConfig("java")["pattern"]
+
+	// 每个文件单独识别
+	java := filepath.Join(dir, "java.log")
+	writeLines(t, java,
+		"2021-01-01 00:00:00 ERROR request failed",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Service.handle(Service.java:42)",
+	)
+	plain := filepath.Join(dir, "plain.log")
+	writeLines(t, plain, "a", "b", "c", "d")
+	assert.Equal(t, javaPattern, prepare(t, h, newTestFile(t, java)))
+	assert.Equal(t, "", prepare(t, h, newTestFile(t, plain)))
+
+	// 已读取足够的行数后不再识别
+	f := newTestFile(t, plain)
+	writeLines(t, plain, "\tat com.example.Service.handle(Service.java:42)")
+	info, err := os.Stat(plain)
+	assert.NoError(t, err)
+	assert.False(t, h.Refresh(f, info))
+}
+
+func TestHookRedetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "automultiline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h := newTestHook(t, map[string]interface{}{"auto": true, "sample_lines": 4})
+	path := filepath.Join(dir, "test.log")
+	writeLines(t, path, "2021-01-01 00:00:00 INFO started")
+
+	// 内容不足 N 行时先不做多行合并
+	f := newTestFile(t, path)
+	assert.Equal(t, "", prepare(t, h, f))
+	assert.False(t, h.Refresh(f, f.Info))
+
+	// 文件增长后识别出预设规则，重新开始采集
+	writeLines(t, path,
+		"2021-01-01 00:00:00 INFO started",
+		"java.lang.IllegalStateException: boom",
+		"\tat com.example.Service.handle(Service.java:42)",
+	)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, h.Refresh(f, info))
+	assert.False(t, h.Refresh(f, info))
+	assert.Equal(t, cfginput.MultilinePresetConfig("java")["pattern"], prepare(t, h, newTestFile(t, path)))
+
+	// 文件删除后移除识别结果
+	h.Forget(path)
+	assert.Empty(t, h.(*hook).files)
+}
@@ -0,0 +1,223 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package backfill
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listFiles 获取需要回填的文件及其大小，文件列表在回填开始时确定，之后新增的文件不再处理
+func listFiles(patterns, excludeFiles []string, since time.Time) (map[string]int64, error) {
+	excludes := make([]*regexp.Regexp, 0, len(excludeFiles))
+	for _, expr := range excludeFiles {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_files(%s): %v", expr, err)
+		}
+		excludes = append(excludes, re)
+	}
+
+	files := make(map[string]int64)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path(%s): %v", pattern, err)
+		}
+	match:
+		for _, path := range matches {
+			for _, re := range excludes {
+				if re.MatchString(path) {
+					continue match
+				}
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if !since.IsZero() && info.ModTime().Before(since) {
+				continue
+			}
+			files[path] = info.Size()
+		}
+	}
+	return files, nil
+}
+
+// progress 回填进度，以文件开始回填时的大小作为总量
+type progress struct {
+	mtx     sync.Mutex
+	sizes   map[string]int64
+	offsets map[string]int64
+	lines   int64
+}
+
+func newProgress(sizes map[string]int64) *progress {
+	return &progress{
+		sizes:   sizes,
+		offsets: make(map[string]int64, len(sizes)),
+	}
+}
+
+// update 更新文件的读取位置，返回新增读取的字节数
+func (p *progress) update(source string, offset int64) int64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if _, ok := p.sizes[source]; !ok {
+		return 0
+	}
+	last := p.offsets[source]
+	if offset <= last {
+		return 0
+	}
+	p.offsets[source] = offset
+	return offset - last
+}
+
+func (p *progress) addLines(n int64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.lines += n
+}
+
+// stat 返回已完成字节数、总字节数以及读取的行数
+func (p *progress) stat() (done, total, lines int64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for source, size := range p.sizes {
+		total += size
+		if offset := p.offsets[source]; offset < size {
+			done += offset
+		} else {
+			done += size
+		}
+	}
+	return done, total, p.lines
+}
+
+// completed 所有文件都已读取到回填开始时的大小
+func (p *progress) completed() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for source, size := range p.sizes {
+		if p.offsets[source] < size {
+			return false
+		}
+	}
+	return true
+}
+
+// marker 回填完成标记，存在时不再重复回填
+type marker struct {
+	DataID     int       `json:"dataid"`
+	Paths      []string  `json:"paths"`
+	Since      string    `json:"since,omitempty"`
+	Files      int       `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	Lines      int64     `json:"lines"`
+	StartTime  time.Time `json:"start_time"`
+	FinishTime time.Time `json:"finish_time"`
+}
+
+// markerFile 根据 dataid、paths 以及 since 生成完成标记的文件路径，配置变化后重新回填
+func markerFile(dir string, dataID int, paths []string, since string) string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "\n") + "\n" + since))
+	return filepath.Join(dir, fmt.Sprintf("%d-%x.json", dataID, sum[:8]))
+}
+
+// loadMarker 读取完成标记，不存在时返回 nil
+func loadMarker(path string) (*marker, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &marker{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// saveMarker 写入临时文件后重命名，避免写入一半的标记
+func saveMarker(path string, m *marker) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// rateLimiter 按字节数限速的令牌桶，最多允许 1 秒的突发
+type rateLimiter struct {
+	mtx    sync.Mutex
+	limit  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{
+		limit:  float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// reserve 消耗 n 个字节的令牌，返回需要等待的时间
+func (r *rateLimiter) reserve(n int64) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.limit
+	if r.tokens > r.limit {
+		r.tokens = r.limit
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.limit * float64(time.Second))
+}
@@ -0,0 +1,210 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package backfill
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+)
+
+func TestListFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	now := time.Now()
+	write("a.log", "hello\n", now)
+	write("b.log", "old\n", now.Add(-48*time.Hour))
+	write("c.log.gz", "gz", now)
+
+	files, err := listFiles([]string{filepath.Join(dir, "*")}, []string{`\.gz$`}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		filepath.Join(dir, "a.log"): 6,
+		filepath.Join(dir, "b.log"): 4,
+	}, files)
+
+	files, err = listFiles([]string{filepath.Join(dir, "*.log")}, nil, now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{filepath.Join(dir, "a.log"): 6}, files)
+
+	_, err = listFiles([]string{filepath.Join(dir, "*")}, []string{"("}, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestProgress(t *testing.T) {
+	p := newProgress(map[string]int64{"/a.log": 10, "/b.log": 20})
+	assert.False(t, p.completed())
+
+	assert.Equal(t, int64(5), p.update("/a.log", 5))
+	assert.Equal(t, int64(0), p.update("/a.log", 3))
+	assert.Equal(t, int64(0), p.update("/other.log", 100))
+	// 回填期间文件继续写入，超出部分不计入进度
+	assert.Equal(t, int64(7), p.update("/a.log", 12))
+	p.addLines(2)
+
+	done, total, lines := p.stat()
+	assert.Equal(t, int64(10), done)
+	assert.Equal(t, int64(30), total)
+	assert.Equal(t, int64(2), lines)
+	assert.False(t, p.completed())
+
+	p.update("/b.log", 20)
+	assert.True(t, p.completed())
+
+	assert.True(t, newProgress(map[string]int64{}).completed())
+}
+
+func TestMarker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := markerFile(filepath.Join(dir, "marker"), 1001, []string{"/b/*.log", "/a/*.log"}, "")
+	assert.Equal(t, path, markerFile(filepath.Join(dir, "marker"), 1001, []string{"/a/*.log", "/b/*.log"}, ""))
+	assert.NotEqual(t, path, markerFile(filepath.Join(dir, "marker"), 1001, []string{"/a/*.log", "/b/*.log"}, "2021-01-01T00:00:00Z"))
+	assert.NotEqual(t, path, markerFile(filepath.Join(dir, "marker"), 1002, []string{"/a/*.log", "/b/*.log"}, ""))
+
+	m, err := loadMarker(path)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	assert.NoError(t, saveMarker(path, &marker{DataID: 1001, Files: 2, Bytes: 30, Lines: 3}))
+	m, err = loadMarker(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1001, m.DataID)
+	assert.Equal(t, int64(30), m.Bytes)
+	assert.Equal(t, int64(3), m.Lines)
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter(100)
+	// 允许 1 秒的突发
+	assert.Equal(t, time.Duration(0), r.reserve(100))
+	wait := r.reserve(50)
+	assert.True(t, wait > 400*time.Millisecond && wait <= 500*time.Millisecond, wait)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := defaultConfig
+	assert.Error(t, c.Validate())
+
+	c.Paths = []string{"/var/log/*.log"}
+	assert.NoError(t, c.Validate())
+
+	c.Backfill.Since = "yesterday"
+	assert.Error(t, c.Validate())
+
+	c.Backfill.Since = "2021-01-01T00:00:00Z"
+	since, err := c.since()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), since)
+}
+
+// testOutlet 记录发送的事件
+type testOutlet struct {
+	mtx    sync.Mutex
+	events []*util.Data
+	done   chan struct{}
+}
+
+func (o *testOutlet) OnEvent(data *util.Data) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.events = append(o.events, data)
+	return true
+}
+
+func (o *testOutlet) Close() error {
+	return nil
+}
+
+func (o *testOutlet) Done() <-chan struct{} {
+	return o.done
+}
+
+func TestInputOnAck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outlet := &testOutlet{done: make(chan struct{})}
+	p := &Input{
+		config:     config{DataID: 1001, StateNamespace: "task-1001"},
+		outlet:     outlet,
+		markerFile: filepath.Join(dir, "marker"),
+		progress:   newProgress(map[string]int64{"/a.log": 10}),
+		acked:      newProgress(map[string]int64{"/a.log": 10}),
+		readDone:   make(chan struct{}),
+		completed:  make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	p.progress.update("/a.log", 10)
+
+	// 读取完成但未确认发送时不写入完成标记
+	p.onAck([]file.State{registrar.WithNamespace(file.State{Source: "/a.log", Offset: 5}, "task-1001")})
+	// 其他任务相同文件的确认不影响回填进度
+	p.onAck([]file.State{
+		{Source: "/a.log", Offset: 10},
+		registrar.WithNamespace(file.State{Source: "/a.log", Offset: 10}, "task-1002"),
+	})
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-p.completed:
+		t.Fatal("completed before ack")
+	default:
+	}
+	m, err := loadMarker(p.markerFile)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	p.onAck([]file.State{registrar.WithNamespace(file.State{Source: "/a.log", Offset: 10}, "task-1001")})
+	select {
+	case <-p.completed:
+	case <-time.After(time.Second):
+		t.Fatal("not completed after ack")
+	}
+	assert.Eventually(t, func() bool {
+		outlet.mtx.Lock()
+		defer outlet.mtx.Unlock()
+		return len(outlet.events) == 1
+	}, time.Second, 10*time.Millisecond)
+	m, err = loadMarker(p.markerFile)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), m.Bytes)
+}
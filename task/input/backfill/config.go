@@ -0,0 +1,78 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package backfill
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+var defaultConfig = config{
+	FileInput: "log",
+	Backfill: backfillConfig{
+		MaxBytesPerSecond: 5 * humanize.MiByte,
+	},
+}
+
+type config struct {
+	DataID       int            `config:"dataid"`
+	Paths        []string       `config:"paths"`
+	ExcludeFiles []string       `config:"exclude_files"`
+	Backfill     backfillConfig `config:"backfill"`
+
+	FileInput      string `config:"file_input"`      // 读取文件的日志采集类型，由任务配置初始化时确定
+	StateNamespace string `config:"state_namespace"` // 采集进度的命名空间，由任务创建 input 时写入
+}
+
+type backfillConfig struct {
+	Since             string `config:"since"`                // RFC3339 格式，仅回填修改时间不早于该时间的文件，为空时回填全部文件
+	MaxBytesPerSecond int64  `config:"max_bytes_per_second"` // 读取速率上限，避免影响持续采集的任务
+	MarkerPath        string `config:"marker_path"`          // 完成标记的存储目录，默认在 data 目录下
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("paths is required in backfill mode")
+	}
+	if _, err := c.since(); err != nil {
+		return err
+	}
+	if c.Backfill.MaxBytesPerSecond <= 0 {
+		return fmt.Errorf("backfill.max_bytes_per_second must be greater than 0")
+	}
+	return nil
+}
+
+func (c *config) since() (time.Time, error) {
+	if c.Backfill.Since == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, c.Backfill.Since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid backfill.since(%s): %v", c.Backfill.Since, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,432 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package backfill
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const (
+	inputName         = "backfill"
+	defaultMarkerPath = "backfill"
+)
+
+var (
+	backfillStarted   = bkmonitoring.NewInt("backfill_started")   // 开始回填的任务数
+	backfillCompleted = bkmonitoring.NewInt("backfill_completed") // 完成回填的任务数
+	backfillSkipped   = bkmonitoring.NewInt("backfill_skipped")   // 已有完成标记而跳过的任务数
+	backfillError     = bkmonitoring.NewInt("backfill_error")     // 回填异常次数
+
+	// inputs 运行中的回填任务，用于处理 pipeline 的确认回调
+	inputs   = map[*Input]struct{}{}
+	inputsMu sync.RWMutex
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+	base.RegisterAckObserver(onAck)
+}
+
+// onAck pipeline 确认发送后回调，更新各回填任务已确认的进度
+func onAck(states []file.State) {
+	inputsMu.RLock()
+	defer inputsMu.RUnlock()
+	for p := range inputs {
+		p.onAck(states)
+	}
+}
+
+// Input 一次性读取存量文件到末尾，所有数据确认发送后写入完成标记
+// 由 log 类型任务配置 mode: backfill 后切换而来，见 config/input/log.go
+type Input struct {
+	mutex        sync.Mutex
+	started      bool
+	readOnce     sync.Once
+	readDone     chan struct{} // 所有文件已读取到末尾
+	completeOnce sync.Once
+	completed    chan struct{} // 所有数据已确认发送并写入完成标记
+
+	config  config
+	cfg     *common.Config
+	outlet  channel.Outleter
+	context input.Context
+
+	markerFile string
+	startTime  time.Time
+	progress   *progress // 读取进度
+	acked      *progress // 已确认发送的进度，全部完成后才写入完成标记
+	limiter    *rateLimiter
+	child      input.Input
+	done       chan struct{}
+
+	bytesTotal *bkmonitoring.Int
+	bytesDone  *bkmonitoring.Int
+}
+
+// NewInput creates a new backfill input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	markerPath := config.Backfill.MarkerPath
+	if markerPath == "" {
+		markerPath = paths.Resolve(paths.Data, defaultMarkerPath)
+	}
+
+	p := &Input{
+		config:     config,
+		cfg:        cfg,
+		outlet:     outlet,
+		context:    context,
+		markerFile: markerFile(markerPath, config.DataID, config.Paths, config.Backfill.Since),
+		limiter:    newRateLimiter(config.Backfill.MaxBytesPerSecond),
+		readDone:   make(chan struct{}),
+		completed:  make(chan struct{}),
+		done:       make(chan struct{}),
+		bytesTotal: bkmonitoring.NewIntWithDataID(config.DataID, "backfill_bytes_total"),
+		bytesDone:  bkmonitoring.NewIntWithDataID(config.DataID, "backfill_bytes_done"),
+	}
+	return p, nil
+}
+
+// Run 首次调用时确定回填的文件列表，之后由 input.Runner 周期调用以推进读取并输出进度
+func (p *Input) Run() {
+	p.mutex.Lock()
+	if !p.started {
+		if err := p.start(); err != nil {
+			p.mutex.Unlock()
+			backfillError.Add(1)
+			logp.Err("%s(dataid=%d) start error: %v", inputName, p.config.DataID, err)
+			return
+		}
+	}
+	child := p.child
+	p.mutex.Unlock()
+
+	if p.isReadDone() {
+		return
+	}
+	done, total, lines := p.progress.stat()
+	logp.Info("%s(dataid=%d) progress: %d/%d bytes, %d lines", inputName, p.config.DataID, done, total, lines)
+	// 日志采集在扫描时会同步发送事件，不能持有锁
+	child.Run()
+}
+
+func (p *Input) isReadDone() bool {
+	select {
+	case <-p.readDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// start 检查完成标记，确定回填的文件列表并创建日志采集
+func (p *Input) start() error {
+	m, err := loadMarker(p.markerFile)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		backfillSkipped.Add(1)
+		logp.Info("%s(dataid=%d) already completed at %s, skip", inputName, p.config.DataID, m.FinishTime)
+		p.started = true
+		p.readOnce.Do(func() { close(p.readDone) })
+		p.completeOnce.Do(func() { close(p.completed) })
+		return nil
+	}
+
+	since, _ := p.config.since()
+	files, err := listFiles(p.config.Paths, p.config.ExcludeFiles, since)
+	if err != nil {
+		return err
+	}
+	p.progress = newProgress(files)
+	p.acked = newProgress(files)
+	// 从上次中断的位置继续，Registrar 中的进度都已确认发送
+	for _, state := range p.context.States {
+		p.progress.update(state.Source, state.Offset)
+		p.acked.update(state.Source, state.Offset)
+	}
+
+	if !p.progress.completed() {
+		p.child, err = p.newChildInput(files)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.startTime = time.Now()
+	p.started = true
+	backfillStarted.Add(1)
+	done, total, _ := p.progress.stat()
+	p.bytesTotal.Set(total)
+	p.bytesDone.Set(done)
+	logp.Info("%s(dataid=%d) start, files: %d, bytes: %d/%d", inputName, p.config.DataID, len(files), done, total)
+
+	if p.child == nil {
+		p.readOnce.Do(p.finishRead)
+	}
+	if p.acked.completed() {
+		p.completeOnce.Do(p.complete)
+		return nil
+	}
+	inputsMu.Lock()
+	inputs[p] = struct{}{}
+	inputsMu.Unlock()
+	return nil
+}
+
+// newChildInput 使用固定的文件列表创建日志采集
+func (p *Input) newChildInput(files map[string]int64) (input.Input, error) {
+	cfg, err := common.NewConfigFrom(p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = cfg.Remove("paths", -1)
+	sources := make([]string, 0, len(files))
+	for source := range files {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for i, source := range sources {
+		if err = cfg.SetString("paths", i, source); err != nil {
+			return nil, err
+		}
+	}
+	// 开启文件保护、编码识别等功能时由按文件管理的日志采集读取
+	factory, err := input.GetFactory(p.config.FileInput)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.SetString("type", -1, p.config.FileInput); err != nil {
+		return nil, err
+	}
+
+	connector := func(*common.Config, *common.MapStrPointer) (channel.Outleter, error) {
+		return &backfillOutlet{input: p}, nil
+	}
+	return factory(cfg, connector, p.context)
+}
+
+// onEvent 更新进度并限速，所有文件读取完成后结束回填
+func (p *Input) onEvent(data *util.Data) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+
+	if data.Event.Fields != nil {
+		p.progress.addLines(int64(data.Event.Count()))
+	}
+	state := data.GetState()
+	if delta := p.progress.update(state.Source, state.Offset); delta > 0 {
+		done, _, _ := p.progress.stat()
+		p.bytesDone.Set(done)
+		if wait := p.limiter.reserve(delta); wait > 0 {
+			select {
+			case <-p.done:
+				return false
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	if !p.outlet.OnEvent(data) {
+		return false
+	}
+	if p.progress.completed() {
+		p.readOnce.Do(p.finishRead)
+	}
+	return true
+}
+
+// finishRead 所有文件读取到末尾后停止日志采集，仅执行一次
+func (p *Input) finishRead() {
+	close(p.readDone)
+	done, total, lines := p.progress.stat()
+	logp.Info("%s(dataid=%d) read finished, bytes: %d/%d, lines: %d, waiting for ack",
+		inputName, p.config.DataID, done, total, lines)
+
+	// 当前可能处于 harvester 的发送流程中，需要异步停止
+	// 文件列表为空时在 start 中完成，此时还未创建日志采集
+	if p.child != nil {
+		go p.child.Stop()
+	}
+}
+
+// onAck 更新已确认发送的进度，全部确认后完成回填
+func (p *Input) onAck(states []file.State) {
+	for _, state := range states {
+		// 其他任务采集相同文件的确认不影响回填进度
+		if registrar.GetStateNamespace(state) != p.config.StateNamespace {
+			continue
+		}
+		p.acked.update(state.Source, state.Offset)
+	}
+	if !p.acked.completed() {
+		return
+	}
+	// 确认回调中不能阻塞，汇总事件的发送需要异步执行
+	go p.completeOnce.Do(p.complete)
+}
+
+// complete 所有数据确认发送后写入完成标记并发送汇总事件，仅执行一次
+// 完成标记写入前退出时，下次启动从 Registrar 中的进度继续，不会丢失数据
+func (p *Input) complete() {
+	close(p.completed)
+	inputsMu.Lock()
+	delete(inputs, p)
+	inputsMu.Unlock()
+
+	done, total, lines := p.progress.stat()
+	m := &marker{
+		DataID:     p.config.DataID,
+		Paths:      p.config.Paths,
+		Since:      p.config.Backfill.Since,
+		Files:      len(p.progress.sizes),
+		Bytes:      total,
+		Lines:      lines,
+		StartTime:  p.startTime,
+		FinishTime: time.Now(),
+	}
+	if err := saveMarker(p.markerFile, m); err != nil {
+		backfillError.Add(1)
+		logp.Err("%s(dataid=%d) save marker error: %v", inputName, p.config.DataID, err)
+	}
+	backfillCompleted.Add(1)
+	logp.Info("%s(dataid=%d) completed, files: %d, bytes: %d/%d, lines: %d, duration: %s",
+		inputName, p.config.DataID, m.Files, done, total, lines, m.FinishTime.Sub(m.StartTime))
+
+	p.sendSummary(m)
+}
+
+// sendSummary 发送回填完成的汇总事件
+func (p *Input) sendSummary(m *marker) {
+	summary, err := json.Marshal(map[string]interface{}{
+		"event":       "backfill_completed",
+		"files":       m.Files,
+		"bytes":       m.Bytes,
+		"lines":       m.Lines,
+		"start_time":  m.StartTime,
+		"finish_time": m.FinishTime,
+		"duration_ms": m.FinishTime.Sub(m.StartTime).Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: m.FinishTime,
+		Fields:    common.MapStr{"data": string(summary)},
+	}
+	data.SetState(base.NewStatelessState(fmt.Sprintf("%s://%d", inputName, m.DataID)))
+	formatter.SetEventExt(data, map[string]interface{}{"backfill_status": "completed"})
+	p.outlet.OnEvent(data)
+}
+
+// Stop 停止回填，未完成时下次启动从中断的位置继续
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	logp.Info("Stopping %s(dataid=%d) input", inputName, p.config.DataID)
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	child := p.child
+	p.mutex.Unlock()
+
+	inputsMu.Lock()
+	delete(inputs, p)
+	inputsMu.Unlock()
+
+	if child != nil {
+		child.Stop()
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
+
+// backfillOutlet 日志采集的 outlet，关闭时不影响任务的 outlet
+type backfillOutlet struct {
+	input *Input
+}
+
+// OnEvent 转发到回填任务
+func (o *backfillOutlet) OnEvent(data *util.Data) bool {
+	return o.input.onEvent(data)
+}
+
+// Close 由日志采集停止时调用
+func (o *backfillOutlet) Close() error {
+	return nil
+}
+
+// Done 返回回填任务状态
+func (o *backfillOutlet) Done() <-chan struct{} {
+	return o.input.done
+}
@@ -0,0 +1,71 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package compressed
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	extGzip  = ".gz"
+	extBzip2 = ".bz2"
+	extZstd  = ".zst"
+)
+
+var defaultConfig = Config{
+	Enabled:       false,
+	Extensions:    []string{extGzip, extBzip2, extZstd},
+	ScanFrequency: 10 * time.Second,
+}
+
+// Config 压缩文件采集配置，位于日志采集配置的 compressed 下
+type Config struct {
+	Enabled       bool          `config:"enabled"`
+	Paths         []string      `config:"paths"`      // 压缩文件路径，为空时根据日志采集的 paths 推导
+	Extensions    []string      `config:"extensions"` // 支持的压缩格式后缀：.gz、.bz2、.zst
+	ScanFrequency time.Duration `config:"scan_frequency"`
+}
+
+// Validate 校验压缩格式后缀
+func (c *Config) Validate() error {
+	for _, ext := range c.Extensions {
+		switch ext {
+		case extGzip, extBzip2, extZstd:
+		default:
+			return fmt.Errorf("compressed extension(%s) is not supported", ext)
+		}
+	}
+	if c.ScanFrequency <= 0 {
+		return fmt.Errorf("compressed scan_frequency must be greater than 0")
+	}
+	return nil
+}
+
+// inputConfig 从日志采集配置中解析压缩文件采集需要的配置
+type inputConfig struct {
+	Paths          []string `config:"paths"`
+	MaxBytes       int      `config:"max_bytes"`
+	FileIdentifier string   `config:"file_identifier"`
+	Compressed     Config   `config:"compressed"`
+}
@@ -0,0 +1,121 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package compressed
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// fingerprintSize 计算指纹时读取的文件头大小
+const fingerprintSize = 4096
+
+// fingerprint 使用文件头和文件大小计算压缩文件的指纹
+// 压缩文件生成后不再变化，指纹可用于识别 inode 复用以及同一文件被改名的情况
+func fingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.CopyN(h, f, fingerprintSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil)[:16], size), nil
+}
+
+// matchExtension 返回文件对应的压缩格式后缀，不支持时返回空
+func matchExtension(path string, extensions []string) string {
+	for _, ext := range extensions {
+		if strings.HasSuffix(path, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// newDecompressor 按压缩格式创建解压 reader
+func newDecompressor(ext string, r io.Reader) (io.ReadCloser, error) {
+	switch ext {
+	case extGzip:
+		return gzip.NewReader(r)
+	case extBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case extZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("compressed extension(%s) is not supported", ext)
+	}
+}
+
+// skipBytes 跳过解压后的前 offset 个字节，返回实际跳过的字节数
+func skipBytes(r io.Reader, offset int64) (int64, error) {
+	if offset <= 0 {
+		return 0, nil
+	}
+	n, err := io.CopyN(ioutil.Discard, r, offset)
+	if err == io.EOF {
+		return n, nil
+	}
+	return n, err
+}
+
+// readLines 按行读取解压后的内容，offset 为当前行结束后的位置
+// 超过 maxBytes 的行会被截断，fn 返回 false 时停止读取
+func readLines(r io.Reader, offset int64, maxBytes int, fn func(line string, offset int64) bool) (int64, error) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			offset += int64(len(line))
+			text := strings.TrimRight(line, "\r\n")
+			if maxBytes > 0 && len(text) > maxBytes {
+				text = text[:maxBytes]
+			}
+			if !fn(text, offset) {
+				return offset, nil
+			}
+		}
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeGzip(t *testing.T, path, content string) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.log.1.gz")
+	b := filepath.Join(dir, "b.log.1.gz")
+	writeGzip(t, a, "line1\nline2\n")
+	writeGzip(t, b, "line3\n")
+
+	infoA, _ := os.Stat(a)
+	infoB, _ := os.Stat(b)
+	fpA, err := fingerprint(a, infoA.Size())
+	assert.NoError(t, err)
+	fpB, err := fingerprint(b, infoB.Size())
+	assert.NoError(t, err)
+	assert.NotEqual(t, fpA, fpB)
+
+	// 改名后指纹不变
+	renamed := filepath.Join(dir, "a.log.2.gz")
+	assert.NoError(t, os.Rename(a, renamed))
+	fpRenamed, err := fingerprint(renamed, infoA.Size())
+	assert.NoError(t, err)
+	assert.Equal(t, fpA, fpRenamed)
+}
+
+func TestMatchExtension(t *testing.T) {
+	extensions := defaultConfig.Extensions
+	assert.Equal(t, ".gz", matchExtension("/var/log/a.log.1.gz", extensions))
+	assert.Equal(t, ".bz2", matchExtension("/var/log/a.log-20210101.bz2", extensions))
+	assert.Equal(t, ".zst", matchExtension("/var/log/a.log.zst", extensions))
+	assert.Equal(t, "", matchExtension("/var/log/a.log.zip", extensions))
+}
+
+func TestReadLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log.1.gz")
+	writeGzip(t, path, "line1\nline2\r\nlong-line3\nline4")
+
+	read := func(offset int64, maxBytes int) ([]string, []int64, int64) {
+		f, err := os.Open(path)
+		assert.NoError(t, err)
+		defer f.Close()
+		r, err := newDecompressor(extGzip, f)
+		assert.NoError(t, err)
+		defer r.Close()
+
+		skipped, err := skipBytes(r, offset)
+		assert.NoError(t, err)
+
+		var lines []string
+		var offsets []int64
+		end, err := readLines(r, skipped, maxBytes, func(line string, offset int64) bool {
+			lines = append(lines, line)
+			offsets = append(offsets, offset)
+			return true
+		})
+		assert.NoError(t, err)
+		return lines, offsets, end
+	}
+
+	// 从头读取，最后一行没有换行符也需要读取
+	lines, offsets, end := read(0, 0)
+	assert.Equal(t, []string{"line1", "line2", "long-line3", "line4"}, lines)
+	assert.Equal(t, []int64{6, 13, 24, 29}, offsets)
+	assert.EqualValues(t, 29, end)
+
+	// 从原始文件的进度处续读
+	lines, _, _ = read(13, 0)
+	assert.Equal(t, []string{"long-line3", "line4"}, lines)
+
+	// 超长的行被截断
+	lines, _, _ = read(13, 4)
+	assert.Equal(t, []string{"long", "line"}, lines)
+
+	// 进度超过解压后的大小
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	r, err := newDecompressor(extGzip, f)
+	assert.NoError(t, err)
+	skipped, err := skipBytes(r, 100)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 29, skipped)
+}
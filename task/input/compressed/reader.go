@@ -0,0 +1,399 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package compressed
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+)
+
+const (
+	// stateTTLNever 压缩文件存在期间一直保留采集进度，文件删除后由 Reader 通知 registrar 清理
+	stateTTLNever = -1
+	// originOffsetTTL 原始文件删除后保留其采集进度的时长，超过后对应的压缩文件从头读取
+	originOffsetTTL = 24 * time.Hour
+)
+
+var (
+	compressedFilesRead    = bkmonitoring.NewInt("compressed_files_read")    // 读取完成的压缩文件数
+	compressedFilesResumed = bkmonitoring.NewInt("compressed_files_resumed") // 从原始文件进度续读的压缩文件数
+	compressedLines        = bkmonitoring.NewInt("compressed_lines")         // 从压缩文件读取的行数
+	compressedErrors       = bkmonitoring.NewInt("compressed_read_error")    // 读取失败次数
+)
+
+// IsCompressedState 判断 state 是否由压缩文件采集产生
+func IsCompressedState(state file.State) bool {
+	return registrar.GetStateFingerprint(state) != ""
+}
+
+// originOffset 原始文件最后的采集进度
+type originOffset struct {
+	offset  int64
+	updated time.Time
+}
+
+// Reader 对轮转后被压缩的文件进行一次性读取
+// 压缩文件的采集进度以指纹区分，并尽量从压缩前原始文件的采集进度处续读，避免重复采集
+type Reader struct {
+	config   inputConfig
+	patterns []string
+	emit     func(data *util.Data) bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mtx     sync.Mutex
+	offsets map[string]originOffset // 原始文件最后的采集进度，key 为文件路径
+	states  map[string]file.State   // 压缩文件的采集进度，key 为指纹，读取完成的进度带有完成标记
+}
+
+// NewReader 根据日志采集配置创建压缩文件读取，未开启时返回 nil
+func NewReader(rawConfig *common.Config, states []file.State, emit func(data *util.Data) bool) (*Reader, error) {
+	config := inputConfig{Compressed: defaultConfig}
+	err := rawConfig.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Compressed.Enabled {
+		return nil, nil
+	}
+	return newReader(config, states, emit), nil
+}
+
+func newReader(config inputConfig, states []file.State, emit func(data *util.Data) bool) *Reader {
+	r := &Reader{
+		config:   config,
+		patterns: config.Compressed.Paths,
+		emit:     emit,
+		done:     make(chan struct{}),
+		offsets:  make(map[string]originOffset),
+		states:   make(map[string]file.State),
+	}
+	// 未单独配置时，在日志路径后追加压缩后缀，兼容 a.log.1.gz、a.log-20210101.gz 等轮转方式
+	if len(r.patterns) == 0 {
+		for _, path := range config.Paths {
+			for _, ext := range config.Compressed.Extensions {
+				r.patterns = append(r.patterns, path+"*"+ext)
+			}
+		}
+	}
+
+	for _, state := range states {
+		if fp := registrar.GetStateFingerprint(state); fp != "" {
+			r.states[fp] = state
+		} else {
+			r.offsets[state.Source] = originOffset{offset: state.Offset, updated: state.Timestamp}
+		}
+	}
+	return r
+}
+
+// Observe 记录原始文件的采集进度，用于压缩后续读
+func (r *Reader) Observe(state file.State) {
+	if IsCompressedState(state) {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.offsets[state.Source] = originOffset{offset: state.Offset, updated: time.Now()}
+}
+
+// Start 按 scan_frequency 周期扫描压缩文件
+func (r *Reader) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.config.Compressed.ScanFrequency)
+		defer ticker.Stop()
+		for {
+			r.scan()
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止扫描并等待当前文件读取退出
+func (r *Reader) Stop() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *Reader) isDone() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// scan 读取匹配到的压缩文件，完整扫描后清理已删除文件的采集进度
+func (r *Reader) scan() {
+	seen := make(map[string]struct{})
+	complete := true
+	for _, pattern := range r.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			complete = false
+			logp.L.Errorf("compressed glob(%s) error: %v", pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			if r.isDone() {
+				return
+			}
+			ext := matchExtension(path, r.config.Compressed.Extensions)
+			if ext == "" {
+				continue
+			}
+			fp, err := r.readFile(path, ext)
+			if fp != "" {
+				seen[fp] = struct{}{}
+			} else if err != nil {
+				// 无法确认文件指纹时不清理，避免误删仍然存在的文件的采集进度
+				complete = false
+			}
+			if err != nil {
+				compressedErrors.Add(1)
+				logp.L.Errorf("compressed read file(%s) error: %v", path, err)
+			}
+		}
+	}
+	if complete && !r.isDone() {
+		r.prune(seen)
+	}
+}
+
+// readFile 读取单个压缩文件，已读取完成的文件直接跳过，返回文件的指纹
+func (r *Reader) readFile(path, ext string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil
+	}
+	fp, err := fingerprint(path, info.Size())
+	if err != nil {
+		return "", err
+	}
+
+	r.mtx.Lock()
+	previous, hasPrevious := r.states[fp]
+	r.mtx.Unlock()
+	if hasPrevious && registrar.IsStateCompleted(previous) {
+		// 重启后重新接管已读取完成的进度，避免被 registrar 清理后重复读取
+		if previous.TTL != stateTTLNever || previous.Source != path {
+			previous.Source = path
+			r.finish(fp, previous)
+		}
+		return fp, nil
+	}
+
+	// 压缩前的原始文件仍然存在时由日志采集负责，等原始文件删除后再读取
+	origin := strings.TrimSuffix(path, ext)
+	if _, err = os.Stat(origin); err == nil {
+		return fp, nil
+	}
+
+	r.mtx.Lock()
+	originState, hasOrigin := r.offsets[origin]
+	r.mtx.Unlock()
+
+	state := registrar.WithFingerprint(file.State{
+		Source:         path,
+		Type:           "log",
+		Fileinfo:       info,
+		FileStateOS:    commonFile.GetOSState(info),
+		FileIdentifier: r.config.FileIdentifier,
+		TTL:            stateTTLNever,
+	}, fp)
+	resumed := false
+	if hasPrevious {
+		state.Offset = previous.Offset
+	} else if hasOrigin {
+		state.Offset = originState.offset
+		resumed = true
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fp, err
+	}
+	defer f.Close()
+	reader, err := newDecompressor(ext, f)
+	if err != nil {
+		return fp, err
+	}
+	defer reader.Close()
+
+	skipped, err := skipBytes(reader, state.Offset)
+	if err != nil {
+		return fp, err
+	}
+	if skipped < state.Offset {
+		if !resumed {
+			// 上次已读取到文件末尾，仅需标记读取完成
+			r.finish(fp, state)
+			return fp, nil
+		}
+		// 原始文件的进度超过了解压后的大小，说明并非同一个文件，从头读取
+		logp.L.Warnf("compressed file(%s) is shorter than origin(%s) offset %d, read from beginning",
+			path, origin, state.Offset)
+		return fp, r.readFromBeginning(path, ext, fp, state)
+	}
+	if resumed {
+		compressedFilesResumed.Add(1)
+		logp.L.Infof("compressed file(%s) resume from origin(%s) offset %d", path, origin, state.Offset)
+	}
+	return fp, r.read(reader, fp, state)
+}
+
+func (r *Reader) readFromBeginning(path, ext, fp string, state file.State) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := newDecompressor(ext, f)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	state.Offset = 0
+	return r.read(reader, fp, state)
+}
+
+func (r *Reader) read(reader io.Reader, fp string, state file.State) error {
+	stopped := false
+	_, err := readLines(reader, state.Offset, r.config.MaxBytes, func(line string, offset int64) bool {
+		if r.isDone() {
+			stopped = true
+			return false
+		}
+		state.Offset = offset
+		state.Timestamp = time.Now()
+		data := &util.Data{Event: beat.Event{
+			Timestamp: state.Timestamp,
+			Fields:    common.MapStr{"data": line},
+		}}
+		data.SetState(state)
+		if !r.emit(data) {
+			stopped = true
+			return false
+		}
+		compressedLines.Add(1)
+		return true
+	})
+
+	r.mtx.Lock()
+	r.states[fp] = state
+	r.mtx.Unlock()
+	if err != nil || stopped {
+		return err
+	}
+
+	compressedFilesRead.Add(1)
+	logp.L.Infof("compressed file(%s) read finished, offset: %d", state.Source, state.Offset)
+	r.finish(fp, state)
+	return nil
+}
+
+// finish 标记压缩文件读取完成，并发送采集进度
+// 完成标记随采集进度持久化，重启后不会再次读取
+func (r *Reader) finish(fp string, state file.State) {
+	state = registrar.WithCompleted(state)
+	state.Finished = true
+	state.TTL = stateTTLNever
+	state.Timestamp = time.Now()
+	data := &util.Data{}
+	data.SetState(state)
+	if !r.emit(data) {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.states[fp] = state
+}
+
+// prune 清理已删除的压缩文件以及长时间未更新的原始文件的采集进度
+func (r *Reader) prune(seen map[string]struct{}) {
+	now := time.Now()
+	var removed []file.State
+
+	r.mtx.Lock()
+	for fp, state := range r.states {
+		if _, ok := seen[fp]; ok {
+			continue
+		}
+		delete(r.states, fp)
+		// 已接管的进度不会过期，需要通知 registrar 清理；未接管的进度由 registrar 自行清理
+		if state.TTL == stateTTLNever {
+			removed = append(removed, state)
+		}
+	}
+	for path, origin := range r.offsets {
+		if now.Sub(origin.updated) < originOffsetTTL {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		delete(r.offsets, path)
+	}
+	r.mtx.Unlock()
+
+	for _, state := range removed {
+		state.Finished = true
+		state.TTL = 0
+		state.Timestamp = now
+		data := &util.Data{}
+		data.SetState(state)
+		if !r.emit(data) {
+			return
+		}
+	}
+}
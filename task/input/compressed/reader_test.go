@@ -0,0 +1,185 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package compressed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
+)
+
+// mockOutput 记录 Reader 发送的事件
+type mockOutput struct {
+	mtx    sync.Mutex
+	lines  []string
+	states []file.State
+}
+
+func (o *mockOutput) emit(data *util.Data) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if data.Event.Fields != nil {
+		line, _ := data.Event.Fields.GetValue("data")
+		o.lines = append(o.lines, line.(string))
+	}
+	o.states = append(o.states, data.GetState())
+	return true
+}
+
+func (o *mockOutput) lastState() file.State {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.states[len(o.states)-1]
+}
+
+func (o *mockOutput) reset() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.lines = nil
+	o.states = nil
+}
+
+func newTestReader(dir string, states []file.State, out *mockOutput) *Reader {
+	config := inputConfig{
+		Paths:          []string{filepath.Join(dir, "*.log")},
+		FileIdentifier: "inode",
+		Compressed:     defaultConfig,
+	}
+	config.Compressed.Enabled = true
+	return newReader(config, states, out.emit)
+}
+
+func TestReaderResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log.1.gz")
+	writeGzip(t, path, "line1\nline2\nline3\n")
+
+	// 从原始文件的采集进度续读
+	out := &mockOutput{}
+	r := newTestReader(dir, []file.State{{Source: filepath.Join(dir, "a.log.1"), Offset: 6}}, out)
+	r.scan()
+	assert.Equal(t, []string{"line2", "line3"}, out.lines)
+	state := out.lastState()
+	assert.True(t, state.Finished)
+	assert.True(t, registrar.IsStateCompleted(state))
+	assert.NotEmpty(t, registrar.GetStateFingerprint(state))
+	assert.EqualValues(t, 18, state.Offset)
+	assert.EqualValues(t, stateTTLNever, state.TTL)
+
+	// 同一进程内不再读取
+	out.reset()
+	r.scan()
+	assert.Empty(t, out.states)
+
+	// 重启后所有进度被重置为 Finished，根据完成标记跳过，并重新接管进度
+	restored := registrar.ResetStates([]file.State{state})
+	out.reset()
+	r = newTestReader(dir, restored, out)
+	r.scan()
+	assert.Empty(t, out.lines)
+	assert.Len(t, out.states, 1)
+	assert.True(t, registrar.IsStateCompleted(out.lastState()))
+	assert.EqualValues(t, stateTTLNever, out.lastState().TTL)
+
+	out.reset()
+	r.scan()
+	assert.Empty(t, out.states)
+}
+
+func TestReaderResumeUnfinished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log.1.gz")
+	writeGzip(t, path, "line1\nline2\nline3\n")
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	fp, err := fingerprint(path, info.Size())
+	assert.NoError(t, err)
+
+	// 上次读取到一半退出，从压缩文件自身的进度续读，忽略原始文件的进度
+	previous := registrar.WithFingerprint(file.State{Source: path, Offset: 12, FileIdentifier: "inode"}, fp)
+	origin := file.State{Source: filepath.Join(dir, "a.log.1"), Offset: 6}
+	out := &mockOutput{}
+	r := newTestReader(dir, registrar.ResetStates([]file.State{previous, origin}), out)
+	r.scan()
+	assert.Equal(t, []string{"line3"}, out.lines)
+	assert.True(t, registrar.IsStateCompleted(out.lastState()))
+
+	// 原始文件的进度超过解压后的大小，不是同一个文件，从头读取
+	other := filepath.Join(dir, "b.log.1.gz")
+	writeGzip(t, other, "b1\n")
+	out.reset()
+	r.Observe(file.State{Source: filepath.Join(dir, "b.log.1"), Offset: 100})
+	r.scan()
+	assert.Equal(t, []string{"b1"}, out.lines)
+
+	// 原始文件仍然存在时不读取
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.log.1"), []byte("c1\n"), 0644))
+	writeGzip(t, filepath.Join(dir, "c.log.1.gz"), "c1\n")
+	out.reset()
+	r.scan()
+	assert.Empty(t, out.states)
+}
+
+func TestReaderPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log.1.gz")
+	writeGzip(t, path, "line1\n")
+
+	out := &mockOutput{}
+	r := newTestReader(dir, nil, out)
+	r.Observe(file.State{Source: filepath.Join(dir, "a.log.1"), Offset: 0})
+	r.scan()
+	assert.Len(t, r.states, 1)
+
+	// 压缩文件删除后，通知 registrar 清理进度
+	assert.NoError(t, os.Remove(path))
+	out.reset()
+	r.scan()
+	assert.Empty(t, r.states)
+	assert.Len(t, out.states, 1)
+	assert.EqualValues(t, 0, out.lastState().TTL)
+	assert.True(t, out.lastState().Finished)
+
+	// 原始文件删除且长时间未更新的进度被清理
+	r.offsets[filepath.Join(dir, "a.log.1")] = originOffset{updated: time.Now().Add(-2 * originOffsetTTL)}
+	r.scan()
+	assert.Empty(t, r.offsets)
+}
@@ -0,0 +1,48 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package input
+
+import (
+	"time"
+
+	"github.com/elastic/beats/filebeat/util"
+)
+
+// containerInputType 容器标准输出采集类型，见 config/input/container.go
+const containerInputType = "container"
+
+// normalizeContainerFields 补齐容器日志的 log_time 字段
+// docker-json reader 将日志中的时间写入 Timestamp，这里与 is_container_std 的输出保持一致
+func normalizeContainerFields(data *util.Data) {
+	fields := data.Event.Fields
+	if fields == nil {
+		return
+	}
+	if _, ok := fields["log_time"]; ok {
+		return
+	}
+	if data.Event.Timestamp.IsZero() {
+		return
+	}
+	fields["log_time"] = data.Event.Timestamp.UTC().Format(time.RFC3339Nano)
+}
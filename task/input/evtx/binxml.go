@@ -0,0 +1,573 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package evtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// BinXML token 类型，带 0x40 标记的 token 表示后面还有同类数据(如更多的属性)
+const (
+	tokenEndOfStream       = 0x00
+	tokenOpenStartElement  = 0x01
+	tokenCloseStartElement = 0x02
+	tokenCloseEmptyElement = 0x03
+	tokenEndElement        = 0x04
+	tokenValue             = 0x05
+	tokenAttribute         = 0x06
+	tokenCDATASection      = 0x07
+	tokenCharRef           = 0x08
+	tokenEntityRef         = 0x09
+	tokenPITarget          = 0x0a
+	tokenPIData            = 0x0b
+	tokenTemplateInstance  = 0x0c
+	tokenNormalSubst       = 0x0d
+	tokenOptionalSubst     = 0x0e
+	tokenFragmentHeader    = 0x0f
+
+	tokenMoreDataFlag = 0x40
+)
+
+// BinXML 值类型，带 0x80 标记的为数组
+const (
+	valueNull       = 0x00
+	valueString     = 0x01
+	valueAnsiString = 0x02
+	valueInt8       = 0x03
+	valueUint8      = 0x04
+	valueInt16      = 0x05
+	valueUint16     = 0x06
+	valueInt32      = 0x07
+	valueUint32     = 0x08
+	valueInt64      = 0x09
+	valueUint64     = 0x0a
+	valueReal32     = 0x0b
+	valueReal64     = 0x0c
+	valueBool       = 0x0d
+	valueBinary     = 0x0e
+	valueGUID       = 0x0f
+	valueSizeT      = 0x10
+	valueFileTime   = 0x11
+	valueSysTime    = 0x12
+	valueSID        = 0x13
+	valueHexInt32   = 0x14
+	valueHexInt64   = 0x15
+	valueEvtHandle  = 0x20
+	valueBinXML     = 0x21
+	valueEvtXML     = 0x23
+
+	valueArrayFlag = 0x80
+)
+
+const (
+	// maxDepth 元素以及模板的最大嵌套层数，避免损坏的文件导致栈溢出
+	maxDepth = 64
+	// templateHeaderSize 模板定义头：下一个模板偏移(4)、GUID(16)、数据长度(4)
+	templateHeaderSize = 24
+)
+
+// errCorrupted 解析越界或遇到无法识别的 token，由 render 统一转换为错误
+type errCorrupted struct {
+	msg string
+}
+
+func (e errCorrupted) Error() string {
+	return e.msg
+}
+
+func corrupted(format string, args ...interface{}) {
+	panic(errCorrupted{fmt.Sprintf(format, args...)})
+}
+
+// substitution 模板实例中的替换值
+type substitution struct {
+	valueType byte
+	offset    int
+	data      []byte
+}
+
+// binXMLRenderer 将 chunk 中的 BinXML 渲染为 XML 文本，名称与模板均以 chunk 内的偏移引用
+type binXMLRenderer struct {
+	chunk []byte
+	out   strings.Builder
+	depth int
+}
+
+// renderBinXML 渲染 chunk 中从 offset 开始、长度为 size 的 BinXML
+func renderBinXML(chunk []byte, offset, size int) (xml string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(errCorrupted)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	r := &binXMLRenderer{chunk: chunk}
+	r.renderFragment(offset, offset+size, nil)
+	return r.out.String(), nil
+}
+
+func (r *binXMLRenderer) need(pos, n, end int) {
+	if pos < 0 || n < 0 || pos+n > end || pos+n > len(r.chunk) {
+		corrupted("binxml truncated at offset %d", pos)
+	}
+}
+
+func (r *binXMLRenderer) u8(pos, end int) byte {
+	r.need(pos, 1, end)
+	return r.chunk[pos]
+}
+
+func (r *binXMLRenderer) u16(pos, end int) uint16 {
+	r.need(pos, 2, end)
+	return binary.LittleEndian.Uint16(r.chunk[pos:])
+}
+
+func (r *binXMLRenderer) u32(pos, end int) uint32 {
+	r.need(pos, 4, end)
+	return binary.LittleEndian.Uint32(r.chunk[pos:])
+}
+
+func (r *binXMLRenderer) enter() {
+	r.depth++
+	if r.depth > maxDepth {
+		corrupted("binxml nested too deep")
+	}
+}
+
+func (r *binXMLRenderer) leave() {
+	r.depth--
+}
+
+// renderFragment 渲染 token 序列直到 EndOfStream 或到达 end
+func (r *binXMLRenderer) renderFragment(pos, end int, subs []substitution) int {
+	r.enter()
+	defer r.leave()
+
+	for pos < end {
+		token := r.u8(pos, end)
+		switch token &^ tokenMoreDataFlag {
+		case tokenEndOfStream:
+			return pos + 1
+		case tokenFragmentHeader:
+			pos += 4
+		case tokenTemplateInstance:
+			pos = r.renderTemplateInstance(pos, end)
+		case tokenOpenStartElement:
+			pos = r.renderElement(pos, end, subs)
+		default:
+			corrupted("unexpected binxml token 0x%02x at offset %d", token, pos)
+		}
+	}
+	return pos
+}
+
+// readName 读取名称，名称首次出现时内联在当前位置，之后以偏移引用
+func (r *binXMLRenderer) readName(nameOffset uint32, pos, end int) (string, int) {
+	off := int(nameOffset)
+	count := int(r.u16(off+6, len(r.chunk)))
+	r.need(off+8, count*2, len(r.chunk))
+	name := decodeUTF16(r.chunk[off+8 : off+8+count*2])
+	if off == pos {
+		size := 8 + count*2 + 2
+		r.need(pos, size, end)
+		pos += size
+	}
+	return name, pos
+}
+
+// renderTemplateInstance 解析模板定义以及替换值，并渲染模板
+func (r *binXMLRenderer) renderTemplateInstance(pos, end int) int {
+	r.enter()
+	defer r.leave()
+
+	// token(1)、未知(1)、模板 ID(4)、模板定义偏移(4)
+	defOffset := int(r.u32(pos+6, end))
+	pos += 10
+	// 模板首次出现时定义内联在当前位置
+	defSize := int(r.u32(defOffset+20, len(r.chunk)))
+	if defOffset == pos {
+		r.need(pos, templateHeaderSize+defSize, end)
+		pos += templateHeaderSize + defSize
+	}
+
+	count := int(r.u32(pos, end))
+	pos += 4
+	r.need(pos, count*4, end)
+	subs := make([]substitution, count)
+	sizes := make([]int, count)
+	for i := 0; i < count; i++ {
+		sizes[i] = int(r.u16(pos, end))
+		subs[i].valueType = r.u8(pos+2, end)
+		pos += 4
+	}
+	for i := 0; i < count; i++ {
+		r.need(pos, sizes[i], end)
+		subs[i].offset = pos
+		subs[i].data = r.chunk[pos : pos+sizes[i]]
+		pos += sizes[i]
+	}
+
+	start := defOffset + templateHeaderSize
+	r.need(start, defSize, len(r.chunk))
+	r.renderFragment(start, start+defSize, subs)
+	return pos
+}
+
+// renderElement 渲染元素及其属性、内容
+func (r *binXMLRenderer) renderElement(pos, end int, subs []substitution) int {
+	r.enter()
+	defer r.leave()
+
+	token := r.u8(pos, end)
+	// token(1)、依赖 ID(2)、数据长度(4)、名称偏移(4)
+	nameOffset := r.u32(pos+7, end)
+	pos += 11
+	name, pos := r.readName(nameOffset, pos, end)
+	r.out.WriteString("<")
+	r.out.WriteString(name)
+
+	if token&tokenMoreDataFlag != 0 {
+		// 属性列表长度
+		pos += 4
+		for {
+			attrToken := r.u8(pos, end)
+			if attrToken&^tokenMoreDataFlag != tokenAttribute {
+				break
+			}
+			attrName, next := r.readName(r.u32(pos+1, end), pos+5, end)
+			value, present, next := r.readValueNode(next, end, subs)
+			pos = next
+			if !present {
+				continue
+			}
+			r.out.WriteString(" ")
+			r.out.WriteString(attrName)
+			r.out.WriteString("=\"")
+			r.out.WriteString(escapeXML(value))
+			r.out.WriteString("\"")
+		}
+	}
+
+	switch token := r.u8(pos, end); token {
+	case tokenCloseEmptyElement:
+		r.out.WriteString("/>")
+		return pos + 1
+	case tokenCloseStartElement:
+		r.out.WriteString(">")
+		pos++
+	default:
+		corrupted("unexpected binxml token 0x%02x at offset %d, expect close element", token, pos)
+	}
+
+	for {
+		token := r.u8(pos, end)
+		switch token &^ tokenMoreDataFlag {
+		case tokenEndElement:
+			r.out.WriteString("</")
+			r.out.WriteString(name)
+			r.out.WriteString(">")
+			return pos + 1
+		case tokenOpenStartElement:
+			pos = r.renderElement(pos, end, subs)
+		case tokenNormalSubst, tokenOptionalSubst:
+			pos = r.renderSubstitution(pos, end, subs)
+		case tokenCDATASection:
+			count := int(r.u16(pos+1, end))
+			r.need(pos+3, count*2, end)
+			r.out.WriteString("<![CDATA[")
+			r.out.WriteString(decodeUTF16(r.chunk[pos+3 : pos+3+count*2]))
+			r.out.WriteString("]]>")
+			pos += 3 + count*2
+		case tokenPITarget:
+			target, next := r.readName(r.u32(pos+1, end), pos+5, end)
+			r.out.WriteString("<?")
+			r.out.WriteString(target)
+			pos = next
+			if r.u8(pos, end) == tokenPIData {
+				count := int(r.u16(pos+1, end))
+				r.need(pos+3, count*2, end)
+				r.out.WriteString(" ")
+				r.out.WriteString(decodeUTF16(r.chunk[pos+3 : pos+3+count*2]))
+				pos += 3 + count*2
+			}
+			r.out.WriteString("?>")
+		default:
+			value, _, next := r.readValueNode(pos, end, subs)
+			r.out.WriteString(escapeXML(value))
+			pos = next
+		}
+	}
+}
+
+// renderSubstitution 渲染元素内容中的替换值，嵌套的 BinXML 直接展开
+func (r *binXMLRenderer) renderSubstitution(pos, end int, subs []substitution) int {
+	index := int(r.u16(pos+1, end))
+	pos += 4
+	if index >= len(subs) {
+		corrupted("substitution index %d out of range %d", index, len(subs))
+	}
+	sub := subs[index]
+	// 嵌入的 BinXML 中的偏移同样相对于 chunk
+	if sub.valueType == valueBinXML {
+		if len(sub.data) > 0 {
+			r.renderFragment(sub.offset, sub.offset+len(sub.data), nil)
+		}
+		return pos
+	}
+	r.out.WriteString(escapeXML(formatValue(sub.valueType, sub.data)))
+	return pos
+}
+
+// readValueNode 读取属性值或元素内容，返回值以及是否需要输出
+func (r *binXMLRenderer) readValueNode(pos, end int, subs []substitution) (string, bool, int) {
+	token := r.u8(pos, end)
+	switch token &^ tokenMoreDataFlag {
+	case tokenValue:
+		valueType := r.u8(pos+1, end)
+		if valueType != valueString {
+			corrupted("unexpected value type 0x%02x at offset %d", valueType, pos)
+		}
+		count := int(r.u16(pos+2, end))
+		r.need(pos+4, count*2, end)
+		return decodeUTF16(r.chunk[pos+4 : pos+4+count*2]), true, pos + 4 + count*2
+	case tokenNormalSubst, tokenOptionalSubst:
+		index := int(r.u16(pos+1, end))
+		if index >= len(subs) {
+			corrupted("substitution index %d out of range %d", index, len(subs))
+		}
+		sub := subs[index]
+		present := !(token&^tokenMoreDataFlag == tokenOptionalSubst && (sub.valueType == valueNull || len(sub.data) == 0))
+		return formatValue(sub.valueType, sub.data), present, pos + 4
+	case tokenCharRef:
+		return string(rune(r.u16(pos+1, end))), true, pos + 3
+	case tokenEntityRef:
+		name, next := r.readName(r.u32(pos+1, end), pos+5, end)
+		return entityValue(name), true, next
+	}
+	corrupted("unexpected binxml token 0x%02x at offset %d, expect value", token, pos)
+	return "", false, pos
+}
+
+func entityValue(name string) string {
+	switch name {
+	case "lt":
+		return "<"
+	case "gt":
+		return ">"
+	case "amp":
+		return "&"
+	case "quot":
+		return "\""
+	case "apos":
+		return "'"
+	}
+	return "&" + name + ";"
+}
+
+var xmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\"", "&quot;",
+	"'", "&apos;",
+)
+
+func escapeXML(s string) string {
+	return xmlEscaper.Replace(s)
+}
+
+// decodeUTF16 解码 UTF-16LE，并去掉末尾的 NUL
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
+
+// fileTimeUnixOffset FILETIME 以 1601-01-01 起的 100 纳秒为单位，与 Unix 时间相差的秒数
+const fileTimeUnixOffset = 11644473600
+
+func fileTimeToTime(v uint64) time.Time {
+	return time.Unix(int64(v/1e7)-fileTimeUnixOffset, int64(v%1e7)*100).UTC()
+}
+
+// formatTime 与 Windows 事件查看器导出的 XML 保持一致，如 2021-01-01T00:00:00.1234567Z
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.0000000Z")
+}
+
+// valueSize 定长类型的长度，变长类型返回 0
+func valueSize(valueType byte) int {
+	switch valueType {
+	case valueInt8, valueUint8:
+		return 1
+	case valueInt16, valueUint16:
+		return 2
+	case valueInt32, valueUint32, valueReal32, valueBool, valueHexInt32:
+		return 4
+	case valueInt64, valueUint64, valueReal64, valueFileTime, valueHexInt64:
+		return 8
+	case valueGUID, valueSysTime:
+		return 16
+	}
+	return 0
+}
+
+// formatValue 将替换值格式化为文本
+func formatValue(valueType byte, data []byte) string {
+	if valueType&valueArrayFlag != 0 {
+		return formatArray(valueType&^valueArrayFlag, data)
+	}
+
+	if size := valueSize(valueType); size > 0 && len(data) < size {
+		return ""
+	}
+	switch valueType {
+	case valueNull:
+		return ""
+	case valueString:
+		return decodeUTF16(data)
+	case valueAnsiString:
+		return strings.TrimRight(string(data), "\x00")
+	case valueInt8:
+		return strconv.FormatInt(int64(int8(data[0])), 10)
+	case valueUint8:
+		return strconv.FormatUint(uint64(data[0]), 10)
+	case valueInt16:
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(data))), 10)
+	case valueUint16:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint16(data)), 10)
+	case valueInt32:
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data))), 10)
+	case valueUint32:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10)
+	case valueInt64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10)
+	case valueUint64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(data), 10)
+	case valueReal32:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), 'g', -1, 32)
+	case valueReal64:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)), 'g', -1, 64)
+	case valueBool:
+		return strconv.FormatBool(binary.LittleEndian.Uint32(data) != 0)
+	case valueBinary:
+		return strings.ToUpper(hex.EncodeToString(data))
+	case valueGUID:
+		return formatGUID(data)
+	case valueSizeT:
+		if len(data) == 4 {
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(data))
+		}
+		if len(data) == 8 {
+			return fmt.Sprintf("0x%x", binary.LittleEndian.Uint64(data))
+		}
+		return ""
+	case valueFileTime:
+		return formatTime(fileTimeToTime(binary.LittleEndian.Uint64(data)))
+	case valueSysTime:
+		return formatSystemTime(data)
+	case valueSID:
+		return formatSID(data)
+	case valueHexInt32:
+		return fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(data))
+	case valueHexInt64:
+		return fmt.Sprintf("0x%x", binary.LittleEndian.Uint64(data))
+	case valueEvtHandle:
+		return ""
+	}
+	return strings.ToUpper(hex.EncodeToString(data))
+}
+
+// formatArray 数组以逗号分隔，字符串数组以 NUL 分隔
+func formatArray(valueType byte, data []byte) string {
+	var items []string
+	switch valueType {
+	case valueString:
+		for _, s := range strings.Split(decodeUTF16(data), "\x00") {
+			items = append(items, s)
+		}
+	case valueAnsiString:
+		items = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	default:
+		size := valueSize(valueType)
+		if size == 0 {
+			return strings.ToUpper(hex.EncodeToString(data))
+		}
+		for i := 0; i+size <= len(data); i += size {
+			items = append(items, formatValue(valueType, data[i:i+size]))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// formatGUID 前三段为小端序，如 {54849625-5478-4994-A5BA-3E3B0328C30D}
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16])
+}
+
+// formatSID 如 S-1-5-18
+func formatSID(b []byte) string {
+	if len(b) < 8 {
+		return ""
+	}
+	count := int(b[1])
+	if len(b) < 8+count*4 {
+		return ""
+	}
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "S-%d-%d", b[0], authority)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&sb, "-%d", binary.LittleEndian.Uint32(b[8+i*4:]))
+	}
+	return sb.String()
+}
+
+func formatSystemTime(b []byte) string {
+	v := func(i int) int { return int(binary.LittleEndian.Uint16(b[i*2:])) }
+	t := time.Date(v(0), time.Month(v(1)), v(3), v(4), v(5), v(6), v(7)*int(time.Millisecond), time.UTC)
+	return formatTime(t)
+}
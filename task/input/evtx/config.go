@@ -0,0 +1,55 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package evtx
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+var defaultConfig = config{}
+
+type config struct {
+	DataID       int      `config:"dataid"`
+	Paths        []string `config:"paths"`         // EVTX 文件路径，支持通配符
+	ExcludeFiles []string `config:"exclude_files"` // 排除的文件，正则表达式
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("at least one path must be configured as part of paths")
+	}
+	for _, path := range c.Paths {
+		if _, err := filepath.Match(path, ""); err != nil {
+			return fmt.Errorf("invalid path(%s): %v", path, err)
+		}
+	}
+	for _, expr := range c.ExcludeFiles {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid exclude_files(%s): %v", expr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	fileHeaderSize  = 4096
+	chunkSize       = 65536
+	chunkHeaderSize = 512
+	recordHeader    = 24
+)
+
+var (
+	fileMagic   = []byte("ElfFile\x00")
+	chunkMagic  = []byte("ElfChnk\x00")
+	recordMagic = []byte{0x2a, 0x2a, 0x00, 0x00}
+)
+
+// Record EVTX 文件中的一条事件记录
+type Record struct {
+	ID      uint64
+	Written time.Time
+	XML     string
+}
+
+// chunkInfo chunk 头中的记录范围
+type chunkInfo struct {
+	index         int
+	firstRecordID uint64
+	lastRecordID  uint64
+}
+
+// File 只读打开的 EVTX 文件
+type File struct {
+	f      *os.File
+	size   int64
+	chunks []chunkInfo
+}
+
+// Open 打开 EVTX 文件并读取所有 chunk 头
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{f: f}
+	if err = file.init(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return file, nil
+}
+
+func (f *File) init() error {
+	stat, err := f.f.Stat()
+	if err != nil {
+		return err
+	}
+	f.size = stat.Size()
+
+	header := make([]byte, fileHeaderSize)
+	if _, err = io.ReadFull(f.f, header); err != nil {
+		return fmt.Errorf("read file header error: %v", err)
+	}
+	if !bytes.Equal(header[:8], fileMagic) {
+		return fmt.Errorf("invalid file signature")
+	}
+
+	// 文件头中的 chunk 数量在未正常关闭(dirty)时可能不准确，以文件大小为准
+	count := int((f.size - fileHeaderSize) / chunkSize)
+	chunkHeader := make([]byte, chunkHeaderSize)
+	for i := 0; i < count; i++ {
+		if _, err = f.f.ReadAt(chunkHeader, fileHeaderSize+int64(i)*chunkSize); err != nil {
+			return fmt.Errorf("read chunk(%d) header error: %v", i, err)
+		}
+		if !bytes.Equal(chunkHeader[:8], chunkMagic) {
+			// 预分配而未使用的 chunk
+			continue
+		}
+		f.chunks = append(f.chunks, chunkInfo{
+			index:         i,
+			firstRecordID: binary.LittleEndian.Uint64(chunkHeader[24:]),
+			lastRecordID:  binary.LittleEndian.Uint64(chunkHeader[32:]),
+		})
+	}
+	// 循环写入的日志中最早的 chunk 不一定在文件开头，按记录 ID 排序
+	sort.Slice(f.chunks, func(i, j int) bool {
+		return f.chunks[i].firstRecordID < f.chunks[j].firstRecordID
+	})
+	return nil
+}
+
+// LastRecordID 文件中最大的记录 ID
+func (f *File) LastRecordID() uint64 {
+	var last uint64
+	for _, c := range f.chunks {
+		if c.lastRecordID > last {
+			last = c.lastRecordID
+		}
+	}
+	return last
+}
+
+// Close 关闭文件
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Read 按记录 ID 顺序遍历大于 after 的记录，fn 返回 false 时停止
+// 单条记录解析失败时调用 onError 后继续，不影响其他记录
+func (f *File) Read(after uint64, fn func(Record) bool, onError func(error)) error {
+	chunk := make([]byte, chunkSize)
+	for _, c := range f.chunks {
+		if c.lastRecordID <= after {
+			continue
+		}
+		n, err := f.f.ReadAt(chunk, fileHeaderSize+int64(c.index)*chunkSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n < chunkHeaderSize {
+			onError(fmt.Errorf("chunk(%d) truncated", c.index))
+			continue
+		}
+		if !readChunk(chunk[:n], c.index, after, fn, onError) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readChunk 遍历 chunk 中的记录，返回 false 表示 fn 要求停止
+func readChunk(chunk []byte, index int, after uint64, fn func(Record) bool, onError func(error)) bool {
+	end := int(binary.LittleEndian.Uint32(chunk[48:]))
+	if end < chunkHeaderSize || end > len(chunk) {
+		end = len(chunk)
+	}
+	// 校验失败时仍尽量解析，取证场景下部分损坏的文件同样需要读取
+	if crc32.ChecksumIEEE(chunk[chunkHeaderSize:end]) != binary.LittleEndian.Uint32(chunk[52:]) {
+		onError(fmt.Errorf("chunk(%d) records checksum mismatch", index))
+	}
+
+	pos := chunkHeaderSize
+	for pos+recordHeader <= end {
+		if !bytes.Equal(chunk[pos:pos+4], recordMagic) {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[pos+4:]))
+		if size < recordHeader+4 || pos+size > end {
+			onError(fmt.Errorf("chunk(%d) record at offset %d has invalid size %d", index, pos, size))
+			break
+		}
+		id := binary.LittleEndian.Uint64(chunk[pos+8:])
+		if id > after {
+			xml, err := renderBinXML(chunk, pos+recordHeader, size-recordHeader-4)
+			if err != nil {
+				onError(fmt.Errorf("chunk(%d) record(%d) render error: %v", index, id, err))
+			} else {
+				record := Record{
+					ID:      id,
+					Written: fileTimeToTime(binary.LittleEndian.Uint64(chunk[pos+16:])),
+					XML:     xml,
+				}
+				if !fn(record) {
+					return false
+				}
+			}
+		}
+		pos += size
+	}
+	return true
+}
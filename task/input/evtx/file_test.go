@@ -0,0 +1,480 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package evtx
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// binXMLWriter 按 chunk 内的偏移写入 BinXML，用于构造测试文件
+type binXMLWriter struct {
+	chunk     []byte
+	pos       int
+	names     map[string]int
+	templates map[uint32]int
+}
+
+func newChunkWriter() *binXMLWriter {
+	return &binXMLWriter{
+		chunk:     make([]byte, chunkSize),
+		pos:       chunkHeaderSize,
+		names:     make(map[string]int),
+		templates: make(map[uint32]int),
+	}
+}
+
+func (w *binXMLWriter) bytes(b ...byte) {
+	copy(w.chunk[w.pos:], b)
+	w.pos += len(b)
+}
+
+func (w *binXMLWriter) u16(v uint16) {
+	binary.LittleEndian.PutUint16(w.chunk[w.pos:], v)
+	w.pos += 2
+}
+
+func (w *binXMLWriter) u32(v uint32) {
+	binary.LittleEndian.PutUint32(w.chunk[w.pos:], v)
+	w.pos += 4
+}
+
+func (w *binXMLWriter) u64(v uint64) {
+	binary.LittleEndian.PutUint64(w.chunk[w.pos:], v)
+	w.pos += 8
+}
+
+func (w *binXMLWriter) utf16(s string) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		w.u16(c)
+	}
+}
+
+// name 首次出现时内联写入，之后以偏移引用
+func (w *binXMLWriter) name(s string) {
+	if off, ok := w.names[s]; ok {
+		w.u32(uint32(off))
+		return
+	}
+	off := w.pos + 4
+	w.names[s] = off
+	w.u32(uint32(off))
+	w.u32(0)
+	w.u16(0)
+	w.u16(uint16(len(utf16.Encode([]rune(s)))))
+	w.utf16(s)
+	w.u16(0)
+}
+
+func (w *binXMLWriter) open(name string, attrs bool) {
+	token := byte(tokenOpenStartElement)
+	if attrs {
+		token |= tokenMoreDataFlag
+	}
+	w.bytes(token)
+	w.u16(0xffff)
+	w.u32(0)
+	w.name(name)
+	if attrs {
+		w.u32(0)
+	}
+}
+
+func (w *binXMLWriter) attr(name string, more bool) {
+	token := byte(tokenAttribute)
+	if more {
+		token |= tokenMoreDataFlag
+	}
+	w.bytes(token)
+	w.name(name)
+}
+
+func (w *binXMLWriter) text(s string) {
+	w.bytes(tokenValue, valueString)
+	w.u16(uint16(len(utf16.Encode([]rune(s)))))
+	w.utf16(s)
+}
+
+func (w *binXMLWriter) subst(index uint16, valueType byte, optional bool) {
+	token := byte(tokenNormalSubst)
+	if optional {
+		token = tokenOptionalSubst
+	}
+	w.bytes(token)
+	w.u16(index)
+	w.bytes(valueType)
+}
+
+type testValue struct {
+	valueType byte
+	write     func(w *binXMLWriter)
+}
+
+// template 写入模板实例，模板首次出现时内联定义
+func (w *binXMLWriter) template(id uint32, body func(w *binXMLWriter), values []testValue) {
+	w.bytes(tokenTemplateInstance, 0x01)
+	w.u32(id)
+	if off, ok := w.templates[id]; ok {
+		w.u32(uint32(off))
+	} else {
+		off := w.pos + 4
+		w.templates[id] = off
+		w.u32(uint32(off))
+		w.u32(0)
+		w.bytes(make([]byte, 16)...)
+		sizePos := w.pos
+		w.u32(0)
+		start := w.pos
+		body(w)
+		w.bytes(tokenEndOfStream)
+		binary.LittleEndian.PutUint32(w.chunk[sizePos:], uint32(w.pos-start))
+	}
+
+	w.u32(uint32(len(values)))
+	descPos := w.pos
+	w.pos += 4 * len(values)
+	for i, v := range values {
+		start := w.pos
+		if v.write != nil {
+			v.write(w)
+		}
+		binary.LittleEndian.PutUint16(w.chunk[descPos+i*4:], uint16(w.pos-start))
+		w.chunk[descPos+i*4+2] = v.valueType
+	}
+}
+
+func (w *binXMLWriter) fragment(fn func(w *binXMLWriter)) {
+	w.bytes(tokenFragmentHeader, 0x01, 0x01, 0x00)
+	fn(w)
+	w.bytes(tokenEndOfStream)
+}
+
+func (w *binXMLWriter) record(id uint64, written time.Time, fn func(w *binXMLWriter)) {
+	start := w.pos
+	w.bytes(recordMagic...)
+	w.u32(0)
+	w.u64(id)
+	w.u64(toFileTime(written))
+	w.fragment(fn)
+	w.pos += 4
+	size := uint32(w.pos - start)
+	binary.LittleEndian.PutUint32(w.chunk[start+4:], size)
+	binary.LittleEndian.PutUint32(w.chunk[w.pos-4:], size)
+}
+
+// finish 写入 chunk 头
+func (w *binXMLWriter) finish(firstID, lastID uint64) []byte {
+	copy(w.chunk, chunkMagic)
+	binary.LittleEndian.PutUint64(w.chunk[8:], firstID)
+	binary.LittleEndian.PutUint64(w.chunk[16:], lastID)
+	binary.LittleEndian.PutUint64(w.chunk[24:], firstID)
+	binary.LittleEndian.PutUint64(w.chunk[32:], lastID)
+	binary.LittleEndian.PutUint32(w.chunk[40:], 128)
+	binary.LittleEndian.PutUint32(w.chunk[48:], uint32(w.pos))
+	binary.LittleEndian.PutUint32(w.chunk[52:], crc32.ChecksumIEEE(w.chunk[chunkHeaderSize:w.pos]))
+	return w.chunk
+}
+
+func toFileTime(t time.Time) uint64 {
+	return uint64(t.Unix()+fileTimeUnixOffset)*1e7 + uint64(t.Nanosecond()/100)
+}
+
+func writeEVTX(t *testing.T, chunks ...[]byte) string {
+	dir, err := ioutil.TempDir("", "evtx")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	header := make([]byte, fileHeaderSize)
+	copy(header, fileMagic)
+	binary.LittleEndian.PutUint32(header[32:], 128)
+	binary.LittleEndian.PutUint16(header[38:], 3)
+	binary.LittleEndian.PutUint16(header[40:], fileHeaderSize)
+	binary.LittleEndian.PutUint16(header[42:], uint16(len(chunks)))
+	data := header
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	path := filepath.Join(dir, "Security.evtx")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+var (
+	testGUID = []byte{0x25, 0x96, 0x84, 0x54, 0x78, 0x54, 0x94, 0x49, 0xa5, 0xba, 0x3e, 0x3b, 0x03, 0x28, 0xc3, 0x0d}
+	testSID  = []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x12, 0x00, 0x00, 0x00}
+	testTime = time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+)
+
+// securityEvent 与 Windows 安全日志结构相同的模板
+func securityEvent(w *binXMLWriter) {
+	w.open("Event", true)
+	w.attr("xmlns", false)
+	w.text("http://schemas.microsoft.com/win/2004/08/events/event")
+	w.bytes(tokenCloseStartElement)
+	{
+		w.open("System", false)
+		w.bytes(tokenCloseStartElement)
+		w.open("Provider", true)
+		w.attr("Name", true)
+		w.subst(0, valueString, false)
+		w.attr("Guid", false)
+		w.subst(1, valueGUID, false)
+		w.bytes(tokenCloseEmptyElement)
+		w.open("EventID", false)
+		w.bytes(tokenCloseStartElement)
+		w.subst(2, valueUint16, false)
+		w.bytes(tokenEndElement)
+		w.open("Level", false)
+		w.bytes(tokenCloseStartElement)
+		w.subst(3, valueUint8, false)
+		w.bytes(tokenEndElement)
+		w.open("Keywords", false)
+		w.bytes(tokenCloseStartElement)
+		w.subst(4, valueHexInt64, false)
+		w.bytes(tokenEndElement)
+		w.open("TimeCreated", true)
+		w.attr("SystemTime", false)
+		w.subst(5, valueFileTime, false)
+		w.bytes(tokenCloseEmptyElement)
+		w.open("EventRecordID", false)
+		w.bytes(tokenCloseStartElement)
+		w.subst(6, valueUint64, false)
+		w.bytes(tokenEndElement)
+		w.open("Channel", false)
+		w.bytes(tokenCloseStartElement)
+		w.text("Security")
+		w.bytes(tokenEndElement)
+		w.open("Security", true)
+		w.attr("UserID", false)
+		w.subst(7, valueSID, true)
+		w.bytes(tokenCloseEmptyElement)
+		w.bytes(tokenEndElement)
+	}
+	{
+		w.open("EventData", false)
+		w.bytes(tokenCloseStartElement)
+		w.open("Data", true)
+		w.attr("Name", false)
+		w.text("TargetUserName")
+		w.bytes(tokenCloseStartElement)
+		w.subst(8, valueString, true)
+		w.bytes(tokenEndElement)
+		w.open("Data", true)
+		w.attr("Name", false)
+		w.text("LogonType")
+		w.bytes(tokenCloseStartElement)
+		w.subst(9, valueUint32, false)
+		w.bytes(tokenEndElement)
+		w.bytes(tokenEndElement)
+	}
+	w.bytes(tokenEndElement)
+}
+
+func writeString(s string) func(w *binXMLWriter) {
+	return func(w *binXMLWriter) {
+		w.utf16(s)
+		w.u16(0)
+	}
+}
+
+func securityRecord(w *binXMLWriter, id uint64, user string, sid []byte) {
+	w.record(id, testTime, func(w *binXMLWriter) {
+		values := []testValue{
+			{valueString, writeString("Microsoft-Windows-Security-Auditing")},
+			{valueGUID, func(w *binXMLWriter) { w.bytes(testGUID...) }},
+			{valueUint16, func(w *binXMLWriter) { w.u16(4624) }},
+			{valueUint8, func(w *binXMLWriter) { w.bytes(0) }},
+			{valueHexInt64, func(w *binXMLWriter) { w.u64(0x8020000000000000) }},
+			{valueFileTime, func(w *binXMLWriter) { w.u64(toFileTime(testTime)) }},
+			{valueUint64, func(w *binXMLWriter) { w.u64(id) }},
+			{valueNull, nil},
+			{valueString, writeString(user)},
+			{valueUint32, func(w *binXMLWriter) { w.u32(2) }},
+		}
+		if sid != nil {
+			values[7] = testValue{valueSID, func(w *binXMLWriter) { w.bytes(sid...) }}
+		}
+		w.template(1, securityEvent, values)
+	})
+}
+
+const expectXML = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">` +
+	`<System><Provider Name="Microsoft-Windows-Security-Auditing" Guid="{54849625-5478-4994-A5BA-3E3B0328C30D}"/>` +
+	`<EventID>4624</EventID><Level>0</Level><Keywords>0x8020000000000000</Keywords>` +
+	`<TimeCreated SystemTime="2021-03-04T05:06:07.1234567Z"/><EventRecordID>1</EventRecordID>` +
+	`<Channel>Security</Channel><Security/></System>` +
+	`<EventData><Data Name="TargetUserName">admin&lt;1&gt;</Data><Data Name="LogonType">2</Data></EventData></Event>`
+
+func readAll(t *testing.T, path string, after uint64) ([]Record, []error) {
+	f, err := Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var records []Record
+	var errs []error
+	err = f.Read(after, func(r Record) bool {
+		records = append(records, r)
+		return true
+	}, func(err error) {
+		errs = append(errs, err)
+	})
+	assert.NoError(t, err)
+	return records, errs
+}
+
+func TestReadRecords(t *testing.T) {
+	w := newChunkWriter()
+	securityRecord(w, 1, "admin<1>", nil)
+	securityRecord(w, 2, "guest", testSID)
+	securityRecord(w, 3, "", nil)
+	path := writeEVTX(t, w.finish(1, 3))
+
+	records, errs := readAll(t, path, 0)
+	assert.Empty(t, errs)
+	if !assert.Len(t, records, 3) {
+		return
+	}
+	assert.Equal(t, uint64(1), records[0].ID)
+	assert.Equal(t, testTime, records[0].Written)
+	assert.Equal(t, expectXML, records[0].XML)
+	// 第二条记录复用模板定义
+	assert.Contains(t, records[1].XML, `<Security UserID="S-1-5-18"/>`)
+	assert.Contains(t, records[1].XML, `<Data Name="TargetUserName">guest</Data>`)
+	assert.Contains(t, records[2].XML, `<Data Name="TargetUserName"></Data>`)
+
+	// 从上次的进度继续
+	records, _ = readAll(t, path, 2)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, uint64(3), records[0].ID)
+	}
+
+	f, err := Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), f.LastRecordID())
+	_ = f.Close()
+}
+
+func TestReadChunksInRecordOrder(t *testing.T) {
+	// 循环写入后较新的 chunk 位于文件开头
+	newer := newChunkWriter()
+	securityRecord(newer, 3, "c", nil)
+	securityRecord(newer, 4, "d", nil)
+	older := newChunkWriter()
+	securityRecord(older, 1, "a", nil)
+	securityRecord(older, 2, "b", nil)
+	unused := make([]byte, chunkSize)
+	path := writeEVTX(t, newer.finish(3, 4), older.finish(1, 2), unused)
+
+	records, errs := readAll(t, path, 0)
+	assert.Empty(t, errs)
+	ids := make([]uint64, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4}, ids)
+}
+
+func TestEmbeddedBinXML(t *testing.T) {
+	w := newChunkWriter()
+	w.record(1, testTime, func(w *binXMLWriter) {
+		w.template(1, func(w *binXMLWriter) {
+			w.open("Event", false)
+			w.bytes(tokenCloseStartElement)
+			w.subst(0, valueBinXML, true)
+			w.bytes(tokenEndElement)
+		}, []testValue{{valueBinXML, func(w *binXMLWriter) {
+			w.fragment(func(w *binXMLWriter) {
+				w.template(2, func(w *binXMLWriter) {
+					w.open("UserData", false)
+					w.bytes(tokenCloseStartElement)
+					w.open("Param", false)
+					w.bytes(tokenCloseStartElement)
+					w.subst(0, valueString|valueArrayFlag, false)
+					w.bytes(tokenEndElement)
+					w.bytes(tokenEndElement)
+				}, []testValue{{valueString | valueArrayFlag, func(w *binXMLWriter) {
+					w.utf16("a\x00b\x00")
+				}}})
+			})
+		}}})
+	})
+	path := writeEVTX(t, w.finish(1, 1))
+
+	records, errs := readAll(t, path, 0)
+	assert.Empty(t, errs)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "<Event><UserData><Param>a,b</Param></UserData></Event>", records[0].XML)
+	}
+}
+
+func TestCorruptedRecord(t *testing.T) {
+	w := newChunkWriter()
+	securityRecord(w, 1, "a", nil)
+	// 第二条记录的模板偏移损坏，第三条记录的长度损坏
+	start := w.pos
+	securityRecord(w, 2, "b", nil)
+	binary.LittleEndian.PutUint32(w.chunk[start+24+4+6:], 0xfffff)
+	start = w.pos
+	securityRecord(w, 3, "c", nil)
+	binary.LittleEndian.PutUint32(w.chunk[start+4:], 0xfffff)
+	path := writeEVTX(t, w.finish(1, 3))
+
+	records, errs := readAll(t, path, 0)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, uint64(1), records[0].ID)
+	}
+	assert.Len(t, errs, 2)
+}
+
+func TestInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evtx")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "invalid.evtx")
+	assert.NoError(t, ioutil.WriteFile(path, make([]byte, fileHeaderSize), 0644))
+
+	_, err = Open(path)
+	assert.Error(t, err)
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "{54849625-5478-4994-A5BA-3E3B0328C30D}", formatValue(valueGUID, testGUID))
+	assert.Equal(t, "S-1-5-18", formatValue(valueSID, testSID))
+	assert.Equal(t, "0x10", formatValue(valueHexInt32, []byte{0x10, 0, 0, 0}))
+	assert.Equal(t, "-1", formatValue(valueInt16, []byte{0xff, 0xff}))
+	assert.Equal(t, "true", formatValue(valueBool, []byte{1, 0, 0, 0}))
+	assert.Equal(t, "0A0B", formatValue(valueBinary, []byte{0x0a, 0x0b}))
+	assert.Equal(t, "1,2", formatValue(valueUint16|valueArrayFlag, []byte{1, 0, 2, 0}))
+	assert.Equal(t, "2021-03-04T05:06:07.1230000Z",
+		formatValue(valueSysTime, []byte{0xe5, 0x07, 3, 0, 4, 0, 4, 0, 5, 0, 6, 0, 7, 0, 123, 0}))
+	// 长度不足时不越界
+	assert.Equal(t, "", formatValue(valueUint64, []byte{1}))
+}
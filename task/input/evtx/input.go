@@ -0,0 +1,300 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package evtx
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/winlogbeat/checkpoint"
+	"github.com/elastic/beats/winlogbeat/eventlog"
+	"github.com/elastic/beats/winlogbeat/sys"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/wineventlog"
+)
+
+const (
+	inputName = "evtx"
+)
+
+var (
+	evtxFiles   = bkmonitoring.NewInt("evtx_files")   // 读取的文件数
+	evtxRecords = bkmonitoring.NewInt("evtx_records") // 发送的事件记录数
+	evtxError   = bkmonitoring.NewInt("evtx_error")   // 文件或记录解析失败次数
+)
+
+// levelNames 离线解析时没有事件的渲染信息，按标准级别转换为名称
+var levelNames = map[uint8]string{
+	0: "Information",
+	1: "Critical",
+	2: "Error",
+	3: "Warning",
+	4: "Information",
+	5: "Verbose",
+}
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// fileStamp 文件读取完成时的大小与修改时间，未变化的文件不再重复解析
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Input 离线解析导出的 EVTX 文件，不依赖 Windows API
+// 事件字段与 winlog 采集保持一致，读取进度以 winlog 类型的状态按文件记录在 registrar 中
+type Input struct {
+	mutex    sync.Mutex
+	stopOnce sync.Once
+
+	config   config
+	excludes []*regexp.Regexp
+	outlet   channel.Outleter
+
+	states  map[string]uint64 // 文件已发送的最大记录 ID
+	scanned map[string]fileStamp
+	done    chan struct{}
+}
+
+// NewInput creates a new evtx input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes := make([]*regexp.Regexp, 0, len(config.ExcludeFiles))
+	for _, expr := range config.ExcludeFiles {
+		excludes = append(excludes, regexp.MustCompile(expr))
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]uint64)
+	for _, s := range context.States {
+		if s.Type == wineventlog.WinLogFileStateType {
+			states[s.Source] = wineventlog.FileStateToWinLogState(s).RecordNumber
+		}
+	}
+
+	p := &Input{
+		config:   config,
+		excludes: excludes,
+		outlet:   outlet,
+		states:   states,
+		scanned:  make(map[string]fileStamp),
+		done:     make(chan struct{}),
+	}
+	return p, nil
+}
+
+// Run 由 input.Runner 周期调用，解析新增的文件以及文件中新增的记录
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, path := range p.listFiles() {
+		if p.isDone() {
+			return
+		}
+		p.readFile(path)
+	}
+}
+
+func (p *Input) isDone() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// listFiles 匹配需要解析的文件，按路径排序
+func (p *Input) listFiles() []string {
+	files := make(map[string]struct{})
+	for _, pattern := range p.config.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+	match:
+		for _, path := range matches {
+			for _, re := range p.excludes {
+				if re.MatchString(path) {
+					continue match
+				}
+			}
+			files[path] = struct{}{}
+		}
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// readFile 从上次发送的记录之后继续解析
+func (p *Input) readFile(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+	if p.scanned[path] == stamp {
+		return
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		evtxError.Add(1)
+		logp.Err("%s(dataid=%d) open error: %v", inputName, p.config.DataID, err)
+		return
+	}
+	defer f.Close()
+
+	after := p.states[path]
+	if f.LastRecordID() <= after {
+		p.scanned[path] = stamp
+		return
+	}
+	evtxFiles.Add(1)
+	logp.Info("%s(dataid=%d) read %s after record %d", inputName, p.config.DataID, path, after)
+
+	completed := true
+	err = f.Read(after, func(r Record) bool {
+		if !p.send(path, r) {
+			completed = false
+			return false
+		}
+		return true
+	}, func(err error) {
+		evtxError.Add(1)
+		logp.Err("%s(dataid=%d) %s: %v", inputName, p.config.DataID, path, err)
+	})
+	if err != nil {
+		evtxError.Add(1)
+		logp.Err("%s(dataid=%d) read %s error: %v", inputName, p.config.DataID, path, err)
+		return
+	}
+	if completed {
+		p.scanned[path] = stamp
+	}
+}
+
+// send 转换为与 winlog 采集相同格式的事件并发送
+func (p *Input) send(path string, r Record) bool {
+	if p.isDone() {
+		return false
+	}
+	record, err := toRecord(path, r)
+	if err != nil {
+		evtxError.Add(1)
+		logp.Err("%s(dataid=%d) %s record(%d) unmarshal error: %v", inputName, p.config.DataID, path, r.ID, err)
+		return true
+	}
+
+	data := util.NewData()
+	data.Event = wineventlog.ToEvent(record)
+	data.SetState(wineventlog.WinLogStateToFileState(record.Offset))
+	if !p.outlet.OnEvent(data) {
+		return false
+	}
+	evtxRecords.Add(1)
+	p.states[path] = r.ID
+	return true
+}
+
+// toRecord 将渲染的 XML 解析为 winlog 采集使用的事件记录
+func toRecord(path string, r Record) (eventlog.Record, error) {
+	e, err := sys.UnmarshalEventXML([]byte(r.XML))
+	if err != nil {
+		return eventlog.Record{}, err
+	}
+	if e.RecordID == 0 {
+		e.RecordID = r.ID
+	}
+	if e.TimeCreated.SystemTime.IsZero() {
+		e.TimeCreated.SystemTime = r.Written
+	}
+	if e.Level == "" {
+		e.Level = levelNames[uint8(e.LevelRaw)]
+	}
+	return eventlog.Record{
+		Event: e,
+		API:   inputName,
+		XML:   r.XML,
+		Offset: checkpoint.EventLogState{
+			Name:         path,
+			RecordNumber: r.ID,
+			Timestamp:    e.TimeCreated.SystemTime,
+		},
+	}, nil
+}
+
+// Stop 停止解析，等待正在进行的解析结束
+func (p *Input) Stop() {
+	p.stopOnce.Do(func() {
+		logp.Info("Stopping %s(dataid=%d) input", inputName, p.config.DataID)
+		close(p.done)
+		// 先关闭 outlet，避免发送阻塞时无法等到解析结束
+		_ = p.outlet.Close()
+	})
+	p.mutex.Lock()
+	p.mutex.Unlock()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
@@ -0,0 +1,186 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package execinput
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+// waitDelay 命令退出或超时后，等待子进程关闭输出管道的最长时间
+const waitDelay = 5 * time.Second
+
+// result 单次执行结果
+type result struct {
+	ExitCode  int
+	Duration  time.Duration
+	TimedOut  bool
+	Truncated bool // 输出超过 max_output_size 被丢弃
+}
+
+// lineHandler 处理一行输出，返回 false 时丢弃后续输出
+type lineHandler func(stream, line string) bool
+
+// output 按行拆分命令输出
+// interval 模式下 stdout 与 stderr 共享单次执行的输出大小限制；continuous 模式下命令长期运行，仅限制单行长度
+type output struct {
+	mtx       sync.Mutex
+	maxSize   int
+	perLine   bool // 是否仅限制单行长度
+	size      int
+	truncated bool // 有输出被丢弃或截断
+	stopped   bool // 不再发送后续输出
+	onLine    lineHandler
+}
+
+func (o *output) emit(stream string, line []byte) {
+	if o.stopped {
+		return
+	}
+	line = bytes.TrimRight(line, "\r")
+	if o.perLine {
+		if len(line) > o.maxSize {
+			line = line[:o.maxSize]
+			o.truncated = true
+		}
+	} else if o.size+len(line) > o.maxSize {
+		o.truncated = true
+		o.stopped = true
+		return
+	}
+	if !o.onLine(stream, string(line)) {
+		o.stopped = true
+		return
+	}
+	o.size += len(line) + 1
+}
+
+// lineWriter 单个输出流的 writer，缓存未结束的行
+type lineWriter struct {
+	stream   string
+	output   *output
+	buf      []byte
+	skipping bool // 当前行已被截断，丢弃到下一个换行符为止
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.output.mtx.Lock()
+	defer w.output.mtx.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if w.skipping {
+			w.skipping = false
+		} else {
+			w.output.emit(w.stream, w.buf[:i])
+		}
+		w.buf = w.buf[i+1:]
+	}
+	// 单行超过限制时直接截断并丢弃该行剩余的内容，避免缓存无限增长
+	if len(w.buf) > w.output.maxSize {
+		if !w.skipping {
+			w.output.emit(w.stream, w.buf[:w.output.maxSize])
+			w.skipping = true
+		}
+		w.output.truncated = true
+		w.buf = w.buf[:0]
+	}
+	return len(p), nil
+}
+
+// flush 发送最后一行没有换行符的输出
+func (w *lineWriter) flush() {
+	w.output.mtx.Lock()
+	defer w.output.mtx.Unlock()
+	if len(w.buf) > 0 && !w.skipping {
+		w.output.emit(w.stream, w.buf)
+	}
+	w.buf = nil
+	w.skipping = false
+}
+
+// runCommand 执行命令，并按行回调 stdout 以及 stderr(可选) 的输出
+func runCommand(ctx context.Context, c config, onLine lineHandler) (result, error) {
+	var res result
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Dir = c.WorkingDir
+	if c.InheritEnv {
+		cmd.Env = append(os.Environ(), c.Env...)
+	} else {
+		// Env 为 nil 时子进程会继承采集器的环境变量，这里需要保证不为 nil
+		cmd.Env = append([]string{}, c.Env...)
+	}
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	out := &output{maxSize: c.MaxOutputSize, perLine: c.Mode == modeContinuous, onLine: onLine}
+	stdout := &lineWriter{stream: streamStdout, output: out}
+	cmd.Stdout = stdout
+	var stderr *lineWriter
+	if c.IncludeStderr {
+		stderr = &lineWriter{stream: streamStderr, output: out}
+		cmd.Stderr = stderr
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	res.Duration = time.Since(start)
+	stdout.flush()
+	if stderr != nil {
+		stderr.flush()
+	}
+	res.Truncated = out.truncated
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.TimedOut = true
+		return res, nil
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+		return res, err
+	}
+	return res, nil
+}
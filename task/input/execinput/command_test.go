@@ -0,0 +1,154 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package execinput
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func collect(t *testing.T, c config) ([]string, result) {
+	var lines []string
+	res, err := runCommand(context.Background(), c, func(stream, line string) bool {
+		lines = append(lines, stream+":"+line)
+		return true
+	})
+	assert.NoError(t, err)
+	return lines, res
+}
+
+func TestRunCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Command = "/bin/sh"
+	c.Args = []string{"-c", "echo line1; echo err1 >&2; printf \"$BK_NAME-$(pwd)\"; exit 3"}
+	c.WorkingDir = dir
+	c.Env = []string{"BK_NAME=bk"}
+
+	// 默认不采集 stderr，最后一行没有换行符也需要采集
+	lines, res := collect(t, c)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "stdout:line1", lines[0])
+	assert.Contains(t, lines[1], "stdout:bk-")
+	assert.Equal(t, 3, res.ExitCode)
+	assert.False(t, res.TimedOut)
+	assert.False(t, res.Truncated)
+
+	c.IncludeStderr = true
+	lines, _ = collect(t, c)
+	assert.Contains(t, lines, "stderr:err1")
+	assert.Len(t, lines, 3)
+
+	// 不继承采集器的环境变量
+	assert.NoError(t, os.Setenv("BK_EXEC_TEST", "inherited"))
+	defer os.Unsetenv("BK_EXEC_TEST")
+	c.Args = []string{"-c", "echo ${BK_EXEC_TEST:-none}"}
+	c.IncludeStderr = false
+	lines, _ = collect(t, c)
+	assert.Equal(t, []string{"stdout:inherited"}, lines)
+
+	c.InheritEnv = false
+	c.Env = nil
+	lines, _ = collect(t, c)
+	assert.Equal(t, []string{"stdout:none"}, lines)
+}
+
+func TestRunCommandLimit(t *testing.T) {
+	c := defaultConfig
+	c.Command = "/bin/sh"
+	c.Args = []string{"-c", "for i in 1 2 3 4 5; do echo line$i; done"}
+	c.MaxOutputSize = 12
+
+	lines, res := collect(t, c)
+	assert.Equal(t, []string{"stdout:line1", "stdout:line2"}, lines)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, 0, res.ExitCode)
+
+	// 超时后终止命令
+	c.Args = []string{"-c", "echo start; sleep 10"}
+	c.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	lines, res = collect(t, c)
+	assert.True(t, res.TimedOut)
+	assert.Equal(t, []string{"stdout:start"}, lines)
+	assert.True(t, time.Since(start) < waitDelay)
+
+	// continuous 模式下只限制单行长度
+	c.Mode = modeContinuous
+	c.Timeout = 0
+	c.MaxOutputSize = 6
+	c.Args = []string{"-c", "for i in 1 2 3 4 5; do echo line$i; done; echo a-very-long-line; printf end"}
+	lines, res = collect(t, c)
+	assert.Equal(t, []string{"stdout:line1", "stdout:line2", "stdout:line3", "stdout:line4", "stdout:line5",
+		"stdout:a-very", "stdout:end"}, lines)
+	assert.True(t, res.Truncated)
+
+	// 命令不存在
+	c.Command = "/not/exist/command"
+	_, err := runCommand(context.Background(), c, func(stream, line string) bool { return true })
+	assert.Error(t, err)
+}
+
+func TestContinuousTimeout(t *testing.T) {
+	timeout := defaultConfig.Timeout
+	defaultConfig.Timeout = 100 * time.Millisecond
+	defer func() { defaultConfig.Timeout = timeout }()
+
+	newTestConfig := func(vars map[string]interface{}) config {
+		vars["command"] = "/bin/sh"
+		vars["args"] = []string{"-c", "echo start; sleep 0.3; echo end"}
+		c, err := newConfig(common.MustNewConfigFrom(vars))
+		assert.NoError(t, err)
+		return c
+	}
+
+	// continuous 模式下未配置 timeout 时，持续运行的命令不受 interval 模式的默认超时限制
+	c := newTestConfig(map[string]interface{}{"mode": modeContinuous})
+	assert.Equal(t, time.Duration(0), c.Timeout)
+	lines, res := collect(t, c)
+	assert.False(t, res.TimedOut)
+	assert.Equal(t, []string{"stdout:start", "stdout:end"}, lines)
+
+	// 显式配置时仍然生效
+	c = newTestConfig(map[string]interface{}{"mode": modeContinuous, "timeout": "100ms"})
+	_, res = collect(t, c)
+	assert.True(t, res.TimedOut)
+
+	// interval 模式使用默认超时
+	c = newTestConfig(map[string]interface{}{})
+	assert.Equal(t, 100*time.Millisecond, c.Timeout)
+	_, res = collect(t, c)
+	assert.True(t, res.TimedOut)
+}
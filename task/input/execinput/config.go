@@ -0,0 +1,97 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package execinput
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	modeInterval   = "interval"   // 按周期执行，执行结束后发送输出
+	modeContinuous = "continuous" // 持续运行，退出后自动重启，输出实时发送
+)
+
+var defaultConfig = config{
+	Mode:          modeInterval,
+	Interval:      1 * time.Minute,
+	Timeout:       30 * time.Second, // 仅 interval 模式使用，continuous 模式未配置时不超时
+	InheritEnv:    true,
+	MaxOutputSize: 1 * humanize.MiByte,
+	RestartDelay:  10 * time.Second,
+}
+
+type config struct {
+	Command       string        `config:"command"`         // 执行的命令
+	Args          []string      `config:"args"`            // 命令参数
+	Mode          string        `config:"mode"`            // 执行方式：interval、continuous
+	Interval      time.Duration `config:"interval"`        // interval 模式的执行周期
+	Timeout       time.Duration `config:"timeout"`         // 单次执行超时，continuous 模式下为 0 表示不超时
+	WorkingDir    string        `config:"working_dir"`     // 工作目录
+	Env           []string      `config:"env"`             // 环境变量，格式为 KEY=VALUE
+	InheritEnv    bool          `config:"inherit_env"`     // 是否继承采集器的环境变量
+	MaxOutputSize int           `config:"max_output_size"` // 单次执行最多采集的输出大小，continuous 模式下为单行的最大长度
+	IncludeStderr bool          `config:"include_stderr"`  // 是否采集 stderr
+	RestartDelay  time.Duration `config:"restart_delay"`   // continuous 模式下命令退出后的重启间隔
+}
+
+// newConfig 解析配置，continuous 模式下未配置 timeout 时不使用 interval 模式的默认超时，避免持续运行的命令被周期性终止
+func newConfig(cfg *common.Config) (config, error) {
+	c := defaultConfig
+	if err := cfg.Unpack(&c); err != nil {
+		return c, err
+	}
+	if c.Mode == modeContinuous && !cfg.HasField("timeout") {
+		c.Timeout = 0
+	}
+	return c, nil
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Command == "" {
+		return fmt.Errorf("command is required")
+	}
+	switch c.Mode {
+	case modeInterval:
+		if c.Interval <= 0 {
+			return fmt.Errorf("interval must be greater than 0")
+		}
+		if c.Timeout <= 0 {
+			return fmt.Errorf("timeout must be greater than 0 in interval mode")
+		}
+	case modeContinuous:
+		if c.RestartDelay <= 0 {
+			return fmt.Errorf("restart_delay must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("mode(%s) is not supported", c.Mode)
+	}
+	if c.MaxOutputSize <= 0 {
+		return fmt.Errorf("max_output_size must be greater than 0")
+	}
+	return nil
+}
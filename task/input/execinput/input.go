@@ -0,0 +1,285 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package execinput
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+	"github.com/TencentBlueKing/bkunifylogbeat/utils"
+)
+
+const inputName = "exec"
+
+var (
+	execRuns     = bkmonitoring.NewInt("exec_runs")      // 命令执行次数
+	execSkipped  = bkmonitoring.NewInt("exec_skipped")   // 上次执行未结束而跳过的次数
+	execTimeouts = bkmonitoring.NewInt("exec_timeouts")  // 执行超时次数
+	execFailed   = bkmonitoring.NewInt("exec_failed")    // 命令无法启动的次数
+	execLines    = bkmonitoring.NewInt("exec_lines")     // 采集的输出行数
+	execTruncate = bkmonitoring.NewInt("exec_truncated") // 输出超过限制被截断的次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 周期执行或持续运行命令，将输出作为日志采集
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+
+	config  config
+	command string // 完整命令，附加到 ext 中
+	outlet  channel.Outleter
+
+	running int32 // 是否有正在执行的命令，用于防止重复执行
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewInput creates a new exec input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config, err := newConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config:  config,
+		command: strings.Join(append([]string{config.Command}, config.Args...), " "),
+		outlet:  outlet,
+	}
+	return p, nil
+}
+
+// Run 启动命令调度，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started {
+		return
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.wg.Add(1)
+	if p.config.Mode == modeContinuous {
+		go p.runContinuous()
+	} else {
+		go p.runInterval()
+	}
+	logp.Info("%s input started, command: %s, mode: %s", inputName, p.command, p.config.Mode)
+	p.started = true
+}
+
+// runInterval 按周期执行命令，上一次执行未结束时跳过本次执行
+func (p *Input) runInterval() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	var runs sync.WaitGroup
+	defer runs.Wait()
+	for {
+		if atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+			runs.Add(1)
+			go func() {
+				defer runs.Done()
+				defer atomic.StoreInt32(&p.running, 0)
+				p.runOnce()
+			}()
+		} else {
+			execSkipped.Add(1)
+			logp.Warn("%s input skip running %s, last run is not finished", inputName, p.command)
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce 执行一次命令，结束后将输出连同退出码、耗时一起发送
+func (p *Input) runOnce() {
+	if !p.waitCpuLimiter() {
+		return
+	}
+
+	type line struct {
+		stream string
+		text   string
+	}
+	var lines []line
+	res, err := runCommand(p.ctx, p.config, func(stream, text string) bool {
+		lines = append(lines, line{stream: stream, text: text})
+		return true
+	})
+	if !p.onFinished(res, err) {
+		return
+	}
+
+	for _, l := range lines {
+		ext := p.newExt(l.stream)
+		ext["exit_code"] = res.ExitCode
+		ext["duration_ms"] = res.Duration.Milliseconds()
+		if res.TimedOut {
+			ext["timed_out"] = true
+		}
+		if !p.emit(l.text, ext) {
+			return
+		}
+	}
+}
+
+// runContinuous 持续运行命令并实时发送输出，命令退出后按 restart_delay 重启
+func (p *Input) runContinuous() {
+	defer p.wg.Done()
+	for {
+		if !p.waitCpuLimiter() {
+			return
+		}
+		res, err := runCommand(p.ctx, p.config, func(stream, text string) bool {
+			return p.emit(text, p.newExt(stream))
+		})
+		p.onFinished(res, err)
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(p.config.RestartDelay):
+		}
+	}
+}
+
+// onFinished 记录执行结果，返回是否需要发送输出
+func (p *Input) onFinished(res result, err error) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		execFailed.Add(1)
+		logp.Err("%s input run %s error: %v", inputName, p.command, err)
+		return false
+	}
+	execRuns.Add(1)
+	if res.TimedOut {
+		execTimeouts.Add(1)
+		logp.Warn("%s input run %s timeout after %s", inputName, p.command, res.Duration)
+	}
+	if res.Truncated {
+		execTruncate.Add(1)
+	}
+	logp.Debug(inputName, "run %s finished, exit code: %d, duration: %s", p.command, res.ExitCode, res.Duration)
+	return true
+}
+
+// waitCpuLimiter 开启 CPU 限制时，等待 CPU 使用率降低后再执行命令
+func (p *Input) waitCpuLimiter() bool {
+	if !utils.IsEnableRateLimiter || utils.GlobalCpuLimiter == nil {
+		return true
+	}
+	checkInterval := utils.GlobalCpuLimiter.GetCheckInterval()
+	for !utils.GlobalCpuLimiter.Allow() {
+		select {
+		case <-p.ctx.Done():
+			return false
+		case <-time.After(checkInterval):
+		}
+	}
+	return true
+}
+
+func (p *Input) newExt(stream string) map[string]interface{} {
+	return map[string]interface{}{
+		"command": p.command,
+		"stream":  stream,
+	}
+}
+
+func (p *Input) emit(text string, ext map[string]interface{}) bool {
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"data": text},
+	}
+	// stdout、stderr 分开打包，保证同一个打包内的 ext 一致
+	data.SetState(base.NewStatelessState(inputName + "://" + p.command + "#" + ext["stream"].(string)))
+	formatter.SetEventExt(data, ext)
+	if !p.outlet.OnEvent(data) {
+		return false
+	}
+	execLines.Add(1)
+	return true
+}
+
+// Stop 停止调度，并终止正在执行的命令
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input, command: %s", inputName, p.command)
+	if p.started {
+		p.cancel()
+		p.wg.Wait()
+		p.started = false
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
@@ -0,0 +1,79 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fifo
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+var defaultConfig = config{
+	Create:         true,
+	Mode:           "0660",
+	Framing:        framing.Newline,
+	MaxMessageSize: 1 * humanize.MiByte,
+	ReopenInterval: 100 * time.Millisecond,
+}
+
+type config struct {
+	Path           string        `config:"path"`             // 命名管道路径
+	Create         bool          `config:"create"`           // 管道不存在时是否自动创建
+	Mode           string        `config:"mode"`             // 自动创建时的文件权限
+	Framing        string        `config:"framing"`          // 分帧方式：newline、null、octet_counting
+	MaxMessageSize int           `config:"max_message_size"` // 单条消息最大长度，超出部分被截断
+	ReopenInterval time.Duration `config:"reopen_interval"`  // 打开或读取管道异常后，重新打开管道的间隔
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if err := framing.Validate(c.Framing); err != nil {
+		return err
+	}
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("max_message_size must be greater than 0")
+	}
+	if c.ReopenInterval <= 0 {
+		return fmt.Errorf("reopen_interval must be greater than 0")
+	}
+	if _, err := c.fileMode(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *config) fileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode(%s): %v", c.Mode, err)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,72 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package fifo
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ensureFifo 检查路径是否为命名管道，不存在时按配置创建
+func ensureFifo(c config) error {
+	info, err := os.Stat(c.Path)
+	if os.IsNotExist(err) {
+		if !c.Create {
+			return fmt.Errorf("fifo(%s) does not exist", c.Path)
+		}
+		mode, err := c.fileMode()
+		if err != nil {
+			return err
+		}
+		if err = syscall.Mkfifo(c.Path, uint32(mode)); err != nil {
+			return err
+		}
+		// 不受 umask 影响
+		return os.Chmod(c.Path, mode)
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a fifo", c.Path)
+	}
+	return nil
+}
+
+// openFifo 以阻塞方式打开管道，直到有写入端连接才返回，避免没有写入端时读取立即返回 EOF 而反复打开
+// 打开后的读取由 runtime poller 等待数据
+func openFifo(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY, 0)
+}
+
+// wakeFifo 以写入端打开一次管道，唤醒阻塞在 openFifo 中的读取，没有读取端时直接返回
+func wakeFifo(path string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err == nil {
+		_ = f.Close()
+	}
+}
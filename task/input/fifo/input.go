@@ -0,0 +1,150 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fifo
+
+import (
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const inputName = "fifo"
+
+var (
+	fifoMessages          = bkmonitoring.NewInt("fifo_messages")           // 接收的消息数
+	fifoMessagesTruncated = bkmonitoring.NewInt("fifo_messages_truncated") // 超过最大长度被截断的消息数
+	fifoReopened          = bkmonitoring.NewInt("fifo_reopened")           // 已连接的写入端全部断开后重新打开的次数
+	fifoErrors            = bkmonitoring.NewInt("fifo_error")              // 读取异常次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 读取命名管道中的日志，没有采集进度，不依赖 Registrar
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+
+	config config
+	outlet channel.Outleter
+	reader *reader
+}
+
+// NewInput creates a new fifo input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config: config,
+		outlet: outlet,
+	}
+	p.reader = newReader(config, p.onMessage, func(err error) {
+		fifoErrors.Add(1)
+		logp.Err("%s input(%s) error: %v", inputName, config.Path, err)
+	})
+	return p, nil
+}
+
+// onMessage 将消息转换为采集事件，outlet 阻塞时停止读取，由管道缓冲区实现背压
+func (p *Input) onMessage(msg string, truncated bool) bool {
+	fifoMessages.Add(1)
+	if truncated {
+		fifoMessagesTruncated.Add(1)
+	}
+
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"data": msg},
+	}
+	data.SetState(base.NewStatelessState(inputName + "://" + p.config.Path))
+	formatter.SetEventExt(data, map[string]interface{}{"fifo_path": p.config.Path})
+	return p.outlet.OnEvent(data)
+}
+
+// Run 开始读取管道，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started {
+		return
+	}
+	if err := p.reader.Start(); err != nil {
+		fifoErrors.Add(1)
+		logp.Err("%s input open %s error: %v", inputName, p.config.Path, err)
+		return
+	}
+	logp.Info("%s input reading from %s", inputName, p.config.Path)
+	p.started = true
+}
+
+// Stop 停止读取管道
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input on %s", inputName, p.config.Path)
+	if p.started {
+		p.reader.Stop()
+		p.started = false
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
@@ -0,0 +1,169 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fifo
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+// handler 处理一条消息，返回 false 时停止读取
+type handler func(msg string, truncated bool) bool
+
+// reader 持续读取命名管道，写入端全部断开后重新打开，阻塞等待新的写入端
+type reader struct {
+	config  config
+	handler handler
+	onError func(err error)
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mtx  sync.Mutex
+	file *os.File
+}
+
+func newReader(config config, h handler, onError func(err error)) *reader {
+	return &reader{
+		config:  config,
+		handler: h,
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 检查管道并开始读取
+func (r *reader) Start() error {
+	if err := ensureFifo(r.config); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+// Stop 关闭管道并等待读取结束，等待写入端连接的读取由 wakeFifo 唤醒
+func (r *reader) Stop() {
+	close(r.done)
+	r.mtx.Lock()
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	r.mtx.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(finished)
+	}()
+	for {
+		// 读取可能在唤醒之后才开始等待写入端，因此按间隔重复唤醒
+		wakeFifo(r.config.Path)
+		select {
+		case <-finished:
+			return
+		case <-time.After(r.config.ReopenInterval):
+		}
+	}
+}
+
+func (r *reader) isDone() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *reader) run() {
+	defer r.wg.Done()
+	for {
+		stopped, err := r.readOnce()
+		if err != nil && !r.isDone() {
+			r.onError(err)
+		}
+		if stopped {
+			return
+		}
+		if err == nil {
+			// 写入端全部断开，立即重新打开等待新的写入端
+			fifoReopened.Add(1)
+			continue
+		}
+		// 打开或读取异常时按间隔重试
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.config.ReopenInterval):
+		}
+	}
+}
+
+// readOnce 等待写入端连接后读取到所有写入端断开为止，返回是否需要停止
+func (r *reader) readOnce() (bool, error) {
+	f, err := openFifo(r.config.Path)
+	if err != nil {
+		return r.isDone(), err
+	}
+	r.mtx.Lock()
+	if r.isDone() {
+		r.mtx.Unlock()
+		_ = f.Close()
+		return true, nil
+	}
+	r.file = f
+	r.mtx.Unlock()
+
+	defer func() {
+		r.mtx.Lock()
+		r.file = nil
+		r.mtx.Unlock()
+		_ = f.Close()
+	}()
+
+	frameReader, err := framing.NewReader(f, r.config.Framing, r.config.MaxMessageSize)
+	if err != nil {
+		return true, err
+	}
+	for {
+		msg, truncated, err := frameReader.Next()
+		if errors.Is(err, io.EOF) {
+			return r.isDone(), nil
+		}
+		if err != nil {
+			if r.isDone() {
+				return true, nil
+			}
+			return false, err
+		}
+		if !r.handler(string(msg), truncated) {
+			return true, nil
+		}
+	}
+}
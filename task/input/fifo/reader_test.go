@@ -0,0 +1,130 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package fifo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.fifo")
+	c.ReopenInterval = 10 * time.Millisecond
+
+	received := make(chan string, 10)
+	r := newReader(c, func(msg string, truncated bool) bool {
+		received <- msg
+		return true
+	}, func(err error) {})
+	assert.NoError(t, r.Start())
+	defer r.Stop()
+
+	info, err := os.Stat(c.Path)
+	assert.NoError(t, err)
+	assert.True(t, info.Mode()&os.ModeNamedPipe != 0)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	write := func(content string) {
+		w, err := os.OpenFile(c.Path, os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+	wait := func() string {
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+			return ""
+		}
+	}
+
+	// 没有写入端时等待写入端连接，不会反复重新打开
+	reopened := fifoReopened.Get()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, reopened, fifoReopened.Get())
+
+	// 写入端断开后重新打开，继续接收新写入端的数据
+	write("line1\nline2")
+	assert.Equal(t, "line1", wait())
+	assert.Equal(t, "line2", wait())
+	write("line3\n")
+	assert.Equal(t, "line3", wait())
+	// 第一个写入端断开后才能读取到第二个写入端的数据
+	assert.True(t, fifoReopened.Get() > reopened)
+}
+
+func TestReaderStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.fifo")
+	r := newReader(c, func(msg string, truncated bool) bool { return true }, func(err error) {})
+	assert.NoError(t, r.Start())
+
+	// 等待写入端连接时也能停止
+	time.Sleep(50 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop timeout")
+	}
+}
+
+func TestEnsureFifo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.fifo")
+	c.Create = false
+	assert.Error(t, ensureFifo(c))
+
+	// 普通文件
+	c.Path = filepath.Join(dir, "app.log")
+	assert.NoError(t, ioutil.WriteFile(c.Path, []byte("x"), 0644))
+	assert.Error(t, ensureFifo(c))
+}
@@ -0,0 +1,90 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	// sampleSize 识别二进制内容时读取的文件头大小
+	sampleSize = 8 * 1024
+	// maxControlPercent 控制字符占比超过该值时视为二进制内容
+	maxControlPercent = 10
+)
+
+var boms = [][]byte{
+	{0xEF, 0xBB, 0xBF}, // utf-8
+	{0xFF, 0xFE},       // utf-16le
+	{0xFE, 0xFF},       // utf-16be
+}
+
+// readSample 读取文件头用于识别二进制内容
+func readSample(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sampleSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// IsBinary 根据文件头判断是否为二进制内容：包含 NUL 字节或控制字符占比过高
+// 带 BOM 的内容视为文本，utf-16 等包含 NUL 字节的编码由调用方跳过识别
+func IsBinary(sample []byte) bool {
+	if len(sample) == 0 {
+		return false
+	}
+	for _, bom := range boms {
+		if bytes.HasPrefix(sample, bom) {
+			return false
+		}
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	control := 0
+	for _, c := range sample {
+		if (c < 0x20 && !isTextControl(c)) || c == 0x7F {
+			control++
+		}
+	}
+	return control*100 > len(sample)*maxControlPercent
+}
+
+// isTextControl 文本中常见的控制字符，包括终端颜色使用的 ESC
+func isTextControl(c byte) bool {
+	switch c {
+	case '\t', '\n', '\r', '\f', '\v', '\b', 0x1B:
+		return true
+	}
+	return false
+}
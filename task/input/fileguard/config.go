@@ -0,0 +1,52 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config 文件采集的保护配置，由按文件管理的日志采集通过 Hook 使用
+type Config struct {
+	DataID      int           `config:"dataid"`
+	Encoding    string        `config:"encoding"`
+	IgnoreOlder time.Duration `config:"ignore_older"`
+
+	MaxFileSize         int64 `config:"max_file_size"`                    // 超过该大小的文件不采集，0 表示不限制
+	MaxReadBytesPerScan int64 `config:"max_read_bytes_per_file_per_scan"` // 每个文件在一个扫描周期内最多读取的字节数，0 表示不限制
+	SkipBinaryFiles     bool  `config:"skip_binary_files"`                // 跳过内容为二进制的文件
+}
+
+// Enabled 是否配置了任意一项保护
+func (c *Config) Enabled() bool {
+	return c.MaxFileSize > 0 || c.MaxReadBytesPerScan > 0 || c.SkipBinaryFiles
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.MaxFileSize < 0 || c.MaxReadBytesPerScan < 0 {
+		return fmt.Errorf("max_file_size and max_read_bytes_per_file_per_scan must not be negative")
+	}
+	return nil
+}
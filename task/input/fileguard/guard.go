@@ -0,0 +1,216 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var guardID int64
+
+// binaryResult 文件二进制内容的识别结果，文件未替换时不再重复读取
+type binaryResult struct {
+	info   os.FileInfo
+	binary bool
+}
+
+// Guard 在文件开始采集前检查文件大小、修改时间以及内容，并限制每个扫描周期内读取的字节数
+// 被跳过的文件记录在跳过报告中，之后每次扫描重新检查
+type Guard struct {
+	id     int
+	config Config
+
+	mtx     sync.Mutex
+	binary  map[string]binaryResult
+	budgets map[string]*Budget
+}
+
+// New 创建文件保护
+func New(config Config) *Guard {
+	return &Guard{
+		id:      int(atomic.AddInt64(&guardID, 1)),
+		config:  config,
+		binary:  make(map[string]binaryResult),
+		budgets: make(map[string]*Budget),
+	}
+}
+
+// Check 检查文件是否可以采集，因文件大小或内容不能采集时记录到跳过报告
+func (g *Guard) Check(path string, info os.FileInfo, now time.Time) bool {
+	reason, detail := g.check(path, info, now)
+	if reason == "" || reason == ReasonIgnoreOlder {
+		skipReport.clear(g.id, path)
+		return reason == ""
+	}
+	skipReport.skip(g.id, SkipRecord{
+		DataID:    g.config.DataID,
+		Path:      path,
+		Reason:    reason,
+		Detail:    detail,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		SkippedAt: now,
+	})
+	return false
+}
+
+func (g *Guard) check(path string, info os.FileInfo, now time.Time) (string, string) {
+	if g.config.IgnoreOlder > 0 && now.Sub(info.ModTime()) > g.config.IgnoreOlder {
+		return ReasonIgnoreOlder, fmt.Sprintf("modified %s ago, ignore_older is %s",
+			now.Sub(info.ModTime()).Truncate(time.Second), g.config.IgnoreOlder)
+	}
+	if g.config.MaxFileSize > 0 && info.Size() > g.config.MaxFileSize {
+		return ReasonMaxFileSize, fmt.Sprintf("size %d exceeds max_file_size %d", info.Size(), g.config.MaxFileSize)
+	}
+	if g.config.SkipBinaryFiles && g.isBinary(path, info) {
+		return ReasonBinary, "file content is not text"
+	}
+	return "", ""
+}
+
+// isBinary 识别文件内容，utf-16 编码的文件不识别
+func (g *Guard) isBinary(path string, info os.FileInfo) bool {
+	if strings.HasPrefix(strings.ToLower(g.config.Encoding), "utf-16") {
+		return false
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	// 文件头不足识别的大小时，文件增长后重新识别
+	if result, ok := g.binary[path]; ok && os.SameFile(result.info, info) &&
+		(result.info.Size() >= sampleSize || result.info.Size() == info.Size()) {
+		return result.binary
+	}
+	sample, err := readSample(path)
+	if err != nil {
+		// 读取失败时交由日志采集处理
+		return false
+	}
+	binary := IsBinary(sample)
+	g.binary[path] = binaryResult{info: info, binary: binary}
+	return binary
+}
+
+// Budget 获取文件在每个扫描周期内的读取额度，未配置时返回 nil
+func (g *Guard) Budget(path string) *Budget {
+	if g.config.MaxReadBytesPerScan <= 0 {
+		return nil
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	b, ok := g.budgets[path]
+	if !ok {
+		b = newBudget(g.config.MaxReadBytesPerScan)
+		g.budgets[path] = b
+	}
+	return b
+}
+
+// ResetBudgets 新的扫描周期开始，恢复所有文件的读取额度
+func (g *Guard) ResetBudgets() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for _, b := range g.budgets {
+		b.reset()
+	}
+}
+
+// Forget 文件已删除，移除相关的记录
+func (g *Guard) Forget(path string) {
+	g.mtx.Lock()
+	delete(g.binary, path)
+	if b, ok := g.budgets[path]; ok {
+		b.reset()
+		delete(g.budgets, path)
+	}
+	g.mtx.Unlock()
+	skipReport.clear(g.id, path)
+}
+
+// Close 停止采集时移除跳过报告中的全部记录，并释放等待读取额度的采集
+func (g *Guard) Close() {
+	g.mtx.Lock()
+	for path, b := range g.budgets {
+		b.reset()
+		delete(g.budgets, path)
+	}
+	g.mtx.Unlock()
+	skipReport.remove(g.id)
+}
+
+// Budget 单个文件在一个扫描周期内的读取额度
+type Budget struct {
+	mtx    sync.Mutex
+	limit  int64
+	used   int64
+	offset int64 // 上一次记录的读取位置
+	next   chan struct{}
+}
+
+func newBudget(limit int64) *Budget {
+	return &Budget{
+		limit:  limit,
+		offset: -1,
+		next:   make(chan struct{}),
+	}
+}
+
+// Consume 记录文件读取到的位置，本周期的额度用完时阻塞到下一个扫描周期，done 关闭时返回 false
+// 额度按读取位置的增量计算，单条事件超出额度时仍然发送
+func (b *Budget) Consume(offset int64, done <-chan struct{}) bool {
+	b.mtx.Lock()
+	throttled := false
+	for b.used >= b.limit {
+		if !throttled {
+			throttled = true
+			readThrottled.Add(1)
+		}
+		next := b.next
+		b.mtx.Unlock()
+		select {
+		case <-next:
+		case <-done:
+			return false
+		}
+		b.mtx.Lock()
+	}
+	if b.offset >= 0 && offset > b.offset {
+		b.used += offset - b.offset
+	}
+	b.offset = offset
+	b.mtx.Unlock()
+	return true
+}
+
+func (b *Budget) reset() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.used = 0
+	close(b.next)
+	b.next = make(chan struct{})
+}
@@ -0,0 +1,181 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, IsBinary(nil))
+	assert.False(t, IsBinary([]byte("2021-03-04 05:06:07 INFO hello\n\tat Main.java:10\n")))
+	assert.False(t, IsBinary([]byte("\x1b[31mERROR\x1b[0m colored\r\n")))
+	// gbk 等非 utf-8 的文本
+	assert.False(t, IsBinary([]byte{0xc4, 0xe3, 0xba, 0xc3, '\n'}))
+	// 带 BOM 的 utf-16
+	assert.False(t, IsBinary([]byte{0xFF, 0xFE, 'a', 0, '\n', 0}))
+
+	assert.True(t, IsBinary([]byte("\x7fELF\x02\x01\x01\x00\x00\x00")))
+	assert.True(t, IsBinary(bytes.Repeat([]byte{0x01, 0x02, 'a', 'b', 'c'}, 100)))
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) (string, os.FileInfo) {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, content, 0644))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	return path, info
+}
+
+func TestGuardCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileguard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	skipReport.setFile(filepath.Join(dir, "report", "skip_report.json"))
+	defer skipReport.setFile("")
+
+	g := New(Config{
+		DataID:          1,
+		IgnoreOlder:     24 * time.Hour,
+		MaxFileSize:     100,
+		SkipBinaryFiles: true,
+	})
+	defer g.Close()
+	now := time.Now()
+
+	text, info := writeFile(t, dir, "text.log", []byte("hello\n"))
+	assert.True(t, g.Check(text, info, now))
+
+	big, info := writeFile(t, dir, "big.log", bytes.Repeat([]byte("a\n"), 100))
+	assert.False(t, g.Check(big, info, now))
+
+	binary, info := writeFile(t, dir, "binary.log", []byte("\x00\x01\x02"))
+	assert.False(t, g.Check(binary, info, now))
+
+	// ignore_older 不记录到跳过报告
+	old, info := writeFile(t, dir, "old.log", []byte("hello\n"))
+	assert.False(t, g.Check(old, info, now.Add(48*time.Hour)))
+
+	records := make(map[string]SkipRecord)
+	for _, record := range skipReport.list() {
+		records[record.Path] = record
+	}
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, ReasonMaxFileSize, records[big].Reason)
+	assert.Equal(t, int64(200), records[big].Size)
+	assert.Equal(t, ReasonBinary, records[binary].Reason)
+	assert.Equal(t, 1, records[binary].DataID)
+	_, ok := records[old]
+	assert.False(t, ok)
+
+	// 报告文件延迟写入
+	_, err = os.Stat(filepath.Join(dir, "report", "skip_report.json"))
+	assert.True(t, os.IsNotExist(err))
+	skipReport.flush()
+	b, err := ioutil.ReadFile(filepath.Join(dir, "report", "skip_report.json"))
+	assert.NoError(t, err)
+	var content struct {
+		Files []SkipRecord `json:"files"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &content))
+	assert.Equal(t, 2, len(content.Files))
+
+	// 重复跳过时保留首次跳过的时间
+	_, info = writeFile(t, dir, "big.log", bytes.Repeat([]byte("a\n"), 200))
+	assert.False(t, g.Check(big, info, now.Add(time.Minute)))
+	for _, record := range skipReport.list() {
+		if record.Path == big {
+			assert.Equal(t, int64(400), record.Size)
+			assert.True(t, record.SkippedAt.Equal(now))
+		}
+	}
+
+	// 文件截断后恢复采集
+	_, info = writeFile(t, dir, "big.log", []byte("a\n"))
+	assert.True(t, g.Check(big, info, now))
+	assert.Equal(t, 1, len(skipReport.list()))
+
+	// 文件删除后移除记录
+	g.Forget(binary)
+	assert.Equal(t, 0, len(skipReport.list()))
+	_, info = writeFile(t, dir, "binary.log", []byte("\x00\x01\x02"))
+	assert.False(t, g.Check(binary, info, now))
+
+	g.Close()
+	assert.Equal(t, 0, len(skipReport.list()))
+}
+
+func TestGuardSkipBinaryWithUTF16(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileguard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	g := New(Config{Encoding: "utf-16le", SkipBinaryFiles: true})
+	defer g.Close()
+	path, info := writeFile(t, dir, "utf16.log", []byte{'a', 0, '\n', 0})
+	assert.True(t, g.Check(path, info, time.Now()))
+}
+
+func TestBudget(t *testing.T) {
+	g := New(Config{MaxReadBytesPerScan: 100})
+	defer g.Close()
+	assert.Nil(t, New(Config{}).Budget("a.log"))
+
+	b := g.Budget("a.log")
+	assert.True(t, b == g.Budget("a.log"))
+	done := make(chan struct{})
+	assert.True(t, b.Consume(0, done))
+	assert.True(t, b.Consume(60, done))
+	// 单条事件超出额度时仍然发送
+	assert.True(t, b.Consume(160, done))
+
+	consumed := make(chan bool)
+	go func() {
+		consumed <- b.Consume(170, done)
+	}()
+	select {
+	case <-consumed:
+		t.Fatal("budget should be exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 下一个扫描周期恢复额度
+	g.ResetBudgets()
+	assert.True(t, <-consumed)
+
+	// 文件截断后不计入额度
+	assert.True(t, b.Consume(10, done))
+	assert.True(t, b.Consume(100, done))
+	go func() {
+		consumed <- b.Consume(110, done)
+	}()
+	close(done)
+	assert.False(t, <-consumed)
+}
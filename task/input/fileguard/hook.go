@@ -0,0 +1,114 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/paths"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/managedlog"
+)
+
+const (
+	hookName = "file_guard"
+
+	// defaultReportFile 跳过报告的文件名，位于 path.data 下
+	defaultReportFile = "skip_report.json"
+)
+
+var reportOnce sync.Once
+
+func init() {
+	err := managedlog.RegisterHook(hookName, newHook)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// hook 检查通过的文件才开始采集，并限制每个扫描周期内读取的字节数
+// log 类型任务配置 max_file_size 等文件保护后开启，见 config/input/log.go
+type hook struct {
+	guard *Guard
+}
+
+func newHook(cfg *common.Config, _ *input.Context) (managedlog.Hook, error) {
+	config := Config{}
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled() {
+		return nil, nil
+	}
+	// 跳过报告写入 path.data 下的 skip_report.json
+	reportOnce.Do(func() {
+		skipReport.setFile(paths.Resolve(paths.Data, defaultReportFile))
+	})
+	return &hook{guard: New(config)}, nil
+}
+
+// Check 检查文件大小、修改时间以及内容
+func (h *hook) Check(path string, info os.FileInfo, now time.Time) bool {
+	return h.guard.Check(path, info, now)
+}
+
+// Prepare 配置了单次扫描读取量时，按读取额度限制文件的读取速度
+func (h *hook) Prepare(f *managedlog.File) (bool, error) {
+	budget := h.guard.Budget(f.Path)
+	if budget == nil {
+		return true, nil
+	}
+	f.AddFilter(func(data *util.Data, done <-chan struct{}) bool {
+		if data.Event.Fields == nil {
+			return true
+		}
+		return budget.Consume(data.GetState().Offset, done)
+	})
+	return true, nil
+}
+
+// Refresh 文件保护不影响采集中的文件的配置
+func (h *hook) Refresh(*managedlog.File, os.FileInfo) bool {
+	return false
+}
+
+// Reset 新的扫描周期开始，恢复所有文件的读取额度
+func (h *hook) Reset() {
+	h.guard.ResetBudgets()
+}
+
+// Forget 文件已删除，移除相关的记录
+func (h *hook) Forget(path string) {
+	h.guard.Forget(path)
+}
+
+// Close 移除跳过报告中的记录，并释放等待读取额度的采集
+func (h *hook) Close() {
+	h.guard.Close()
+}
@@ -0,0 +1,206 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package fileguard
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+// 文件被跳过的原因
+const (
+	ReasonIgnoreOlder = "ignore_older"  // 修改时间早于 ignore_older，属于日志采集的常规行为，不记录到跳过报告
+	ReasonMaxFileSize = "max_file_size" // 文件大小超过 max_file_size
+	ReasonBinary      = "binary"        // 文件内容为二进制
+)
+
+// reportFlushInterval 跳过报告变化后延迟写入文件的时间，期间的变化合并为一次写入
+const reportFlushInterval = 10 * time.Second
+
+var (
+	skippedFiles = bkmonitoring.NewInt("file_skipped_files", monitoring.Gauge) // 当前被跳过的文件数量
+	skippedTotal = map[string]*monitoring.Int{                                 // 按原因统计文件被跳过的次数
+		ReasonMaxFileSize: bkmonitoring.NewInt("file_skipped_max_file_size"),
+		ReasonBinary:      bkmonitoring.NewInt("file_skipped_binary"),
+	}
+	readThrottled = bkmonitoring.NewInt("file_read_throttled") // 文件读取达到单次扫描上限的次数
+)
+
+// SkipRecord 跳过报告中的一条记录，说明哪个文件在什么时候因为什么原因没有采集
+type SkipRecord struct {
+	DataID    int       `json:"dataid"`
+	Path      string    `json:"path"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	SkippedAt time.Time `json:"skipped_at"` // 首次因为该原因被跳过的时间
+}
+
+// report 所有任务当前被跳过的文件，变化后延迟写入报告文件
+type report struct {
+	mtx     sync.Mutex
+	file    string
+	records map[int]map[string]SkipRecord // guard id => path => record
+	timer   *time.Timer                   // 等待写入的定时器，为空表示没有未写入的变化
+
+	writeMtx sync.Mutex // 保证报告文件按顺序写入
+}
+
+var skipReport = &report{records: make(map[int]map[string]SkipRecord)}
+
+// setFile 设置报告文件路径，为空时不写入文件
+func (r *report) setFile(path string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.file = path
+}
+
+// skip 记录被跳过的文件，原因不变时保留首次跳过的时间
+func (r *report) skip(id int, record SkipRecord) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	records, ok := r.records[id]
+	if !ok {
+		records = make(map[string]SkipRecord)
+		r.records[id] = records
+	}
+	last, ok := records[record.Path]
+	if ok && last.Reason == record.Reason {
+		record.SkippedAt = last.SkippedAt
+		records[record.Path] = record
+		return
+	}
+	if !ok {
+		skippedFiles.Add(1)
+	}
+	skippedTotal[record.Reason].Add(1)
+	records[record.Path] = record
+	r.changed()
+}
+
+// clear 文件不再被跳过或已被删除时移除记录
+func (r *report) clear(id int, path string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.records[id][path]; !ok {
+		return
+	}
+	delete(r.records[id], path)
+	skippedFiles.Add(-1)
+	r.changed()
+}
+
+// remove 移除 guard 的全部记录
+func (r *report) remove(id int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	records, ok := r.records[id]
+	if !ok {
+		return
+	}
+	delete(r.records, id)
+	skippedFiles.Add(-int64(len(records)))
+	r.changed()
+}
+
+// list 按 dataid、路径排序的全部记录
+func (r *report) list() []SkipRecord {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.sorted()
+}
+
+func (r *report) sorted() []SkipRecord {
+	list := make([]SkipRecord, 0)
+	for _, records := range r.records {
+		for _, record := range records {
+			list = append(list, record)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DataID != list[j].DataID {
+			return list[i].DataID < list[j].DataID
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// changed 记录变化后等待写入，调用方需持有锁
+func (r *report) changed() {
+	if r.file == "" || r.timer != nil {
+		return
+	}
+	r.timer = time.AfterFunc(reportFlushInterval, r.flush)
+}
+
+// flush 写入临时文件后重命名，避免读取到写入一半的报告
+func (r *report) flush() {
+	r.writeMtx.Lock()
+	defer r.writeMtx.Unlock()
+
+	r.mtx.Lock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	file, list := r.file, r.sorted()
+	r.mtx.Unlock()
+	if file == "" {
+		return
+	}
+	if err := writeReport(file, list); err != nil {
+		logp.Err("write skip report(%s) error: %v", file, err)
+	}
+}
+
+func writeReport(file string, list []SkipRecord) error {
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"update_time": time.Now(),
+		"files":       list,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
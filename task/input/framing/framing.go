@@ -0,0 +1,171 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package framing 流式连接的消息分帧读取
+package framing
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+const (
+	Newline       = "newline"        // 以 \n 分隔，兼容 \r\n
+	Null          = "null"           // 以 \0 分隔
+	OctetCounting = "octet_counting" // RFC6587 octet counting: "长度 空格 消息"
+)
+
+// maxOctetCountDigits 长度字段的最大位数
+const maxOctetCountDigits = 10
+
+// ErrInvalidOctetCount octet counting 分帧的长度字段不合法
+var ErrInvalidOctetCount = errors.New("invalid octet counting frame")
+
+// Reader 按分帧方式从连接中读取消息，超过 maxSize 的消息会被截断
+type Reader struct {
+	reader  *bufio.Reader
+	framing string
+	maxSize int
+}
+
+// NewReader 创建分帧读取，maxSize 小于等于 0 时不限制消息长度
+func NewReader(r io.Reader, framing string, maxSize int) (*Reader, error) {
+	if err := Validate(framing); err != nil {
+		return nil, err
+	}
+	return &Reader{
+		reader:  bufio.NewReader(r),
+		framing: framing,
+		maxSize: maxSize,
+	}, nil
+}
+
+// Next 读取下一条消息，truncated 表示消息是否被截断
+func (f *Reader) Next() (msg []byte, truncated bool, err error) {
+	switch f.framing {
+	case Null:
+		return f.readDelimited(0)
+	case OctetCounting:
+		return f.readOctetCounting()
+	default:
+		msg, truncated, err = f.readDelimited('\n')
+		if n := len(msg); n > 0 && msg[n-1] == '\r' {
+			msg = msg[:n-1]
+		}
+		return msg, truncated, err
+	}
+}
+
+// readDelimited 读取到分隔符为止，超出 maxSize 的部分丢弃
+// 连接关闭时如果还有未以分隔符结尾的数据，同样作为一条消息返回
+func (f *Reader) readDelimited(delim byte) ([]byte, bool, error) {
+	var (
+		msg       []byte
+		truncated bool
+	)
+	for {
+		line, err := f.reader.ReadSlice(delim)
+		if err == nil {
+			line = line[:len(line)-1]
+		}
+		if !truncated {
+			if f.maxSize > 0 && len(msg)+len(line) > f.maxSize {
+				msg = append(msg, line[:f.maxSize-len(msg)]...)
+				truncated = true
+			} else {
+				msg = append(msg, line...)
+			}
+		}
+
+		switch err {
+		case nil:
+			return msg, truncated, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(msg) > 0 || truncated {
+				return msg, truncated, nil
+			}
+			return nil, false, io.EOF
+		default:
+			return nil, false, err
+		}
+	}
+}
+
+func (f *Reader) readOctetCounting() ([]byte, bool, error) {
+	var digits []byte
+	for {
+		b, err := f.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(digits) > 0 {
+				return nil, false, io.ErrUnexpectedEOF
+			}
+			return nil, false, err
+		}
+		// 兼容部分客户端在消息之间额外追加的换行符
+		if len(digits) == 0 && (b == '\n' || b == '\r') {
+			continue
+		}
+		if b == ' ' && len(digits) > 0 {
+			break
+		}
+		if b < '0' || b > '9' || len(digits) >= maxOctetCountDigits {
+			return nil, false, ErrInvalidOctetCount
+		}
+		digits = append(digits, b)
+	}
+
+	size, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return nil, false, ErrInvalidOctetCount
+	}
+
+	readSize, truncated := size, false
+	if f.maxSize > 0 && size > f.maxSize {
+		readSize, truncated = f.maxSize, true
+	}
+	msg := make([]byte, readSize)
+	if _, err = io.ReadFull(f.reader, msg); err != nil {
+		return nil, false, err
+	}
+	if truncated {
+		if _, err = io.CopyN(ioutil.Discard, f.reader, int64(size-readSize)); err != nil {
+			return nil, false, err
+		}
+	}
+	return msg, truncated, nil
+}
+
+// Validate 校验分帧方式是否支持
+func Validate(framing string) error {
+	switch framing {
+	case Newline, Null, OctetCounting:
+		return nil
+	default:
+		return fmt.Errorf("framing(%s) is not supported", framing)
+	}
+}
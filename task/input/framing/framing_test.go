@@ -0,0 +1,93 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package framing
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, input, framing string, maxSize int) ([]string, []bool, error) {
+	reader, err := NewReader(strings.NewReader(input), framing, maxSize)
+	assert.NoError(t, err)
+
+	var (
+		msgs      []string
+		truncated []bool
+	)
+	for {
+		msg, isTruncated, err := reader.Next()
+		if err == io.EOF {
+			return msgs, truncated, nil
+		}
+		if err != nil {
+			return msgs, truncated, err
+		}
+		msgs = append(msgs, string(msg))
+		truncated = append(truncated, isTruncated)
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	// 换行分隔，兼容 \r\n，最后一条没有换行符
+	msgs, truncated, err := readAll(t, "line1\nline2\r\n\nline3", Newline, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line1", "line2", "", "line3"}, msgs)
+	assert.Equal(t, []bool{false, false, false, false}, truncated)
+
+	// 超长截断
+	msgs, truncated, err = readAll(t, "0123456789\nabc\n", Newline, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0123", "abc"}, msgs)
+	assert.Equal(t, []bool{true, false}, truncated)
+
+	// null 分隔，消息中可以包含换行
+	msgs, _, err = readAll(t, "multi\nline\x00line2\x00", Null, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"multi\nline", "line2"}, msgs)
+
+	// octet counting
+	msgs, truncated, err = readAll(t, "11 hello\nworld5 abcde\n3 xyz", OctetCounting, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello\nworld", "abcde", "xyz"}, msgs)
+	assert.Equal(t, []bool{false, false, false}, truncated)
+
+	msgs, truncated, err = readAll(t, "10 01234567893 abc", OctetCounting, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0123", "abc"}, msgs)
+	assert.Equal(t, []bool{true, false}, truncated)
+
+	// 非法长度
+	_, _, err = readAll(t, "abc hello", OctetCounting, 100)
+	assert.Equal(t, ErrInvalidOctetCount, err)
+
+	// 不完整的消息
+	_, _, err = readAll(t, "10 hello", OctetCounting, 100)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = NewReader(strings.NewReader(""), "lf", 100)
+	assert.Error(t, err)
+}
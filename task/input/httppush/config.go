@@ -0,0 +1,101 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package httppush
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	formatAuto   = "auto"
+	formatNDJSON = "ndjson"
+	formatText   = "text"
+)
+
+var defaultConfig = config{
+	Host:        "localhost:9080",
+	SocketMode:  "0660",
+	Path:        "/",
+	Format:      formatAuto,
+	MaxBodySize: 10 * humanize.MiByte,
+	QueueSize:   4096,
+	ReadTimeout: 30 * time.Second,
+}
+
+type config struct {
+	Host        string        `config:"host"`        // 监听地址，仅建议监听 localhost
+	UnixSocket  string        `config:"unix_socket"` // 监听 unix socket，配置后忽略 host
+	SocketMode  string        `config:"socket_mode"` // unix socket 文件权限
+	Path        string        `config:"path"`        // 请求路径
+	Token       string        `config:"token"`       // 认证 token，通过 Authorization: Bearer <token> 传递，用于区分任务
+	Format      string        `config:"format"`      // 请求体格式：auto、ndjson、text，auto 时根据 Content-Type 判断
+	MaxBodySize int64         `config:"max_body_size"`
+	QueueSize   int           `config:"queue_size"`   // 缓冲队列长度，队列满时返回 429，单个请求的行数不能超过该长度
+	ReadTimeout time.Duration `config:"read_timeout"` // 请求体的读取超时，同一地址的任务可以各自配置
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if c.Host == "" && c.UnixSocket == "" {
+		return fmt.Errorf("host or unix_socket is required")
+	}
+	switch c.Format {
+	case formatAuto, formatNDJSON, formatText:
+	default:
+		return fmt.Errorf("format(%s) is not supported", c.Format)
+	}
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("max_body_size must be greater than 0")
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("queue_size must be greater than 0")
+	}
+	if _, err := c.socketFileMode(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// address 监听地址，相同地址的任务共享同一个 HTTP 服务
+func (c *config) address() string {
+	if c.UnixSocket != "" {
+		return "unix://" + c.UnixSocket
+	}
+	return c.Host
+}
+
+func (c *config) socketFileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid socket_mode(%s): %v", c.SocketMode, err)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,190 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package httppush
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const inputName = "http"
+
+var (
+	httpRequests     = bkmonitoring.NewInt("http_push_requests")     // 接收的请求数
+	httpUnauthorized = bkmonitoring.NewInt("http_push_unauthorized") // token 认证失败的请求数
+	httpRejected     = bkmonitoring.NewInt("http_push_rejected")     // 队列已满或任务停止导致拒绝的请求数
+	httpEvents       = bkmonitoring.NewInt("http_push_events")       // 接收的日志行数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 通过 HTTP 接收推送的日志，用于无法写文件的短生命周期任务
+// 请求被接受(202)表示日志已进入缓冲队列，队列满时返回 429，行数超过队列长度时返回 413，任务停止时返回 503
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+	closed  bool
+
+	config config
+	outlet channel.Outleter
+	queue  chan *util.Data
+	wg     sync.WaitGroup
+}
+
+// NewInput creates a new http push input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config: config,
+		outlet: outlet,
+		queue:  make(chan *util.Data, config.QueueSize),
+	}
+	return p, nil
+}
+
+// Run 注册到 HTTP 服务，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started || p.closed {
+		return
+	}
+	if err := register(p.config, p); err != nil {
+		logp.Err("%s input register on %s error: %v", inputName, p.config.address(), err)
+		return
+	}
+	p.wg.Add(1)
+	go p.forward()
+	logp.Info("%s input listening on %s%s", inputName, p.config.address(), p.config.Path)
+	p.started = true
+}
+
+// receive 将日志写入缓冲队列，队列剩余空间不足时整个请求被拒绝，避免部分写入
+func (p *Input) receive(lines []string, remoteAddr string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return http.StatusServiceUnavailable
+	}
+	// 行数超过队列长度的请求重试也无法写入，需要客户端拆分
+	if len(lines) > cap(p.queue) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if len(p.queue)+len(lines) > cap(p.queue) {
+		return http.StatusTooManyRequests
+	}
+
+	now := time.Now()
+	// 以客户端地址区分来源，保证同一个打包内的 ext 一致
+	state := base.NewStatelessState(fmt.Sprintf("%s://%s", inputName, remoteAddr))
+	ext := map[string]interface{}{"peer_addr": remoteAddr}
+	for _, line := range lines {
+		data := util.NewData()
+		data.Event = beat.Event{
+			Timestamp: now,
+			Fields:    common.MapStr{"data": line},
+		}
+		data.SetState(state)
+		formatter.SetEventExt(data, ext)
+		p.queue <- data
+	}
+	httpEvents.Add(int64(len(lines)))
+	return http.StatusAccepted
+}
+
+// forward 将缓冲队列中的日志发送到任务的处理流程
+func (p *Input) forward() {
+	defer p.wg.Done()
+	for data := range p.queue {
+		if !p.outlet.OnEvent(data) {
+			p.mutex.Lock()
+			p.closed = true
+			p.mutex.Unlock()
+		}
+	}
+}
+
+// Stop 注销任务，停止接收新的请求，并等待缓冲队列中的日志发送完成
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	if p.closed && !p.started {
+		p.mutex.Unlock()
+		return
+	}
+	logp.Info("Stopping %s input on %s", inputName, p.config.address())
+	p.closed = true
+	started := p.started
+	p.started = false
+	p.mutex.Unlock()
+
+	if started {
+		unregister(p.config)
+		close(p.queue)
+		p.wg.Wait()
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
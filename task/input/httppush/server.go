@@ -0,0 +1,257 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package httppush
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readHeaderTimeout 读取请求头的超时时间，请求体的读取超时由各任务的 read_timeout 控制
+const readHeaderTimeout = 10 * time.Second
+
+var (
+	servers   = map[string]*server{}
+	serverMtx sync.Mutex
+)
+
+// receiver 接收推送的日志，返回 http 状态码
+type receiver interface {
+	receive(lines []string, remoteAddr string) int
+}
+
+type route struct {
+	config   config
+	receiver receiver
+}
+
+// server 同一个监听地址的 HTTP 服务，多个任务通过 token 区分
+type server struct {
+	address  string
+	listener net.Listener
+	http     *http.Server
+
+	mtx    sync.RWMutex
+	routes map[string]*route // key 为 token
+}
+
+// register 注册任务，相同地址的任务共享 HTTP 服务
+func register(c config, rcv receiver) error {
+	serverMtx.Lock()
+	defer serverMtx.Unlock()
+
+	address := c.address()
+	s, ok := servers[address]
+	if ok {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if _, ok = s.routes[c.Token]; ok {
+			return fmt.Errorf("token is already used by another task on %s", address)
+		}
+		s.routes[c.Token] = &route{config: c, receiver: rcv}
+		return nil
+	}
+
+	s, err := newServer(c)
+	if err != nil {
+		return err
+	}
+	s.routes[c.Token] = &route{config: c, receiver: rcv}
+	servers[address] = s
+	return nil
+}
+
+// unregister 注销任务，没有任务时关闭 HTTP 服务
+func unregister(c config) {
+	serverMtx.Lock()
+	defer serverMtx.Unlock()
+
+	address := c.address()
+	s, ok := servers[address]
+	if !ok {
+		return
+	}
+
+	s.mtx.Lock()
+	delete(s.routes, c.Token)
+	empty := len(s.routes) == 0
+	s.mtx.Unlock()
+
+	if empty {
+		delete(servers, address)
+		s.close()
+	}
+}
+
+func newServer(c config) (*server, error) {
+	var (
+		listener net.Listener
+		err      error
+	)
+	if c.UnixSocket != "" {
+		listener, err = listenUnix(c)
+	} else {
+		listener, err = net.Listen("tcp", c.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		address:  c.address(),
+		listener: listener,
+		routes:   make(map[string]*route),
+	}
+	// 多个任务共享同一个服务，请求体的读取超时在找到对应任务后单独设置
+	s.http = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	go func() {
+		_ = s.http.Serve(listener)
+	}()
+	return s, nil
+}
+
+// listenUnix 监听 unix socket，清理上次异常退出残留的 socket 文件
+func listenUnix(c config) (net.Listener, error) {
+	if info, err := os.Lstat(c.UnixSocket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s already exists and is not a socket", c.UnixSocket)
+		}
+		if err = os.Remove(c.UnixSocket); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", c.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	mode, _ := c.socketFileMode()
+	if err = os.Chmod(c.UnixSocket, mode); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (s *server) close() {
+	_ = s.http.Close()
+}
+
+// lookup 根据 token 查找任务
+func (s *server) lookup(token string) *route {
+	if token == "" {
+		return nil
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for t, r := range s.routes {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return auth[len(prefix):]
+	}
+	return ""
+}
+
+type response struct {
+	Accepted int    `json:"accepted,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ServeHTTP 处理推送请求
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	httpRequests.Add(1)
+	if r.Method != http.MethodPost {
+		writeResponse(w, http.StatusMethodNotAllowed, response{Error: "only POST is allowed"})
+		return
+	}
+
+	rt := s.lookup(bearerToken(r))
+	if rt == nil {
+		httpUnauthorized.Add(1)
+		writeResponse(w, http.StatusUnauthorized, response{Error: "invalid token"})
+		return
+	}
+	if r.URL.Path != rt.config.Path {
+		writeResponse(w, http.StatusNotFound, response{Error: "path not found"})
+		return
+	}
+
+	if rt.config.ReadTimeout > 0 {
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(rt.config.ReadTimeout))
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, rt.config.MaxBodySize)
+	lines, err := readBody(r, rt.config.Format, rt.config.MaxBodySize)
+	if errors.Is(err, errBodyTooLarge) {
+		writeResponse(w, http.StatusRequestEntityTooLarge, response{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{Error: err.Error()})
+		return
+	}
+
+	status := rt.receiver.receive(lines, r.RemoteAddr)
+	switch status {
+	case http.StatusAccepted:
+		writeResponse(w, status, response{Accepted: len(lines)})
+	case http.StatusTooManyRequests:
+		httpRejected.Add(1)
+		writeResponse(w, status, response{Error: "pipeline is busy, retry later"})
+	case http.StatusRequestEntityTooLarge:
+		httpRejected.Add(1)
+		writeResponse(w, status, response{
+			Error: fmt.Sprintf("too many lines, split the request into at most %d lines", rt.config.QueueSize),
+		})
+	default:
+		httpRejected.Add(1)
+		writeResponse(w, status, response{Error: "input is stopping"})
+	}
+}
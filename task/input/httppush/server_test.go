@@ -0,0 +1,167 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package httppush
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockReceiver struct {
+	mtx    sync.Mutex
+	lines  []string
+	status int
+}
+
+func (m *mockReceiver) receive(lines []string, remoteAddr string) int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.status != http.StatusAccepted {
+		return m.status
+	}
+	m.lines = append(m.lines, lines...)
+	return m.status
+}
+
+func TestSplitLines(t *testing.T) {
+	lines, err := splitLines("line1\r\n\nline2", formatText)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line1", "line2"}, lines)
+
+	lines, err = splitLines("{\"a\":1}\n{\"b\":2}\n", formatNDJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{\"a\":1}", "{\"b\":2}"}, lines)
+
+	_, err = splitLines("{\"a\":1}\nnot json\n", formatNDJSON)
+	assert.Error(t, err)
+
+	assert.Equal(t, formatNDJSON, detectFormat("application/x-ndjson; charset=utf-8"))
+	assert.Equal(t, formatText, detectFormat("text/plain"))
+	assert.Equal(t, formatText, detectFormat(""))
+}
+
+func TestServer(t *testing.T) {
+	c := defaultConfig
+	c.Host = "127.0.0.1:0"
+	c.Token = "token-a"
+	c.MaxBodySize = 64
+	rcv := &mockReceiver{status: http.StatusAccepted}
+	assert.NoError(t, register(c, rcv))
+	defer unregister(c)
+
+	// 相同地址的 token 不能重复
+	assert.Error(t, register(c, &mockReceiver{}))
+
+	url := "http://" + servers[c.address()].listener.Addr().String() + "/"
+	post := func(token string, body []byte, header map[string]string) int {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		assert.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("", []byte("line"), nil))
+	assert.Equal(t, http.StatusUnauthorized, post("token-b", []byte("line"), nil))
+	assert.Equal(t, http.StatusAccepted, post("token-a", []byte("line1\nline2\n"), nil))
+
+	// gzip 压缩
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("{\"msg\":\"gzip\"}\n"))
+	_ = gz.Close()
+	assert.Equal(t, http.StatusAccepted, post("token-a", buf.Bytes(), map[string]string{
+		"Content-Encoding": "gzip",
+		"Content-Type":     "application/x-ndjson",
+	}))
+	assert.Equal(t, http.StatusBadRequest, post("token-a", []byte("not json"), map[string]string{
+		"Content-Type": "application/x-ndjson",
+	}))
+
+	// 超过大小限制
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("token-a", []byte(strings.Repeat("a", 65)), nil))
+
+	rcv.mtx.Lock()
+	assert.Equal(t, []string{"line1", "line2", "{\"msg\":\"gzip\"}"}, rcv.lines)
+	rcv.status = http.StatusTooManyRequests
+	rcv.mtx.Unlock()
+	assert.Equal(t, http.StatusTooManyRequests, post("token-a", []byte("line3"), nil))
+
+	// 行数超过队列长度
+	rcv.mtx.Lock()
+	rcv.status = http.StatusRequestEntityTooLarge
+	rcv.mtx.Unlock()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("token-a", []byte("line4"), nil))
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	a := defaultConfig
+	a.Host = "127.0.0.1:0"
+	a.Token = "token-a"
+	assert.NoError(t, register(a, &mockReceiver{status: http.StatusAccepted}))
+	defer unregister(a)
+
+	// 共享服务的任务使用各自的读取超时
+	b := a
+	b.Token = "token-b"
+	b.ReadTimeout = 100 * time.Millisecond
+	assert.NoError(t, register(b, &mockReceiver{status: http.StatusAccepted}))
+	defer unregister(b)
+
+	url := "http://" + servers[a.address()].listener.Addr().String() + "/"
+	slowPost := func(token string) int {
+		body, writer := io.Pipe()
+		go func() {
+			_, _ = writer.Write([]byte("line1\n"))
+			time.Sleep(500 * time.Millisecond)
+			_, _ = writer.Write([]byte("line2\n"))
+			_ = writer.Close()
+		}()
+		req, err := http.NewRequest(http.MethodPost, url, body)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusAccepted, slowPost("token-a"))
+	assert.NotEqual(t, http.StatusAccepted, slowPost("token-b"))
+}
@@ -36,8 +36,12 @@ import (
 	"github.com/elastic/beats/libbeat/common"
 
 	"github.com/TencentBlueKing/bkunifylogbeat/config"
+	"github.com/TencentBlueKing/bkunifylogbeat/registrar"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/filter"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/compressed"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/lifecycle"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/startpos"
 	"github.com/TencentBlueKing/bkunifylogbeat/utils"
 )
 
@@ -100,6 +104,9 @@ func NewInput(
 		Node:              base.NewEmptyNode(taskCfg.InputID),
 		IsContainerStd:    taskCfg.IsContainerStd,
 		IsCRIContainerStd: taskCfg.IsCRIContainerStd,
+		IsContainer:       taskCfg.Type == containerInputType,
+
+		stateNamespace: taskCfg.GetStateNamespace(),
 	}
 
 	f, err := filter.NewFilters(taskCfg, taskNode)
@@ -110,6 +117,44 @@ func NewInput(
 	in.AddTaskNode(f.Node, taskNode)
 	go in.Run()
 
+	// 隔离模式下仅加载所属命名空间的采集进度
+	if taskCfg.IsBackfill() {
+		// 回填任务从头读取，不迁移共享的采集进度
+		states = registrar.GetNamespaceStates(states, in.stateNamespace)
+		// 回填任务按命名空间区分采集进度的确认，确认完成后写入完成标记
+		err = taskCfg.RawConfig.SetString("state_namespace", -1, in.stateNamespace)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		states = registrar.LoadNamespaceStates(states, in.stateNamespace)
+	}
+	if in.stateNamespace != "" {
+		logp.L.Infof("input(%s) load states with namespace(%s), count=>%d", in.ID, in.stateNamespace, len(states))
+	}
+	// 文件编码仅由自动识别编码的任务使用
+	if !taskCfg.IsAutoEncoding() {
+		for i := range states {
+			states[i] = registrar.WithoutEncoding(states[i])
+		}
+	}
+	// 启动时已存在且没有采集进度的文件按 start_position 确定起始位置
+	if taskCfg.StartPosition != "" {
+		states = startpos.InitStates(taskCfg, states)
+	}
+
+	// 配置了 lifecycle_dataid 时发送文件的生命周期事件
+	in.lifecycle, err = lifecycle.NewTracker(taskCfg.RawConfig, states)
+	if err != nil {
+		return nil, err
+	}
+
+	// 开启后对轮转压缩的文件进行一次性读取
+	in.compressed, err = compressed.NewReader(taskCfg.RawConfig, states, in.OnEvent)
+	if err != nil {
+		return nil, err
+	}
+
 	// input.New 里会发送事件出来，需要先创建好后续的Output，再创建Input
 	in.runner, err = input.New(
 		taskCfg.RawConfig, ConnectToTask(in), beatDone, states, nil)
@@ -139,6 +184,12 @@ type Input struct {
 
 	IsContainerStd    bool
 	IsCRIContainerStd bool
+	IsContainer       bool // 容器标准输出采集(container)，由 docker-json reader 完成解析与分片重组
+
+	stateNamespace string // 采集进度命名空间，为空时使用共享的采集进度
+
+	compressed *compressed.Reader // 压缩文件读取，未开启时为空
+	lifecycle  *lifecycle.Tracker // 文件生命周期事件，未开启时为空
 
 	runner   *input.Runner
 	runOnce  sync.Once
@@ -150,6 +201,9 @@ type Input struct {
 func (in *Input) Start() {
 	in.runOnce.Do(func() {
 		in.runner.Start()
+		if in.compressed != nil {
+			in.compressed.Start()
+		}
 	})
 }
 
@@ -179,7 +233,21 @@ func (in *Input) Run() {
 			base.CrawlerReceived.Add(1)
 
 			data := e.(*util.Data)
+			if base.IsFileState(data.GetState()) {
+				if in.compressed != nil {
+					in.compressed.Observe(data.GetState())
+				}
+				if in.lifecycle != nil {
+					in.lifecycle.Observe(data.GetState())
+				}
+				if in.stateNamespace != "" {
+					data.SetState(registrar.WithNamespace(data.GetState(), in.stateNamespace))
+				}
+			}
 			if data.Event.Fields != nil {
+				if in.IsContainer {
+					normalizeContainerFields(data)
+				}
 				for _, out := range in.GetOuts() {
 					select {
 					case <-in.End:
@@ -213,6 +281,9 @@ func (in *Input) Run() {
 func (in *Input) stop() {
 	in.stopOnce.Do(func() {
 		go in.runner.Stop() // 防止卡主reload的流程，这里改为异步，不等待input结束
+		if in.compressed != nil {
+			go in.compressed.Stop()
+		}
 	})
 }
 
@@ -0,0 +1,44 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package k8spods
+
+import "time"
+
+const (
+	defaultPodsPath       = "/var/log/pods"
+	defaultContainersPath = "/var/log/containers"
+)
+
+var defaultConfig = config{
+	PodsPath:       defaultPodsPath,
+	ContainersPath: defaultContainersPath,
+	ScanFrequency:  10 * time.Second,
+}
+
+type config struct {
+	PodsPath       string         `config:"pods_path"`       // pod 日志目录
+	ContainersPath string         `config:"containers_path"` // 容器日志软链目录，为空时不扫描
+	ScanFrequency  time.Duration  `config:"scan_frequency"`
+	Include        SelectorConfig `config:"include"`
+	Exclude        SelectorConfig `config:"exclude"`
+}
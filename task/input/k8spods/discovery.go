@@ -0,0 +1,229 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package k8spods
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// containerMeta 从日志路径中解析出的容器信息
+type containerMeta struct {
+	Namespace string
+	Pod       string
+	UID       string
+	Container string
+
+	// 容器日志文件的匹配路径
+	Paths []string
+}
+
+// Key 容器的唯一标识
+func (m containerMeta) Key() string {
+	if m.UID != "" {
+		return m.UID + "/" + m.Container
+	}
+	return m.Namespace + "/" + m.Pod + "/" + m.Container
+}
+
+// Ext 附加到采集事件中的容器信息，与容器采集下发的 ext_meta 字段保持一致
+func (m containerMeta) Ext() map[string]interface{} {
+	ext := map[string]interface{}{
+		"io_kubernetes_pod_namespace": m.Namespace,
+		"io_kubernetes_pod":           m.Pod,
+		"container_name":              m.Container,
+	}
+	// 无法确定 pod uid 时不输出该字段，避免下游按空值关联
+	if m.UID != "" {
+		ext["io_kubernetes_pod_uid"] = m.UID
+	}
+	return ext
+}
+
+// parsePodDirName 解析 /var/log/pods 下的目录名: <namespace>_<pod>_<uid>
+func parsePodDirName(name string) (namespace, pod, uid string, ok bool) {
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// parseContainerLogName 解析 /var/log/containers 下的文件名: <pod>_<namespace>_<container>-<container_id>.log
+func parseContainerLogName(name string) (pod, namespace, container string, ok bool) {
+	if !strings.HasSuffix(name, ".log") {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, ".log"), "_", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", false
+	}
+	idx := strings.LastIndex(parts[2], "-")
+	if idx <= 0 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2][:idx], true
+}
+
+// parsePodLogPath 从 pod 日志路径中解析 pod uid: .../<namespace>_<pod>_<uid>/<container>/<n>.log
+// 仅当路径中的 namespace、pod、container 与软链文件名一致时才认为有效
+func parsePodLogPath(logPath, namespace, pod, container string) (string, bool) {
+	containerDir := filepath.Dir(logPath)
+	if filepath.Base(containerDir) != container {
+		return "", false
+	}
+	ns, name, uid, ok := parsePodDirName(filepath.Base(filepath.Dir(containerDir)))
+	if !ok || ns != namespace || name != pod {
+		return "", false
+	}
+	return uid, true
+}
+
+// discoverContainers 扫描本机的容器日志目录，不依赖 API Server
+// 1. 优先扫描 podsPath: <namespace>_<pod>_<uid>/<container>/*.log
+// 2. 再扫描 containersPath 下的软链，未指向已发现的 pod 目录时单独采集
+func discoverContainers(podsPath, containersPath string) (map[string]containerMeta, error) {
+	containers := make(map[string]containerMeta)
+	containerDirs := make(map[string]struct{})
+
+	if podsPath != "" {
+		podDirs, err := os.ReadDir(podsPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, podDir := range podDirs {
+			if !podDir.IsDir() {
+				continue
+			}
+			namespace, pod, uid, ok := parsePodDirName(podDir.Name())
+			if !ok {
+				continue
+			}
+			containerEntries, err := os.ReadDir(filepath.Join(podsPath, podDir.Name()))
+			if err != nil {
+				// pod 目录可能在扫描过程中被删除
+				continue
+			}
+			for _, containerDir := range containerEntries {
+				if !containerDir.IsDir() {
+					continue
+				}
+				dir := filepath.Join(podsPath, podDir.Name(), containerDir.Name())
+				meta := containerMeta{
+					Namespace: namespace,
+					Pod:       pod,
+					UID:       uid,
+					Container: containerDir.Name(),
+					Paths:     []string{filepath.Join(dir, "*.log")},
+				}
+				containers[meta.Key()] = meta
+				containerDirs[dir] = struct{}{}
+			}
+		}
+	}
+
+	if containersPath != "" {
+		logFiles, err := os.ReadDir(containersPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, logFile := range logFiles {
+			pod, namespace, container, ok := parseContainerLogName(logFile.Name())
+			if !ok {
+				continue
+			}
+			logPath := filepath.Join(containersPath, logFile.Name())
+
+			meta := containerMeta{
+				Namespace: namespace,
+				Pod:       pod,
+				Container: container,
+			}
+
+			if target, err := filepath.EvalSymlinks(logPath); err == nil {
+				// 软链指向已发现的 pod 目录时，无需重复采集
+				if _, exist := containerDirs[filepath.Dir(target)]; exist {
+					continue
+				}
+				// 软链指向未扫描的 pod 目录时，从目标路径中获取 pod uid
+				if uid, ok := parsePodLogPath(target, namespace, pod, container); ok {
+					meta.UID = uid
+				}
+			}
+
+			if exist, ok := containers[meta.Key()]; ok {
+				meta = exist
+			}
+			meta.Paths = append(meta.Paths, logPath)
+			containers[meta.Key()] = meta
+		}
+	}
+	return containers, nil
+}
+
+// SelectorConfig 容器选择器，支持通配符
+type SelectorConfig struct {
+	Namespaces []string `config:"namespaces"`
+	Pods       []string `config:"pods"`
+	Containers []string `config:"containers"`
+	// UIDs 匹配从日志路径或软链目标路径中解析出的 pod uid
+	UIDs []string `config:"uids"`
+}
+
+// IsEmpty 是否未配置任何选择条件
+func (c SelectorConfig) IsEmpty() bool {
+	return len(c.Namespaces) == 0 && len(c.Pods) == 0 && len(c.Containers) == 0 && len(c.UIDs) == 0
+}
+
+// Match 各字段之间为"与"关系，同一字段的多个匹配规则为"或"关系，未配置的字段不参与匹配
+func (c SelectorConfig) Match(meta containerMeta) bool {
+	return matchAny(c.Namespaces, meta.Namespace) &&
+		matchAny(c.Pods, meta.Pod) &&
+		matchAny(c.Containers, meta.Container) &&
+		matchAny(c.UIDs, meta.UID)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// selectContainer 先匹配 include，再排除 exclude
+func selectContainer(include, exclude SelectorConfig, meta containerMeta) bool {
+	if !include.IsEmpty() && !include.Match(meta) {
+		return false
+	}
+	if !exclude.IsEmpty() && exclude.Match(meta) {
+		return false
+	}
+	return true
+}
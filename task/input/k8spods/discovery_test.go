@@ -0,0 +1,174 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package k8spods
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockLogTree(t *testing.T) (string, string) {
+	root, err := os.MkdirTemp("", "k8spods")
+	assert.NoError(t, err)
+
+	podsPath := filepath.Join(root, "pods")
+	containersPath := filepath.Join(root, "containers")
+	files := []string{
+		"pods/default_nginx-7c5b4d9f8-abcde_6f1f8c3a-1111-2222-3333-444455556666/nginx/0.log",
+		"pods/default_nginx-7c5b4d9f8-abcde_6f1f8c3a-1111-2222-3333-444455556666/sidecar/0.log",
+		"pods/kube-system_kube-proxy-xk2lp_9a8b7c6d-1111-2222-3333-444455556666/kube-proxy/1.log",
+		"legacy/abc123-json.log",
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(t, os.WriteFile(p, []byte("hello\n"), 0o644))
+	}
+	// 非法的 pod 目录
+	assert.NoError(t, os.MkdirAll(filepath.Join(podsPath, "invalid"), 0o755))
+
+	assert.NoError(t, os.MkdirAll(containersPath, 0o755))
+	links := map[string]string{
+		"nginx-7c5b4d9f8-abcde_default_nginx-0123456789abcdef.log": "pods/default_nginx-7c5b4d9f8-abcde_6f1f8c3a-1111-2222-3333-444455556666/nginx/0.log",
+		"legacy-app_prod_app-fedcba9876543210.log":                 "legacy/abc123-json.log",
+	}
+	for name, target := range links {
+		assert.NoError(t, os.Symlink(filepath.Join(root, target), filepath.Join(containersPath, name)))
+	}
+	return root, podsPath
+}
+
+func TestParseName(t *testing.T) {
+	namespace, pod, uid, ok := parsePodDirName("default_nginx-7c5b4d9f8-abcde_6f1f8c3a-1111")
+	assert.True(t, ok)
+	assert.Equal(t, "default", namespace)
+	assert.Equal(t, "nginx-7c5b4d9f8-abcde", pod)
+	assert.Equal(t, "6f1f8c3a-1111", uid)
+
+	_, _, _, ok = parsePodDirName("default_nginx")
+	assert.False(t, ok)
+
+	pod, namespace, container, ok := parseContainerLogName("nginx-abcde_default_istio-proxy-0123456789abcdef.log")
+	assert.True(t, ok)
+	assert.Equal(t, "nginx-abcde", pod)
+	assert.Equal(t, "default", namespace)
+	assert.Equal(t, "istio-proxy", container)
+
+	_, _, _, ok = parseContainerLogName("nginx-abcde_default_nginx.txt")
+	assert.False(t, ok)
+
+	uid, ok = parsePodLogPath("/var/log/pods/default_nginx-abcde_6f1f8c3a-1111/nginx/0.log", "default", "nginx-abcde", "nginx")
+	assert.True(t, ok)
+	assert.Equal(t, "6f1f8c3a-1111", uid)
+
+	_, ok = parsePodLogPath("/var/log/pods/default_nginx-abcde_6f1f8c3a-1111/nginx/0.log", "default", "nginx-abcde", "sidecar")
+	assert.False(t, ok)
+	_, ok = parsePodLogPath("/var/lib/docker/containers/abc123/abc123-json.log", "default", "nginx-abcde", "nginx")
+	assert.False(t, ok)
+}
+
+func TestDiscoverContainers(t *testing.T) {
+	root, podsPath := mockLogTree(t)
+	defer os.RemoveAll(root)
+	containersPath := filepath.Join(root, "containers")
+
+	containers, err := discoverContainers(podsPath, containersPath)
+	assert.NoError(t, err)
+	assert.Len(t, containers, 4)
+
+	nginx, ok := containers["6f1f8c3a-1111-2222-3333-444455556666/nginx"]
+	assert.True(t, ok)
+	assert.Equal(t, "default", nginx.Namespace)
+	assert.Equal(t, "nginx-7c5b4d9f8-abcde", nginx.Pod)
+	assert.Equal(t, []string{filepath.Join(podsPath, "default_nginx-7c5b4d9f8-abcde_6f1f8c3a-1111-2222-3333-444455556666", "nginx", "*.log")}, nginx.Paths)
+	assert.Equal(t, "nginx", nginx.Ext()["container_name"])
+	assert.Equal(t, "6f1f8c3a-1111-2222-3333-444455556666", nginx.Ext()["io_kubernetes_pod_uid"])
+
+	// 软链指向 pods 目录外的文件，单独采集
+	legacy, ok := containers["prod/legacy-app/app"]
+	assert.True(t, ok)
+	assert.Equal(t, []string{filepath.Join(containersPath, "legacy-app_prod_app-fedcba9876543210.log")}, legacy.Paths)
+	// 无法确定 pod uid 时不输出该字段
+	_, exist := legacy.Ext()["io_kubernetes_pod_uid"]
+	assert.False(t, exist)
+
+	// 只扫描 containers 目录时，从软链目标路径获取 pod uid
+	containers, err = discoverContainers("", containersPath)
+	assert.NoError(t, err)
+	assert.Len(t, containers, 2)
+	nginx, ok = containers["6f1f8c3a-1111-2222-3333-444455556666/nginx"]
+	assert.True(t, ok)
+	assert.Equal(t, "6f1f8c3a-1111-2222-3333-444455556666", nginx.Ext()["io_kubernetes_pod_uid"])
+	assert.Equal(t, []string{filepath.Join(containersPath, "nginx-7c5b4d9f8-abcde_default_nginx-0123456789abcdef.log")}, nginx.Paths)
+
+	// pod 删除后不再发现
+	assert.NoError(t, os.RemoveAll(filepath.Join(podsPath, "kube-system_kube-proxy-xk2lp_9a8b7c6d-1111-2222-3333-444455556666")))
+	containers, err = discoverContainers(podsPath, containersPath)
+	assert.NoError(t, err)
+	assert.Len(t, containers, 3)
+
+	// 目录不存在时不报错
+	containers, err = discoverContainers(filepath.Join(root, "not_exists"), "")
+	assert.NoError(t, err)
+	assert.Len(t, containers, 0)
+}
+
+func TestSelectContainer(t *testing.T) {
+	meta := containerMeta{Namespace: "default", Pod: "nginx-7c5b4d9f8-abcde", Container: "sidecar"}
+
+	assert.True(t, selectContainer(SelectorConfig{}, SelectorConfig{}, meta))
+	assert.True(t, selectContainer(SelectorConfig{Namespaces: []string{"kube-*", "default"}}, SelectorConfig{}, meta))
+	assert.False(t, selectContainer(SelectorConfig{Namespaces: []string{"kube-*"}}, SelectorConfig{}, meta))
+	assert.True(t, selectContainer(SelectorConfig{Pods: []string{"nginx-*"}}, SelectorConfig{Containers: []string{"istio-proxy"}}, meta))
+	assert.False(t, selectContainer(SelectorConfig{Pods: []string{"nginx-*"}}, SelectorConfig{Containers: []string{"side*"}}, meta))
+	assert.False(t, selectContainer(SelectorConfig{}, SelectorConfig{Namespaces: []string{"default"}, Pods: []string{"nginx-*"}}, meta))
+}
+
+func TestSelectContainerByUID(t *testing.T) {
+	root, podsPath := mockLogTree(t)
+	defer os.RemoveAll(root)
+	containersPath := filepath.Join(root, "containers")
+	include := SelectorConfig{UIDs: []string{"6f1f8c3a-*"}}
+
+	// 只扫描 containers 目录时，通过软链目标路径中的 pod uid 匹配
+	containers, err := discoverContainers("", containersPath)
+	assert.NoError(t, err)
+	var selected []string
+	for key, meta := range containers {
+		if selectContainer(include, SelectorConfig{}, meta) {
+			selected = append(selected, key)
+		}
+	}
+	assert.Equal(t, []string{"6f1f8c3a-1111-2222-3333-444455556666/nginx"}, selected)
+
+	containers, err = discoverContainers(podsPath, containersPath)
+	assert.NoError(t, err)
+	nginx := containers["6f1f8c3a-1111-2222-3333-444455556666/nginx"]
+	assert.True(t, selectContainer(include, SelectorConfig{}, nginx))
+	assert.False(t, selectContainer(SelectorConfig{}, include, nginx))
+	// 无法确定 pod uid 的容器不会被 uid 选中
+	assert.False(t, selectContainer(include, SelectorConfig{}, containers["prod/legacy-app/app"]))
+}
@@ -0,0 +1,252 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package k8spods
+
+import (
+	"sync"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/log"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const inputName = "k8s_pods"
+
+var (
+	containersActive  = bkmonitoring.NewInt("k8s_pods_containers", monitoring.Gauge) // 当前采集中的容器数量
+	containersAdded   = bkmonitoring.NewInt("k8s_pods_containers_added")             // 新发现的容器数量
+	containersRemoved = bkmonitoring.NewInt("k8s_pods_containers_removed")           // 已移除的容器数量
+	discoverErrors    = bkmonitoring.NewInt("k8s_pods_discover_error")               // 扫描失败次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 扫描本机 pod 日志目录，为每个容器创建日志采集，并随 pod 的增删自动调整
+type Input struct {
+	mutex       sync.Mutex
+	initialized bool
+
+	config  config
+	cfg     *common.Config
+	outlet  channel.Outleter
+	context input.Context
+
+	containers map[string]*containerInput
+}
+
+// containerInput 单个容器的日志采集
+type containerInput struct {
+	meta  containerMeta
+	input input.Input
+}
+
+// NewInput creates a new kubernetes pods input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config:     config,
+		cfg:        cfg,
+		outlet:     outlet,
+		context:    context,
+		containers: make(map[string]*containerInput),
+	}
+	return p, nil
+}
+
+// Run 由 input.Runner 按 scan_frequency 周期调用，完成容器发现以及日志文件扫描
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	containers, err := discoverContainers(p.config.PodsPath, p.config.ContainersPath)
+	if err != nil {
+		discoverErrors.Add(1)
+		logp.Err("%s discover containers error: %v", inputName, err)
+	} else {
+		p.syncContainers(containers)
+	}
+	p.initialized = true
+
+	for _, c := range p.containers {
+		c.input.Run()
+	}
+}
+
+// syncContainers 对比扫描结果，创建新容器的采集并停止已删除容器的采集
+func (p *Input) syncContainers(containers map[string]containerMeta) {
+	for key, c := range p.containers {
+		if _, ok := containers[key]; ok {
+			continue
+		}
+		logp.Info("%s container removed, stop harvesting: %s", inputName, key)
+		delete(p.containers, key)
+		containersRemoved.Add(1)
+		containersActive.Add(-1)
+		// 防止阻塞扫描流程，这里异步停止
+		go c.input.Stop()
+	}
+
+	for key, meta := range containers {
+		if _, ok := p.containers[key]; ok {
+			continue
+		}
+		if !selectContainer(p.config.Include, p.config.Exclude, meta) {
+			continue
+		}
+
+		in, err := p.newContainerInput(meta)
+		if err != nil {
+			logp.Err("%s create input for container(%s) error: %v", inputName, key, err)
+			continue
+		}
+		logp.Info("%s container found, start harvesting: %s, paths: %v", inputName, key, meta.Paths)
+		p.containers[key] = &containerInput{meta: meta, input: in}
+		containersAdded.Add(1)
+		containersActive.Add(1)
+	}
+}
+
+func (p *Input) newContainerInput(meta containerMeta) (input.Input, error) {
+	cfg, err := common.NewConfigFrom(p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = cfg.Remove("paths", -1)
+	for i, path := range meta.Paths {
+		if err = cfg.SetString("paths", i, path); err != nil {
+			return nil, err
+		}
+	}
+	if err = cfg.SetString("type", -1, "log"); err != nil {
+		return nil, err
+	}
+	// 启动后新创建的容器需要从头开始采集，避免丢失容器启动时的日志
+	if p.initialized {
+		if err = cfg.SetBool("tail_files", -1, false); err != nil {
+			return nil, err
+		}
+	}
+
+	ext := meta.Ext()
+	connector := func(*common.Config, *common.MapStrPointer) (channel.Outleter, error) {
+		return newContainerOutlet(p.outlet, ext), nil
+	}
+	return log.NewInput(cfg, connector, p.context)
+}
+
+// Stop stops all container inputs
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input", inputName)
+	var wg sync.WaitGroup
+	for key, c := range p.containers {
+		wg.Add(1)
+		go func(in input.Input) {
+			defer wg.Done()
+			in.Stop()
+		}(c.input)
+		delete(p.containers, key)
+		containersActive.Add(-1)
+	}
+	wg.Wait()
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
+
+// containerOutlet 为容器采集事件附加容器信息，关闭时不影响任务的 outlet
+type containerOutlet struct {
+	outlet channel.Outleter
+	ext    map[string]interface{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newContainerOutlet(outlet channel.Outleter, ext map[string]interface{}) *containerOutlet {
+	return &containerOutlet{
+		outlet: outlet,
+		ext:    ext,
+		done:   make(chan struct{}),
+	}
+}
+
+// OnEvent 附加容器信息后转发到任务的 outlet
+func (o *containerOutlet) OnEvent(data *util.Data) bool {
+	select {
+	case <-o.done:
+		return false
+	default:
+	}
+	formatter.SetEventExt(data, o.ext)
+	return o.outlet.OnEvent(data)
+}
+
+// Close 仅关闭当前容器的 outlet
+func (o *containerOutlet) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.done)
+	})
+	return nil
+}
+
+// Done 返回 outlet 状态
+func (o *containerOutlet) Done() <-chan struct{} {
+	return o.done
+}
@@ -0,0 +1,153 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lifecycle
+
+import (
+	"os"
+	"sync"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/utils"
+)
+
+var lifecycleEventsTotal = bkmonitoring.NewInt("lifecycle_events_total") // 发送的生命周期事件数量
+
+// config 从日志采集配置中解析生命周期事件需要的配置
+type config struct {
+	DataID          int  `config:"dataid"`
+	LifecycleDataID int  `config:"lifecycle_dataid"` // 生命周期事件发送的 dataid，小于等于 0 时不开启
+	CloseEOF        bool `config:"close_eof"`
+}
+
+// Tracker 观察 input 的采集进度，在文件打开、轮转、截断、关闭以及清理时发送生命周期事件
+type Tracker struct {
+	config config
+
+	mtx     sync.Mutex
+	tracker *tracker
+}
+
+// NewTracker 创建生命周期事件跟踪，未配置 lifecycle_dataid 时返回空
+func NewTracker(rawConfig *common.Config, states []file.State) (*Tracker, error) {
+	var c config
+	err := rawConfig.Unpack(&c)
+	if err != nil {
+		return nil, err
+	}
+	if c.LifecycleDataID <= 0 {
+		return nil, nil
+	}
+
+	t := &Tracker{
+		config:  c,
+		tracker: newTracker(c.CloseEOF),
+	}
+	for _, state := range states {
+		t.tracker.load(toFileState(state))
+	}
+	return t, nil
+}
+
+// Observe 根据新的采集进度推断生命周期事件并发送
+func (t *Tracker) Observe(state file.State) {
+	s := toFileState(state)
+	if state.Finished && state.TTL != 0 {
+		fillFileStatus(&s, state)
+	}
+
+	t.mtx.Lock()
+	events := t.tracker.observe(s)
+	t.mtx.Unlock()
+
+	for _, e := range events {
+		logp.L.Infof("file lifecycle event: %s, reason: %s, source: %s, offset: %d", e.Type, e.Reason, e.Source, e.Offset)
+		beat.SendEvent(beat.Event{Fields: t.format(e)})
+		lifecycleEventsTotal.Add(1)
+	}
+}
+
+// format 与日志采集的默认输出格式一致，事件内容位于 items 中
+func (t *Tracker) format(e Event) beat.MapStr {
+	datetime, utcTime, timestamp := utils.GetDateTime()
+	item := beat.MapStr{
+		"event":          e.Type,
+		"reason":         e.Reason,
+		"source":         e.Source,
+		"identity":       e.Identity,
+		"state_id":       e.StateID,
+		"offset":         e.Offset,
+		"source_dataid":  t.config.DataID,
+		"iterationindex": 0,
+	}
+	if e.OldSource != "" {
+		item["old_source"] = e.OldSource
+	}
+	if e.Size >= 0 {
+		item["size"] = e.Size
+		item["unread_bytes"] = e.UnreadBytes()
+	}
+	return beat.MapStr{
+		"dataid":   t.config.LifecycleDataID,
+		"filename": e.Source,
+		"datetime": datetime,
+		"utctime":  utcTime,
+		"time":     timestamp,
+		"items":    []beat.MapStr{item},
+		"ext":      map[string]interface{}{},
+	}
+}
+
+func toFileState(state file.State) fileState {
+	return fileState{
+		ID:       state.ID(),
+		Source:   state.Source,
+		Identity: state.FileStateOS.String(),
+		Offset:   state.Offset,
+		Finished: state.Finished,
+		Removed:  state.TTL == 0,
+		Size:     -1,
+	}
+}
+
+// fillFileStatus harvester 停止时获取文件当前的状态，用于推断关闭原因
+func fillFileStatus(s *fileState, state file.State) {
+	info, err := os.Stat(state.Source)
+	if err != nil {
+		// 文件已删除时使用 harvester 最后记录的文件大小
+		if state.Fileinfo != nil {
+			s.Size = state.Fileinfo.Size()
+		}
+		return
+	}
+	s.Exists = true
+	s.Same = commonFile.GetOSState(info).IsSame(state.FileStateOS)
+	if s.Same {
+		s.Size = info.Size()
+	}
+}
@@ -0,0 +1,190 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package lifecycle 根据采集进度的变化推断文件的生命周期事件，并发送到指定的 dataid
+package lifecycle
+
+// 生命周期事件类型
+const (
+	EventOpened    = "opened"    // 开始读取文件
+	EventRotated   = "rotated"   // 读取中的文件被重命名
+	EventTruncated = "truncated" // 文件被截断，从头重新读取
+	EventClosed    = "closed"    // 停止读取文件
+	EventDeleted   = "deleted"   // 文件已删除，采集进度被清理
+)
+
+// 事件原因
+const (
+	ReasonNew            = "new"              // 没有采集进度的文件
+	ReasonResume         = "resume"           // 从已有的采集进度继续读取
+	ReasonReopened       = "reopened"         // 关闭后文件有新的内容
+	ReasonRenamed        = "renamed"          // 文件被重命名(轮转)
+	ReasonTruncated      = "truncated"        // 文件被截断
+	ReasonRemoved        = "removed"          // 文件被删除
+	ReasonCloseInactive  = "close_inactive"   // 读取到末尾后超时没有新内容
+	ReasonCloseEOF       = "close_eof"        // 读取到末尾后关闭
+	ReasonCloseBeforeEOF = "close_before_eof" // 未读取到末尾时关闭，如 close_timeout
+	ReasonCleanRemoved   = "clean_removed"    // 文件删除后清理采集进度
+)
+
+// fileState 推断生命周期所需的采集进度信息
+type fileState struct {
+	ID       string
+	Source   string
+	Identity string
+	Offset   int64
+	Finished bool // harvester 已停止
+	Removed  bool // 采集进度被清理
+
+	// 以下字段仅在 Finished 时由调用方填充
+	Exists bool  // Source 路径存在
+	Same   bool  // Source 路径仍是同一个文件
+	Size   int64 // 文件大小，未知时为 -1
+}
+
+// Event 生命周期事件
+type Event struct {
+	Type      string
+	Reason    string
+	StateID   string
+	Source    string
+	OldSource string
+	Identity  string
+	Offset    int64 // 事件发生时的读取位置
+	Size      int64 // 文件大小，未知时为 -1
+}
+
+// UnreadBytes 文件关闭时未读取的字节数
+func (e Event) UnreadBytes() int64 {
+	if e.Size < 0 || e.Size <= e.Offset {
+		return 0
+	}
+	return e.Size - e.Offset
+}
+
+// fileRecord 文件最近一次的采集进度
+type fileRecord struct {
+	source   string
+	offset   int64
+	finished bool
+}
+
+// tracker 对比同一文件(state ID)前后的采集进度，推断生命周期事件
+type tracker struct {
+	closeEOF bool
+	files    map[string]*fileRecord
+}
+
+func newTracker(closeEOF bool) *tracker {
+	return &tracker{
+		closeEOF: closeEOF,
+		files:    make(map[string]*fileRecord),
+	}
+}
+
+// load 加载启动时已有的采集进度，不产生事件
+func (t *tracker) load(s fileState) {
+	t.files[s.ID] = &fileRecord{source: s.Source, offset: s.Offset, finished: true}
+}
+
+// observe 记录新的采集进度，返回推断出的事件
+func (t *tracker) observe(s fileState) []Event {
+	rec, ok := t.files[s.ID]
+	if s.Removed {
+		if !ok {
+			return nil
+		}
+		delete(t.files, s.ID)
+		return []Event{t.event(EventDeleted, ReasonCleanRemoved, s, "")}
+	}
+	if !ok {
+		t.files[s.ID] = &fileRecord{source: s.Source, offset: s.Offset, finished: s.Finished}
+		if s.Finished {
+			return nil
+		}
+		reason := ReasonNew
+		if s.Offset > 0 {
+			reason = ReasonResume
+		}
+		return []Event{t.event(EventOpened, reason, s, "")}
+	}
+
+	var events []Event
+	truncated := s.Offset < rec.offset
+	if truncated {
+		events = append(events, t.event(EventTruncated, ReasonTruncated, s, ""))
+	}
+	if rec.finished && !s.Finished {
+		reason := ReasonReopened
+		if truncated {
+			reason = ReasonTruncated
+		}
+		events = append(events, t.event(EventOpened, reason, s, ""))
+	}
+	if rec.source != s.Source {
+		events = append(events, t.event(EventRotated, ReasonRenamed, s, rec.source))
+	}
+	if !rec.finished && s.Finished {
+		reason := t.closeReason(s)
+		if truncated {
+			reason = ReasonTruncated
+		}
+		events = append(events, t.event(EventClosed, reason, s, ""))
+	}
+
+	rec.source = s.Source
+	rec.offset = s.Offset
+	rec.finished = s.Finished
+	return events
+}
+
+// closeReason 根据关闭时文件的状态推断关闭原因
+func (t *tracker) closeReason(s fileState) string {
+	switch {
+	case !s.Exists:
+		return ReasonRemoved
+	case !s.Same:
+		return ReasonRenamed
+	case s.Size >= 0 && s.Offset < s.Size:
+		return ReasonCloseBeforeEOF
+	case t.closeEOF:
+		return ReasonCloseEOF
+	}
+	return ReasonCloseInactive
+}
+
+func (t *tracker) event(eventType, reason string, s fileState, oldSource string) Event {
+	size := int64(-1)
+	if s.Finished || s.Removed {
+		size = s.Size
+	}
+	return Event{
+		Type:      eventType,
+		Reason:    reason,
+		StateID:   s.ID,
+		Source:    s.Source,
+		OldSource: oldSource,
+		Identity:  s.Identity,
+		Offset:    s.Offset,
+		Size:      size,
+	}
+}
@@ -0,0 +1,124 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func types(events []Event) []string {
+	list := make([]string, 0, len(events))
+	for _, e := range events {
+		list = append(list, e.Type+":"+e.Reason)
+	}
+	return list
+}
+
+func TestTrackerOpenAndClose(t *testing.T) {
+	tr := newTracker(false)
+
+	events := tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 0})
+	assert.Equal(t, []string{"opened:new"}, types(events))
+	assert.Equal(t, int64(-1), events[0].Size)
+
+	// 读取中的采集进度不产生事件
+	assert.Empty(t, tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100}))
+
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100, Finished: true,
+		Exists: true, Same: true, Size: 100})
+	assert.Equal(t, []string{"closed:close_inactive"}, types(events))
+	assert.Equal(t, int64(0), events[0].UnreadBytes())
+
+	// 关闭后有新内容
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100})
+	assert.Equal(t, []string{"opened:reopened"}, types(events))
+
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 150, Finished: true,
+		Exists: true, Same: true, Size: 200})
+	assert.Equal(t, []string{"closed:close_before_eof"}, types(events))
+	assert.Equal(t, int64(50), events[0].UnreadBytes())
+
+	tr = newTracker(true)
+	tr.observe(fileState{ID: "1", Source: "/var/log/a.log"})
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 10, Finished: true,
+		Exists: true, Same: true, Size: 10})
+	assert.Equal(t, []string{"closed:close_eof"}, types(events))
+}
+
+func TestTrackerLoadedState(t *testing.T) {
+	tr := newTracker(false)
+	tr.load(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100})
+
+	// 已完成的采集进度不产生事件
+	assert.Empty(t, tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100, Finished: true}))
+
+	events := tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100})
+	assert.Equal(t, []string{"opened:reopened"}, types(events))
+
+	events = tr.observe(fileState{ID: "2", Source: "/var/log/b.log", Offset: 10})
+	assert.Equal(t, []string{"opened:resume"}, types(events))
+}
+
+func TestTrackerRotateAndRemove(t *testing.T) {
+	tr := newTracker(false)
+	tr.observe(fileState{ID: "1", Source: "/var/log/a.log"})
+
+	events := tr.observe(fileState{ID: "1", Source: "/var/log/a.log.1", Offset: 10})
+	assert.Equal(t, []string{"rotated:renamed"}, types(events))
+	assert.Equal(t, "/var/log/a.log", events[0].OldSource)
+	assert.Equal(t, "/var/log/a.log.1", events[0].Source)
+
+	// 轮转后的文件在读取完成前被删除
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log.1", Offset: 20, Finished: true, Size: 50})
+	assert.Equal(t, []string{"closed:removed"}, types(events))
+	assert.Equal(t, int64(30), events[0].UnreadBytes())
+
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log.1", Offset: 20, Finished: true, Removed: true})
+	assert.Equal(t, []string{"deleted:clean_removed"}, types(events))
+	assert.Empty(t, tr.observe(fileState{ID: "1", Source: "/var/log/a.log.1", Removed: true}))
+
+	// 路径指向了新的文件
+	tr.observe(fileState{ID: "2", Source: "/var/log/b.log"})
+	events = tr.observe(fileState{ID: "2", Source: "/var/log/b.log", Offset: 10, Finished: true, Exists: true, Size: -1})
+	assert.Equal(t, []string{"closed:renamed"}, types(events))
+}
+
+func TestTrackerTruncate(t *testing.T) {
+	tr := newTracker(false)
+	tr.observe(fileState{ID: "1", Source: "/var/log/a.log"})
+	tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 100})
+
+	events := tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 0, Finished: true,
+		Exists: true, Same: true, Size: 10})
+	assert.Equal(t, []string{"truncated:truncated", "closed:truncated"}, types(events))
+
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 0})
+	assert.Equal(t, []string{"opened:reopened"}, types(events))
+
+	// 关闭后被截断，重新打开时从头读取
+	tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 50, Finished: true, Exists: true, Same: true, Size: 50})
+	events = tr.observe(fileState{ID: "1", Source: "/var/log/a.log", Offset: 0})
+	assert.Equal(t, []string{"truncated:truncated", "opened:truncated"}, types(events))
+}
@@ -0,0 +1,86 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package managedlog
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultConfig = config{
+	HarvesterLimit: 1000,
+	ScanFrequency:  10 * time.Second,
+	CloseInactive:  2 * time.Minute,
+	TimeSlice:      1 * time.Minute,
+	StarvedAfter:   1 * time.Minute,
+}
+
+type config struct {
+	DataID         int           `config:"dataid"`
+	Paths          []string      `config:"paths"`
+	ExcludeFiles   []string      `config:"exclude_files"`
+	HarvesterLimit int           `config:"harvester_limit"`
+	ScanFrequency  time.Duration `config:"scan_frequency"`
+	CloseInactive  time.Duration `config:"close_inactive"`
+	TailFiles      bool          `config:"tail_files"`
+
+	Scheduling   string        `config:"harvester_scheduling"`    // 调度策略：newest、lag、round_robin，为空时仅限制同时采集的文件数
+	TimeSlice    time.Duration `config:"harvester_time_slice"`    // round_robin 策略下每个文件连续采集的最长时间
+	StarvedAfter time.Duration `config:"harvester_starved_after"` // 有数据的文件等待超过该时间时计入饥饿文件数
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("paths is required")
+	}
+	switch c.Scheduling {
+	case "":
+		return nil
+	case PolicyNewest, PolicyLag, PolicyRoundRobin:
+	default:
+		return fmt.Errorf("harvester_scheduling(%s) is not supported", c.Scheduling)
+	}
+	if c.HarvesterLimit <= 0 {
+		return fmt.Errorf("harvester_limit must be greater than 0 when harvester_scheduling is set")
+	}
+	if c.TimeSlice <= 0 || c.StarvedAfter <= 0 {
+		return fmt.Errorf("harvester_time_slice and harvester_starved_after must be greater than 0")
+	}
+	return nil
+}
+
+func (c *config) scheduleOptions() scheduleOptions {
+	opts := scheduleOptions{
+		policy:        c.Scheduling,
+		limit:         c.HarvesterLimit,
+		timeSlice:     c.TimeSlice,
+		idleAfter:     c.ScanFrequency,
+		closeInactive: c.CloseInactive,
+	}
+	// 未配置调度策略时与 harvester_limit 的行为一致，不抢占采集中的文件
+	if opts.policy == "" {
+		opts.idleAfter = c.CloseInactive
+	}
+	return opts
+}
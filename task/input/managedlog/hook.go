@@ -0,0 +1,122 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package managedlog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Hook 按文件管理的日志采集的扩展，文件保护、编码识别等功能以 Hook 的形式组合到同一个日志采集中
+// Hook 的方法均在扫描周期中依次调用，只有 EventFilter 在文件的采集协程中调用
+type Hook interface {
+	// Check 扫描时检查文件是否可以采集，返回 false 时不采集，采集中的文件会被停止
+	Check(path string, info os.FileInfo, now time.Time) bool
+	// Prepare 文件开始采集前调用，可修改采集配置或添加事件处理，返回 false 时等待下次扫描
+	Prepare(f *File) (bool, error)
+	// Refresh 扫描时对采集中的文件调用，返回 true 时停止当前的采集，之后重新 Prepare 并从采集进度继续
+	Refresh(f *File, info os.FileInfo) bool
+	// Reset 每个扫描周期开始读取前调用
+	Reset()
+	// Forget 文件不再匹配时调用
+	Forget(path string)
+	// Close 停止采集时调用
+	Close()
+}
+
+// HookFactory 按任务配置创建 Hook，未开启对应的功能时返回 nil
+// 可修改 context.States，如移除仅由 Hook 使用的采集进度信息
+type HookFactory func(cfg *common.Config, context *input.Context) (Hook, error)
+
+type hookFactory struct {
+	name    string
+	factory HookFactory
+}
+
+var (
+	hookFactories []hookFactory
+	hooksMu       sync.RWMutex
+)
+
+// RegisterHook 注册 Hook，按注册顺序调用
+func RegisterHook(name string, factory HookFactory) error {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	for _, f := range hookFactories {
+		if f.name == name {
+			return fmt.Errorf("hook(%s) already registered", name)
+		}
+	}
+	hookFactories = append(hookFactories, hookFactory{name: name, factory: factory})
+	return nil
+}
+
+// newHooks 创建任务开启的 Hook
+func newHooks(cfg *common.Config, context *input.Context) ([]Hook, error) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	hooks := make([]Hook, 0, len(hookFactories))
+	for _, f := range hookFactories {
+		hook, err := f.factory(cfg, context)
+		if err != nil {
+			return nil, fmt.Errorf("hook(%s) error: %v", f.name, err)
+		}
+		if hook != nil {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+// EventFilter 文件的事件发送到任务前调用，返回 false 时停止当前文件的采集，done 在文件停止采集时关闭
+type EventFilter func(data *util.Data, done <-chan struct{}) bool
+
+// File 采集中的文件，每次开始采集时创建
+type File struct {
+	Path   string
+	Info   os.FileInfo    // 开始采集时的文件信息
+	Config *common.Config // 文件日志采集的配置，仅在 Prepare 中修改
+
+	filters []EventFilter
+}
+
+// AddFilter 添加文件的事件处理，按添加顺序调用
+func (f *File) AddFilter(filter EventFilter) {
+	f.filters = append(f.filters, filter)
+}
+
+// Filter 依次调用文件的事件处理，任意一个返回 false 时停止
+func (f *File) Filter(data *util.Data, done <-chan struct{}) bool {
+	for _, filter := range f.filters {
+		if !filter(data, done) {
+			return false
+		}
+	}
+	return true
+}
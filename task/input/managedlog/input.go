@@ -0,0 +1,498 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package managedlog
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/input/log"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/common"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const inputName = "managed_log"
+
+var (
+	harvesterPreempted = bkmonitoring.NewInt("harvester_preempted") // 被调度让出采集位置的次数
+	harvesterRefreshed = bkmonitoring.NewInt("harvester_refreshed") // 因采集配置变化重新开始采集的次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 按文件管理的日志采集，每个文件使用单独的日志采集
+// 同时采集的文件数受 harvester_limit 限制，配置了 harvester_scheduling 时按调度策略决定采集哪些文件，
+// 文件保护、编码识别等功能通过 Hook 组合，由 log 类型任务开启对应配置后切换而来，见 config/input/log.go
+type Input struct {
+	mutex       sync.Mutex
+	initialized bool
+
+	config   config
+	excludes []*regexp.Regexp
+	hooks    []Hook
+	cfg      *common.Config
+	outlet   channel.Outleter
+	context  input.Context
+
+	files       map[string]*fileStatus
+	matched     map[string]struct{} // 上一次扫描匹配到的文件，包括未通过检查的文件
+	children    map[string]*fileInput
+	initFiles   map[string]struct{} // 首次扫描时已存在的文件，按任务配置的 tail_files 采集
+	statesMutex sync.Mutex
+	states      map[string]file.State // 最新的采集进度，以 state.ID() 为 key
+	lastEvents  map[string]time.Time  // 文件最近一次发送事件的时间
+	identities  map[string]commonFile.StateOS
+
+	activeFiles  *bkmonitoring.Int
+	waitingFiles *bkmonitoring.Int
+	starvedFiles *bkmonitoring.Int
+}
+
+// fileInput 单个文件的日志采集
+type fileInput struct {
+	file  *File
+	input input.Input
+}
+
+// NewInput creates a new managed log input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes := make([]*regexp.Regexp, 0, len(config.ExcludeFiles))
+	for _, expr := range config.ExcludeFiles {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, re)
+	}
+
+	hooks, err := newHooks(cfg, &context)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]file.State, len(context.States))
+	for _, state := range context.States {
+		states[state.ID()] = state
+	}
+
+	p := &Input{
+		config:     config,
+		excludes:   excludes,
+		hooks:      hooks,
+		cfg:        cfg,
+		outlet:     outlet,
+		context:    context,
+		files:      make(map[string]*fileStatus),
+		matched:    make(map[string]struct{}),
+		children:   make(map[string]*fileInput),
+		initFiles:  make(map[string]struct{}),
+		states:     states,
+		lastEvents: make(map[string]time.Time),
+		identities: make(map[string]commonFile.StateOS),
+
+		activeFiles:  bkmonitoring.NewIntWithDataID(config.DataID, "harvester_scheduled_active"),
+		waitingFiles: bkmonitoring.NewIntWithDataID(config.DataID, "harvester_waiting_files"),
+		starvedFiles: bkmonitoring.NewIntWithDataID(config.DataID, "harvester_starved_files"),
+	}
+	return p, nil
+}
+
+// Run 由 input.Runner 按 scan_frequency 周期调用，更新文件状态后重新调度
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	p.scan(now)
+	p.initialized = true
+	p.refresh(now)
+
+	list := make([]*fileStatus, 0, len(p.files))
+	for _, f := range p.files {
+		list = append(list, f)
+	}
+	start, stop := plan(list, p.config.scheduleOptions(), now)
+	for _, f := range stop {
+		p.stopFile(f, now)
+	}
+	for _, f := range start {
+		p.startFile(f, now)
+	}
+	for _, hook := range p.hooks {
+		hook.Reset()
+	}
+	for _, child := range p.children {
+		child.input.Run()
+	}
+	p.updateMetrics(now)
+}
+
+// scan 获取匹配的文件及其大小、修改时间和采集进度，未通过 Hook 检查的文件不参与调度
+func (p *Input) scan(now time.Time) {
+	found := make(map[string]os.FileInfo)
+	matched := make(map[string]struct{})
+	for _, pattern := range p.config.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logp.Err("%s invalid path(%s): %v", inputName, pattern, err)
+			continue
+		}
+	match:
+		for _, path := range matches {
+			for _, re := range p.excludes {
+				if re.MatchString(path) {
+					continue match
+				}
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			matched[path] = struct{}{}
+			if !p.check(path, info, now) {
+				continue
+			}
+			found[path] = info
+		}
+	}
+	for path := range p.matched {
+		if _, ok := matched[path]; !ok {
+			for _, hook := range p.hooks {
+				hook.Forget(path)
+			}
+		}
+	}
+	p.matched = matched
+
+	for path, f := range p.files {
+		if _, ok := found[path]; ok {
+			continue
+		}
+		delete(p.files, path)
+		delete(p.identities, path)
+		if f.active {
+			p.stopFile(f, now)
+		}
+	}
+
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+	for path, info := range found {
+		f, ok := p.files[path]
+		if !ok {
+			f = &fileStatus{path: path, offset: -1}
+			p.files[path] = f
+			if !p.initialized {
+				p.initFiles[path] = struct{}{}
+			}
+		}
+		osState := commonFile.GetOSState(info)
+		if f.offset >= 0 && !p.identities[path].IsSame(osState) {
+			// 轮转后路径对应新的文件
+			f.offset = 0
+		}
+		p.identities[path] = osState
+		f.info = info
+		f.size = info.Size()
+		f.modTime = info.ModTime()
+		f.lastEvent = p.lastEvents[path]
+		if offset, ok := p.offset(path, osState); ok {
+			f.offset = offset
+		} else if f.offset < 0 {
+			// 没有采集进度的文件：首次扫描时按 tail_files 从末尾开始，之后出现的文件从头开始
+			f.offset = 0
+			if p.tailFile(path) {
+				f.offset = f.size
+			}
+		}
+		if !f.active && f.pending() && f.waitingSince.IsZero() {
+			f.waitingSince = now
+		}
+	}
+}
+
+// check 所有 Hook 检查通过的文件才可以采集
+func (p *Input) check(path string, info os.FileInfo, now time.Time) bool {
+	for _, hook := range p.hooks {
+		if !hook.Check(path, info, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh Hook 要求重新开始采集的文件，停止当前的采集后重新参与调度
+func (p *Input) refresh(now time.Time) {
+	for path, child := range p.children {
+		f := p.files[path]
+		for _, hook := range p.hooks {
+			if !hook.Refresh(child.file, f.info) {
+				continue
+			}
+			harvesterRefreshed.Add(1)
+			logp.Info("%s(dataid=%d) restart harvesting file: %s, offset: %d", inputName, p.config.DataID, path, f.offset)
+			child.input.Stop()
+			delete(p.children, path)
+			f.active = false
+			if f.pending() {
+				f.waitingSince = now
+			}
+			break
+		}
+	}
+}
+
+// offset 获取当前文件(相同 inode)的采集位置
+func (p *Input) offset(path string, osState commonFile.StateOS) (int64, bool) {
+	for _, state := range p.states {
+		if state.Source == path && state.FileStateOS.IsSame(osState) {
+			return state.Offset, true
+		}
+	}
+	return 0, false
+}
+
+func (p *Input) tailFile(path string) bool {
+	_, ok := p.initFiles[path]
+	return ok && p.config.TailFiles
+}
+
+// startFile 为文件创建日志采集，并传入最新的采集进度
+func (p *Input) startFile(f *fileStatus, now time.Time) {
+	child, ok, err := p.newFileInput(f)
+	if err != nil {
+		logp.Err("%s create input for file(%s) error: %v", inputName, f.path, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if !f.waitingSince.IsZero() && now.Sub(f.waitingSince) >= p.config.StarvedAfter {
+		logp.Info("%s(dataid=%d) start harvesting starved file: %s, waited: %s",
+			inputName, p.config.DataID, f.path, now.Sub(f.waitingSince))
+	}
+	p.children[f.path] = child
+	f.active = true
+	f.activeSince = now
+	f.waitingSince = time.Time{}
+}
+
+// stopFile 停止文件的采集，同步等待 harvester 退出，避免重新调度时重复采集
+func (p *Input) stopFile(f *fileStatus, now time.Time) {
+	child, ok := p.children[f.path]
+	if ok {
+		child.input.Stop()
+		delete(p.children, f.path)
+	}
+	if f.pending() && p.files[f.path] == f {
+		harvesterPreempted.Add(1)
+		logp.Info("%s(dataid=%d) preempt file: %s, offset: %d/%d", inputName, p.config.DataID, f.path, f.offset, f.size)
+		f.waitingSince = now
+	}
+	f.active = false
+}
+
+// newFileInput 创建文件的日志采集，Hook 未准备好时返回 false
+func (p *Input) newFileInput(f *fileStatus) (*fileInput, bool, error) {
+	cfg, err := common.NewConfigFrom(p.cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	_, _ = cfg.Remove("paths", -1)
+	if err = cfg.SetString("paths", 0, f.path); err != nil {
+		return nil, false, err
+	}
+	if err = cfg.SetString("type", -1, "log"); err != nil {
+		return nil, false, err
+	}
+	// 采集的文件数由调度控制，轮转后同一路径下可能同时存在新旧两个文件
+	if err = cfg.SetInt("harvester_limit", -1, 0); err != nil {
+		return nil, false, err
+	}
+	if err = cfg.SetBool("tail_files", -1, p.tailFile(f.path)); err != nil {
+		return nil, false, err
+	}
+
+	fileHook := &File{Path: f.path, Info: f.info, Config: cfg}
+	for _, hook := range p.hooks {
+		ok, err := hook.Prepare(fileHook)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	context := p.context
+	context.States = nil
+	p.statesMutex.Lock()
+	for _, state := range p.states {
+		if state.Source == f.path {
+			context.States = append(context.States, state)
+		}
+	}
+	p.statesMutex.Unlock()
+
+	connector := func(*common.Config, *common.MapStrPointer) (channel.Outleter, error) {
+		return newFileOutlet(p, fileHook), nil
+	}
+	in, err := log.NewInput(cfg, connector, context)
+	if err != nil {
+		return nil, false, err
+	}
+	return &fileInput{file: fileHook, input: in}, true, nil
+}
+
+// onEvent 记录最新的采集进度后转发到任务的 outlet
+func (p *Input) onEvent(path string, data *util.Data) bool {
+	state := data.GetState()
+	if state.Source != "" {
+		p.statesMutex.Lock()
+		p.states[state.ID()] = state
+		p.lastEvents[path] = time.Now()
+		p.statesMutex.Unlock()
+	}
+	return p.outlet.OnEvent(data)
+}
+
+func (p *Input) updateMetrics(now time.Time) {
+	var active, waiting int64
+	list := make([]*fileStatus, 0, len(p.files))
+	for _, f := range p.files {
+		list = append(list, f)
+		if f.active {
+			active++
+		} else if f.pending() {
+			waiting++
+		}
+	}
+	p.activeFiles.Set(active)
+	p.waitingFiles.Set(waiting)
+	p.starvedFiles.Set(int64(starved(list, now, p.config.StarvedAfter)))
+}
+
+// Stop stops all file inputs
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s(dataid=%d) input", inputName, p.config.DataID)
+	// 释放等待中的采集，如等待读取额度
+	for _, hook := range p.hooks {
+		hook.Close()
+	}
+	var wg sync.WaitGroup
+	for path, child := range p.children {
+		wg.Add(1)
+		go func(in input.Input) {
+			defer wg.Done()
+			in.Stop()
+		}(child.input)
+		delete(p.children, path)
+	}
+	wg.Wait()
+	p.activeFiles.Set(0)
+	p.waitingFiles.Set(0)
+	p.starvedFiles.Set(0)
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
+
+// fileOutlet 单个文件的 outlet，关闭时不影响任务的 outlet
+type fileOutlet struct {
+	input *Input
+	file  *File
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newFileOutlet(input *Input, file *File) *fileOutlet {
+	return &fileOutlet{
+		input: input,
+		file:  file,
+		done:  make(chan struct{}),
+	}
+}
+
+// OnEvent 经过文件的事件处理后转发到任务
+func (o *fileOutlet) OnEvent(data *util.Data) bool {
+	select {
+	case <-o.done:
+		return false
+	default:
+	}
+	if !o.file.Filter(data, o.done) {
+		return false
+	}
+	return o.input.onEvent(o.file.Path, data)
+}
+
+// Close 仅关闭当前文件的 outlet
+func (o *fileOutlet) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.done)
+	})
+	return nil
+}
+
+// Done 返回 outlet 状态
+func (o *fileOutlet) Done() <-chan struct{} {
+	return o.done
+}
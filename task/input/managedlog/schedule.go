@@ -0,0 +1,180 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package managedlog
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// 调度策略，在文件数超过 harvester_limit 时决定哪些文件优先采集
+// 未配置时按路径顺序占用空闲的位置，采集中的文件超过 close_inactive 没有新事件才让出位置
+const (
+	PolicyNewest     = "newest"      // 修改时间最新的文件优先
+	PolicyLag        = "lag"         // 未读取字节数最多的文件优先
+	PolicyRoundRobin = "round_robin" // 轮流采集，每个文件最多连续占用一个时间片
+)
+
+// fileStatus 文件的调度状态
+type fileStatus struct {
+	path    string
+	info    os.FileInfo // 最近一次扫描时的文件信息
+	size    int64
+	modTime time.Time
+	offset  int64 // 已发送的位置，小于 size 表示有待采集的数据
+
+	active       bool
+	activeSince  time.Time // 本次开始采集的时间
+	lastEvent    time.Time // 最近一次发送事件的时间
+	waitingSince time.Time // 开始等待采集的时间，未在等待时为零值
+}
+
+// pending 是否有未读取的数据
+func (f *fileStatus) pending() bool {
+	return f.offset < f.size
+}
+
+// lastActivity 最近一次开始采集或发送事件的时间
+func (f *fileStatus) lastActivity() time.Time {
+	if f.lastEvent.After(f.activeSince) {
+		return f.lastEvent
+	}
+	return f.activeSince
+}
+
+// idle 已读取到文件末尾，且超过 after 没有新的事件
+func (f *fileStatus) idle(now time.Time, after time.Duration) bool {
+	return !f.pending() && now.Sub(f.lastActivity()) >= after
+}
+
+// scheduleOptions 调度参数
+type scheduleOptions struct {
+	policy        string
+	limit         int           // 同时采集的文件数上限，小于等于 0 时不限制
+	timeSlice     time.Duration // round_robin 策略下每个文件连续采集的最长时间
+	idleAfter     time.Duration // 读取到末尾后超过该时间没有新事件，可以让出采集位置
+	closeInactive time.Duration // 超过该时间没有新事件时停止采集，与 close_inactive 一致
+}
+
+// plan 计算需要停止以及开始采集的文件
+// 1. 超过 close_inactive 没有新事件的文件停止采集
+// 2. 有文件等待时，按策略排序后依次占用空闲的位置；没有空闲位置时抢占已读取到末尾的文件，
+// round_robin 策略下还会抢占连续采集超过时间片的文件
+func plan(files []*fileStatus, opts scheduleOptions, now time.Time) (start, stop []*fileStatus) {
+	var (
+		active  []*fileStatus
+		waiting []*fileStatus
+	)
+	for _, f := range files {
+		switch {
+		case f.active && now.Sub(f.lastActivity()) >= opts.closeInactive && !f.pending():
+			stop = append(stop, f)
+		case f.active:
+			active = append(active, f)
+		case f.pending():
+			waiting = append(waiting, f)
+		}
+	}
+	if len(waiting) == 0 {
+		return nil, stop
+	}
+	sortWaiting(waiting, opts.policy)
+
+	free := opts.limit - len(active)
+	if opts.limit <= 0 {
+		// 不限制同时采集的文件数
+		free = len(waiting)
+	}
+	preemptable := preemptableFiles(active, opts, now)
+	for _, f := range waiting {
+		if free > 0 {
+			free--
+		} else if len(preemptable) > 0 {
+			stop = append(stop, preemptable[0])
+			preemptable = preemptable[1:]
+		} else {
+			break
+		}
+		start = append(start, f)
+	}
+	return start, stop
+}
+
+// sortWaiting 按调度策略对等待中的文件排序，路径用于保证顺序稳定
+func sortWaiting(files []*fileStatus, policy string) {
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		switch policy {
+		case PolicyNewest:
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.After(b.modTime)
+			}
+		case PolicyLag:
+			if lagA, lagB := a.size-a.offset, b.size-b.offset; lagA != lagB {
+				return lagA > lagB
+			}
+		case PolicyRoundRobin:
+			if !a.waitingSince.Equal(b.waitingSince) {
+				return a.waitingSince.Before(b.waitingSince)
+			}
+		}
+		return a.path < b.path
+	})
+}
+
+// preemptableFiles 可以让出采集位置的文件，最久没有活动的优先
+func preemptableFiles(active []*fileStatus, opts scheduleOptions, now time.Time) []*fileStatus {
+	var files []*fileStatus
+	for _, f := range active {
+		if f.idle(now, opts.idleAfter) {
+			files = append(files, f)
+			continue
+		}
+		if opts.policy == PolicyRoundRobin && now.Sub(f.activeSince) >= opts.timeSlice {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if idleA, idleB := a.idle(now, opts.idleAfter), b.idle(now, opts.idleAfter); idleA != idleB {
+			return idleA
+		}
+		if !a.lastActivity().Equal(b.lastActivity()) {
+			return a.lastActivity().Before(b.lastActivity())
+		}
+		return a.path < b.path
+	})
+	return files
+}
+
+// starved 等待时间超过 after 的文件数
+func starved(files []*fileStatus, now time.Time, after time.Duration) int {
+	count := 0
+	for _, f := range files {
+		if !f.active && f.pending() && !f.waitingSince.IsZero() && now.Sub(f.waitingSince) >= after {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,148 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package managedlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+func testOptions(policy string, limit int) scheduleOptions {
+	return scheduleOptions{
+		policy:        policy,
+		limit:         limit,
+		timeSlice:     time.Minute,
+		idleAfter:     10 * time.Second,
+		closeInactive: 2 * time.Minute,
+	}
+}
+
+func paths(files []*fileStatus) []string {
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		result = append(result, f.path)
+	}
+	return result
+}
+
+func TestPlanNewest(t *testing.T) {
+	files := []*fileStatus{
+		{path: "stale.log", size: 100, offset: 0, modTime: testNow.Add(-24 * time.Hour)},
+		{path: "current.log", size: 100, offset: 0, modTime: testNow},
+		{path: "recent.log", size: 100, offset: 50, modTime: testNow.Add(-time.Minute)},
+		{path: "done.log", size: 100, offset: 100, modTime: testNow},
+	}
+	start, stop := plan(files, testOptions(PolicyNewest, 2), testNow)
+	assert.Equal(t, []string{"current.log", "recent.log"}, paths(start))
+	assert.Empty(t, stop)
+}
+
+func TestPlanLag(t *testing.T) {
+	files := []*fileStatus{
+		{path: "a.log", size: 100, offset: 90},
+		{path: "b.log", size: 1000, offset: 0},
+		{path: "c.log", size: 500, offset: 0},
+	}
+	start, _ := plan(files, testOptions(PolicyLag, 2), testNow)
+	assert.Equal(t, []string{"b.log", "c.log"}, paths(start))
+}
+
+func TestPlanPreemptIdle(t *testing.T) {
+	files := []*fileStatus{
+		// 已读取到末尾且一段时间没有新事件，让出位置
+		{path: "idle.log", size: 100, offset: 100, active: true, activeSince: testNow.Add(-time.Hour), lastEvent: testNow.Add(-time.Minute)},
+		// 仍在读取，不能被抢占
+		{path: "busy.log", size: 100, offset: 10, active: true, activeSince: testNow.Add(-time.Hour), lastEvent: testNow},
+		{path: "new.log", size: 100, offset: 0, modTime: testNow},
+		{path: "other.log", size: 100, offset: 0, modTime: testNow.Add(-time.Second)},
+	}
+	start, stop := plan(files, testOptions(PolicyNewest, 2), testNow)
+	assert.Equal(t, []string{"new.log"}, paths(start))
+	assert.Equal(t, []string{"idle.log"}, paths(stop))
+}
+
+func TestPlanCloseInactive(t *testing.T) {
+	files := []*fileStatus{
+		{path: "inactive.log", size: 100, offset: 100, active: true, activeSince: testNow.Add(-time.Hour), lastEvent: testNow.Add(-3 * time.Minute)},
+		{path: "active.log", size: 100, offset: 100, active: true, activeSince: testNow.Add(-time.Hour), lastEvent: testNow},
+	}
+	start, stop := plan(files, testOptions(PolicyNewest, 2), testNow)
+	assert.Empty(t, start)
+	assert.Equal(t, []string{"inactive.log"}, paths(stop))
+}
+
+func TestPlanRoundRobin(t *testing.T) {
+	files := []*fileStatus{
+		{path: "a.log", size: 100, offset: 10, active: true, activeSince: testNow.Add(-2 * time.Minute), lastEvent: testNow},
+		{path: "b.log", size: 100, offset: 10, active: true, activeSince: testNow.Add(-10 * time.Second), lastEvent: testNow},
+		{path: "c.log", size: 100, offset: 0, waitingSince: testNow.Add(-time.Minute)},
+		{path: "d.log", size: 100, offset: 0, waitingSince: testNow.Add(-2 * time.Minute)},
+	}
+	// 超过时间片的 a.log 让出位置给等待最久的 d.log
+	start, stop := plan(files, testOptions(PolicyRoundRobin, 2), testNow)
+	assert.Equal(t, []string{"d.log"}, paths(start))
+	assert.Equal(t, []string{"a.log"}, paths(stop))
+
+	// 其他策略不按时间片抢占
+	start, stop = plan(files, testOptions(PolicyNewest, 2), testNow)
+	assert.Empty(t, start)
+	assert.Empty(t, stop)
+}
+
+func TestStarved(t *testing.T) {
+	files := []*fileStatus{
+		{path: "a.log", size: 100, offset: 0, waitingSince: testNow.Add(-2 * time.Minute)},
+		{path: "b.log", size: 100, offset: 0, waitingSince: testNow.Add(-10 * time.Second)},
+		{path: "c.log", size: 100, offset: 0, active: true},
+		{path: "d.log", size: 100, offset: 100, waitingSince: testNow.Add(-2 * time.Minute)},
+	}
+	assert.Equal(t, 1, starved(files, testNow, time.Minute))
+}
+
+func TestPlanDefault(t *testing.T) {
+	c := defaultConfig
+	c.HarvesterLimit = 1
+	files := []*fileStatus{
+		// 未配置调度策略时，已读取到末尾的文件在 close_inactive 之前不让出位置
+		{path: "idle.log", size: 100, offset: 100, active: true, activeSince: testNow.Add(-time.Hour), lastEvent: testNow.Add(-time.Minute)},
+		{path: "b.log", size: 100, offset: 0, modTime: testNow},
+		{path: "a.log", size: 100, offset: 0, modTime: testNow.Add(-time.Hour)},
+	}
+	start, stop := plan(files, c.scheduleOptions(), testNow)
+	assert.Empty(t, start)
+	assert.Empty(t, stop)
+
+	files[0].lastEvent = testNow.Add(-3 * time.Minute)
+	start, stop = plan(files, c.scheduleOptions(), testNow)
+	assert.Equal(t, []string{"a.log"}, paths(start))
+	assert.Equal(t, []string{"idle.log"}, paths(stop))
+
+	// 不限制同时采集的文件数
+	c.HarvesterLimit = 0
+	start, _ = plan(files, c.scheduleOptions(), testNow)
+	assert.Equal(t, []string{"a.log", "b.log"}, paths(start))
+}
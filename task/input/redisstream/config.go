@@ -0,0 +1,81 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstream
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultConfig = config{
+	Host:          "localhost:6379",
+	Group:         "bkunifylogbeat",
+	StartID:       "$",
+	BatchSize:     100,
+	Block:         5 * time.Second,
+	Timeout:       10 * time.Second,
+	ClaimTimeout:  5 * time.Minute,
+	ClaimInterval: 1 * time.Minute,
+	MaxPending:    10000,
+}
+
+type config struct {
+	Host         string `config:"host"`
+	Password     string `config:"password"`
+	DB           int    `config:"db"`
+	Stream       string `config:"stream"`
+	Group        string `config:"group"`         // 消费组，不存在时自动创建
+	Consumer     string `config:"consumer"`      // 消费者名称，默认为主机名，重启后需要保持一致才能继续处理未确认的消息
+	StartID      string `config:"start_id"`      // 创建消费组时的起始位置：$ 仅消费新消息，0 从头消费
+	MessageField string `config:"message_field"` // 作为日志内容的字段，为空或不存在时以 JSON 格式输出全部字段
+
+	BatchSize     int           `config:"batch_size"`     // 每次读取的消息数
+	Block         time.Duration `config:"block"`          // 没有新消息时的阻塞等待时间
+	Timeout       time.Duration `config:"timeout"`        // 连接及读写超时
+	ClaimTimeout  time.Duration `config:"claim_timeout"`  // 消息超过该时间未确认时，从其他消费者转移过来重新处理
+	ClaimInterval time.Duration `config:"claim_interval"` // 检查超时未确认消息的间隔
+	MaxPending    int           `config:"max_pending"`    // 已发送但未确认的最大消息数，超出后暂停读取
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Stream == "" {
+		return fmt.Errorf("stream is required")
+	}
+	if c.Group == "" {
+		return fmt.Errorf("group is required")
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("batch_size must be greater than 0")
+	}
+	if c.Block <= 0 || c.Timeout <= 0 {
+		return fmt.Errorf("block and timeout must be greater than 0")
+	}
+	if c.ClaimTimeout <= 0 || c.ClaimInterval <= 0 {
+		return fmt.Errorf("claim_timeout and claim_interval must be greater than 0")
+	}
+	if c.MaxPending < c.BatchSize {
+		return fmt.Errorf("max_pending must not be less than batch_size")
+	}
+	return nil
+}
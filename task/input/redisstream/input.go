@@ -0,0 +1,550 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const (
+	inputName = "redis_stream"
+
+	// stateType 消息的 state 类型，pipeline 确认后由 onAck 发送 XACK，不写入 Registrar
+	stateType = "redis_stream"
+
+	// ackInterval 批量发送 XACK 的间隔
+	ackInterval = 1 * time.Second
+	// retryInterval 连接异常后的重试间隔
+	retryInterval = 5 * time.Second
+	// maxAckBatch 单次 XACK 的最大消息数
+	maxAckBatch = 1000
+)
+
+var (
+	streamEntries   = bkmonitoring.NewInt("redis_stream_entries")                   // 读取的消息数
+	streamAcked     = bkmonitoring.NewInt("redis_stream_acked")                     // 已确认的消息数
+	streamReclaimed = bkmonitoring.NewInt("redis_stream_reclaimed")                 // 从其他消费者转移过来的消息数
+	streamPending   = bkmonitoring.NewInt("redis_stream_pending", monitoring.Gauge) // 已发送未确认的消息数
+	streamErrors    = bkmonitoring.NewInt("redis_stream_error")                     // 读取或确认异常次数
+
+	// inputs 按 state.Source 查找 input，用于处理 pipeline 的确认回调
+	inputs   = map[string]*Input{}
+	inputsMu sync.RWMutex
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+	base.RegisterAckHandler(stateType, onAck)
+}
+
+// onAck pipeline 确认发送后回调，记录确认的序号，由 ackLoop 异步发送 XACK
+func onAck(states []file.State) {
+	inputsMu.RLock()
+	defer inputsMu.RUnlock()
+	for _, state := range states {
+		if p, ok := inputs[state.Source]; ok {
+			p.ack(state.Offset)
+		}
+	}
+}
+
+// Input 通过消费组读取 Redis Stream，消息在 pipeline 确认发送后才执行 XACK
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+
+	config config
+	source string
+	outlet channel.Outleter
+
+	inflight *inflight
+	emitMu   sync.Mutex // 保证序号与发送顺序一致
+	ackCh    chan struct{}
+
+	readConn redis.Conn // 阻塞读取专用的连接
+	connMu   sync.Mutex
+	conn     redis.Conn // XACK、XPENDING、XCLAIM 共用的连接
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewInput creates a new redis stream input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Consumer == "" {
+		config.Consumer, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname for consumer error: %v", err)
+		}
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config:   config,
+		source:   fmt.Sprintf("%s://%s/%d/%s?group=%s&consumer=%s", inputName, config.Host, config.DB, config.Stream, config.Group, config.Consumer),
+		outlet:   outlet,
+		inflight: newInflight(),
+		ackCh:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	return p, nil
+}
+
+// Run 启动消费，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started {
+		return
+	}
+
+	inputsMu.Lock()
+	_, exists := inputs[p.source]
+	if !exists {
+		inputs[p.source] = p
+	}
+	inputsMu.Unlock()
+	if exists {
+		streamErrors.Add(1)
+		logp.Err("%s input(%s) is already running", inputName, p.source)
+		return
+	}
+
+	logp.Info("%s input start consuming %s", inputName, p.source)
+	p.started = true
+	p.wg.Add(3)
+	go p.readLoop()
+	go p.ackLoop()
+	go p.claimLoop()
+}
+
+func (p *Input) dial(readTimeout time.Duration) (redis.Conn, error) {
+	return redis.Dial("tcp", p.config.Host,
+		redis.DialPassword(p.config.Password),
+		redis.DialDatabase(p.config.DB),
+		redis.DialConnectTimeout(p.config.Timeout),
+		redis.DialReadTimeout(readTimeout),
+		redis.DialWriteTimeout(p.config.Timeout),
+	)
+}
+
+// do 使用共用的连接执行命令，连接异常时重新建立
+func (p *Input) do(cmd string, args ...interface{}) (interface{}, error) {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.conn == nil {
+		conn, err := p.dial(p.config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+	}
+	reply, err := p.conn.Do(cmd, args...)
+	if err != nil {
+		if _, ok := err.(redis.Error); !ok {
+			_ = p.conn.Close()
+			p.conn = nil
+		}
+	}
+	return reply, err
+}
+
+// ensureGroup 创建消费组，已存在时忽略
+func (p *Input) ensureGroup() error {
+	_, err := p.do("XGROUP", "CREATE", p.config.Stream, p.config.Group, p.config.StartID, "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// wait 等待一段时间，input 停止时返回 false
+func (p *Input) wait(d time.Duration) bool {
+	select {
+	case <-p.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (p *Input) onError(action string, err error) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	streamErrors.Add(1)
+	logp.Err("%s input(%s) %s error: %v", inputName, p.source, action, err)
+}
+
+// readLoop 读取消息，首先读取当前消费者未确认的历史消息，之后读取新消息
+func (p *Input) readLoop() {
+	defer p.wg.Done()
+
+	readID := "0"
+	groupReady := false
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		if !groupReady {
+			if err := p.ensureGroup(); err != nil {
+				p.onError("create group", err)
+				if !p.wait(retryInterval) {
+					return
+				}
+				continue
+			}
+			groupReady = true
+		}
+
+		// 未确认的消息过多时暂停读取，等待 pipeline 确认
+		if p.inflight.len() >= p.config.MaxPending {
+			if !p.wait(100 * time.Millisecond) {
+				return
+			}
+			continue
+		}
+
+		entries, err := p.read(readID)
+		if err != nil {
+			p.onError("read", err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				groupReady = false
+			}
+			if !p.wait(retryInterval) {
+				return
+			}
+			continue
+		}
+
+		if readID != ">" {
+			if len(entries) == 0 {
+				readID = ">"
+				continue
+			}
+			readID = entries[len(entries)-1].ID
+		}
+		for _, e := range entries {
+			if !p.emit(e, false) {
+				return
+			}
+		}
+	}
+}
+
+// read 执行 XREADGROUP，使用专用连接以免阻塞确认
+func (p *Input) read(readID string) ([]entry, error) {
+	p.connMu.Lock()
+	conn := p.readConn
+	p.connMu.Unlock()
+
+	if conn == nil {
+		var err error
+		conn, err = p.dial(p.config.Block + p.config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		p.connMu.Lock()
+		select {
+		case <-p.done:
+			p.connMu.Unlock()
+			_ = conn.Close()
+			return nil, nil
+		default:
+		}
+		p.readConn = conn
+		p.connMu.Unlock()
+	}
+
+	reply, err := conn.Do("XREADGROUP", "GROUP", p.config.Group, p.config.Consumer,
+		"COUNT", p.config.BatchSize, "BLOCK", p.config.Block.Milliseconds(),
+		"STREAMS", p.config.Stream, readID)
+	if err != nil {
+		if _, ok := err.(redis.Error); !ok {
+			p.connMu.Lock()
+			_ = conn.Close()
+			p.readConn = nil
+			p.connMu.Unlock()
+		}
+		return nil, err
+	}
+	return parseReadReply(reply, p.config.Stream)
+}
+
+// emit 将消息转换为采集事件，outlet 阻塞时暂停读取
+func (p *Input) emit(e entry, reclaimed bool) bool {
+	// 已被裁剪的消息直接确认，避免一直处于未确认状态
+	if e.Deleted {
+		p.xack([]string{e.ID})
+		return true
+	}
+
+	p.emitMu.Lock()
+	defer p.emitMu.Unlock()
+
+	streamEntries.Add(1)
+	if reclaimed {
+		streamReclaimed.Add(1)
+	}
+
+	message, ok := e.Fields[p.config.MessageField]
+	if p.config.MessageField == "" || !ok {
+		b, err := json.Marshal(e.Fields)
+		if err != nil {
+			p.onError("encode entry", err)
+			return true
+		}
+		message = string(b)
+	}
+
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"data": message},
+	}
+	seq := p.inflight.add(e.ID)
+	data.SetState(file.State{
+		Source: p.source,
+		Type:   stateType,
+		Offset: seq,
+	})
+	formatter.SetEventExt(data, map[string]interface{}{
+		"redis_stream":    p.config.Stream,
+		"redis_stream_id": e.ID,
+	})
+	return p.outlet.OnEvent(data)
+}
+
+// ack 记录 pipeline 确认的序号并唤醒 ackLoop
+func (p *Input) ack(seq int64) {
+	p.inflight.ack(seq)
+	select {
+	case p.ackCh <- struct{}{}:
+	default:
+	}
+}
+
+// ackLoop 对 pipeline 已确认的消息批量发送 XACK
+func (p *Input) ackLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			// 停止前确认已发送成功的消息
+			p.flushAck()
+			return
+		case <-p.ackCh:
+		case <-ticker.C:
+		}
+		p.flushAck()
+	}
+}
+
+// flushAck 只确认 pipeline 已确认的消息，被过滤或丢弃的消息同样经 pipeline 确认
+// 未确认的消息保留在 Redis 的待确认列表中，超时后由 XCLAIM 重新处理
+func (p *Input) flushAck() {
+	ids := p.inflight.pop()
+	if len(ids) == 0 {
+		return
+	}
+	p.xack(ids)
+}
+
+// xack 确认失败的消息会在超时后被重新处理，保证至少发送一次
+func (p *Input) xack(ids []string) {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxAckBatch {
+			n = maxAckBatch
+		}
+		args := make([]interface{}, 0, n+2)
+		args = append(args, p.config.Stream, p.config.Group)
+		for _, id := range ids[:n] {
+			args = append(args, id)
+		}
+		if _, err := p.do("XACK", args...); err != nil {
+			p.onError("ack", err)
+		} else {
+			streamAcked.Add(int64(n))
+		}
+		ids = ids[n:]
+	}
+}
+
+// claimLoop 定期将超时未确认的消息转移到当前消费者重新处理，如已下线的消费者遗留的消息
+func (p *Input) claimLoop() {
+	defer p.wg.Done()
+
+	for p.wait(p.config.ClaimInterval) {
+		if err := p.claim(); err != nil {
+			p.onError("claim", err)
+		}
+	}
+}
+
+func (p *Input) claim() error {
+	minIdle := p.config.ClaimTimeout.Milliseconds()
+	start := "-"
+	claimed := 0
+	for claimed < p.config.BatchSize {
+		if p.inflight.len() >= p.config.MaxPending {
+			return nil
+		}
+		reply, err := p.do("XPENDING", p.config.Stream, p.config.Group, start, "+", p.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		pending, err := parsePendingReply(reply)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]interface{}, 0, len(pending))
+		for _, e := range pending {
+			// 当前正在处理的消息等待 pipeline 确认
+			if e.IdleMillis < minIdle || p.inflight.contains(e.ID) {
+				continue
+			}
+			ids = append(ids, e.ID)
+		}
+		if len(ids) > 0 {
+			args := append([]interface{}{p.config.Stream, p.config.Group, p.config.Consumer, minIdle}, ids...)
+			reply, err = p.do("XCLAIM", args...)
+			if err != nil {
+				return err
+			}
+			entries, err := parseEntries(reply)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if !p.emit(e, true) {
+					return nil
+				}
+			}
+			claimed += len(entries)
+		}
+
+		if len(pending) < p.config.BatchSize {
+			return nil
+		}
+		start, err = nextID(pending[len(pending)-1].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop 停止消费，未确认的消息在重启后由当前消费者重新读取，或超时后被其他消费者转移
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input(%s)", inputName, p.source)
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	// 关闭连接以中断阻塞的读取
+	p.connMu.Lock()
+	if p.readConn != nil {
+		_ = p.readConn.Close()
+		p.readConn = nil
+	}
+	p.connMu.Unlock()
+	_ = p.outlet.Close()
+
+	if p.started {
+		p.wg.Wait()
+		p.started = false
+
+		inputsMu.Lock()
+		delete(inputs, p.source)
+		inputsMu.Unlock()
+		p.inflight.clear()
+	}
+
+	p.connMu.Lock()
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+	p.connMu.Unlock()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
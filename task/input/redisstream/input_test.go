@@ -0,0 +1,112 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstream
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOutlet struct {
+	events chan *util.Data
+	done   chan struct{}
+}
+
+func (o *testOutlet) OnEvent(data *util.Data) bool {
+	select {
+	case <-o.done:
+		return false
+	case o.events <- data:
+		return true
+	}
+}
+
+func (o *testOutlet) Close() error {
+	return nil
+}
+
+func (o *testOutlet) Done() <-chan struct{} {
+	return o.done
+}
+
+// TestInputWithRedis 需要本地的 redis-server，通过 REDIS_STREAM_TEST_HOST 指定地址，如 localhost:6379
+func TestInputWithRedis(t *testing.T) {
+	host := os.Getenv("REDIS_STREAM_TEST_HOST")
+	if host == "" {
+		t.Skip("REDIS_STREAM_TEST_HOST is not set")
+	}
+
+	config := defaultConfig
+	config.Host = host
+	config.Stream = fmt.Sprintf("bkunifylogbeat-test-%d", time.Now().UnixNano())
+	config.Consumer = "test"
+	config.StartID = "0"
+	config.Block = 100 * time.Millisecond
+	assert.NoError(t, config.Validate())
+
+	outlet := &testOutlet{events: make(chan *util.Data, 10), done: make(chan struct{})}
+	p := &Input{
+		config:   config,
+		source:   config.Stream,
+		outlet:   outlet,
+		inflight: newInflight(),
+		ackCh:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	defer func() {
+		close(outlet.done)
+		p.Stop()
+		_, _ = p.do("DEL", config.Stream)
+	}()
+
+	_, err := p.do("XADD", config.Stream, "*", "message", "hello")
+	assert.NoError(t, err)
+	p.Run()
+
+	var data *util.Data
+	select {
+	case data = <-outlet.events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	assert.Equal(t, "{\"message\":\"hello\"}", data.Event.Fields["data"])
+
+	// pipeline 确认前消息处于未确认状态
+	pending := func() int {
+		reply, err := p.do("XPENDING", config.Stream, config.Group, "-", "+", 10)
+		assert.NoError(t, err)
+		entries, err := parsePendingReply(reply)
+		assert.NoError(t, err)
+		return len(entries)
+	}
+	assert.Equal(t, 1, pending())
+
+	onAck([]file.State{data.GetState()})
+	assert.Eventually(t, func() bool { return pending() == 0 }, 5*time.Second, 50*time.Millisecond)
+}
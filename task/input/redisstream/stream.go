@@ -0,0 +1,268 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// entry Stream 中的一条消息
+type entry struct {
+	ID     string
+	Fields map[string]string
+	// 历史消息已被裁剪时，只有 ID 没有内容
+	Deleted bool
+}
+
+// pendingEntry XPENDING 返回的未确认消息
+type pendingEntry struct {
+	ID         string
+	Consumer   string
+	IdleMillis int64
+	Deliveries int64
+}
+
+func replyString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case []byte:
+		return string(s), true
+	case string:
+		return s, true
+	}
+	return "", false
+}
+
+func replyInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case []byte:
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// parseReadReply 解析 XREADGROUP 的返回：[[stream, [[id, [field, value, ...]], ...]]]
+// 阻塞超时时返回 nil
+func parseReadReply(reply interface{}, stream string) ([]entry, error) {
+	if reply == nil {
+		return nil, nil
+	}
+	streams, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected XREADGROUP reply type %T", reply)
+	}
+	for _, s := range streams {
+		pair, ok := s.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("unexpected XREADGROUP stream reply %v", s)
+		}
+		if name, _ := replyString(pair[0]); name != stream {
+			continue
+		}
+		return parseEntries(pair[1])
+	}
+	return nil, nil
+}
+
+// parseEntries 解析消息列表：[[id, [field, value, ...]], ...]，XCLAIM 返回同样的格式
+func parseEntries(reply interface{}) ([]entry, error) {
+	if reply == nil {
+		return nil, nil
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected entries reply type %T", reply)
+	}
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		// XCLAIM 时已被删除的消息返回 nil
+		if item == nil {
+			continue
+		}
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("unexpected entry reply %v", item)
+		}
+		id, ok := replyString(pair[0])
+		if !ok {
+			return nil, fmt.Errorf("unexpected entry id %v", pair[0])
+		}
+		if pair[1] == nil {
+			entries = append(entries, entry{ID: id, Deleted: true})
+			continue
+		}
+		values, ok := pair[1].([]interface{})
+		if !ok || len(values)%2 != 0 {
+			return nil, fmt.Errorf("unexpected entry(%s) fields %v", id, pair[1])
+		}
+		fields := make(map[string]string, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			k, _ := replyString(values[i])
+			v, _ := replyString(values[i+1])
+			fields[k] = v
+		}
+		entries = append(entries, entry{ID: id, Fields: fields})
+	}
+	return entries, nil
+}
+
+// parsePendingReply 解析 XPENDING key group start end count 的返回：[[id, consumer, idle, deliveries], ...]
+func parsePendingReply(reply interface{}) ([]pendingEntry, error) {
+	if reply == nil {
+		return nil, nil
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected XPENDING reply type %T", reply)
+	}
+	entries := make([]pendingEntry, 0, len(items))
+	for _, item := range items {
+		values, ok := item.([]interface{})
+		if !ok || len(values) != 4 {
+			return nil, fmt.Errorf("unexpected pending entry %v", item)
+		}
+		id, ok1 := replyString(values[0])
+		consumer, ok2 := replyString(values[1])
+		idle, ok3 := replyInt(values[2])
+		deliveries, ok4 := replyInt(values[3])
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil, fmt.Errorf("unexpected pending entry %v", item)
+		}
+		entries = append(entries, pendingEntry{ID: id, Consumer: consumer, IdleMillis: idle, Deliveries: deliveries})
+	}
+	return entries, nil
+}
+
+// nextID 返回比 id 大的最小消息 ID，用于 XPENDING 分页，兼容不支持 "(" 前缀的版本
+func nextID(id string) (string, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid stream id(%s)", id)
+	}
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id(%s)", id)
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id(%s)", id)
+	}
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-0", ms+1), nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+// inflight 已发送到 pipeline 但未确认的消息
+// 按发送顺序分配序号并写入 state.Offset，pipeline 确认某个序号时，该序号及之前的消息均已发送成功
+// 依赖 Input 只属于一个任务，见 config/task.go initIDWithConfig
+// 未确认的消息数同步到 redis_stream_pending 指标，移除消息时减少
+type inflight struct {
+	mtx    sync.Mutex
+	seq    int64
+	acked  int64
+	queue  []inflightEntry
+	exists map[string]struct{}
+}
+
+type inflightEntry struct {
+	seq int64
+	id  string
+}
+
+func newInflight() *inflight {
+	return &inflight{exists: make(map[string]struct{})}
+}
+
+// add 记录发送的消息，返回分配的序号
+func (f *inflight) add(id string) int64 {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.seq++
+	f.queue = append(f.queue, inflightEntry{seq: f.seq, id: id})
+	f.exists[id] = struct{}{}
+	streamPending.Add(1)
+	return f.seq
+}
+
+// ack 记录 pipeline 确认的序号
+func (f *inflight) ack(seq int64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if seq > f.acked {
+		f.acked = seq
+	}
+}
+
+// pop 移除并返回已确认的消息 ID
+func (f *inflight) pop() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n := 0
+	for n < len(f.queue) && f.queue[n].seq <= f.acked {
+		n++
+	}
+	return f.remove(n)
+}
+
+// clear 移除全部消息，停止后由 Redis 在重启或超时后重新处理
+func (f *inflight) clear() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.remove(len(f.queue))
+}
+
+// remove 移除队列头部的 n 条消息，调用方需持有锁
+func (f *inflight) remove(n int) []string {
+	if n == 0 {
+		return nil
+	}
+	ids := make([]string, 0, n)
+	for _, e := range f.queue[:n] {
+		ids = append(ids, e.id)
+		delete(f.exists, e.id)
+	}
+	f.queue = append(f.queue[:0:0], f.queue[n:]...)
+	streamPending.Add(-int64(n))
+	return ids
+}
+
+// contains 消息是否正在处理中
+func (f *inflight) contains(id string) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	_, ok := f.exists[id]
+	return ok
+}
+
+// len 未确认的消息数
+func (f *inflight) len() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.queue)
+}
@@ -0,0 +1,126 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReadReply(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{
+			[]byte("logs"),
+			[]interface{}{
+				[]interface{}{[]byte("1526919030474-55"), []interface{}{[]byte("level"), []byte("info"), []byte("message"), []byte("hello")}},
+				[]interface{}{[]byte("1526919030474-56"), nil},
+			},
+		},
+	}
+	entries, err := parseReadReply(reply, "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, []entry{
+		{ID: "1526919030474-55", Fields: map[string]string{"level": "info", "message": "hello"}},
+		{ID: "1526919030474-56", Deleted: true},
+	}, entries)
+
+	// 阻塞超时
+	entries, err = parseReadReply(nil, "logs")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = parseReadReply(reply, "other")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = parseReadReply([]interface{}{[]interface{}{[]byte("logs")}}, "logs")
+	assert.Error(t, err)
+
+	_, err = parseEntries([]interface{}{[]interface{}{[]byte("1-1"), []interface{}{[]byte("odd")}}})
+	assert.Error(t, err)
+
+	// XCLAIM 时已删除的消息为 nil
+	entries, err = parseEntries([]interface{}{nil, []interface{}{[]byte("1-1"), []interface{}{}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []entry{{ID: "1-1", Fields: map[string]string{}}}, entries)
+}
+
+func TestParsePendingReply(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{[]byte("1-1"), []byte("host-a"), int64(600000), int64(2)},
+	}
+	pending, err := parsePendingReply(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, []pendingEntry{{ID: "1-1", Consumer: "host-a", IdleMillis: 600000, Deliveries: 2}}, pending)
+
+	_, err = parsePendingReply([]interface{}{[]interface{}{[]byte("1-1")}})
+	assert.Error(t, err)
+}
+
+func TestNextID(t *testing.T) {
+	id, err := nextID("1526919030474-55")
+	assert.NoError(t, err)
+	assert.Equal(t, "1526919030474-56", id)
+
+	id, err = nextID("1-18446744073709551615")
+	assert.NoError(t, err)
+	assert.Equal(t, "2-0", id)
+
+	_, err = nextID("invalid")
+	assert.Error(t, err)
+}
+
+func TestInflight(t *testing.T) {
+	f := newInflight()
+	assert.Equal(t, int64(1), f.add("1-1"))
+	assert.Equal(t, int64(2), f.add("1-2"))
+	assert.Equal(t, int64(3), f.add("0-9")) // 转移过来的旧消息按发送顺序确认
+	assert.Equal(t, 3, f.len())
+	assert.True(t, f.contains("0-9"))
+	assert.Empty(t, f.pop())
+
+	// 确认序号 2 表示序号 1、2 均已发送
+	f.ack(2)
+	f.ack(1)
+	assert.Equal(t, []string{"1-1", "1-2"}, f.pop())
+	assert.Empty(t, f.pop())
+	assert.False(t, f.contains("1-1"))
+	assert.Equal(t, 1, f.len())
+
+	// 未确认的消息保留在 Redis 的待确认列表中，停止后由 XCLAIM 重新处理
+	f.clear()
+	assert.Equal(t, 0, f.len())
+	assert.False(t, f.contains("0-9"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := defaultConfig
+	assert.Error(t, c.Validate())
+
+	c.Stream = "logs"
+	assert.NoError(t, c.Validate())
+
+	c.MaxPending = c.BatchSize - 1
+	assert.Error(t, c.Validate())
+}
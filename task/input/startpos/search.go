@@ -0,0 +1,273 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package startpos 为没有采集进度的文件确定起始位置
+package startpos
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	// maxProbeBytes 二分查找时每次最多向后读取的字节数，超出仍没有时间的位置视为满足条件
+	maxProbeBytes = 1 << 20
+	// maxTimePrefix 仅在行首的这些字节内查找时间
+	maxTimePrefix = 128
+	// tailBlockSize 从末尾向前查找换行符时每次读取的字节数
+	tailBlockSize = 64 * 1024
+)
+
+// timeLayout 行内时间的匹配规则以及对应的解析格式
+type timeLayout struct {
+	re      *regexp.Regexp
+	layouts []string
+	noYear  bool
+}
+
+var timeLayouts = []timeLayout{
+	{
+		// 2021-03-04T05:06:07.123+08:00、2021-03-04 05:06:07,123
+		re: regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+		layouts: []string{
+			"2006-01-02T15:04:05.999999999Z07:00",
+			"2006-01-02T15:04:05.999999999Z0700",
+			"2006-01-02T15:04:05.999999999",
+			"2006-01-02 15:04:05.999999999Z07:00",
+			"2006-01-02 15:04:05.999999999Z0700",
+			"2006-01-02 15:04:05.999999999",
+		},
+	},
+	{
+		// 2021/03/04 05:06:07
+		re:      regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`),
+		layouts: []string{"2006/01/02 15:04:05.999999999"},
+	},
+	{
+		// nginx、apache 访问日志：04/Mar/2021:05:06:07 +0800
+		re:      regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`),
+		layouts: []string{"02/Jan/2006:15:04:05 -0700"},
+	},
+	{
+		// syslog：Mar  4 05:06:07，不带年份
+		re:      regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`),
+		layouts: []string{time.Stamp},
+		noYear:  true,
+	},
+}
+
+// parseLineTime 解析行首附近的时间，不带时区时使用 loc
+func parseLineTime(line []byte, loc *time.Location, now time.Time) (time.Time, bool) {
+	if len(line) > maxTimePrefix {
+		line = line[:maxTimePrefix]
+	}
+	for _, l := range timeLayouts {
+		match := l.re.Find(line)
+		if match == nil {
+			continue
+		}
+		value := string(bytes.Replace(match, []byte(","), []byte("."), 1))
+		for _, layout := range l.layouts {
+			t, err := time.ParseInLocation(layout, value, loc)
+			if err != nil {
+				continue
+			}
+			if l.noYear {
+				t = t.AddDate(now.In(loc).Year(), 0, 0)
+				// 跨年时，未带年份的时间可能属于上一年
+				if t.After(now.Add(24 * time.Hour)) {
+					t = t.AddDate(-1, 0, 0)
+				}
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// OffsetSince 二分查找第一个时间不早于 since 的行的位置，要求文件中的时间整体有序
+// 没有时间的行(如多行日志的后续行)归属于前一行；文件中找不到时间时从头读取
+func OffsetSince(path string, since time.Time, loc *time.Location) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	now := time.Now()
+
+	// 查找最小的 offset，使其之后第一个带时间的行满足条件
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		p, err := probe(f, mid, loc, now)
+		if err != nil {
+			return 0, err
+		}
+		if !p.found || !p.time.Before(since) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo >= size {
+		return size, nil
+	}
+	p, err := probe(f, lo, loc, now)
+	if err != nil {
+		return 0, err
+	}
+	if !p.found {
+		if lo > 0 {
+			// 之后没有时间的内容属于前面早于 since 的行
+			return size, nil
+		}
+		// 文件中找不到时间，从头读取
+		return 0, nil
+	}
+	return p.timeStart, nil
+}
+
+// probeResult offset 之后第一个完整行的位置，以及第一个带时间的行的位置及时间
+type probeResult struct {
+	lineStart int64
+	timeStart int64
+	time      time.Time
+	found     bool
+}
+
+// probe 从 offset 之后的第一个完整行开始，找到第一个带时间的行
+func probe(f *os.File, offset int64, loc *time.Location, now time.Time) (probeResult, error) {
+	pos := offset
+	if offset > 0 {
+		// 从前一个字节开始读取，offset 恰好为行首时不会跳过该行
+		pos = offset - 1
+	}
+	reader := bufio.NewReader(io.NewSectionReader(f, pos, maxProbeBytes))
+	if offset > 0 {
+		n, err := skipLine(reader)
+		pos += n
+		if err != nil {
+			return probeResult{lineStart: pos}, ignoreEOF(err)
+		}
+	}
+
+	result := probeResult{lineStart: pos}
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if t, ok := parseLineTime(line, loc, now); ok {
+				result.timeStart, result.time, result.found = pos, t, true
+				return result, nil
+			}
+		}
+		pos += int64(len(line))
+		if err == bufio.ErrBufferFull {
+			n, err := skipLine(reader)
+			pos += n
+			if err != nil {
+				return result, ignoreEOF(err)
+			}
+			continue
+		}
+		if err != nil {
+			return result, ignoreEOF(err)
+		}
+	}
+}
+
+// skipLine 跳过到下一个换行符之后，返回跳过的字节数
+func skipLine(reader *bufio.Reader) (int64, error) {
+	var n int64
+	for {
+		line, err := reader.ReadSlice('\n')
+		n += int64(len(line))
+		if err != bufio.ErrBufferFull {
+			return n, err
+		}
+	}
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// OffsetLastLines 从末尾向前查找倒数第 n 行的起始位置，行数不足时从头读取
+func OffsetLastLines(path string, n int) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	end := info.Size()
+	if end == 0 {
+		return 0, nil
+	}
+	// 文件以换行符结尾时，最后一个换行符属于最后一行
+	last := make([]byte, 1)
+	if _, err = f.ReadAt(last, end-1); err != nil {
+		return 0, err
+	}
+	if last[0] == '\n' {
+		end--
+	}
+
+	count := 0
+	buf := make([]byte, tailBlockSize)
+	for end > 0 {
+		start := end - tailBlockSize
+		if start < 0 {
+			start = 0
+		}
+		block := buf[:end-start]
+		if _, err = f.ReadAt(block, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i] != '\n' {
+				continue
+			}
+			count++
+			if count == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,137 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package startpos
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "startpos")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestParseLineTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2021, 3, 10, 0, 0, 0, 0, loc)
+	expected := time.Date(2021, 3, 4, 5, 6, 7, 0, loc)
+
+	cases := map[string]time.Time{
+		"2021-03-04T05:06:07+08:00 INFO start":          expected,
+		"[2021-03-04 05:06:07,000] INFO start":          expected,
+		"2021-03-04T05:06:07.000Z INFO start":           time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		"2021/03/04 05:06:07 [error] 1#0: failed":       expected,
+		`127.0.0.1 - - [04/Mar/2021:05:06:07 +0800] ""`: expected,
+		"Mar  4 05:06:07 host sshd[1]: accepted":        expected,
+	}
+	for line, want := range cases {
+		got, ok := parseLineTime([]byte(line), loc, now)
+		assert.True(t, ok, line)
+		assert.True(t, want.Equal(got), "%s: %s", line, got)
+	}
+
+	_, ok := parseLineTime([]byte("\tat com.example.Main(Main.java:10)"), loc, now)
+	assert.False(t, ok)
+
+	// 未带年份的时间晚于当前时间时属于上一年
+	got, ok := parseLineTime([]byte("Dec 31 23:00:00 host app: msg"), loc, now)
+	assert.True(t, ok)
+	assert.Equal(t, 2020, got.Year())
+}
+
+func TestOffsetSince(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, time.Date(2021, 3, 4, 0, i, 0, 0, time.UTC).Format(time.RFC3339)+" line")
+		// 多行日志的后续行
+		if i%3 == 0 {
+			lines = append(lines, "\tat stack trace")
+		}
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	path := writeFile(t, content)
+
+	offset, err := OffsetSince(path, time.Date(2021, 3, 4, 0, 30, 0, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content[offset:], "2021-03-04T00:30:00Z line\n"))
+
+	// 早于所有内容时从头读取
+	offset, err = OffsetSince(path, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	// 晚于所有内容时从末尾读取
+	offset, err = OffsetSince(path, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), offset)
+
+	// 介于两行之间时从较晚的一行开始
+	offset, err = OffsetSince(path, time.Date(2021, 3, 4, 0, 29, 30, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content[offset:], "2021-03-04T00:30:00Z line\n"))
+}
+
+func TestOffsetSinceWithoutTime(t *testing.T) {
+	path := writeFile(t, "no time here\nnor here\n")
+	offset, err := OffsetSince(path, time.Now(), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+}
+
+func TestOffsetLastLines(t *testing.T) {
+	content := "a\nbb\nccc\ndddd\n"
+	path := writeFile(t, content)
+
+	offset, err := OffsetLastLines(path, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "ccc\ndddd\n", content[offset:])
+
+	offset, err = OffsetLastLines(path, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	// 最后一行没有换行符
+	content = "a\nbb\nccc"
+	path = writeFile(t, content)
+	offset, err = OffsetLastLines(path, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "ccc", content[offset:])
+
+	// 超过读取块大小的文件
+	content = strings.Repeat(strings.Repeat("x", 999)+"\n", 200)
+	path = writeFile(t, content)
+	offset, err = OffsetLastLines(path, 150)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)-150*1000), offset)
+}
@@ -0,0 +1,154 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package startpos
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input/file"
+	commonFile "github.com/elastic/beats/libbeat/common/file"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/config"
+)
+
+var (
+	startPositionFiles = bkmonitoring.NewInt("start_position_files") // 按 start_position 确定起始位置的文件数
+	startPositionError = bkmonitoring.NewInt("start_position_error") // 确定起始位置失败而从头读取的文件数
+)
+
+// fileConfig 日志采集中与起始位置相关的配置
+type fileConfig struct {
+	Paths          []string      `config:"paths"`
+	ExcludeFiles   []string      `config:"exclude_files"`
+	FileIdentifier string        `config:"file_identifier"`
+	CleanInactive  time.Duration `config:"clean_inactive"`
+}
+
+// InitStates 为启动时已存在且没有采集进度的文件按 start_position 生成采集进度
+// 日志采集加载后会从该位置开始读取，已有采集进度的文件不受影响
+func InitStates(taskCfg *config.TaskConfig, states []file.State) []file.State {
+	position, err := config.ParseStartPosition(taskCfg.StartPosition, time.Now())
+	if err != nil || position.Mode == "" || position.Mode == config.StartPositionBeginning {
+		return states
+	}
+
+	var cfg fileConfig
+	if err = taskCfg.RawConfig.Unpack(&cfg); err != nil {
+		logp.L.Errorf("start_position unpack config error: %v", err)
+		return states
+	}
+
+	count := 0
+	for path, info := range listFiles(cfg.Paths, cfg.ExcludeFiles) {
+		osState := commonFile.GetOSState(info)
+		if hasState(states, path, osState) {
+			continue
+		}
+		offset, err := findOffset(path, info, position)
+		if err != nil {
+			startPositionError.Add(1)
+			logp.L.Errorf("start_position(%s) find offset of file(%s) error: %v", taskCfg.StartPosition, path, err)
+			continue
+		}
+		if offset <= 0 {
+			continue
+		}
+		states = append(states, file.State{
+			Source:         path,
+			Type:           "log",
+			Offset:         offset,
+			Fileinfo:       info,
+			FileStateOS:    osState,
+			FileIdentifier: cfg.FileIdentifier,
+			Timestamp:      time.Now(),
+			TTL:            cfg.CleanInactive,
+			Finished:       true,
+		})
+		count++
+	}
+	startPositionFiles.Add(int64(count))
+	logp.L.Infof("start_position(%s) of task(%d) init %d file states", taskCfg.StartPosition, taskCfg.DataID, count)
+	return states
+}
+
+// findOffset 计算文件的起始位置
+func findOffset(path string, info os.FileInfo, position config.StartPosition) (int64, error) {
+	switch position.Mode {
+	case config.StartPositionEnd:
+		return info.Size(), nil
+	case config.StartPositionSince:
+		// 修改时间早于指定时间的文件不会有满足条件的内容
+		if info.ModTime().Before(position.Since) {
+			return info.Size(), nil
+		}
+		return OffsetSince(path, position.Since, time.Local)
+	case config.StartPositionLastLines:
+		return OffsetLastLines(path, position.LastLines)
+	}
+	return 0, nil
+}
+
+func hasState(states []file.State, path string, osState commonFile.StateOS) bool {
+	for _, state := range states {
+		if state.Source == path || state.FileStateOS.IsSame(osState) {
+			return true
+		}
+	}
+	return false
+}
+
+func listFiles(patterns, excludeFiles []string) map[string]os.FileInfo {
+	excludes := make([]*regexp.Regexp, 0, len(excludeFiles))
+	for _, expr := range excludeFiles {
+		if re, err := regexp.Compile(expr); err == nil {
+			excludes = append(excludes, re)
+		}
+	}
+
+	files := make(map[string]os.FileInfo)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+	match:
+		for _, path := range matches {
+			for _, re := range excludes {
+				if re.MatchString(path) {
+					continue match
+				}
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			files[path] = info
+		}
+	}
+	return files
+}
@@ -0,0 +1,204 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package streamserver 流式监听(tcp、unix socket)的连接管理以及分帧读取
+package streamserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+// acceptRetryDelay accept 失败后的重试间隔，避免持续失败时空转
+const acceptRetryDelay = 100 * time.Millisecond
+
+// Config 连接的读取配置以及连接数指标
+type Config struct {
+	Framing        string
+	MaxMessageSize int
+	MaxConnections int           // 最大连接数，为 0 时不限制
+	Timeout        time.Duration // 读超时，为 0 时不限制
+
+	Connections *monitoring.Int // 当前连接数
+	Rejected    *monitoring.Int // 超过最大连接数被拒绝的连接数
+}
+
+// MessageHandler 处理一条消息，返回 false 时关闭连接
+type MessageHandler func(msg string, truncated bool) bool
+
+// ConnHandler 连接建立后、开始读取前调用，如 TLS 握手，返回该连接的消息处理，返回错误时关闭连接
+type ConnHandler func(conn net.Conn) (MessageHandler, error)
+
+// Server 从 listener 接收连接，按连接分帧读取
+type Server struct {
+	config   Config
+	listener net.Listener
+	onConn   ConnHandler
+	onError  func(err error)
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mtx   sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// New 创建服务端，listener 由调用方创建，Stop 时关闭
+func New(listener net.Listener, config Config, onConn ConnHandler, onError func(err error)) *Server {
+	return &Server{
+		config:   config,
+		listener: listener,
+		onConn:   onConn,
+		onError:  onError,
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start 开始接收连接
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.accept()
+}
+
+// Addr 返回实际监听的地址
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Stop 关闭监听以及所有连接，并等待处理结束
+func (s *Server) Stop() {
+	close(s.done)
+	_ = s.listener.Close()
+	s.mtx.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.isDone() {
+				return
+			}
+			s.onError(err)
+			time.Sleep(acceptRetryDelay)
+			continue
+		}
+
+		if !s.addConn(conn) {
+			s.config.Rejected.Add(1)
+			_ = conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.removeConn(conn)
+			s.handle(conn)
+		}()
+	}
+}
+
+// addConn 记录连接，超过最大连接数时返回 false
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.config.MaxConnections > 0 && len(s.conns) >= s.config.MaxConnections {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.config.Connections.Add(1)
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	_ = conn.Close()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.conns[conn]; ok {
+		delete(s.conns, conn)
+		s.config.Connections.Add(-1)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	handler, err := s.onConn(conn)
+	if err != nil {
+		if !s.isDone() {
+			s.onError(err)
+		}
+		return
+	}
+
+	reader, err := framing.NewReader(conn, s.config.Framing, s.config.MaxMessageSize)
+	if err != nil {
+		s.onError(err)
+		return
+	}
+	for {
+		if s.config.Timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.config.Timeout))
+		}
+		msg, truncated, err := reader.Next()
+		if err != nil {
+			if !s.isDone() && !isClosedError(err) {
+				s.onError(err)
+			}
+			return
+		}
+		if !handler(string(msg), truncated) {
+			return
+		}
+	}
+}
+
+// isClosedError 连接正常关闭或读超时时不需要记录错误
+func isClosedError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF)
+}
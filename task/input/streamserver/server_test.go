@@ -0,0 +1,119 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package streamserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+func TestServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	connections, rejected := &monitoring.Int{}, &monitoring.Int{}
+	received := make(chan string, 10)
+	s := New(listener, Config{
+		Framing:        framing.Newline,
+		MaxMessageSize: 1024,
+		MaxConnections: 1,
+		Connections:    connections,
+		Rejected:       rejected,
+	}, func(conn net.Conn) (MessageHandler, error) {
+		peer := conn.RemoteAddr().String()
+		return func(msg string, truncated bool) bool {
+			received <- peer + " " + msg
+			return true
+		}, nil
+	}, func(err error) {})
+	s.Start()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello\n"))
+	assert.NoError(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, conn.LocalAddr().String()+" hello", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+	}
+	assert.Equal(t, int64(1), connections.Get())
+
+	// 超过最大连接数后新连接被关闭
+	other, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer other.Close()
+	_ = other.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = other.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, int64(1), rejected.Get())
+
+	// 停止时关闭所有连接
+	s.Stop()
+	assert.Equal(t, int64(0), connections.Get())
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServerConnHandlerError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	errs := make(chan error, 1)
+	s := New(listener, Config{
+		Framing:     framing.Newline,
+		Connections: &monitoring.Int{},
+		Rejected:    &monitoring.Int{},
+	}, func(conn net.Conn) (MessageHandler, error) {
+		return nil, errors.New("handshake failed")
+	}, func(err error) {
+		errs <- err
+	})
+	s.Start()
+	defer s.Stop()
+
+	// 连接准备失败时记录错误并关闭连接
+	conn, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	select {
+	case err = <-errs:
+		assert.EqualError(t, err, "handshake failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait error timeout")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,128 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+const (
+	clientAuthNone     = "none"
+	clientAuthOptional = "optional"
+	clientAuthRequired = "required"
+)
+
+var defaultConfig = config{
+	Host:           "localhost:9000",
+	Framing:        framing.Newline,
+	MaxMessageSize: 1 * humanize.MiByte,
+	MaxConnections: 1000,
+	Timeout:        5 * time.Minute,
+	TLS: tlsConfig{
+		ClientAuth: clientAuthNone,
+	},
+}
+
+type config struct {
+	Host           string        `config:"host"`
+	Framing        string        `config:"framing"`          // 分帧方式：newline、null、octet_counting
+	MaxMessageSize int           `config:"max_message_size"` // 单条消息最大长度，超出部分被截断
+	MaxConnections int           `config:"max_connections"`  // 最大连接数，超出后拒绝新连接，0 表示不限制
+	Timeout        time.Duration `config:"timeout"`          // 连接空闲超时
+	TLS            tlsConfig     `config:"ssl"`
+	ExtTLSSubject  bool          `config:"ext_tls_subject"` // 是否将客户端证书的 subject 附加到 ext
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if err := framing.Validate(c.Framing); err != nil {
+		return err
+	}
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("max_message_size must be greater than 0")
+	}
+	if c.MaxConnections < 0 {
+		return fmt.Errorf("max_connections must not be negative")
+	}
+	return nil
+}
+
+type tlsConfig struct {
+	Enabled                bool     `config:"enabled"`
+	Certificate            string   `config:"certificate"`
+	Key                    string   `config:"key"`
+	CertificateAuthorities []string `config:"certificate_authorities"`
+	ClientAuth             string   `config:"client_authentication"` // 客户端证书认证：none、optional、required
+}
+
+// build 生成服务端 TLS 配置，未开启时返回 nil
+func (c tlsConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.Certificate, c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate error: %v", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(c.CertificateAuthorities) > 0 {
+		pool := x509.NewCertPool()
+		for _, path := range c.CertificateAuthorities {
+			pem, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("load certificate authority error: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("invalid certificate authority: %s", path)
+			}
+		}
+		tlsCfg.ClientCAs = pool
+	}
+
+	switch c.ClientAuth {
+	case "", clientAuthNone:
+		tlsCfg.ClientAuth = tls.NoClientCert
+	case clientAuthOptional:
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case clientAuthRequired:
+		if tlsCfg.ClientCAs == nil {
+			return nil, fmt.Errorf("certificate_authorities is required when client_authentication is required")
+		}
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("client_authentication(%s) is not supported", c.ClientAuth)
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,164 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tcp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const inputName = "tcp"
+
+var (
+	tcpConnections         = bkmonitoring.NewInt("tcp_connections", monitoring.Gauge) // 当前连接数
+	tcpConnectionsRejected = bkmonitoring.NewInt("tcp_connections_rejected")          // 超过最大连接数被拒绝的连接数
+	tcpMessages            = bkmonitoring.NewInt("tcp_messages")                      // 接收的消息数
+	tcpMessagesTruncated   = bkmonitoring.NewInt("tcp_messages_truncated")            // 超过最大长度被截断的消息数
+	tcpErrors              = bkmonitoring.NewInt("tcp_error")                         // 连接异常次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 通过 TCP 接收日志，每条消息附加客户端地址后进入任务的处理流程
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+
+	config config
+	outlet channel.Outleter
+	server *server
+}
+
+// NewInput creates a new tcp input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("%s input ssl config error: %v", inputName, err)
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config: config,
+		outlet: outlet,
+	}
+	p.server = newServer(config, tlsConfig, p.onMessage, func(err error) {
+		tcpErrors.Add(1)
+		logp.Err("%s input(%s) error: %v", inputName, config.Host, err)
+	})
+	return p, nil
+}
+
+// onMessage 将消息转换为采集事件，outlet 阻塞时停止读取，由 TCP 流控实现背压
+func (p *Input) onMessage(msg string, truncated bool, meta connMeta) bool {
+	tcpMessages.Add(1)
+	if truncated {
+		tcpMessagesTruncated.Add(1)
+	}
+
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"data": msg},
+	}
+	// 以客户端地址区分来源，保证同一个打包内的 ext 一致
+	data.SetState(base.NewStatelessState(fmt.Sprintf("%s://%s", inputName, meta.PeerAddr)))
+
+	ext := map[string]interface{}{"peer_addr": meta.PeerAddr}
+	if p.config.ExtTLSSubject && meta.TLSSubject != "" {
+		ext["tls_subject"] = meta.TLSSubject
+	}
+	formatter.SetEventExt(data, ext)
+	return p.outlet.OnEvent(data)
+}
+
+// Run 启动 TCP 服务，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started {
+		return
+	}
+	if err := p.server.Start(); err != nil {
+		tcpErrors.Add(1)
+		logp.Err("%s input listen on %s error: %v", inputName, p.config.Host, err)
+		return
+	}
+	logp.Info("%s input listening on %s, framing: %s", inputName, p.server.Addr(), p.config.Framing)
+	p.started = true
+}
+
+// Stop 关闭监听和所有连接
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input on %s", inputName, p.config.Host)
+	if p.started {
+		p.server.Stop()
+		p.started = false
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
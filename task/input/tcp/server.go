@@ -0,0 +1,115 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tcp
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/streamserver"
+)
+
+// connMeta 连接信息，附加到每条消息的 ext 中
+type connMeta struct {
+	PeerAddr   string
+	TLSSubject string
+}
+
+// handler 处理一条消息，返回 false 时关闭连接
+type handler func(msg string, truncated bool, meta connMeta) bool
+
+// server TCP 服务端，连接管理以及分帧读取见 task/input/streamserver
+type server struct {
+	config    config
+	tlsConfig *tls.Config
+	handler   handler
+	onError   func(err error)
+
+	stream *streamserver.Server
+}
+
+func newServer(config config, tlsConfig *tls.Config, h handler, onError func(err error)) *server {
+	return &server{
+		config:    config,
+		tlsConfig: tlsConfig,
+		handler:   h,
+		onError:   onError,
+	}
+}
+
+// Start 监听端口并开始接收连接
+func (s *server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Host)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.stream = streamserver.New(listener, streamserver.Config{
+		Framing:        s.config.Framing,
+		MaxMessageSize: s.config.MaxMessageSize,
+		MaxConnections: s.config.MaxConnections,
+		Timeout:        s.config.Timeout,
+		Connections:    tcpConnections,
+		Rejected:       tcpConnectionsRejected,
+	}, s.onConn, s.onError)
+	s.stream.Start()
+	return nil
+}
+
+// Addr 返回实际监听的地址
+func (s *server) Addr() net.Addr {
+	return s.stream.Addr()
+}
+
+// Stop 关闭监听以及所有连接，并等待处理结束
+func (s *server) Stop() {
+	if s.stream != nil {
+		s.stream.Stop()
+	}
+}
+
+// onConn TLS 连接先完成握手，连接信息附加到该连接的每条消息中
+func (s *server) onConn(conn net.Conn) (streamserver.MessageHandler, error) {
+	meta := connMeta{PeerAddr: conn.RemoteAddr().String()}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// 握手超时与读超时一致，未配置时不限制；握手完成后清除，避免长连接被断开
+		if s.config.Timeout > 0 {
+			_ = conn.SetDeadline(time.Now().Add(s.config.Timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		_ = conn.SetDeadline(time.Time{})
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			meta.TLSSubject = certs[0].Subject.String()
+		}
+	}
+
+	return func(msg string, truncated bool) bool {
+		return s.handler(msg, truncated, meta)
+	}, nil
+}
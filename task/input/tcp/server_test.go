@@ -0,0 +1,144 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	config := defaultConfig
+	config.Host = "127.0.0.1:0"
+	config.MaxConnections = 1
+
+	var (
+		mtx  sync.Mutex
+		msgs []string
+		meta connMeta
+	)
+	received := make(chan struct{}, 10)
+	s := newServer(config, nil, func(msg string, truncated bool, m connMeta) bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		msgs = append(msgs, msg)
+		meta = m
+		received <- struct{}{}
+		return true
+	}, func(err error) {})
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello\nworld\n"))
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait message timeout")
+		}
+	}
+
+	mtx.Lock()
+	assert.Equal(t, []string{"hello", "world"}, msgs)
+	assert.Equal(t, conn.LocalAddr().String(), meta.PeerAddr)
+	mtx.Unlock()
+
+	// 超过最大连接数后新连接被关闭
+	rejected, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer rejected.Close()
+	_ = rejected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = rejected.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+// selfSignedCert 生成测试使用的自签名证书
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServerTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+
+	for _, timeout := range []time.Duration{0, 500 * time.Millisecond} {
+		config := defaultConfig
+		config.Host = "127.0.0.1:0"
+		config.Timeout = timeout
+
+		received := make(chan string, 10)
+		s := newServer(config, &tls.Config{Certificates: []tls.Certificate{cert}},
+			func(msg string, truncated bool, m connMeta) bool {
+				received <- msg
+				return true
+			}, func(err error) {})
+		assert.NoError(t, s.Start())
+
+		conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if !assert.NoError(t, err, "timeout=%s", timeout) {
+			s.Stop()
+			continue
+		}
+
+		// 持续有数据的连接在超过握手超时后仍然可用
+		for i := 0; i < 3; i++ {
+			_, err = conn.Write([]byte("hello\n"))
+			assert.NoError(t, err)
+			select {
+			case msg := <-received:
+				assert.Equal(t, "hello", msg)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("wait message timeout, timeout=%s", timeout)
+			}
+			time.Sleep(300 * time.Millisecond)
+		}
+		conn.Close()
+		s.Stop()
+	}
+}
@@ -0,0 +1,88 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package unixsocket
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/framing"
+)
+
+const (
+	socketTypeStream   = "stream"
+	socketTypeDatagram = "datagram"
+)
+
+var defaultConfig = config{
+	SocketType:     socketTypeStream,
+	SocketMode:     "0660",
+	Framing:        framing.Newline,
+	MaxMessageSize: 1 * humanize.MiByte,
+	MaxConnections: 1000,
+}
+
+type config struct {
+	Path           string        `config:"path"`             // socket 文件路径
+	SocketType     string        `config:"socket_type"`      // socket 类型：stream、datagram
+	SocketMode     string        `config:"socket_mode"`      // socket 文件权限
+	SocketGroup    string        `config:"socket_group"`     // socket 文件属组，为空时不修改
+	Framing        string        `config:"framing"`          // stream 类型的分帧方式：newline、null、octet_counting
+	MaxMessageSize int           `config:"max_message_size"` // 单条消息最大长度，超出部分被截断
+	MaxConnections int           `config:"max_connections"`  // stream 类型的最大连接数，0 表示不限制
+	Timeout        time.Duration `config:"timeout"`          // stream 类型的连接空闲超时，0 表示不超时
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	switch c.SocketType {
+	case socketTypeStream, socketTypeDatagram:
+	default:
+		return fmt.Errorf("socket_type(%s) is not supported", c.SocketType)
+	}
+	if err := framing.Validate(c.Framing); err != nil {
+		return err
+	}
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("max_message_size must be greater than 0")
+	}
+	if _, err := c.socketFileMode(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *config) socketFileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid socket_mode(%s): %v", c.SocketMode, err)
+	}
+	return os.FileMode(mode), nil
+}
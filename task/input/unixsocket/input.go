@@ -0,0 +1,162 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package unixsocket
+
+import (
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/channel"
+	"github.com/elastic/beats/filebeat/input"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const inputName = "unix"
+
+var (
+	unixConnections         = bkmonitoring.NewInt("unix_connections", monitoring.Gauge) // 当前连接数
+	unixConnectionsRejected = bkmonitoring.NewInt("unix_connections_rejected")          // 超过最大连接数被拒绝的连接数
+	unixMessages            = bkmonitoring.NewInt("unix_messages")                      // 接收的消息数
+	unixMessagesTruncated   = bkmonitoring.NewInt("unix_messages_truncated")            // 超过最大长度被截断的消息数
+	unixErrors              = bkmonitoring.NewInt("unix_error")                         // 读取异常次数
+)
+
+func init() {
+	err := input.Register(inputName, NewInput)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Input 通过 unix socket 接收日志，没有采集进度，不依赖 Registrar
+type Input struct {
+	mutex   sync.Mutex
+	started bool
+
+	config config
+	outlet channel.Outleter
+	server *server
+}
+
+// NewInput creates a new unix socket input
+func NewInput(
+	cfg *common.Config,
+	outletFactory channel.Connector,
+	context input.Context,
+) (input.Input, error) {
+	config := defaultConfig
+	err := cfg.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	outlet, err := outletFactory(cfg, context.DynamicFields)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Input{
+		config: config,
+		outlet: outlet,
+	}
+	p.server = newServer(config, p.onMessage, func(err error) {
+		unixErrors.Add(1)
+		logp.Err("%s input(%s) error: %v", inputName, config.Path, err)
+	})
+	return p, nil
+}
+
+// onMessage 将消息转换为采集事件，outlet 阻塞时停止读取，由 socket 缓冲区实现背压
+func (p *Input) onMessage(msg string, truncated bool, peerAddr string) bool {
+	unixMessages.Add(1)
+	if truncated {
+		unixMessagesTruncated.Add(1)
+	}
+
+	data := util.NewData()
+	data.Event = beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"data": msg},
+	}
+	data.SetState(base.NewStatelessState(inputName + "://" + p.config.Path))
+
+	ext := map[string]interface{}{
+		"socket_path": p.config.Path,
+		"socket_type": p.config.SocketType,
+	}
+	if peerAddr != "" {
+		ext["peer_addr"] = peerAddr
+	}
+	formatter.SetEventExt(data, ext)
+	return p.outlet.OnEvent(data)
+}
+
+// Run 创建 socket 并开始接收，由 input.Runner 周期调用，仅首次生效
+func (p *Input) Run() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.started {
+		return
+	}
+	if err := p.server.Start(); err != nil {
+		unixErrors.Add(1)
+		logp.Err("%s input listen on %s error: %v", inputName, p.config.Path, err)
+		// 启动失败后需要重新创建 server，下个周期重试
+		p.server = newServer(p.config, p.server.handler, p.server.onError)
+		return
+	}
+	logp.Info("%s input listening on %s, type: %s", inputName, p.config.Path, p.config.SocketType)
+	p.started = true
+}
+
+// Stop 关闭 socket 以及所有连接
+func (p *Input) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logp.Info("Stopping %s input on %s", inputName, p.config.Path)
+	if p.started {
+		p.server.Stop()
+		p.started = false
+	}
+	_ = p.outlet.Close()
+}
+
+// Wait stops the input
+func (p *Input) Wait() {
+	p.Stop()
+}
+
+// Reload input 不做处理，配置变化时直接删除新建
+func (p *Input) Reload() {
+	return
+}
@@ -0,0 +1,217 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package unixsocket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/input/streamserver"
+)
+
+const (
+	// 读取持续失败时的退避时间
+	minReadBackoff = 10 * time.Millisecond
+	maxReadBackoff = time.Second
+)
+
+// handler 处理一条消息，返回 false 时停止读取
+type handler func(msg string, truncated bool, peerAddr string) bool
+
+// server 监听 unix socket，stream 类型按连接分帧读取，datagram 类型每个数据包为一条消息
+type server struct {
+	config  config
+	handler handler
+	onError func(err error)
+
+	datagram *net.UnixConn        // datagram 类型的 socket
+	stream   *streamserver.Server // stream 类型的连接管理以及分帧读取，见 task/input/streamserver
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newServer(config config, h handler, onError func(err error)) *server {
+	return &server{
+		config:  config,
+		handler: h,
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 创建 socket 文件并开始接收数据
+func (s *server) Start() error {
+	if err := removeStaleSocket(s.config.Path); err != nil {
+		return err
+	}
+
+	if s.config.SocketType == socketTypeDatagram {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: s.config.Path, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		s.datagram = conn
+		s.wg.Add(1)
+		go s.readDatagram(conn)
+	} else {
+		listener, err := net.Listen("unix", s.config.Path)
+		if err != nil {
+			return err
+		}
+		s.stream = streamserver.New(listener, streamserver.Config{
+			Framing:        s.config.Framing,
+			MaxMessageSize: s.config.MaxMessageSize,
+			MaxConnections: s.config.MaxConnections,
+			Timeout:        s.config.Timeout,
+			Connections:    unixConnections,
+			Rejected:       unixConnectionsRejected,
+		}, s.onConn, s.onError)
+		s.stream.Start()
+	}
+
+	if err := setSocketPermission(s.config); err != nil {
+		s.Stop()
+		return err
+	}
+	return nil
+}
+
+// Stop 关闭 socket 以及所有连接，并等待处理结束
+func (s *server) Stop() {
+	close(s.done)
+	if s.datagram != nil {
+		_ = s.datagram.Close()
+	}
+	if s.stream != nil {
+		s.stream.Stop()
+	}
+	s.wg.Wait()
+	_ = os.Remove(s.config.Path)
+}
+
+func (s *server) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeStaleSocket 清理上次异常退出残留的 socket 文件
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+// setSocketPermission 设置 socket 文件的权限以及属组
+func setSocketPermission(c config) error {
+	mode, err := c.socketFileMode()
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(c.Path, mode); err != nil {
+		return err
+	}
+	if c.SocketGroup == "" {
+		return nil
+	}
+	group, err := user.LookupGroup(c.SocketGroup)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return err
+	}
+	return os.Chown(c.Path, -1, gid)
+}
+
+func (s *server) readDatagram(conn *net.UnixConn) {
+	defer s.wg.Done()
+	buf := make([]byte, s.config.MaxMessageSize+1)
+	var backoff time.Duration
+	for {
+		n, addr, err := conn.ReadFromUnix(buf)
+		if err != nil {
+			if s.isDone() {
+				return
+			}
+			s.onError(err)
+			// socket 已被关闭，无法再读取
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// 持续读取失败时退避，避免空转
+			backoff *= 2
+			if backoff < minReadBackoff {
+				backoff = minReadBackoff
+			} else if backoff > maxReadBackoff {
+				backoff = maxReadBackoff
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		truncated := n > s.config.MaxMessageSize
+		if truncated {
+			n = s.config.MaxMessageSize
+		}
+		msg := strings.TrimRight(string(buf[:n]), "\r\n")
+		peerAddr := ""
+		if addr != nil {
+			peerAddr = addr.Name
+		}
+		if !s.handler(msg, truncated, peerAddr) {
+			return
+		}
+	}
+}
+
+// onConn stream 类型的连接没有对端地址
+func (s *server) onConn(net.Conn) (streamserver.MessageHandler, error) {
+	return func(msg string, truncated bool) bool {
+		return s.handler(msg, truncated, "")
+	}, nil
+}
@@ -0,0 +1,146 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package unixsocket
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startServer(t *testing.T, c config) (*server, chan string) {
+	received := make(chan string, 10)
+	s := newServer(c, func(msg string, truncated bool, peerAddr string) bool {
+		received <- msg
+		return true
+	}, func(err error) {})
+	assert.NoError(t, s.Start())
+	return s, received
+}
+
+func waitMessage(t *testing.T, received chan string) string {
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait message timeout")
+		return ""
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.sock")
+	c.SocketMode = "0600"
+	s, received := startServer(t, c)
+
+	info, err := os.Stat(c.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	conn, err := net.Dial("unix", c.Path)
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("line1\nline2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "line1", waitMessage(t, received))
+	assert.Equal(t, "line2", waitMessage(t, received))
+	conn.Close()
+
+	// 停止后删除 socket 文件
+	s.Stop()
+	_, err = os.Stat(c.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServerDatagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.sock")
+	c.SocketType = socketTypeDatagram
+	c.MaxMessageSize = 8
+
+	// 残留的 socket 文件会被清理
+	stale, err := net.Listen("unix", c.Path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s, received := startServer(t, c)
+	defer s.Stop()
+
+	conn, err := net.Dial("unixgram", c.Path)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("message1\n"))
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("a very long message"))
+	assert.NoError(t, err)
+	assert.Equal(t, "message1", waitMessage(t, received))
+	assert.Equal(t, "a very l", waitMessage(t, received))
+}
+
+func TestServerDatagramClosed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := defaultConfig
+	c.Path = filepath.Join(dir, "app.sock")
+	c.SocketType = socketTypeDatagram
+
+	var errCount int32
+	s := newServer(c, func(msg string, truncated bool, peerAddr string) bool {
+		return true
+	}, func(err error) {
+		atomic.AddInt32(&errCount, 1)
+	})
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	// socket 异常关闭后停止读取，不会持续报错
+	assert.NoError(t, s.datagram.Close())
+	exited := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait read exit timeout")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&errCount))
+}
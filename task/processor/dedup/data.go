@@ -0,0 +1,153 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dedup
+
+import (
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input/file"
+	"github.com/elastic/beats/filebeat/util"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/monitoring"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/config"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+)
+
+var (
+	dedupSuppressed = bkmonitoring.NewInt("dedup_suppressed")                // 被合并的重复行数
+	dedupSummaries  = bkmonitoring.NewInt("dedup_summaries")                 // 输出的汇总行数
+	dedupEntries    = bkmonitoring.NewInt("dedup_entries", monitoring.Gauge) // 正在跟踪的行数
+)
+
+// Dedup 处理节点中的重复行合并，单行事件按 data 字段合并，多行文本(Texts)逐行合并
+type Dedup struct {
+	deduplicator *Deduplicator
+
+	// 每个文件最新的采集进度，汇总行使用该进度，避免采集进度回退
+	states  map[string]file.State
+	tracked int // 已上报到 dedup_entries 的跟踪行数
+}
+
+// New 创建重复行合并
+func New(c config.DedupConfig) *Dedup {
+	return &Dedup{
+		deduplicator: NewDeduplicator(c.Window, c.MaxEntries, c.Normalize),
+		states:       map[string]file.State{},
+	}
+}
+
+// Handle 处理事件，返回 false 时事件中的数据已全部被合并，事件不需要继续发送
+// 跟踪的行数超出限制而提前结束的周期，其汇总在返回的事件之前发送
+func (d *Dedup) Handle(data *util.Data, now time.Time) (bool, []*util.Data) {
+	state := data.GetState()
+	dataID := base.GetRouteDataID(&data.Event)
+	var summaries []Summary
+	defer d.updateEntries()
+
+	if data.Event.HasTexts() {
+		texts := data.Event.GetTexts()
+		kept := make([]string, 0, len(texts))
+		for _, text := range texts {
+			keep, evicted := d.deduplicator.Add(state.Source, dataID, text, true, now)
+			summaries = append(summaries, evicted...)
+			if keep {
+				kept = append(kept, text)
+			} else {
+				dedupSuppressed.Add(1)
+			}
+		}
+		d.track(state)
+		if len(kept) == 0 {
+			return false, d.toData(summaries, now)
+		}
+		data.Event.Texts = kept
+		return true, d.toData(summaries, now)
+	}
+
+	line, ok := data.Event.Fields["data"].(string)
+	if !ok {
+		return true, nil
+	}
+	keep, summaries := d.deduplicator.Add(state.Source, dataID, line, false, now)
+	d.track(state)
+	if !keep {
+		dedupSuppressed.Add(1)
+	}
+	return keep, d.toData(summaries, now)
+}
+
+// Expire 结束所有已到期的周期，返回汇总事件
+func (d *Dedup) Expire(now time.Time) []*util.Data {
+	defer d.updateEntries()
+	return d.toData(d.deduplicator.Expire(now), now)
+}
+
+// track 记录文件最新的采集进度
+func (d *Dedup) track(state file.State) {
+	if d.deduplicator.Tracking(state.Source) {
+		d.states[state.Source] = state
+	}
+}
+
+// toData 生成汇总事件，不再有跟踪的行的文件不再记录采集进度
+func (d *Dedup) toData(summaries []Summary, now time.Time) []*util.Data {
+	if len(summaries) == 0 {
+		return nil
+	}
+	result := make([]*util.Data, 0, len(summaries))
+	for _, summary := range summaries {
+		line := FormatSummary(summary)
+		data := util.NewData()
+		if summary.Texts {
+			data.Event = beat.Event{Timestamp: now, Texts: []string{line}}
+		} else {
+			data.Event = beat.Event{Timestamp: now, Fields: common.MapStr{"data": line}}
+		}
+		// 汇总行发送到被合并的行路由的 dataid
+		if summary.DataID > 0 {
+			base.SetRouteDataID(&data.Event, summary.DataID)
+		}
+		state, ok := d.states[summary.Source]
+		if !ok {
+			state = base.NewStatelessState(summary.Source)
+		}
+		data.SetState(state)
+		result = append(result, data)
+		dedupSummaries.Add(1)
+	}
+	for source := range d.states {
+		if !d.deduplicator.Tracking(source) {
+			delete(d.states, source)
+		}
+	}
+	return result
+}
+
+func (d *Dedup) updateEntries() {
+	n := d.deduplicator.Len()
+	dedupEntries.Add(int64(n - d.tracked))
+	d.tracked = n
+}
@@ -0,0 +1,258 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dedup
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSampleBytes 汇总中保留的首行内容的最大长度，限制跟踪的内存
+const maxSampleBytes = 1024
+
+// Summary 一个周期内被合并的重复行
+type Summary struct {
+	Source string
+	DataID int    // 路由的目标 dataid，没有路由时为 0
+	Line   string // 周期内第一次出现的行，超出 maxSampleBytes 时截断
+	Texts  bool   // 原始数据是否为多行文本(Texts)
+	Count  int    // 被合并的行数，不包括已输出的第一行
+	First  time.Time
+	Last   time.Time
+}
+
+// entry 一个正在跟踪的行
+type entry struct {
+	key     uint64
+	summary Summary
+	start   time.Time // 第一次出现的时间，周期从此开始
+}
+
+// Deduplicator 在时间窗口内合并相同的行，仅在处理节点的 Run 中使用，非并发安全
+// 周期从第一次出现开始，因此跟踪的行按创建顺序即为周期结束的顺序
+type Deduplicator struct {
+	window     time.Duration
+	maxEntries int
+	normalize  bool
+
+	entries map[uint64]*list.Element
+	order   *list.List     // *entry，按创建时间排序
+	sources map[string]int // 每个文件正在跟踪的行数
+}
+
+// NewDeduplicator 创建重复行合并
+func NewDeduplicator(window time.Duration, maxEntries int, normalize bool) *Deduplicator {
+	return &Deduplicator{
+		window:     window,
+		maxEntries: maxEntries,
+		normalize:  normalize,
+		entries:    map[uint64]*list.Element{},
+		order:      list.New(),
+		sources:    map[string]int{},
+	}
+}
+
+// Add 处理一行数据，返回是否需要输出；跟踪的行数超出限制时提前结束最早的周期，返回其汇总
+// 同一行路由到多个 dataid 时各自合并，dataID 为路由的目标 dataid，没有路由时为 0
+func (d *Deduplicator) Add(source string, dataID int, line string, texts bool, now time.Time) (bool, []Summary) {
+	key := d.key(source, dataID, line)
+	if elem, ok := d.entries[key]; ok {
+		e := elem.Value.(*entry)
+		if now.Sub(e.start) < d.window {
+			if e.summary.Count == 0 {
+				e.summary.First = now
+			}
+			e.summary.Count++
+			e.summary.Last = now
+			return false, nil
+		}
+		// 周期已结束但还未清理，先结束该周期再重新开始
+		summaries := d.remove(elem, nil)
+		return true, d.track(key, source, dataID, line, texts, now, summaries)
+	}
+	return true, d.track(key, source, dataID, line, texts, now, nil)
+}
+
+// FormatSummary 汇总行的内容
+func FormatSummary(s Summary) string {
+	return fmt.Sprintf("last message repeated %d times between %s and %s: %s",
+		s.Count, s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339), s.Line)
+}
+
+// Expire 结束所有已到期的周期，返回有重复行的汇总
+func (d *Deduplicator) Expire(now time.Time) []Summary {
+	var summaries []Summary
+	for elem := d.order.Front(); elem != nil; elem = d.order.Front() {
+		if now.Sub(elem.Value.(*entry).start) < d.window {
+			break
+		}
+		summaries = d.remove(elem, summaries)
+	}
+	return summaries
+}
+
+// Len 正在跟踪的行数
+func (d *Deduplicator) Len() int {
+	return d.order.Len()
+}
+
+// Tracking 文件是否有正在跟踪的行
+func (d *Deduplicator) Tracking(source string) bool {
+	return d.sources[source] > 0
+}
+
+func (d *Deduplicator) track(key uint64, source string, dataID int, line string, texts bool, now time.Time, summaries []Summary) []Summary {
+	for d.order.Len() >= d.maxEntries {
+		summaries = d.remove(d.order.Front(), summaries)
+	}
+	e := &entry{
+		key:     key,
+		start:   now,
+		summary: Summary{Source: source, DataID: dataID, Line: truncate(line), Texts: texts},
+	}
+	d.entries[key] = d.order.PushBack(e)
+	d.sources[source]++
+	return summaries
+}
+
+func (d *Deduplicator) remove(elem *list.Element, summaries []Summary) []Summary {
+	e := d.order.Remove(elem).(*entry)
+	delete(d.entries, e.key)
+	if d.sources[e.summary.Source]--; d.sources[e.summary.Source] <= 0 {
+		delete(d.sources, e.summary.Source)
+	}
+	if e.summary.Count > 0 {
+		summaries = append(summaries, e.summary)
+	}
+	return summaries
+}
+
+// key 文件、路由的目标 dataid 与(归一化后的)行内容的哈希，只保存哈希值以限制内存
+func (d *Deduplicator) key(source string, dataID int, line string) uint64 {
+	if d.normalize {
+		line = Normalize(line)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(source))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(strconv.Itoa(dataID)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(line))
+	return h.Sum64()
+}
+
+// Normalize 将行中的数字及十六进制 ID 替换为占位符，使仅有数字、ID 不同的行被视为相同
+// 0x 开头、长度不少于 8 或长度不少于 4 且同时包含数字和字母的十六进制串(如 UUID 的各段)替换为 <hex>，
+// 其余的连续数字替换为 <num>
+func Normalize(line string) string {
+	var b strings.Builder
+	b.Grow(len(line))
+	for i := 0; i < len(line); {
+		if !isAlnum(line[i]) {
+			b.WriteByte(line[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && isAlnum(line[j]) {
+			j++
+		}
+		writeWord(&b, line[i:j])
+		i = j
+	}
+	return b.String()
+}
+
+func writeWord(b *strings.Builder, word string) {
+	if isHexID(word) {
+		b.WriteString("<hex>")
+		return
+	}
+	for i := 0; i < len(word); {
+		if !isDigit(word[i]) {
+			b.WriteByte(word[i])
+			i++
+			continue
+		}
+		for i < len(word) && isDigit(word[i]) {
+			i++
+		}
+		b.WriteString("<num>")
+	}
+}
+
+func isHexID(word string) bool {
+	if len(word) > 2 && word[0] == '0' && (word[1] == 'x' || word[1] == 'X') {
+		return isHex(word[2:])
+	}
+	if len(word) < 4 || !isHex(word) {
+		return false
+	}
+	if len(word) >= 8 {
+		return true
+	}
+	hasDigit, hasLetter := false, false
+	for i := 0; i < len(word); i++ {
+		if isDigit(word[i]) {
+			hasDigit = true
+		} else {
+			hasLetter = true
+		}
+	}
+	return hasDigit && hasLetter
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isDigit(c) && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// truncate 截断到 maxSampleBytes，不截断多字节字符
+func truncate(line string) string {
+	if len(line) <= maxSampleBytes {
+		return line
+	}
+	end := maxSampleBytes
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end] + "..."
+}
@@ -0,0 +1,153 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dedup
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"connect to 10.0.0.1:8080 failed":                  "connect to <num>.<num>.<num>.<num>:<num> failed",
+		"request 9f86d081884c7d65 took 35ms":               "request <hex> took <num>ms",
+		"ptr=0x7ffd5e8c nil":                               "ptr=<hex> nil",
+		"trace 550e8400-e29b-41d4-a716-446655440000 error": "trace <hex>-<hex>-<hex>-<hex>-<hex> error",
+		"deadbeef coffee":                                  "<hex> coffee",
+		"order 20210304123456 dead":                        "order <hex> dead",
+		"错误码 500，重试 3 次":                                   "错误码 <num>，重试 <num> 次",
+	}
+	for line, expected := range cases {
+		assert.Equal(t, expected, Normalize(line), line)
+	}
+	assert.Equal(t, Normalize("user 1001 login failed"), Normalize("user 1002 login failed"))
+}
+
+func TestDeduplicator(t *testing.T) {
+	d := NewDeduplicator(10*time.Second, 100, true)
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	keep, evicted := d.Add("/var/log/a.log", 0, "panic: id 1", false, start)
+	assert.True(t, keep)
+	assert.Empty(t, evicted)
+
+	// 周期内相同(归一化后)的行被合并，不同文件、不同内容的行不受影响
+	for i := 1; i <= 5; i++ {
+		keep, _ = d.Add("/var/log/a.log", 0, "panic: id 2", false, start.Add(time.Duration(i)*time.Second))
+		assert.False(t, keep)
+	}
+	keep, _ = d.Add("/var/log/b.log", 0, "panic: id 1", false, start.Add(time.Second))
+	assert.True(t, keep)
+	keep, _ = d.Add("/var/log/a.log", 0, "started", false, start.Add(time.Second))
+	assert.True(t, keep)
+	assert.Equal(t, 3, d.Len())
+	assert.True(t, d.Tracking("/var/log/a.log"))
+
+	assert.Empty(t, d.Expire(start.Add(9*time.Second)))
+	summaries := d.Expire(start.Add(11 * time.Second))
+	// 没有重复行的周期不输出汇总
+	assert.Equal(t, []Summary{{
+		Source: "/var/log/a.log",
+		Line:   "panic: id 1",
+		Count:  5,
+		First:  start.Add(time.Second),
+		Last:   start.Add(5 * time.Second),
+	}}, summaries)
+	assert.Equal(t, 0, d.Len())
+	assert.False(t, d.Tracking("/var/log/a.log"))
+
+	// 周期结束后再次出现时重新输出
+	keep, _ = d.Add("/var/log/a.log", 0, "panic: id 3", false, start.Add(12*time.Second))
+	assert.True(t, keep)
+}
+
+func TestDeduplicatorExpiredOnAdd(t *testing.T) {
+	d := NewDeduplicator(time.Second, 100, false)
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	d.Add("a", 0, "line", true, start)
+	d.Add("a", 0, "line", true, start.Add(500*time.Millisecond))
+	// 未清理的已到期周期，再次出现时先输出汇总
+	keep, summaries := d.Add("a", 0, "line", true, start.Add(2*time.Second))
+	assert.True(t, keep)
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, 1, summaries[0].Count)
+	assert.True(t, summaries[0].Texts)
+	assert.Equal(t, 1, d.Len())
+
+	// 未开启归一化时数字不同的行不合并
+	keep, _ = d.Add("a", 0, "line 2", true, start.Add(2*time.Second))
+	assert.True(t, keep)
+}
+
+func TestDeduplicatorMaxEntries(t *testing.T) {
+	d := NewDeduplicator(time.Minute, 2, false)
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	d.Add("a", 0, "first", false, start)
+	d.Add("a", 0, "first", false, start.Add(time.Second))
+	d.Add("a", 0, "second", false, start.Add(time.Second))
+
+	// 超出限制时提前结束最早的周期
+	keep, summaries := d.Add("a", 0, "third", false, start.Add(2*time.Second))
+	assert.True(t, keep)
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, "first", summaries[0].Line)
+	assert.Equal(t, 2, d.Len())
+
+	// 只保留有限长度的首行内容
+	long := strings.Repeat("中", maxSampleBytes)
+	d.Add("b", 0, long, false, start)
+	d.Add("b", 0, long, false, start.Add(time.Second))
+	summaries = d.Expire(start.Add(2 * time.Minute))
+	assert.Len(t, summaries, 1)
+	assert.True(t, len(summaries[0].Line) <= maxSampleBytes+3)
+	assert.True(t, strings.HasSuffix(summaries[0].Line, "中..."))
+}
+
+func TestDeduplicatorRouted(t *testing.T) {
+	d := NewDeduplicator(time.Minute, 10, false)
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	// 同一行路由到多个 dataid 时各自合并
+	keep, _ := d.Add("a", 1001, "panic", false, start)
+	assert.True(t, keep)
+	keep, _ = d.Add("a", 1002, "panic", false, start)
+	assert.True(t, keep)
+	keep, _ = d.Add("a", 1001, "panic", false, start.Add(time.Second))
+	assert.False(t, keep)
+
+	summaries := d.Expire(start.Add(time.Minute))
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, 1001, summaries[0].DataID)
+	assert.Equal(t, 1, summaries[0].Count)
+}
+
+func TestFormatSummary(t *testing.T) {
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	line := FormatSummary(Summary{Line: "panic: id 1", Count: 5, First: start, Last: start.Add(5 * time.Second)})
+	assert.Equal(t, "last message repeated 5 times between 2021-03-04T12:00:00Z and 2021-03-04T12:00:05Z: panic: id 1", line)
+}
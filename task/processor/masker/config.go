@@ -0,0 +1,65 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package masker
+
+import "fmt"
+
+var defaultConfig = config{
+	Fields: []string{"data"},
+}
+
+type config struct {
+	Fields []string     `config:"fields"` // 单行事件中脱敏的字段，多行文本(Texts)逐行脱敏
+	Rules  []ruleConfig `config:"rules"`  // 为空时使用全部内置规则
+	Salt   string       `config:"salt"`   // hash 方式使用的盐，为空时使用本机生成并保存在 path.data/mask_salt 中的盐
+	DataID int          `config:"dataid"` // 任务的 dataid，由处理节点创建时写入，用于按 dataid 上报指标
+}
+
+type ruleConfig struct {
+	Name     string `config:"name"`      // 规则名称，用于 mask_matched_<name> 指标，默认为 type
+	Type     string `config:"type"`      // phone、id_card、bank_card、email、token、password、regex
+	Pattern  string `config:"pattern"`   // regex 类型的正则
+	Group    int    `config:"group"`     // regex 类型只处理该分组匹配的内容，0 为整个匹配
+	Template string `config:"template"`  // regex 类型按模板替换整个匹配，如 ${1}***，配置后 action 不生效
+	Action   string `config:"action"`    // partial、hash、redact，默认按类型选择
+	KeepLast int    `config:"keep_last"` // partial 方式保留的字符数，默认 4
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if len(c.Fields) == 0 {
+		return fmt.Errorf("fields is required")
+	}
+	names := map[string]bool{}
+	for _, rule := range c.Rules {
+		name := rule.Name
+		if name == "" {
+			name = rule.Type
+		}
+		if names[name] {
+			return fmt.Errorf("rule name(%s) is duplicated", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package masker
+
+import (
+	"regexp"
+)
+
+// 内置的识别规则
+const (
+	TypePhone    = "phone"     // 手机号
+	TypeIDCard   = "id_card"   // 身份证号，校验末位校验码
+	TypeBankCard = "bank_card" // 银行卡号，Luhn 校验
+	TypeEmail    = "email"     // 邮箱
+	TypeToken    = "token"     // token、api_key、secret 等键值对的值以及 Bearer token
+	TypePassword = "password"  // password、passwd、pwd 等键值对的值
+	TypeRegex    = "regex"     // 自定义正则
+)
+
+// detector 识别需要脱敏的内容，返回每处内容在文本中的起止位置
+type detector func(text string) [][2]int
+
+var (
+	phoneRegex    = regexp.MustCompile(`(?:\+?86[- ]?)?1[3-9]\d{9}`)
+	idCardRegex   = regexp.MustCompile(`\d{17}[\dXx]`)
+	bankCardRegex = regexp.MustCompile(`\d{4}(?:[ -]\d{4}){2,3}(?:[ -]\d{1,3})?|\d{13,19}`)
+	emailRegex    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	tokenRegexes  = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:access[_-]?token|refresh[_-]?token|api[_-]?key|access[_-]?key|secret[_-]?key|secret|token)["']?\s*[:=]\s*` + quotedValue),
+		regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	}
+	passwordRegex = regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)["']?\s*[:=]\s*` + quotedValue)
+)
+
+// quotedValue 键值对的值，带引号时取引号内的全部内容
+const quotedValue = `(?:"([^"]*)"|'([^']*)'|([^\s"'&,;]+))`
+
+// builtinDetectors 内置的识别规则
+var builtinDetectors = map[string]detector{
+	TypePhone:    digitsDetector(phoneRegex, nil),
+	TypeIDCard:   digitsDetector(idCardRegex, validIDCard),
+	TypeBankCard: digitsDetector(bankCardRegex, validLuhn),
+	TypeEmail:    regexDetector(emailRegex, 0),
+	TypeToken:    multiDetector(regexDetector(tokenRegexes[0], anyGroup), regexDetector(tokenRegexes[1], 1)),
+	TypePassword: regexDetector(passwordRegex, anyGroup),
+}
+
+// digitsDetector 识别数字串，前后紧邻其他数字时不是完整的号码，不做处理
+func digitsDetector(re *regexp.Regexp, valid func(digits string) bool) detector {
+	return func(text string) [][2]int {
+		var spans [][2]int
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] > 0 && isDigit(text[loc[0]-1]) {
+				continue
+			}
+			if loc[1] < len(text) && isDigit(text[loc[1]]) {
+				continue
+			}
+			if valid != nil && !valid(digitsOf(text[loc[0]:loc[1]])) {
+				continue
+			}
+			spans = append(spans, [2]int{loc[0], loc[1]})
+		}
+		return spans
+	}
+}
+
+// anyGroup 处理第一个匹配到的分组
+const anyGroup = -1
+
+// regexDetector 识别正则匹配的内容，group 大于 0 时只处理对应的分组
+func regexDetector(re *regexp.Regexp, group int) detector {
+	return func(text string) [][2]int {
+		var spans [][2]int
+		for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+			g := group
+			if g == anyGroup {
+				g = firstGroup(loc)
+			}
+			start, end := loc[2*g], loc[2*g+1]
+			if start < 0 || start == end {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+		}
+		return spans
+	}
+}
+
+// firstGroup 第一个匹配到的分组，都没有匹配时返回最后一个分组
+func firstGroup(loc []int) int {
+	g := 1
+	for g < len(loc)/2-1 && loc[2*g] < 0 {
+		g++
+	}
+	return g
+}
+
+func multiDetector(detectors ...detector) detector {
+	return func(text string) [][2]int {
+		var spans [][2]int
+		for _, d := range detectors {
+			spans = append(spans, d(text)...)
+		}
+		return spans
+	}
+}
+
+// validLuhn Luhn 校验
+func validLuhn(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var (
+	idCardWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idCardChecks  = "10X98765432"
+)
+
+// validIDCard 18 位身份证号的校验码校验(GB 11643)
+func validIDCard(digits string) bool {
+	if len(digits) != 18 {
+		return false
+	}
+	sum := 0
+	for i, w := range idCardWeights {
+		sum += int(digits[i]-'0') * w
+	}
+	check := digits[17]
+	if check == 'x' {
+		check = 'X'
+	}
+	return idCardChecks[sum%11] == check
+}
+
+// digitsOf 去掉号码中的分隔符，身份证号末位的 X 保留
+func digitsOf(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if isDigit(s[i]) || s[i] == 'X' || s[i] == 'x' {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,265 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package masker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+// 脱敏方式
+const (
+	ActionPartial = "partial" // 只保留最后 keep_last 个字符，其余替换为 *
+	ActionHash    = "hash"    // 替换为加盐后的哈希值，相同内容结果相同，便于关联分析
+	ActionRedact  = "redact"  // 替换为 ******
+)
+
+const redactText = "******"
+
+// defaultActions 内置规则默认的脱敏方式
+var defaultActions = map[string]string{
+	TypePhone:    ActionPartial,
+	TypeIDCard:   ActionPartial,
+	TypeBankCard: ActionPartial,
+	TypeEmail:    ActionHash,
+	TypeToken:    ActionRedact,
+	TypePassword: ActionRedact,
+	TypeRegex:    ActionRedact,
+}
+
+// defaultRules 未配置规则时使用全部内置规则，先匹配的规则优先
+var defaultRules = []string{TypeIDCard, TypeBankCard, TypeEmail, TypePhone, TypeToken, TypePassword}
+
+// matchedMetrics 每个 dataid 每条规则的命中指标，多个处理节点或重新加载时共用，只创建一次
+var (
+	matchedMetrics   = map[string]*monitoring.Int{}
+	matchedMetricMtx sync.Mutex
+)
+
+// matchedMetric 获取规则的命中指标 mask_matched_<name>，按 dataid 上报
+func matchedMetric(dataID int, name string) *monitoring.Int {
+	key := fmt.Sprintf("%d/%s", dataID, name)
+	matchedMetricMtx.Lock()
+	defer matchedMetricMtx.Unlock()
+	metric, ok := matchedMetrics[key]
+	if !ok {
+		metric = bkmonitoring.NewIntWithDataID(dataID, "mask_matched_"+name)
+		matchedMetrics[key] = metric
+	}
+	return metric
+}
+
+// rule 一条脱敏规则
+type rule struct {
+	name     string
+	detect   detector
+	regex    *regexp.Regexp // 配置了 template 时按模板替换整个匹配
+	template string
+	action   string
+	keepLast int
+	matched  *monitoring.Int
+}
+
+// replacement 一处需要替换的内容
+type replacement struct {
+	start, end int
+	text       string
+}
+
+// Masker 按规则对文本脱敏，规则之间没有状态，可以并发使用
+type Masker struct {
+	rules []*rule
+	salt  []byte
+}
+
+// NewMasker 创建脱敏器，dataID 用于上报规则的命中指标，salt 用于 hash 方式
+func NewMasker(dataID int, configs []ruleConfig, salt []byte) (*Masker, error) {
+	if len(configs) == 0 {
+		for _, t := range defaultRules {
+			configs = append(configs, ruleConfig{Type: t})
+		}
+	}
+	m := &Masker{salt: salt}
+	for _, c := range configs {
+		r, err := newRule(c)
+		if err != nil {
+			return nil, err
+		}
+		r.matched = matchedMetric(dataID, r.name)
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+func newRule(c ruleConfig) (*rule, error) {
+	r := &rule{
+		name:     c.Name,
+		action:   c.Action,
+		keepLast: c.KeepLast,
+		template: c.Template,
+	}
+	if r.name == "" {
+		r.name = c.Type
+	}
+	if r.action == "" {
+		r.action = defaultActions[c.Type]
+	}
+	if r.keepLast <= 0 {
+		r.keepLast = 4
+	}
+	switch r.action {
+	case ActionPartial, ActionHash, ActionRedact:
+	default:
+		return nil, fmt.Errorf("rule(%s) action(%s) is not supported", r.name, r.action)
+	}
+
+	if c.Type == TypeRegex {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule(%s) pattern(%s) is invalid: %v", r.name, c.Pattern, err)
+		}
+		if c.Group < 0 || c.Group > re.NumSubexp() {
+			return nil, fmt.Errorf("rule(%s) group(%d) is out of range", r.name, c.Group)
+		}
+		r.regex = re
+		r.detect = regexDetector(re, c.Group)
+	} else {
+		detect, ok := builtinDetectors[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("rule(%s) type(%s) is not supported", r.name, c.Type)
+		}
+		if c.Template != "" {
+			return nil, fmt.Errorf("rule(%s) template is only supported with type(regex)", r.name)
+		}
+		r.detect = detect
+	}
+	return r, nil
+}
+
+// Mask 对文本脱敏，所有规则均在原始文本上匹配，与先匹配的规则重叠的内容不再处理
+func (m *Masker) Mask(text string) (string, bool) {
+	var replacements []replacement
+	for _, r := range m.rules {
+		count := 0
+		for _, rep := range r.find(text, m.salt) {
+			if overlaps(replacements, rep) {
+				continue
+			}
+			replacements = append(replacements, rep)
+			count++
+		}
+		if count > 0 {
+			r.matched.Add(int64(count))
+		}
+	}
+	if len(replacements) == 0 {
+		return text, false
+	}
+
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start < replacements[j].start })
+	var b strings.Builder
+	b.Grow(len(text))
+	last := 0
+	for _, rep := range replacements {
+		b.WriteString(text[last:rep.start])
+		b.WriteString(rep.text)
+		last = rep.end
+	}
+	b.WriteString(text[last:])
+	return b.String(), true
+}
+
+// find 识别文本中需要替换的内容
+func (r *rule) find(text string, salt []byte) []replacement {
+	if r.template != "" {
+		var result []replacement
+		for _, loc := range r.regex.FindAllStringSubmatchIndex(text, -1) {
+			dst := r.regex.ExpandString(nil, r.template, text, loc)
+			result = append(result, replacement{start: loc[0], end: loc[1], text: string(dst)})
+		}
+		return result
+	}
+
+	spans := r.detect(text)
+	if len(spans) == 0 {
+		return nil
+	}
+	result := make([]replacement, 0, len(spans))
+	for _, span := range spans {
+		result = append(result, replacement{
+			start: span[0],
+			end:   span[1],
+			text:  r.mask(text[span[0]:span[1]], salt),
+		})
+	}
+	return result
+}
+
+// mask 按脱敏方式处理
+func (r *rule) mask(value string, salt []byte) string {
+	switch r.action {
+	case ActionPartial:
+		return partial(value, r.keepLast)
+	case ActionHash:
+		mac := hmac.New(sha256.New, salt)
+		_, _ = mac.Write([]byte(value))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return redactText
+	}
+}
+
+// partial 保留最后 keep 个字符，其余替换为 *
+func partial(value string, keep int) string {
+	n := utf8.RuneCountInString(value)
+	if n <= keep {
+		return strings.Repeat("*", n)
+	}
+	i := 0
+	for pos := range value {
+		if i == n-keep {
+			return strings.Repeat("*", n-keep) + value[pos:]
+		}
+		i++
+	}
+	return value
+}
+
+func overlaps(replacements []replacement, rep replacement) bool {
+	for _, r := range replacements {
+		if rep.start < r.end && r.start < rep.end {
+			return true
+		}
+	}
+	return false
+}
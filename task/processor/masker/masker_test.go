@@ -0,0 +1,171 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package masker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.True(t, validLuhn("4111111111111111"))
+	assert.True(t, validLuhn("6222021234567894"))
+	assert.False(t, validLuhn("6222021234567890"))
+	assert.False(t, validLuhn("411111111111"))
+
+	assert.True(t, validIDCard("11010519491231002X"))
+	assert.True(t, validIDCard("11010519491231002x"))
+	assert.True(t, validIDCard("440308199901011234"))
+	assert.False(t, validIDCard("440308199901011235"))
+}
+
+func TestMaskBuiltin(t *testing.T) {
+	m, err := NewMasker(0, nil, []byte("salt"))
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		"user 13812345678 login":                       "user *******5678 login",
+		"tel:+86 13812345678.":                         "tel:***********5678.",
+		"id=440308199901011234 name=foo":               "id=**************1234 name=foo",
+		"id=440308199901011235 name=foo":               "id=440308199901011235 name=foo",
+		"pay with 6222 0212 3456 7894 ok":              "pay with ***************7894 ok",
+		"card 4111111111111111, order 123456789":       "card ************1111, order 123456789",
+		"card 4111111111111112":                        "card 4111111111111112",
+		"token=abc.def-123&uid=1":                      "token=******&uid=1",
+		`{"api_key": "AKIDz8krbsJ5yKBZQpn74WFkmLPx3"}`: `{"api_key": "******"}`,
+		"Authorization: Bearer eyJhbGciOi.J9.abc==":    "Authorization: Bearer ******",
+		"login failed, password: 'p@ss word'":          "login failed, password: '******'",
+		`db "passwd":"s3 cr=t" retry`:                  `db "passwd":"******" retry`,
+		"PWD=hunter2 retry":                            "PWD=****** retry",
+		// 前后紧邻数字时不是完整的号码
+		"order 213812345678901":  "order 213812345678901",
+		"nothing sensitive here": "nothing sensitive here",
+	}
+	for text, expected := range cases {
+		masked, changed := m.Mask(text)
+		assert.Equal(t, expected, masked, text)
+		assert.Equal(t, expected != text, changed, text)
+	}
+
+	// 邮箱默认替换为加盐的哈希值，相同的邮箱结果相同，优先于其中的手机号
+	first, _ := m.Mask("from 13812345678@qq.com")
+	second, _ := m.Mask("to 13812345678@qq.com")
+	assert.True(t, strings.HasPrefix(first, "from sha256:"))
+	assert.Equal(t, strings.TrimPrefix(first, "from "), strings.TrimPrefix(second, "to "))
+	assert.NotContains(t, first, "5678")
+
+	other, err := NewMasker(0, nil, []byte("another host"))
+	assert.NoError(t, err)
+	third, _ := other.Mask("from 13812345678@qq.com")
+	assert.NotEqual(t, first, third)
+}
+
+func TestMaskCustomRules(t *testing.T) {
+	m, err := NewMasker(0, []ruleConfig{
+		{Name: "session", Type: TypeRegex, Pattern: `session=(\w+)`, Group: 1, Action: ActionPartial, KeepLast: 2},
+		{Name: "ip", Type: TypeRegex, Pattern: `(\d+)\.(\d+)\.\d+\.\d+`, Template: "${1}.${2}.*.*"},
+		{Type: TypePhone, Action: ActionRedact},
+	}, []byte("salt"))
+	assert.NoError(t, err)
+
+	masked, changed := m.Mask("session=abcdef from 10.1.2.3 phone 13812345678")
+	assert.True(t, changed)
+	assert.Equal(t, "session=****ef from 10.1.*.* phone ******", masked)
+
+	// \w 不匹配中文，保持原样
+	masked, changed = m.Mask("用户 session=会话")
+	assert.False(t, changed)
+	assert.Equal(t, "用户 session=会话", masked)
+
+	for _, configs := range [][]ruleConfig{
+		{{Type: "unknown"}},
+		{{Type: TypeRegex, Pattern: "("}},
+		{{Type: TypeRegex, Pattern: "a(b)", Group: 2}},
+		{{Type: TypePhone, Action: "encrypt"}},
+		{{Type: TypePhone, Template: "***"}},
+	} {
+		_, err = NewMasker(0, configs, nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestPartial(t *testing.T) {
+	assert.Equal(t, "*******5678", partial("13812345678", 4))
+	assert.Equal(t, "***", partial("abc", 4))
+	assert.Equal(t, "**标识符", partial("会话标识符", 3))
+}
+
+func TestLoadSalt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mask_salt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// 目录不存在时创建，再次读取时使用已生成的盐
+	path := filepath.Join(dir, "data", saltFile)
+	salt, err := loadSalt(path)
+	assert.NoError(t, err)
+	assert.Len(t, salt, 64)
+	again, err := loadSalt(path)
+	assert.NoError(t, err)
+	assert.Equal(t, salt, again)
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGetHostSalt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mask_salt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { hostSalt = nil }()
+
+	// 数据目录暂时不可写时返回错误，不缓存失败的结果
+	blocked := filepath.Join(dir, "data")
+	assert.NoError(t, ioutil.WriteFile(blocked, []byte("x"), 0644))
+	path := filepath.Join(blocked, saltFile)
+	_, err = getHostSalt(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Remove(blocked))
+	salt, err := getHostSalt(path)
+	assert.NoError(t, err)
+	assert.Len(t, salt, 64)
+
+	// 成功后使用缓存的盐
+	again, err := getHostSalt(filepath.Join(dir, "other", saltFile))
+	assert.NoError(t, err)
+	assert.Equal(t, salt, again)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := config{Fields: []string{"data"}, Rules: []ruleConfig{{Type: TypePhone}, {Type: TypePhone}}}
+	assert.Error(t, c.Validate())
+	c.Rules[1].Name = "mobile"
+	assert.NoError(t, c.Validate())
+	c.Fields = nil
+	assert.Error(t, c.Validate())
+}
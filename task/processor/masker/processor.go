@@ -0,0 +1,161 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package masker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+const processorName = "mask"
+
+// saltFile 本机生成的盐保存的文件，相同主机上的结果保持一致
+const saltFile = "mask_salt"
+
+// 本机的盐在进程内读取或生成成功后缓存，多个任务同时创建时不会各自生成不同的盐
+// 失败时不缓存，之后创建的 processor 重新读取
+var (
+	saltMtx  sync.Mutex
+	hostSalt []byte
+)
+
+func init() {
+	processors.RegisterPlugin(processorName, newProcessor)
+}
+
+// maskProcessor 对事件中的敏感信息脱敏，单行事件处理配置的字段，多行文本(Texts)逐行处理
+type maskProcessor struct {
+	config config
+	masker *Masker
+}
+
+func newProcessor(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %s processor configuration: %v", processorName, err)
+	}
+	salt := []byte(config.Salt)
+	if len(salt) == 0 {
+		var err error
+		if salt, err = getHostSalt(paths.Resolve(paths.Data, saltFile)); err != nil {
+			return nil, err
+		}
+	}
+	masker, err := NewMasker(config.DataID, config.Rules, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &maskProcessor{config: config, masker: masker}, nil
+}
+
+// Run 处理事件，字段不存在或不是字符串时不做处理
+func (p *maskProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	if event.HasTexts() {
+		texts := event.GetTexts()
+		masked := make([]string, len(texts))
+		for i, text := range texts {
+			masked[i], _ = p.masker.Mask(text)
+		}
+		event.Texts = masked
+		return event, nil
+	}
+
+	for _, field := range p.config.Fields {
+		value, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if masked, changed := p.masker.Mask(text); changed {
+			_, _ = event.PutValue(field, masked)
+		}
+	}
+	return event, nil
+}
+
+func (p *maskProcessor) String() string {
+	names := make([]string, 0, len(p.masker.rules))
+	for _, r := range p.masker.rules {
+		names = append(names, r.name)
+	}
+	return fmt.Sprintf("%s=[fields=%v, rules=%s]", processorName, p.config.Fields, strings.Join(names, ","))
+}
+
+// getHostSalt 获取缓存的本机的盐，未缓存时读取或生成
+func getHostSalt(path string) ([]byte, error) {
+	saltMtx.Lock()
+	defer saltMtx.Unlock()
+	if hostSalt != nil {
+		return hostSalt, nil
+	}
+	salt, err := loadSalt(path)
+	if err != nil {
+		return nil, err
+	}
+	hostSalt = salt
+	return salt, nil
+}
+
+// loadSalt 读取本机的盐，不存在时生成，写入临时文件后重命名，避免写入一半的盐
+func loadSalt(path string) ([]byte, error) {
+	salt, err := ioutil.ReadFile(path)
+	if err == nil && len(salt) > 0 {
+		return salt, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read mask salt(%s) failed: %v", path, err)
+	}
+
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return nil, fmt.Errorf("generate mask salt failed: %v", err)
+	}
+	salt = []byte(hex.EncodeToString(random))
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create mask salt dir(%s) failed: %v", filepath.Dir(path), err)
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, salt, 0600); err != nil {
+		return nil, fmt.Errorf("write mask salt(%s) failed: %v", tmp, err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("write mask salt(%s) failed: %v", path, err)
+	}
+	logp.Info("mask salt is generated in %s", path)
+	return salt, nil
+}
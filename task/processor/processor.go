@@ -25,6 +25,7 @@ package processor
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
 	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
@@ -34,6 +35,7 @@ import (
 
 	"github.com/TencentBlueKing/bkunifylogbeat/config"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/processor/dedup"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/sender"
 )
 
@@ -52,6 +54,9 @@ type Processors struct {
 	*base.Node
 
 	processors *process.Processors
+
+	dedup         *dedup.Dedup  // 重复行合并，未开启时为 nil
+	dedupInterval time.Duration // 检查合并周期是否结束的间隔
 }
 
 // GetProcessors 获取processor
@@ -93,6 +98,13 @@ func NewProcessors(taskCfg *config.TaskConfig, taskNode *base.TaskNode) (*Proces
 
 		processors: nil,
 	}
+	if taskCfg.Dedup.Enabled {
+		p.dedup = dedup.New(taskCfg.Dedup)
+		p.dedupInterval = time.Second
+		if taskCfg.Dedup.Window < p.dedupInterval {
+			p.dedupInterval = taskCfg.Dedup.Window
+		}
+	}
 	err = p.MergeProcessorsConfig(taskCfg)
 	if err != nil {
 		return nil, err
@@ -129,6 +141,10 @@ func RemoveProcessors(id string) {
 func (p *Processors) MergeProcessorsConfig(taskCfg *config.TaskConfig) error {
 	var err error
 	if p.processors == nil && taskCfg.Processors != nil {
+		err = setProcessorsDataID(taskCfg)
+		if err != nil {
+			return err
+		}
 		p.processors, err = process.New(taskCfg.Processors)
 		if err != nil {
 			return fmt.Errorf("create libbeat.processors faied, err=>%v", err)
@@ -137,39 +153,93 @@ func (p *Processors) MergeProcessorsConfig(taskCfg *config.TaskConfig) error {
 	return nil
 }
 
+// setProcessorsDataID 按 dataid 上报指标的 processor(如 mask)从配置中获取任务的 dataid
+// 配置了 mask 的任务不与其他 dataid 的任务共享处理节点，见 config/task.go initIDWithConfig
+func setProcessorsDataID(taskCfg *config.TaskConfig) error {
+	for _, cfg := range taskCfg.Processors {
+		if !cfg.HasField("mask") {
+			continue
+		}
+		err := cfg.SetInt("mask.dataid", -1, int64(taskCfg.DataID))
+		if err != nil {
+			return fmt.Errorf("set dataid of processor(mask) failed, err=>%v", err)
+		}
+	}
+	return nil
+}
+
 // Run 循环处理数据
 func (p *Processors) Run() {
 	defer close(p.GameOver)
 	defer RemoveProcessors(p.ID)
+
+	// 未开启重复行合并时 expire 为 nil，不会触发
+	var expire <-chan time.Time
+	if p.dedup != nil {
+		ticker := time.NewTicker(p.dedupInterval)
+		defer ticker.Stop()
+		expire = ticker.C
+	}
+
 	for {
 		select {
 		case <-p.End:
 			// node is done
 			return
+		case now := <-expire:
+			for _, summary := range p.dedup.Expire(now) {
+				if !p.output(summary) {
+					return
+				}
+			}
 		case e := <-p.In:
 			data := e.(*util.Data)
 			event := p.Handle(&data.Event)
-			if event != nil {
-				for _, out := range p.GetOuts() {
-					select {
-					case <-p.End:
-						logp.L.Infof("node processor(%s) is done", p.ID)
-						return
-					case out <- data:
-						processHandledTotal.Add(1)
-					}
-				}
-			} else {
+			if event == nil {
 				processDroppedTotal.Add(1)
 				p.ForEachTaskNode(func(tNode *base.TaskNode) {
 					base.CrawlerDropped.Add(1)
 					tNode.CrawlerDropped.Add(1)
 				})
+				// 由回调确认的 state 继续发送，保证被丢弃的消息得到确认
+				if stateData := base.DroppedStateData(data.GetState()); stateData != nil && !p.output(stateData) {
+					return
+				}
+				continue
+			}
+			// 仅更新采集进度的事件不参与合并
+			if p.dedup != nil && (event.Fields != nil || event.HasTexts()) {
+				keep, summaries := p.dedup.Handle(data, time.Now())
+				for _, summary := range summaries {
+					if !p.output(summary) {
+						return
+					}
+				}
+				if !keep {
+					continue
+				}
+			}
+			if !p.output(data) {
+				return
 			}
 		}
 	}
 }
 
+// output 发送到所有下游节点，节点结束时返回 false
+func (p *Processors) output(data *util.Data) bool {
+	for _, out := range p.GetOuts() {
+		select {
+		case <-p.End:
+			logp.L.Infof("node processor(%s) is done", p.ID)
+			return false
+		case out <- data:
+			processHandledTotal.Add(1)
+		}
+	}
+	return true
+}
+
 // Handle 处理采集事件
 func (p *Processors) Handle(event *beat.Event) *beat.Event {
 	if event.Fields == nil {
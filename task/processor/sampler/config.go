@@ -0,0 +1,96 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package sampler
+
+import (
+	"fmt"
+	"time"
+)
+
+// 采样方式
+const (
+	ModeRate  = "rate"  // 按固定比例随机采样
+	ModeHash  = "hash"  // 按 key 的哈希值采样，相同 key 的数据同时保留或丢弃
+	ModeQuota = "quota" // 每个 key 在每个周期内最多保留 quota 行
+)
+
+var defaultConfig = config{
+	Mode:        ModeRate,
+	Rate:        1,
+	Field:       "data",
+	Delimiter:   "|",
+	QuotaPeriod: 1 * time.Minute,
+	MaxKeys:     10000,
+}
+
+type config struct {
+	Mode  string  `config:"mode"`
+	Rate  float64 `config:"rate"`  // rate、hash 方式下保留的比例，(0, 1]
+	Field string  `config:"field"` // 单行事件中采样的字段
+
+	// 采样的 key：按分隔符切分后的第 index 列(从 1 开始)，或者 JSON 格式数据中的字段，支持以 . 分隔的多级字段
+	Delimiter string `config:"delimiter"`
+	Index     int    `config:"index"`
+	JSONKey   string `config:"json_key"`
+
+	Quota       int           `config:"quota"`        // quota 方式下每个 key 每个周期最多保留的行数
+	QuotaPeriod time.Duration `config:"quota_period"` // 配额周期
+	MaxKeys     int           `config:"max_keys"`     // 每个周期最多统计的 key 数量，超出后新的 key 共享同一个配额
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	switch c.Mode {
+	case ModeRate, ModeHash:
+		if c.Rate <= 0 || c.Rate > 1 {
+			return fmt.Errorf("rate(%v) must be in (0, 1]", c.Rate)
+		}
+	case ModeQuota:
+		if c.Quota <= 0 || c.QuotaPeriod <= 0 {
+			return fmt.Errorf("quota and quota_period must be greater than 0")
+		}
+		if c.MaxKeys <= 0 {
+			return fmt.Errorf("max_keys must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("mode(%s) is not supported", c.Mode)
+	}
+	if c.Index < 0 {
+		return fmt.Errorf("index(%d) must not be negative", c.Index)
+	}
+	if c.Index > 0 && c.Delimiter == "" {
+		return fmt.Errorf("delimiter is required when index is set")
+	}
+	if c.Mode == ModeHash && !c.hasKey() {
+		return fmt.Errorf("index or json_key is required in hash mode")
+	}
+	if c.Field == "" {
+		return fmt.Errorf("field is required")
+	}
+	return nil
+}
+
+// hasKey 是否配置了采样的 key
+func (c *config) hasKey() bool {
+	return c.Index > 0 || c.JSONKey != ""
+}
@@ -0,0 +1,120 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package sampler
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+
+	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
+)
+
+const processorName = "sample"
+
+func init() {
+	processors.RegisterPlugin(processorName, newProcessor)
+}
+
+// sampleProcessor 对数据采样，单行事件整体保留或丢弃，多行文本(Texts)逐行采样
+// 保留的每个事件都在 ext 中记录采样率，打包时按全部事件计算整体的采样率
+type sampleProcessor struct {
+	config  config
+	sampler *Sampler
+}
+
+func newProcessor(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %s processor configuration: %v", processorName, err)
+	}
+	return &sampleProcessor{config: config, sampler: NewSampler(config)}, nil
+}
+
+// Run 处理事件，事件中没有保留的数据时丢弃整个事件
+func (p *sampleProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	if event.HasTexts() {
+		return p.runTexts(event), nil
+	}
+
+	var (
+		keep bool
+		rate float64
+	)
+	value, err := event.GetValue(p.config.Field)
+	if line, ok := value.(string); err == nil && ok {
+		keep, rate = p.sampler.Sample(line)
+	} else {
+		keep, rate = p.sampler.SampleKey(p.fieldKey(event))
+	}
+	if !keep {
+		return nil, nil
+	}
+	p.putRate(event, rate)
+	return event, nil
+}
+
+// runTexts 逐行采样，事件的采样率为保留行数与估计的原始行数之比
+func (p *sampleProcessor) runTexts(event *beat.Event) *beat.Event {
+	texts := event.GetTexts()
+	kept := make([]string, 0, len(texts))
+	var origin float64
+	for _, text := range texts {
+		keep, rate := p.sampler.Sample(text)
+		if !keep {
+			continue
+		}
+		kept = append(kept, text)
+		origin += 1 / rate
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	event.Texts = kept
+	p.putRate(event, float64(len(kept))/origin)
+	return event
+}
+
+// fieldKey 采样字段不是字符串时(如结构化的事件)，json_key 直接从事件字段中获取
+func (p *sampleProcessor) fieldKey(event *beat.Event) (string, bool) {
+	if p.config.JSONKey == "" {
+		return "", false
+	}
+	value, err := event.GetValue(p.config.JSONKey)
+	if err != nil || value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// putRate 记录采样率，全部保留时同样记录，避免打包时与其他事件的采样率混淆
+func (p *sampleProcessor) putRate(event *beat.Event, rate float64) {
+	formatter.PutEventExt(event, formatter.SampleRateKey, rate)
+}
+
+func (p *sampleProcessor) String() string {
+	return fmt.Sprintf("%s=[mode=%s, rate=%v, index=%d, json_key=%s, quota=%d, quota_period=%s]", processorName,
+		p.config.Mode, p.config.Rate, p.config.Index, p.config.JSONKey, p.config.Quota, p.config.QuotaPeriod)
+}
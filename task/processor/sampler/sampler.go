@@ -0,0 +1,221 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package sampler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+)
+
+// overflowKey key 数量超过 max_keys 后新的 key 共享的配额
+const overflowKey = "__overflow__"
+
+// minElapsedFraction 周期开始不久时按已过时间推算行数的误差较大，至少按周期的 10% 推算
+const minElapsedFraction = 0.1
+
+var (
+	sampleKept          = bkmonitoring.NewInt("sample_kept")           // 采样保留的行数
+	sampleDropped       = bkmonitoring.NewInt("sample_dropped")        // 采样丢弃的行数
+	sampleQuotaOverflow = bkmonitoring.NewInt("sample_quota_overflow") // key 数量超过 max_keys 而共享配额的行数
+)
+
+// quotaCount 一个 key 在当前周期内的行数
+type quotaCount struct {
+	seen int
+	kept int
+}
+
+// Sampler 按配置判断每行数据是否保留，并给出保留时的采样率
+type Sampler struct {
+	config config
+	random func() float64
+	now    func() time.Time
+
+	mtx         sync.Mutex
+	windowStart time.Time
+	counts      map[string]*quotaCount
+	previous    map[string]int // 上个周期每个 key 的行数，用于估计当前周期的行数
+}
+
+// NewSampler 创建采样器
+func NewSampler(c config) *Sampler {
+	return &Sampler{
+		config:   c,
+		random:   rand.Float64,
+		now:      time.Now,
+		counts:   map[string]*quotaCount{},
+		previous: map[string]int{},
+	}
+}
+
+// Sample 按行内容采样，返回是否保留以及保留时的采样率
+func (s *Sampler) Sample(line string) (bool, float64) {
+	key, ok := s.keyOf(line)
+	return s.SampleKey(key, ok)
+}
+
+// SampleKey 按 key 采样，ok 为 false 表示数据中没有 key
+// hash 方式下没有 key 的数据按比例随机采样，quota 方式下没有 key 的数据共享同一个配额
+func (s *Sampler) SampleKey(key string, ok bool) (bool, float64) {
+	var (
+		keep bool
+		rate = s.config.Rate
+	)
+	switch s.config.Mode {
+	case ModeHash:
+		if ok {
+			keep = hashRatio(key) < s.config.Rate
+		} else {
+			keep = s.random() < s.config.Rate
+		}
+	case ModeQuota:
+		keep, rate = s.quota(key)
+	default:
+		keep = s.random() < s.config.Rate
+	}
+
+	if keep {
+		sampleKept.Add(1)
+	} else {
+		sampleDropped.Add(1)
+	}
+	return keep, rate
+}
+
+// quota 按 key 的配额采样，采样率为配额与该 key 在当前周期内估计的行数之比
+func (s *Sampler) quota(key string) (bool, float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= s.config.QuotaPeriod {
+		s.rotate(now)
+	}
+
+	count, ok := s.counts[key]
+	if !ok {
+		if len(s.counts) >= s.config.MaxKeys {
+			key = overflowKey
+			sampleQuotaOverflow.Add(1)
+			count = s.counts[key]
+		}
+		if count == nil {
+			count = &quotaCount{}
+			s.counts[key] = count
+		}
+	}
+	count.seen++
+	if count.kept >= s.config.Quota {
+		return false, 0
+	}
+	count.kept++
+	return true, s.quotaRate(key, count.seen, now)
+}
+
+// quotaRate 估计 key 在当前周期内的行数：按已过时间推算的行数与上个周期的行数中较大者，
+// 因此首个超出配额的周期内保留的数据同样给出小于 1 的采样率
+func (s *Sampler) quotaRate(key string, seen int, now time.Time) float64 {
+	fraction := float64(now.Sub(s.windowStart)) / float64(s.config.QuotaPeriod)
+	if fraction < minElapsedFraction {
+		fraction = minElapsedFraction
+	}
+	expected := float64(seen) / fraction
+	if previous := float64(s.previous[key]); previous > expected {
+		expected = previous
+	}
+	if expected <= float64(s.config.Quota) {
+		return 1
+	}
+	return float64(s.config.Quota) / expected
+}
+
+// rotate 进入新的周期，记录上个周期每个 key 的行数
+// 中间有周期没有数据时，上个周期的行数不再有参考意义
+func (s *Sampler) rotate(now time.Time) {
+	previous := map[string]int{}
+	if now.Sub(s.windowStart) < 2*s.config.QuotaPeriod {
+		for key, count := range s.counts {
+			previous[key] = count.seen
+		}
+	}
+	s.previous = previous
+	s.counts = make(map[string]*quotaCount, len(s.counts))
+	s.windowStart = now.Truncate(s.config.QuotaPeriod)
+}
+
+// keyOf 从行内容中提取采样的 key
+func (s *Sampler) keyOf(line string) (string, bool) {
+	if s.config.Index > 0 {
+		words := strings.SplitN(line, s.config.Delimiter, s.config.Index+1)
+		if len(words) < s.config.Index {
+			return "", false
+		}
+		return strings.TrimSpace(words[s.config.Index-1]), true
+	}
+	if s.config.JSONKey != "" {
+		// 数字保留原始格式，避免较大的 ID 被转换为科学计数法
+		var fields map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return "", false
+		}
+		return lookup(fields, s.config.JSONKey)
+	}
+	return "", false
+}
+
+// lookup 获取以 . 分隔的多级字段
+func lookup(fields map[string]interface{}, key string) (string, bool) {
+	var value interface{} = fields
+	for _, name := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = m[name]; !ok {
+			return "", false
+		}
+	}
+	if value == nil {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(value), true
+}
+
+// hashRatio 将 key 映射到 [0, 1)，不同机器上相同的 key 结果一致
+func hashRatio(key string) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
@@ -0,0 +1,195 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package sampler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSampler(c config) *Sampler {
+	base := defaultConfig
+	base.Mode = c.Mode
+	if c.Rate > 0 {
+		base.Rate = c.Rate
+	}
+	base.Index = c.Index
+	base.JSONKey = c.JSONKey
+	base.Quota = c.Quota
+	if c.MaxKeys > 0 {
+		base.MaxKeys = c.MaxKeys
+	}
+	return NewSampler(base)
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := []config{
+		{Mode: ModeRate, Rate: 0.1, Field: "data"},
+		{Mode: ModeHash, Rate: 1, Field: "data", Delimiter: "|", Index: 2},
+		{Mode: ModeHash, Rate: 0.5, Field: "data", JSONKey: "trace_id"},
+		{Mode: ModeQuota, Quota: 100, QuotaPeriod: time.Minute, MaxKeys: 10, Field: "data"},
+	}
+	for _, c := range valid {
+		assert.NoError(t, c.Validate(), fmt.Sprintf("%+v", c))
+	}
+
+	invalid := []config{
+		{Mode: "random", Rate: 0.1, Field: "data"},
+		{Mode: ModeRate, Rate: 0, Field: "data"},
+		{Mode: ModeRate, Rate: 1.5, Field: "data"},
+		{Mode: ModeHash, Rate: 0.1, Field: "data"},
+		{Mode: ModeHash, Rate: 0.1, Field: "data", Index: 1},
+		{Mode: ModeQuota, QuotaPeriod: time.Minute, MaxKeys: 10, Field: "data"},
+		{Mode: ModeRate, Rate: 0.1},
+	}
+	for _, c := range invalid {
+		assert.Error(t, c.Validate(), fmt.Sprintf("%+v", c))
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	s := newTestSampler(config{Mode: ModeRate, Rate: 0.25})
+	values := []float64{0.1, 0.3, 0.2, 0.9}
+	s.random = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+
+	var kept []bool
+	for i := 0; i < 4; i++ {
+		keep, rate := s.Sample("line")
+		assert.Equal(t, 0.25, rate)
+		kept = append(kept, keep)
+	}
+	assert.Equal(t, []bool{true, false, true, false}, kept)
+}
+
+func TestSampleHash(t *testing.T) {
+	s := newTestSampler(config{Mode: ModeHash, Rate: 0.1, Index: 2})
+	s.random = func() float64 { panic("lines with key should not be randomly sampled") }
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		traceID := fmt.Sprintf("trace-%d", i)
+		first, rate := s.Sample(fmt.Sprintf("INFO|%s|begin", traceID))
+		second, _ := s.Sample(fmt.Sprintf("DEBUG | %s | end", traceID))
+		// 相同 trace 的数据同时保留或丢弃
+		assert.Equal(t, first, second, traceID)
+		assert.Equal(t, 0.1, rate)
+		if first {
+			kept++
+		}
+	}
+	assert.InDelta(t, 1000, kept, 150)
+
+	// 没有 key 的数据按比例随机采样
+	s.random = func() float64 { return 0.05 }
+	keep, _ := s.Sample("no delimiter")
+	assert.True(t, keep)
+}
+
+func TestSampleQuota(t *testing.T) {
+	s := newTestSampler(config{Mode: ModeQuota, Quota: 2, Index: 1})
+	now := time.Date(2021, 3, 4, 12, 0, 30, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	sample := func(line string) (bool, float64) {
+		return s.Sample(line)
+	}
+
+	// 第一个周期过半：E1 共 4 行保留 2 行，按已过时间推算超出配额时采样率小于 1；E2 共 1 行
+	for i, expected := range []struct {
+		keep bool
+		rate float64
+	}{{true, 1}, {true, 0.5}, {false, 0}, {false, 0}} {
+		keep, rate := sample("E1|timeout")
+		assert.Equal(t, expected.keep, keep, i)
+		assert.Equal(t, expected.rate, rate, i)
+	}
+	keep, rate := sample("E2|refused")
+	assert.True(t, keep)
+	assert.Equal(t, 1.0, rate)
+
+	// 第二个周期：E1 按上个周期的行数估计，E2 未超出配额
+	now = now.Add(time.Minute)
+	keep, rate = sample("E1|timeout")
+	assert.True(t, keep)
+	assert.Equal(t, 0.5, rate)
+	keep, rate = sample("E2|refused")
+	assert.True(t, keep)
+	assert.Equal(t, 1.0, rate)
+
+	// 中间间隔了一个周期，之前的行数不再使用
+	now = now.Add(2 * time.Minute)
+	keep, rate = sample("E1|timeout")
+	assert.True(t, keep)
+	assert.Equal(t, 1.0, rate)
+
+	// 周期刚开始时至少按周期的 10% 推算
+	now = now.Add(time.Minute).Truncate(time.Minute)
+	for i := 0; i < 2; i++ {
+		keep, rate = sample("E3|burst")
+		assert.True(t, keep)
+	}
+	assert.Equal(t, 0.1, rate)
+}
+
+func TestSampleQuotaMaxKeys(t *testing.T) {
+	s := newTestSampler(config{Mode: ModeQuota, Quota: 1, Index: 1, MaxKeys: 2})
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for _, line := range []string{"E1|a", "E2|b", "E3|c"} {
+		keep, _ := s.Sample(line)
+		assert.True(t, keep, line)
+	}
+	// 超出 max_keys 的 key 共享同一个配额
+	keep, _ := s.Sample("E4|d")
+	assert.False(t, keep)
+	assert.Len(t, s.counts, 3)
+}
+
+func TestKeyOf(t *testing.T) {
+	s := newTestSampler(config{Mode: ModeHash, JSONKey: "trace.id"})
+	key, ok := s.keyOf(`{"trace": {"id": 12345678901234567890}, "msg": "hello"}`)
+	assert.True(t, ok)
+	assert.Equal(t, "12345678901234567890", key)
+	key, ok = s.keyOf(`{"trace": {"id": "abc"}}`)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", key)
+	for _, line := range []string{`{"trace": "abc"}`, `{"trace": {"id": null}}`, `not json`} {
+		_, ok = s.keyOf(line)
+		assert.False(t, ok, line)
+	}
+
+	s = newTestSampler(config{Mode: ModeHash, Index: 3})
+	key, ok = s.keyOf("a|b| c |d")
+	assert.True(t, ok)
+	assert.Equal(t, "c", key)
+	_, ok = s.keyOf("a|b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,67 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package syslogparser
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultConfig = config{
+	Field:  "data",
+	Target: "syslog",
+	Format: FormatAuto,
+}
+
+type config struct {
+	Field          string `config:"field"`           // 待解析的字段，beats syslog 采集为 message
+	Target         string `config:"target"`          // 解析结果写入的字段，为空时写入事件顶层
+	Format         string `config:"format"`          // auto、rfc5424、rfc3164
+	Timezone       string `config:"timezone"`        // RFC3164 中不带时区的时间所使用的时区，默认为本地时区
+	ReplaceMessage bool   `config:"replace_message"` // 解析成功时以消息内容替换原字段
+}
+
+// Validate 校验配置
+func (c *config) Validate() error {
+	if c.Field == "" {
+		return fmt.Errorf("field is required")
+	}
+	if _, err := NewParser(c.Format, nil); err != nil {
+		return err
+	}
+	if _, err := c.location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone(%s): %v", c.Timezone, err)
+	}
+	return loc, nil
+}
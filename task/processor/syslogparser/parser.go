@@ -0,0 +1,590 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package syslogparser 解析 RFC5424 以及 RFC3164 格式(含常见设备厂商的变体)的 syslog 消息
+package syslogparser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FormatAuto    = "auto"
+	FormatRFC5424 = "rfc5424"
+	FormatRFC3164 = "rfc3164"
+)
+
+const nilValue = "-"
+
+var (
+	errEmpty       = errors.New("empty message")
+	errMissingPri  = errors.New("missing priority")
+	errMissingTime = errors.New("missing timestamp")
+	errInvalidPri  = errors.New("invalid priority")
+	errNotRFC5424  = errors.New("not a rfc5424 message")
+	errInvalidSD   = errors.New("invalid structured data")
+	errInvalidTime = errors.New("invalid timestamp")
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityNames = []string{
+	"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug",
+}
+
+// FacilityName 返回 facility 名称，未知时返回空
+func FacilityName(facility int) string {
+	if facility < 0 || facility >= len(facilityNames) {
+		return ""
+	}
+	return facilityNames[facility]
+}
+
+// SeverityName 返回 severity 名称，未知时返回空
+func SeverityName(severity int) string {
+	if severity < 0 || severity >= len(severityNames) {
+		return ""
+	}
+	return severityNames[severity]
+}
+
+// Message 解析后的 syslog 消息，不存在的字段为零值
+type Message struct {
+	Format         string
+	Priority       int
+	Version        int
+	Sequence       string // Cisco 设备在时间前输出的序号
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// Facility 由 PRI 计算
+func (m *Message) Facility() int {
+	return m.Priority / 8
+}
+
+// Severity 由 PRI 计算
+func (m *Message) Severity() int {
+	return m.Priority % 8
+}
+
+// Parser syslog 解析器
+type Parser struct {
+	format   string
+	location *time.Location
+	now      func() time.Time
+}
+
+// NewParser 创建解析器，location 为 RFC3164 中不带时区的时间所使用的时区
+func NewParser(format string, location *time.Location) (*Parser, error) {
+	switch format {
+	case "":
+		format = FormatAuto
+	case FormatAuto, FormatRFC5424, FormatRFC3164:
+	default:
+		return nil, fmt.Errorf("syslog format(%s) is not supported", format)
+	}
+	if location == nil {
+		location = time.Local
+	}
+	return &Parser{format: format, location: location, now: time.Now}, nil
+}
+
+// Parse 解析一行 syslog 消息
+func (p *Parser) Parse(line string) (*Message, error) {
+	line = strings.TrimRight(line, "\r\n\x00")
+	if line == "" {
+		return nil, errEmpty
+	}
+
+	if line[0] != '<' {
+		return nil, errMissingPri
+	}
+	pri, rest, err := parsePriority(line)
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{Priority: pri}
+
+	switch {
+	case p.format == FormatRFC5424:
+		err = p.parseRFC5424(m, rest)
+	case p.format == FormatRFC3164:
+		err = p.parseRFC3164(m, rest)
+	case looksLikeRFC5424(rest):
+		err = p.parseRFC5424(m, rest)
+	default:
+		err = p.parseRFC3164(m, rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parsePriority 解析 <PRI>，取值范围 0~191
+func parsePriority(line string) (int, string, error) {
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errInvalidPri
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", errInvalidPri
+	}
+	return pri, line[end+1:], nil
+}
+
+// looksLikeRFC5424 PRI 之后为 "版本号 空格 时间或 -"
+func looksLikeRFC5424(s string) bool {
+	i := 0
+	for i < len(s) && i < 3 && isDigit(s[i]) {
+		i++
+	}
+	if i == 0 || i > 2 || s[0] == '0' || i+1 >= len(s) || s[i] != ' ' {
+		return false
+	}
+	return s[i+1] == '-' || isDigit(s[i+1])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// nextField 读取以空格分隔的下一个字段
+func nextField(s string) (string, string) {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func nilToEmpty(s string) string {
+	if s == nilValue {
+		return ""
+	}
+	return s
+}
+
+// parseRFC5424 VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+func (p *Parser) parseRFC5424(m *Message, s string) error {
+	m.Format = FormatRFC5424
+	if !looksLikeRFC5424(s) {
+		return errNotRFC5424
+	}
+
+	var field string
+	field, s = nextField(s)
+	m.Version, _ = strconv.Atoi(field)
+
+	field, s = nextField(s)
+	if field != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, field)
+		if err != nil {
+			return errInvalidTime
+		}
+		m.Timestamp = t
+	}
+
+	fields := make([]string, 3)
+	field, s = nextField(s)
+	m.Hostname = nilToEmpty(field)
+	for i := range fields {
+		fields[i], s = nextField(s)
+	}
+	m.AppName, m.ProcID, m.MsgID = nilToEmpty(fields[0]), nilToEmpty(fields[1]), nilToEmpty(fields[2])
+
+	switch {
+	case strings.HasPrefix(s, nilValue+" ") || s == nilValue:
+		s = strings.TrimPrefix(s, nilValue)
+	case strings.HasPrefix(s, "["):
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		m.StructuredData, s = sd, rest
+	default:
+		// 部分设备在没有结构化数据时省略了 "-"，剩余内容均作为消息
+		m.Message = strings.TrimPrefix(s, "\xef\xbb\xbf")
+		return nil
+	}
+
+	s = strings.TrimPrefix(s, " ")
+	m.Message = strings.TrimPrefix(s, "\xef\xbb\xbf")
+	return nil
+}
+
+// parseStructuredData 解析一个或多个 [SD-ID PARAM-NAME="PARAM-VALUE" ...]
+// 参数值中的 \" \\ \] 需要转义
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", errInvalidSD
+		}
+		id := s[:end]
+		s = s[end:]
+		params, ok := sd[id]
+		if !ok {
+			params = make(map[string]string)
+			sd[id] = params
+		}
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if s == "" {
+				return nil, "", errInvalidSD
+			}
+			if s[0] == ']' {
+				s = s[1:]
+				break
+			}
+			eq := strings.IndexByte(s, '=')
+			if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+				return nil, "", errInvalidSD
+			}
+			name := s[:eq]
+			value, rest, err := parseParamValue(s[eq+2:])
+			if err != nil {
+				return nil, "", err
+			}
+			if _, exists := params[name]; !exists {
+				params[name] = value
+			}
+			s = rest
+		}
+	}
+	return sd, s, nil
+}
+
+// parseParamValue 读取到未转义的 " 为止
+func parseParamValue(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+				sb.WriteByte(s[i])
+				continue
+			}
+			sb.WriteByte(c)
+		case '"':
+			return sb.String(), s[i+1:], nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", errInvalidSD
+}
+
+// parseRFC3164 解析 TIMESTAMP HOSTNAME TAG: MSG，缺少时间或时间格式错误时返回错误，兼容以下变体：
+//   - Cisco：时间前的序号 "123: "、时间前的 * 或 . 标记、毫秒以及 "UTC:" 时区
+//   - 时间中带年份，如 "Mar  4 2021 05:06:07" 或 "Mar  4 05:06:07 2021"
+//   - RFC3339 格式的时间，如 rsyslog 的 RSYSLOG_ForwardFormat
+//   - 缺少主机名，时间之后直接为 TAG
+//   - Fortinet 的 key=value 格式，时间取自开头的 date、time 字段，全部内容作为消息
+func (p *Parser) parseRFC3164(m *Message, s string) error {
+	m.Format = FormatRFC3164
+	s = strings.TrimLeft(s, " ")
+
+	// Cisco 序号
+	if i := strings.Index(s, ": "); i > 0 && isAllDigits(s[:i]) {
+		m.Sequence = s[:i]
+		s = s[i+2:]
+	}
+
+	if strings.HasPrefix(s, "date=") {
+		t, ok := p.parseKeyValueTimestamp(s)
+		if !ok {
+			return errInvalidTime
+		}
+		m.Timestamp = t
+		m.Message = s
+		return nil
+	}
+
+	t, rest, ok := p.parseBSDTimestamp(s)
+	if !ok {
+		if looksLikeTimestamp(s) {
+			return errInvalidTime
+		}
+		return errMissingTime
+	}
+	m.Timestamp = t
+	s = rest
+	if s != "" && !looksLikeTag(s) {
+		m.Hostname, s = nextField(s)
+	}
+
+	s = strings.TrimLeft(s, " ")
+	m.AppName, m.ProcID, s = parseTag(s)
+	m.Message = s
+	return nil
+}
+
+func isAllDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// looksLikeTimestamp 以数字或月份开头(Cisco 可能带 * 或 . 标记)时视为时间，用于区分时间缺失与格式错误
+func looksLikeTimestamp(s string) bool {
+	s = strings.TrimLeft(s, "*.")
+	if s != "" && isDigit(s[0]) {
+		return true
+	}
+	if len(s) < 3 {
+		return false
+	}
+	_, ok := months[strings.ToLower(s[:3])]
+	return ok
+}
+
+// looksLikeTag 判断时间之后的字段是否为 TAG 而不是主机名
+func looksLikeTag(s string) bool {
+	field, _ := nextField(s)
+	return strings.HasSuffix(field, ":") || strings.Contains(field, "[") || strings.HasPrefix(field, "%")
+}
+
+// parseTag 解析 APP[PID]: 或 APP: 格式的 TAG，不符合时全部作为消息
+func parseTag(s string) (string, string, string) {
+	field, rest := nextField(s)
+	if field == "" {
+		return "", "", s
+	}
+
+	// 华为设备的 TAG 与消息之间没有空格，如 %%01SHELL/5/CMDRECORD(s)[0]:Recorded
+	if i := strings.Index(field, "]:"); i > 0 && i+2 < len(field) {
+		if rest != "" {
+			rest = field[i+2:] + " " + rest
+		} else {
+			rest = field[i+2:]
+		}
+		field = field[:i+2]
+	}
+
+	tag := field
+	hasColon := strings.HasSuffix(tag, ":")
+	tag = strings.TrimSuffix(tag, ":")
+	var pid string
+	if i := strings.IndexByte(tag, '['); i > 0 && strings.HasSuffix(tag, "]") {
+		pid = tag[i+1 : len(tag)-1]
+		tag = tag[:i]
+	} else if !hasColon {
+		return "", "", s
+	}
+	if tag == "" || strings.ContainsAny(tag, "[]=") {
+		return "", "", s
+	}
+	return tag, pid, rest
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// parseBSDTimestamp 解析 RFC3164 的时间及其变体，返回剩余内容
+func (p *Parser) parseBSDTimestamp(s string) (time.Time, string, bool) {
+	// Cisco 在时间未同步时以 * 或 . 开头
+	if s != "" && (s[0] == '*' || s[0] == '.') {
+		s = s[1:]
+	}
+
+	field, rest := nextField(s)
+	if len(field) >= 19 && isDigit(field[0]) && field[4] == '-' {
+		t, err := time.Parse(time.RFC3339Nano, strings.TrimSuffix(field, ":"))
+		if err != nil {
+			return time.Time{}, "", false
+		}
+		return t, rest, true
+	}
+
+	if len(s) < 3 {
+		return time.Time{}, "", false
+	}
+	month, ok := months[strings.ToLower(s[:3])]
+	if !ok || len(s) < 4 || s[3] != ' ' {
+		return time.Time{}, "", false
+	}
+	s = strings.TrimLeft(s[4:], " ")
+
+	var day, year int
+	field, s = nextField(s)
+	if day, ok = atoi(field, 1, 2); !ok || day < 1 || day > 31 {
+		return time.Time{}, "", false
+	}
+	field, rest = nextField(s)
+	if y, ok := atoi(field, 4, 4); ok {
+		year, s = y, rest
+	}
+
+	// hh:mm:ss[.frac][+hh:mm][:]
+	if len(s) < 8 || s[2] != ':' || s[5] != ':' {
+		return time.Time{}, "", false
+	}
+	hour, ok1 := atoi(s[0:2], 2, 2)
+	minute, ok2 := atoi(s[3:5], 2, 2)
+	second, ok3 := atoi(s[6:8], 2, 2)
+	if !ok1 || !ok2 || !ok3 || hour > 23 || minute > 59 || second > 60 {
+		return time.Time{}, "", false
+	}
+	s = s[8:]
+
+	var nsec int
+	if strings.HasPrefix(s, ".") {
+		i := 1
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+		frac := s[1:i]
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		nsec, _ = strconv.Atoi(frac + strings.Repeat("0", 9-len(frac)))
+		s = s[i:]
+	}
+
+	location := p.location
+	if len(s) >= 6 && (s[0] == '+' || s[0] == '-') && s[3] == ':' {
+		if offset, ok := parseOffset(s[:6]); ok {
+			location = time.FixedZone("", offset)
+			s = s[6:]
+		}
+	}
+	s = strings.TrimPrefix(s, ":")
+	s = strings.TrimLeft(s, " ")
+
+	if year == 0 {
+		field, rest = nextField(s)
+		if y, ok := atoi(field, 4, 4); ok {
+			year, s = y, rest
+		}
+	}
+
+	// Cisco 的时区以冒号结尾，如 "UTC:"
+	field, rest = nextField(s)
+	if strings.HasSuffix(field, ":") && len(field) > 1 && isZoneName(field[:len(field)-1]) {
+		if loc := loadZone(field[:len(field)-1]); loc != nil {
+			location = loc
+		}
+		s = rest
+	}
+
+	inferYear := year == 0
+	if inferYear {
+		year = p.now().In(location).Year()
+	}
+	t := time.Date(year, month, day, hour, minute, second, nsec, location)
+	// 跨年时，未带年份的时间可能属于上一年
+	if inferYear && t.After(p.now().Add(24*time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, s, true
+}
+
+// zones 时区名称 => *time.Location，无法加载的时区记录为 nil，避免每条消息都读取时区文件
+var zones sync.Map
+
+// loadZone 加载时区，无法加载时返回 nil
+func loadZone(name string) *time.Location {
+	if v, ok := zones.Load(name); ok {
+		return v.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = nil
+	}
+	zones.Store(name, loc)
+	return loc
+}
+
+// parseKeyValueTimestamp 解析 key=value 格式开头的 date=YYYY-MM-DD time=hh:mm:ss
+func (p *Parser) parseKeyValueTimestamp(s string) (time.Time, bool) {
+	date, rest := nextField(s)
+	clock, _ := nextField(rest)
+	if !strings.HasPrefix(clock, "time=") {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05",
+		strings.TrimPrefix(date, "date=")+" "+strings.TrimPrefix(clock, "time="), p.location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func isZoneName(s string) bool {
+	if len(s) < 3 || len(s) > 5 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseOffset(s string) (int, bool) {
+	hour, ok1 := atoi(s[1:3], 2, 2)
+	minute, ok2 := atoi(s[4:6], 2, 2)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	offset := hour*3600 + minute*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+// atoi 解析长度在 [min, max] 之间的纯数字
+func atoi(s string, min, max int) (int, bool) {
+	if len(s) < min || len(s) > max || !isAllDigits(s) {
+		return 0, false
+	}
+	v, err := strconv.Atoi(s)
+	return v, err == nil
+}
@@ -0,0 +1,206 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package syslogparser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+func newTestParser(t *testing.T, format string) *Parser {
+	p, err := NewParser(format, time.UTC)
+	assert.NoError(t, err)
+	p.now = func() time.Time { return testNow }
+	return p
+}
+
+func TestParseRFC5424(t *testing.T) {
+	p := newTestParser(t, FormatAuto)
+
+	m, err := p.Parse(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+		`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] ` +
+		"\xef\xbb\xbfAn application event log entry...")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatRFC5424, m.Format)
+	assert.Equal(t, 165, m.Priority)
+	assert.Equal(t, 20, m.Facility())
+	assert.Equal(t, 5, m.Severity())
+	assert.Equal(t, "local4", FacilityName(m.Facility()))
+	assert.Equal(t, "notice", SeverityName(m.Severity()))
+	assert.Equal(t, 1, m.Version)
+	assert.Equal(t, time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC), m.Timestamp.UTC())
+	assert.Equal(t, "mymachine.example.com", m.Hostname)
+	assert.Equal(t, "evntslog", m.AppName)
+	assert.Equal(t, "", m.ProcID)
+	assert.Equal(t, "ID47", m.MsgID)
+	assert.Equal(t, map[string]map[string]string{
+		"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+		"examplePriority@32473": {"class": "high"},
+	}, m.StructuredData)
+	assert.Equal(t, "An application event log entry...", m.Message)
+
+	// 参数值中的转义
+	m, err = p.Parse(`<13>1 - - - - - [id a="x\"y\]z\\w" b=""]`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{"id": {"a": `x"y]z\w`, "b": ""}}, m.StructuredData)
+	assert.Equal(t, "", m.Message)
+	assert.True(t, m.Timestamp.IsZero())
+
+	// 没有结构化数据时省略了 "-"
+	m, err = p.Parse(`<34>1 2003-10-11T22:14:15.003+08:00 host su 123 - 'su root' failed`)
+	assert.NoError(t, err)
+	assert.Equal(t, "123", m.ProcID)
+	assert.Equal(t, "'su root' failed", m.Message)
+
+	for _, line := range []string{
+		`<13>1 2003-13-11T22:14:15Z host app - - - msg`,
+		`<13>1 - host app - - [id a="unterminated]`,
+		`<13>1 - host app - - [id a=unquoted]`,
+		`<192>1 - host app - - - msg`,
+		`<13`,
+	} {
+		_, err = p.Parse(line)
+		assert.Error(t, err, line)
+	}
+
+	_, err = newTestParser(t, FormatRFC5424).Parse(`<13>Mar  4 05:06:07 host app: msg`)
+	assert.Error(t, err)
+}
+
+func TestParseRFC3164(t *testing.T) {
+	local := time.FixedZone("", 8*3600)
+	cases := []struct {
+		name string
+		line string
+		want Message
+	}{
+		{
+			name: "standard",
+			line: `<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8`,
+			want: Message{Priority: 34, Timestamp: time.Date(2020, 10, 11, 22, 14, 15, 0, time.UTC),
+				Hostname: "mymachine", AppName: "su", ProcID: "123", Message: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			name: "space padded day",
+			line: `<13>Mar  4 05:06:07 host app: hello world`,
+			want: Message{Priority: 13, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				Hostname: "host", AppName: "app", Message: "hello world"},
+		},
+		{
+			name: "no hostname",
+			line: `<13>Mar  4 05:06:07 sshd[99]: Accepted publickey`,
+			want: Message{Priority: 13, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				AppName: "sshd", ProcID: "99", Message: "Accepted publickey"},
+		},
+		{
+			name: "cisco",
+			line: `<189>123: *Mar  1 00:01:02.345 UTC: %SYS-5-CONFIG_I: Configured from console by vty0`,
+			want: Message{Priority: 189, Sequence: "123", Timestamp: time.Date(2021, 3, 1, 0, 1, 2, 345000000, time.UTC),
+				AppName: "%SYS-5-CONFIG_I", Message: "Configured from console by vty0"},
+		},
+		{
+			name: "cisco with year",
+			line: `<187>45: Mar  1 2021 00:01:02: %LINK-3-UPDOWN: Interface Gi0/1, changed state to down`,
+			want: Message{Priority: 187, Sequence: "45", Timestamp: time.Date(2021, 3, 1, 0, 1, 2, 0, time.UTC),
+				AppName: "%LINK-3-UPDOWN", Message: "Interface Gi0/1, changed state to down"},
+		},
+		{
+			name: "huawei",
+			line: `<187>Mar 4 2021 05:06:07+08:00 SW01 %%01SHELL/5/CMDRECORD(s)[0]:Recorded command information.`,
+			want: Message{Priority: 187, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, local),
+				Hostname: "SW01", AppName: "%%01SHELL/5/CMDRECORD(s)", ProcID: "0", Message: "Recorded command information."},
+		},
+		{
+			name: "year after time",
+			line: `<14>Mar  4 05:06:07 2019 fw01 kernel: drop`,
+			want: Message{Priority: 14, Timestamp: time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC),
+				Hostname: "fw01", AppName: "kernel", Message: "drop"},
+		},
+		{
+			name: "rfc3339 timestamp",
+			line: `<30>2021-03-04T05:06:07.123+08:00 web01 nginx[1]: GET /`,
+			want: Message{Priority: 30, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 123000000, local),
+				Hostname: "web01", AppName: "nginx", ProcID: "1", Message: "GET /"},
+		},
+		{
+			name: "fortinet key value",
+			line: `<189>date=2021-03-04 time=05:06:07 devname=FG100 type=traffic`,
+			want: Message{Priority: 189, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				Message: "date=2021-03-04 time=05:06:07 devname=FG100 type=traffic"},
+		},
+		{
+			name: "no tag",
+			line: `<13>Mar  4 05:06:07 host just a message`,
+			want: Message{Priority: 13, Timestamp: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+				Hostname: "host", Message: "just a message"},
+		},
+	}
+
+	p := newTestParser(t, FormatAuto)
+	for _, c := range cases {
+		m, err := p.Parse(c.line)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		c.want.Format = FormatRFC3164
+		assert.True(t, c.want.Timestamp.Equal(m.Timestamp), "%s: %s", c.name, m.Timestamp)
+		c.want.Timestamp = m.Timestamp
+		assert.Equal(t, c.want, *m, c.name)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	p := newTestParser(t, FormatRFC3164)
+	for _, line := range []string{"", "<abc>msg", "<1234>msg", "\r\n"} {
+		_, err := p.Parse(line)
+		assert.Error(t, err, line)
+	}
+
+	// 缺少 PRI 或时间，以及时间格式错误
+	for line, want := range map[string]error{
+		`Mar  4 05:06:07 host app: hello`:             errMissingPri,
+		`<13>host app: hello`:                         errMissingTime,
+		`<13>`:                                        errMissingTime,
+		`<13>Mar 32 05:06:07 host app: hello`:         errInvalidTime,
+		`<13>Mar  4 25:06:07 host app: hello`:         errInvalidTime,
+		`<30>2021-13-04T05:06:07Z web01 nginx: GET /`: errInvalidTime,
+		`<189>date=2021-03-04 devname=FG100`:          errInvalidTime,
+	} {
+		_, err := newTestParser(t, FormatAuto).Parse(line)
+		assert.Equal(t, want, err, line)
+	}
+
+	// 时区只加载一次
+	m, err := p.Parse(`<189>1: *Mar  1 00:01:02 UTC: %SYS-5-CONFIG_I: Configured`)
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC", m.Timestamp.Location().String())
+	_, ok := zones.Load("UTC")
+	assert.True(t, ok)
+
+	_, err = NewParser("unknown", nil)
+	assert.Error(t, err)
+}
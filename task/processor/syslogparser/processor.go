@@ -0,0 +1,150 @@
+// Tencent is pleased to support the open source community by making bkunifylogbeat 蓝鲸日志采集器 available.
+//
+// Copyright (C) 2021 THL A29 Limited, a Tencent company.  All rights reserved.
+//
+// bkunifylogbeat 蓝鲸日志采集器 is licensed under the MIT License.
+//
+// License for bkunifylogbeat 蓝鲸日志采集器:
+// --------------------------------------------------------------------
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated
+// documentation files (the "Software"), to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software,
+// and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT
+// LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN
+// NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package syslogparser
+
+import (
+	"fmt"
+
+	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+const processorName = "syslog"
+
+var (
+	syslogParsed = bkmonitoring.NewInt("syslog_parsed")       // 解析成功的消息数
+	syslogFailed = bkmonitoring.NewInt("syslog_parse_failed") // 解析失败而原样输出的消息数
+)
+
+func init() {
+	processors.RegisterPlugin(processorName, newProcessor)
+}
+
+// syslogProcessor 解析事件中的 syslog 消息，将 facility、severity、app_name 等写入事件字段
+// 解析失败的事件原样输出，并标记 parse_failed 以及失败原因
+type syslogProcessor struct {
+	config config
+	parser *Parser
+}
+
+func newProcessor(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %s processor configuration: %v", processorName, err)
+	}
+	loc, err := config.location()
+	if err != nil {
+		return nil, err
+	}
+	parser, err := NewParser(config.Format, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogProcessor{config: config, parser: parser}, nil
+}
+
+// Run 处理事件，字段不存在或不是字符串时不做处理
+func (p *syslogProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	value, err := event.GetValue(p.config.Field)
+	if err != nil {
+		return event, nil
+	}
+	line, ok := value.(string)
+	if !ok {
+		return event, nil
+	}
+
+	m, err := p.parser.Parse(line)
+	if err != nil {
+		syslogFailed.Add(1)
+		p.put(event, common.MapStr{
+			"parse_failed": true,
+			"error":        err.Error(),
+		})
+		return event, nil
+	}
+
+	syslogParsed.Add(1)
+	p.put(event, ToFields(m))
+	if p.config.ReplaceMessage {
+		_, _ = event.PutValue(p.config.Field, m.Message)
+	}
+	return event, nil
+}
+
+func (p *syslogProcessor) put(event *beat.Event, fields common.MapStr) {
+	if p.config.Target == "" {
+		event.Fields.DeepUpdate(fields)
+		return
+	}
+	_, _ = event.PutValue(p.config.Target, fields)
+}
+
+func (p *syslogProcessor) String() string {
+	return fmt.Sprintf("%s=[field=%s, target=%s, format=%s]", processorName, p.config.Field, p.config.Target, p.parser.format)
+}
+
+// ToFields 转换为事件字段，不存在的字段不输出
+func ToFields(m *Message) common.MapStr {
+	fields := common.MapStr{
+		"format":        m.Format,
+		"priority":      m.Priority,
+		"facility":      m.Facility(),
+		"facility_name": FacilityName(m.Facility()),
+		"severity":      m.Severity(),
+		"severity_name": SeverityName(m.Severity()),
+		"message":       m.Message,
+	}
+	optional := map[string]string{
+		"sequence": m.Sequence,
+		"hostname": m.Hostname,
+		"app_name": m.AppName,
+		"proc_id":  m.ProcID,
+		"msg_id":   m.MsgID,
+	}
+	for k, v := range optional {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if m.Version > 0 {
+		fields["version"] = m.Version
+	}
+	if !m.Timestamp.IsZero() {
+		fields["timestamp"] = m.Timestamp
+	}
+	if len(m.StructuredData) > 0 {
+		sd := make(common.MapStr, len(m.StructuredData))
+		for id, params := range m.StructuredData {
+			values := make(common.MapStr, len(params))
+			for k, v := range params {
+				values[k] = v
+			}
+			sd[id] = values
+		}
+		fields["structured_data"] = sd
+	}
+	return fields
+}
@@ -24,12 +24,15 @@ package sender
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
 	bkmonitoring "github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/monitoring"
+	"github.com/elastic/beats/filebeat/input/file"
 	"github.com/elastic/beats/filebeat/util"
 
 	"github.com/TencentBlueKing/bkunifylogbeat/config"
@@ -37,6 +40,9 @@ import (
 	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
 )
 
+// routeKeySep 打包缓存中文件与路由 dataid 的分隔符
+const routeKeySep = "#route-"
+
 var (
 	senderReceived  = bkmonitoring.NewInt("sender_received")   // 兼容指标
 	senderState     = bkmonitoring.NewInt("sender_state")      // 兼容指标
@@ -166,11 +172,13 @@ func (send *Sender) Run() {
 			return
 
 		case <-senderTicker.C:
-			// clear cache
-			for _, buffer := range send.cache {
-				if len(buffer) > 0 {
-					send.send(buffer)
-				}
+			// clear cache，同一文件路由到各 dataid 的缓存一起发送
+			sources := map[string]bool{}
+			for key := range send.cache {
+				sources[sourceOfKey(key)] = true
+			}
+			for source := range sources {
+				send.flushSource(source)
 			}
 			send.cache = make(map[string][]*util.Data)
 
@@ -202,32 +210,22 @@ func (send *Sender) String() string {
 }
 
 func (send *Sender) cacheSend(event *util.Data) error {
-	source := event.GetState().Source
+	source := cacheKey(event)
 
 	if !send.sendConfig.CanPackage {
 		send.send([]*util.Data{event})
 		return nil
 	}
 
-	buffer, exist := send.cache[source]
-	// 特殊事件直接发送
+	// 特殊事件直接发送，同一文件的缓存数据在其之前发送，保证采集进度在数据之后更新
 	if event.Event.Fields == nil {
-		if exist {
-			buffer = append(buffer, event)
-			send.send(buffer)
-			send.cache[source] = []*util.Data{}
-			return nil
-		}
-		send.send([]*util.Data{event})
+		send.cache[source] = append(send.cache[source], event)
+		send.flushSource(event.GetState().Source)
 		return nil
 	}
 
 	//正常事件处理
-	if exist {
-		send.cache[source] = append(buffer, event)
-	} else {
-		send.cache[source] = []*util.Data{event}
-	}
+	send.cache[source] = append(send.cache[source], event)
 
 	totalCount := 0
 	for _, evt := range send.cache[source] {
@@ -235,23 +233,95 @@ func (send *Sender) cacheSend(event *util.Data) error {
 	}
 
 	// if msg count reach max count, clear cache
+	// 打包会更新采集进度，因此同一文件路由到其他 dataid 的缓存数据一起发送
 	if totalCount >= send.sendConfig.PackageCount {
-		send.send(send.cache[source])
-		// clear cache
-		send.cache[source] = []*util.Data{}
+		send.flushSource(event.GetState().Source)
 	}
 	return nil
 }
 
+// cacheKey 按文件打包，路由到不同 dataid 的数据分别打包
+func cacheKey(event *util.Data) string {
+	source := event.GetState().Source
+	if dataID := base.GetRouteDataID(&event.Event); dataID > 0 {
+		return fmt.Sprintf("%s%s%d", source, routeKeySep, dataID)
+	}
+	return source
+}
+
+// sourceOfKey 打包缓存对应的文件
+func sourceOfKey(key string) string {
+	if i := strings.Index(key, routeKeySep); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// flushSource 发送同一文件的所有缓存数据，包括路由到各 dataid 的数据
+// 各打包按采集进度从小到大发送，文件的采集进度只在最后一个打包中更新，避免其他打包未发送时采集进度已确认
+func (send *Sender) flushSource(source string) {
+	prefix := source + routeKeySep
+	keys := make([]string, 0, 1)
+	for key, buffer := range send.cache {
+		if len(buffer) > 0 && (key == source || strings.HasPrefix(key, prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := send.cache[keys[i]], send.cache[keys[j]]
+		if offsetA, offsetB := packageState(a).Offset, packageState(b).Offset; offsetA != offsetB {
+			return offsetA < offsetB
+		}
+		// 采集进度相同时，以采集进度事件结尾的打包最后发送
+		if stateA, stateB := isStateOnly(a), isStateOnly(b); stateA != stateB {
+			return stateB
+		}
+		return keys[i] < keys[j]
+	})
+	for i, key := range keys {
+		buffer := send.cache[key]
+		if i < len(keys)-1 && base.IsFileState(packageState(buffer)) {
+			send.sendPackage(buffer, false)
+		} else {
+			send.send(buffer)
+		}
+		send.cache[key] = []*util.Data{}
+	}
+}
+
+// packageState 打包的采集进度，即最后一个事件的采集进度
+func packageState(events []*util.Data) file.State {
+	return events[len(events)-1].GetState()
+}
+
+// isStateOnly 打包是否以采集进度事件结尾
+func isStateOnly(events []*util.Data) bool {
+	event := events[len(events)-1].Event
+	return event.Fields == nil && !event.HasTexts()
+}
+
 // send: 调用beat.SendEvent发送打包后的采集事件
 func (send *Sender) send(events []*util.Data) {
+	send.sendPackage(events, true)
+}
+
+// sendPackage 发送打包后的采集事件，withState 为 false 时不回写采集进度
+func (send *Sender) sendPackage(events []*util.Data, withState bool) {
 	var packageEvent beat.Event
 	if len(events) == 0 {
 		return
 	}
 
-	lastState := events[len(events)-1].GetState()
+	lastState := packageState(events)
 	formattedEvent := send.formatter.Format(events)
+	// 同一个打包中的事件路由到相同的 dataid
+	routeDataID := base.GetRouteDataID(&events[0].Event)
+
+	// 无采集进度的事件不需要回写 Registrar
+	var private interface{} = lastState
+	if !withState || base.IsStatelessState(lastState) {
+		private = nil
+	}
 
 	// send data
 	for taskID, out := range send.GetOuts() {
@@ -265,7 +335,7 @@ func (send *Sender) send(events []*util.Data) {
 		if formattedEvent == nil {
 			packageEvent = beat.Event{
 				Fields:  nil,
-				Private: lastState,
+				Private: private,
 			}
 
 			senderState.Add(1)
@@ -275,11 +345,14 @@ func (send *Sender) send(events []*util.Data) {
 		} else {
 			data := formattedEvent.Clone()
 			data["dataid"] = taskConfig.DataID
+			if routeDataID > 0 {
+				data["dataid"] = routeDataID
+			}
 
 			//处理状态事件
 			packageEvent = beat.Event{
 				Fields:  data,
-				Private: lastState,
+				Private: private,
 			}
 			// 发送到pipeline的数量
 			senderSendTotal.Add(1)
@@ -28,12 +28,14 @@ import (
 
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/beat"
 	"github.com/TencentBlueKing/bkmonitor-datalink/pkg/libgse/logp"
+	"github.com/elastic/beats/filebeat/input/file"
 	"github.com/elastic/beats/filebeat/util"
 	"github.com/elastic/beats/libbeat/common"
 	libbeatlogp "github.com/elastic/beats/libbeat/logp"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/TencentBlueKing/bkunifylogbeat/config"
+	"github.com/TencentBlueKing/bkunifylogbeat/task/base"
 	"github.com/TencentBlueKing/bkunifylogbeat/task/formatter"
 	"github.com/TencentBlueKing/bkunifylogbeat/tests"
 
@@ -192,3 +194,55 @@ func TestSend(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 	assert.Equal(t, sendNums, 4)
 }
+
+func mockRoutedEvent(source string, dataID int) *util.Data {
+	data := tests.MockLogEvent(source, fileText)
+	base.SetRouteDataID(&data.Event, dataID)
+	return data
+}
+
+// TestSendRouted 测试路由到不同 dataid 的数据分别打包
+func TestSendRouted(t *testing.T) {
+	sender, err := mockSender(true, packageCount)
+	if err != nil {
+		panic(err)
+	}
+
+	sendNums = 0
+	sender.In <- mockRoutedEvent(fileSource1, 1001)
+	sender.In <- mockRoutedEvent(fileSource1, 1002)
+	sender.In <- mockRoutedEvent(fileSource1, 1001)
+	time.Sleep(1200 * time.Millisecond)
+	assert.Equal(t, 2, sendNums)
+
+	// 采集进度事件之前先发送同一文件路由的数据
+	sender, err = mockSender(true, packageCount)
+	if err != nil {
+		panic(err)
+	}
+	sendNums = 0
+	sender.In <- mockRoutedEvent(fileSource1, 1001)
+	sender.In <- tests.MockLogEvent(fileSource1, fileTextNull)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 2, sendNums)
+
+	// 打包达到数量时同一文件路由到其他 dataid 的数据先发送，采集进度只在最后一个打包中更新
+	sender, err = mockSender(true, 2)
+	if err != nil {
+		panic(err)
+	}
+	sendNums = 0
+	for i, dataID := range []int{1001, 1002, 1002} {
+		data := mockRoutedEvent(fileSource1, dataID)
+		data.SetState(file.State{Source: fileSource1, Offset: int64(i + 1)})
+		sender.In <- data
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 2, sendNums)
+	assert.Equal(t, 1002, event.Fields["dataid"])
+	assert.Equal(t, int64(3), event.Private.(file.State).Offset)
+
+	assert.Equal(t, fileSource1, cacheKey(tests.MockLogEvent(fileSource1, fileText)))
+	assert.Equal(t, fileSource1, sourceOfKey(cacheKey(mockRoutedEvent(fileSource1, 1001))))
+	assert.NotEqual(t, cacheKey(mockRoutedEvent(fileSource1, 1001)), cacheKey(mockRoutedEvent(fileSource1, 1002)))
+}